@@ -0,0 +1,51 @@
+// dlqreplay 把消费者组死信队列里面的消息发到这个组的第一级重试 topic，修复了消费者的问题之后使用
+//
+//	go run ./cmd/dlqreplay -addr 192.168.1.3:9094 -group interactive
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/IBM/sarama"
+	"github.com/Tuanzi-bug/tuan-book/pkg/saramax"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+)
+
+func main() {
+	addr := flag.String("addr", "192.168.1.3:9094", "kafka 地址，多个用逗号分隔")
+	group := flag.String("group", "", "消费者组，重放这个组的死信队列")
+	idle := flag.Duration("idle", time.Second*10, "多久没有新消息就结束")
+	flag.Parse()
+	if *group == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	cfg := sarama.NewConfig()
+	cfg.Producer.Return.Successes = true
+	// 第一次重放从最早的消息开始
+	cfg.Consumer.Offsets.Initial = sarama.OffsetOldest
+	client, err := sarama.NewClient(strings.Split(*addr, ","), cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "连接 kafka 失败:", err)
+		os.Exit(1)
+	}
+	defer client.Close()
+	producer, err := sarama.NewSyncProducerFromClient(client)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "创建生产者失败:", err)
+		os.Exit(1)
+	}
+	defer producer.Close()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	cnt, err := saramax.ReplayDLQ(ctx, client, producer, *group, *idle)
+	fmt.Printf("重放了 %d 条消息\n", cnt)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "重放失败:", err)
+		os.Exit(1)
+	}
+}
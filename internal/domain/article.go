@@ -8,8 +8,11 @@ type Article struct {
 	Content string
 	Author  Author
 	Status  ArticleStatus
-	Ctime   time.Time
-	Utime   time.Time
+	// PublishAt 定时发表的时间，零值表示没有定时
+	PublishAt time.Time
+	Tags      []string
+	Ctime     time.Time
+	Utime     time.Time
 }
 
 // Abstract 返回文章的摘要，取前128字节返回
@@ -42,4 +45,18 @@ const (
 	ArticleStatusPublished
 	// ArticleStatusPrivate 仅自己可见
 	ArticleStatusPrivate
+	// ArticleStatusScheduled 定时发表，到点之后才会同步到线上库
+	ArticleStatusScheduled
 )
+
+// ArticleRevision 文章的一个历史版本
+type ArticleRevision struct {
+	Id          int64
+	ArticleId   int64
+	Author      Author
+	Title       string
+	Content     string
+	ContentHash string
+	Status      ArticleStatus
+	Ctime       time.Time
+}
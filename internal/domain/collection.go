@@ -0,0 +1,23 @@
+package domain
+
+import "time"
+
+// Collection 收藏夹
+type Collection struct {
+	Id   int64
+	Uid  int64
+	Name string
+	// 收藏夹里面有多少内容
+	ItemCnt int64
+	Ctime   time.Time
+	Utime   time.Time
+}
+
+// CollectionItem 收藏夹里面的一条内容，Title 是被收藏文章的标题
+type CollectionItem struct {
+	Biz   string
+	BizId int64
+	Cid   int64
+	Title string
+	Ctime time.Time
+}
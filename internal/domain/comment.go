@@ -0,0 +1,22 @@
+package domain
+
+import "time"
+
+// Comment 评论。回复只有两层：根评论和挂在根评论下面的回复
+type Comment struct {
+	Id int64
+	// 评论者
+	Uid   int64
+	Biz   string
+	BizId int64
+	// 根评论的 id，根评论自己是 0
+	RootId int64
+	// 直接回复的评论 id，根评论是 0
+	ParentId int64
+	Content  string
+	// 只有根评论有，预先加载的前几条回复以及回复总数
+	Replies  []Comment
+	ReplyCnt int64
+	Ctime    time.Time
+	Utime    time.Time
+}
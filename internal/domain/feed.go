@@ -0,0 +1,21 @@
+package domain
+
+import "time"
+
+// FeedItem 关注的作者发表的一篇文章，Ctime 是发表时间
+type FeedItem struct {
+	Aid      int64
+	AuthorId int64
+	Ctime    time.Time
+}
+
+// FeedCursor feed 的游标，上一页最后一条的发表时间和文章 id。
+// 同一毫秒发表的文章按照 id 区分，零值表示第一页
+type FeedCursor struct {
+	Ctime time.Time
+	Aid   int64
+}
+
+func (c FeedCursor) IsZero() bool {
+	return c.Ctime.IsZero() && c.Aid == 0
+}
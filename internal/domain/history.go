@@ -0,0 +1,10 @@
+package domain
+
+import "time"
+
+// ReadRecord 阅读记录，同一篇文章只保留最近一次阅读的时间
+type ReadRecord struct {
+	Uid   int64
+	Aid   int64
+	Ctime time.Time
+}
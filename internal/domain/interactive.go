@@ -1,10 +1,43 @@
 package domain
 
+import "time"
+
 type Interactive struct {
 	BizId      int64
 	ReadCnt    int64
 	LikeCnt    int64
 	CollectCnt int64
-	Liked      bool
-	Collected  bool
+	// ReaderCnt 每日独立读者数的累计，同一个人一天之内重复阅读只算一次
+	ReaderCnt int64
+	Liked     bool
+	Collected bool
+}
+
+// LikeRecord 用户点赞过的一条内容，Utime 是点赞时间
+type LikeRecord struct {
+	Biz   string
+	BizId int64
+	Uid   int64
+	Utime time.Time
+}
+
+// InteractiveReconcile 一批交互数据的对账结果
+type InteractiveReconcile struct {
+	// 这一批最后一行的 id，下一批从这里继续
+	LastId  int64
+	Scanned int
+	Drifts  []InteractiveDrift
+}
+
+// InteractiveDrift 计数和明细对不上的一项
+type InteractiveDrift struct {
+	Biz   string
+	BizId int64
+	// db 或者 cache
+	Source string
+	// like_cnt 或者 collect_cnt
+	Field string
+	// Expected 是按照明细表统计出来的，Actual 是对账之前的值
+	Expected int64
+	Actual   int64
 }
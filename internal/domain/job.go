@@ -5,6 +5,24 @@ import (
 	"time"
 )
 
+// JobStatus 和 dao 里面的状态保持一致
+type JobStatus uint8
+
+const (
+	// JobStatusWaiting 等待调度
+	JobStatusWaiting JobStatus = iota
+	// JobStatusRunning 已经被某个节点抢占了
+	JobStatusRunning
+	// JobStatusPaused 不再调度，恢复之后重新计算下一次执行的时间
+	JobStatusPaused
+	// JobStatusFailed 连续失败的次数达到上限，不再调度，恢复的方法和暂停一样
+	JobStatusFailed
+)
+
+// jobParser 支持秒，也支持 @every 这样的描述
+var jobParser = cron.NewParser(cron.Second | cron.Minute | cron.Hour |
+	cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
 type Job struct {
 	Id   int64
 	Name string
@@ -14,12 +32,61 @@ type Job struct {
 	Executor   string
 	Cfg        string
 	CancelFunc func()
+
+	// MaxAttempts 连续失败多少次之后不再调度，0 表示使用默认值
+	MaxAttempts int
+	// Backoff 失败之后第一次重试的间隔，之后每次翻倍，0 表示使用默认值
+	Backoff time.Duration
+	// Failures 连续失败的次数，成功之后清零
+	Failures int
+	// Owner 抢占这个任务的节点
+	Owner string
+	// ReclaimedFrom 不为空说明是从这个节点回收的，那个节点很久没有续约了
+	ReclaimedFrom string
+
+	// 下面的字段只有查询任务列表的时候才有
+	Status JobStatus
+	// NextExecTime 数据库里面记录的下一次执行的时间
+	NextExecTime time.Time
+	Ctime        time.Time
+	Utime        time.Time
+}
+
+// ParseJobExpression 校验 cron 表达式，和 NextTime 使用同一个解析器
+func ParseJobExpression(expression string) (cron.Schedule, error) {
+	return jobParser.Parse(expression)
 }
 
 // NextTime returns the next time the job will be executed
+// 表达式不合法的时候返回零值
 func (j Job) NextTime() time.Time {
-	c := cron.NewParser(cron.Second | cron.Minute | cron.Hour |
-		cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
-	s, _ := c.Parse(j.Expression)
+	s, err := ParseJobExpression(j.Expression)
+	if err != nil {
+		return time.Time{}
+	}
 	return s.Next(time.Now())
 }
+
+type JobRunStatus uint8
+
+const (
+	JobRunStatusUnknown JobRunStatus = iota
+	JobRunStatusRunning
+	JobRunStatusSuccess
+	JobRunStatusFailed
+)
+
+// JobRun 任务的一次执行记录
+type JobRun struct {
+	Id  int64
+	Jid int64
+	// Node 在哪个节点上执行的
+	Node   string
+	Status JobRunStatus
+	// Attempt 连续第几次执行，成功之后从 1 重新开始
+	Attempt   int
+	Err       string
+	StartTime time.Time
+	// EndTime 还在执行的时候是零值
+	EndTime time.Time
+}
@@ -0,0 +1,15 @@
+package domain
+
+import "time"
+
+// OutboxMessage 等待发送到消息队列的消息
+type OutboxMessage struct {
+	Id    int64
+	Topic string
+	// Key 同一个 key 的消息按照 Id 顺序发送
+	Key     string
+	Payload []byte
+	Retries int
+	// NextTime 发送失败之后，下一次重试的时间
+	NextTime time.Time
+}
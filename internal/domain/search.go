@@ -0,0 +1,10 @@
+package domain
+
+// ArticleSearchHit 搜索命中的一篇文章，高亮的部分已经做过 HTML 转义
+type ArticleSearchHit struct {
+	// 不包含内容
+	Article          Article
+	Score            float64
+	TitleHighlight   string
+	ContentHighlight string
+}
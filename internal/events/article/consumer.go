@@ -11,26 +11,39 @@ import (
 )
 
 type InteractiveReadEventConsumer struct {
-	client sarama.Client
+	broker saramax.Broker
 	repo   repository.InteractiveRepository
+	// 攒批的参数，批次越大同一篇文章合并得越多
+	batch saramax.BatchConfig
+	// 写数据库失败的批次转发到重试 topic，阅读数不会丢
+	retrier *saramax.Retrier
+	// 阅读数是累加的，重复投递的事件不能再加一次
+	dedup saramax.Deduplicator
 }
 
-func NewInteractiveReadEventConsumer(client sarama.Client, repo repository.InteractiveRepository) *InteractiveReadEventConsumer {
+func NewInteractiveReadEventConsumer(broker saramax.Broker, repo repository.InteractiveRepository,
+	batch saramax.BatchConfig, retrier *saramax.Retrier, dedup saramax.Deduplicator) *InteractiveReadEventConsumer {
 	return &InteractiveReadEventConsumer{
-		client: client,
-		repo:   repo,
+		broker:  broker,
+		repo:    repo,
+		batch:   batch,
+		retrier: retrier,
+		dedup:   dedup,
 	}
 }
 
 // Start 启动消费者
 func (r *InteractiveReadEventConsumer) Start() error {
-	cg, err := sarama.NewConsumerGroupFromClient("interactive", r.client)
+	cg, err := r.broker.ConsumerGroup("interactive")
 	if err != nil {
 		return err
 	}
+	topics := append([]string{TopicReadEvent}, r.retrier.Topics()...)
 	go func() {
 		for {
-			err := cg.Consume(context.Background(), []string{TopicReadEvent}, saramax.NewBatchHandler[ReadEvent](r.BatchConsume))
+			err := cg.Consume(context.Background(), topics,
+				saramax.NewBatchHandler[ReadEvent](r.BatchConsume).WithConfig(r.batch).
+					WithName("interactive").WithRetrier(r.retrier).WithDeduplicator(r.dedup))
 			if err != nil {
 				// 记录日志，不影响主流程
 				log.Println("consume read event failed", zap.Error(err))
@@ -1 +1,88 @@
 package article
+
+import (
+	"context"
+	"github.com/IBM/sarama"
+	repomocks "github.com/Tuanzi-bug/tuan-book/internal/repository/mocks"
+	"github.com/Tuanzi-bug/tuan-book/pkg/saramax"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestInteractiveReadEventConsumer 不需要 kafka，生产者和消费者都用内存 broker
+func TestInteractiveReadEventConsumer(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	repo := repomocks.NewMockInteractiveRepository(ctrl)
+	var (
+		mu  sync.Mutex
+		ids []int64
+	)
+	done := make(chan struct{})
+	repo.EXPECT().BatchIncrReadCnt(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, bizs []string, bizIds []int64) error {
+			mu.Lock()
+			defer mu.Unlock()
+			for _, biz := range bizs {
+				assert.Equal(t, "article", biz)
+			}
+			ids = append(ids, bizIds...)
+			if len(ids) == 5 {
+				close(done)
+			}
+			return nil
+		}).AnyTimes()
+
+	broker := saramax.NewMemoryBroker(0, 0)
+	sp, err := broker.SyncProducer()
+	require.NoError(t, err)
+	producer := NewSaramaSyncProducer(sp)
+	// 消费者启动之前发送的消息也能收到
+	require.NoError(t, producer.ProduceReadEvent(context.Background(), ReadEvent{Aid: 1, Uid: 123}))
+	require.NoError(t, producer.ProduceReadEvent(context.Background(), ReadEvent{Aid: 2, Uid: 123}))
+
+	c := NewInteractiveReadEventConsumer(broker, repo,
+		saramax.BatchConfig{BatchSize: 10, Linger: time.Millisecond * 10}, nil, nil)
+	require.NoError(t, c.Start())
+	require.NoError(t, producer.ProduceReadEvent(context.Background(), ReadEvent{Aid: 1, Uid: 124}))
+	require.NoError(t, producer.ProduceReadEvent(context.Background(), ReadEvent{Aid: 3, Uid: 124}))
+	require.NoError(t, producer.ProduceReadEvent(context.Background(), ReadEvent{Aid: 1, Uid: 125}))
+
+	select {
+	case <-done:
+	case <-time.After(time.Second * 5):
+		t.Fatal("没有消费完阅读事件")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	assert.ElementsMatch(t, []int64{1, 2, 1, 3, 1}, ids)
+}
+
+func TestRankingEventConsumer_BatchConsume(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	repo := repomocks.NewMockRealTimeRankingRepository(ctrl)
+	boards := []string{"daily", "all"}
+	// 撤回的文章不再加分，并且从所有榜单里面移除
+	repo.EXPECT().IncrScores(gomock.Any(), boards, map[int64]float64{1: 6}).Return(nil)
+	repo.EXPECT().Remove(gomock.Any(), boards, []int64{2}).Return(nil)
+
+	c := NewRankingEventConsumer(nil, repo, boards, RankingWeights{Read: 1, Like: 5, Collect: 10}, nil)
+	msgs := []*sarama.ConsumerMessage{
+		{Topic: TopicReadEvent},
+		{Topic: TopicLikeEvent},
+		{Topic: TopicCollectEvent},
+		{Topic: TopicWithdrawnEvent},
+	}
+	evts := []rankingEvent{
+		{Aid: 1},
+		{Aid: 1, Liked: true},
+		{Aid: 2},
+		{Aid: 2},
+	}
+	require.NoError(t, c.BatchConsume(msgs, evts))
+}
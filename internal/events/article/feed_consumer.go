@@ -0,0 +1,61 @@
+package article
+
+import (
+	"context"
+	"github.com/IBM/sarama"
+	"github.com/Tuanzi-bug/tuan-book/pkg/log"
+	"github.com/Tuanzi-bug/tuan-book/pkg/saramax"
+	"go.uber.org/zap"
+	"time"
+)
+
+// FeedPusher 由 service.FeedService 实现，这里单独定义是为了避免循环引用
+type FeedPusher interface {
+	PushArticle(ctx context.Context, aid int64) error
+}
+
+// FeedEventConsumer 消费发表事件，把文章推到粉丝的收件箱
+type FeedEventConsumer struct {
+	broker saramax.Broker
+	pusher FeedPusher
+	// 推送失败的文章转发到重试 topic，不会漏推
+	retrier *saramax.Retrier
+	// 重复投递的发表事件不再推一次
+	dedup saramax.Deduplicator
+}
+
+func NewFeedEventConsumer(broker saramax.Broker, pusher FeedPusher, retrier *saramax.Retrier,
+	dedup saramax.Deduplicator) *FeedEventConsumer {
+	return &FeedEventConsumer{
+		broker:  broker,
+		pusher:  pusher,
+		retrier: retrier,
+		dedup:   dedup,
+	}
+}
+
+func (f *FeedEventConsumer) Start() error {
+	cg, err := f.broker.ConsumerGroup("feed")
+	if err != nil {
+		return err
+	}
+	topics := append([]string{TopicPublishedEvent}, f.retrier.Topics()...)
+	go func() {
+		for {
+			err := cg.Consume(context.Background(), topics,
+				saramax.NewHandler[PublishedEvent](f.Consume).WithRetrier(f.retrier).
+					WithDeduplicator(f.dedup))
+			if err != nil {
+				log.Error("consume article published event failed", zap.Error(err))
+			}
+		}
+	}()
+	return nil
+}
+
+func (f *FeedEventConsumer) Consume(msg *sarama.ConsumerMessage, evt PublishedEvent) error {
+	// 粉丝多的时候要写很多批收件箱，超时时间给得宽松一些
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+	return f.pusher.PushArticle(ctx, evt.Aid)
+}
@@ -0,0 +1,61 @@
+package article
+
+import (
+	"context"
+	"github.com/IBM/sarama"
+	"github.com/Tuanzi-bug/tuan-book/internal/domain"
+	"github.com/Tuanzi-bug/tuan-book/pkg/log"
+	"github.com/Tuanzi-bug/tuan-book/pkg/saramax"
+	"go.uber.org/zap"
+	"time"
+)
+
+// ReadHistoryRecorder 由 service.ReadHistoryService 实现，这里单独定义是为了避免循环引用
+type ReadHistoryRecorder interface {
+	Record(ctx context.Context, records []domain.ReadRecord) error
+}
+
+// ReadHistoryConsumer 消费阅读事件，记录用户的阅读历史
+type ReadHistoryConsumer struct {
+	broker   saramax.Broker
+	recorder ReadHistoryRecorder
+}
+
+func NewReadHistoryConsumer(broker saramax.Broker, recorder ReadHistoryRecorder) *ReadHistoryConsumer {
+	return &ReadHistoryConsumer{
+		broker:   broker,
+		recorder: recorder,
+	}
+}
+
+func (r *ReadHistoryConsumer) Start() error {
+	cg, err := r.broker.ConsumerGroup("read_history")
+	if err != nil {
+		return err
+	}
+	go func() {
+		for {
+			err := cg.Consume(context.Background(), []string{TopicReadEvent},
+				saramax.NewBatchHandler[ReadEvent](r.BatchConsume).WithName("read_history"))
+			if err != nil {
+				log.Error("consume read event for history failed", zap.Error(err))
+			}
+		}
+	}()
+	return nil
+}
+
+func (r *ReadHistoryConsumer) BatchConsume(msgs []*sarama.ConsumerMessage, evts []ReadEvent) error {
+	records := make([]domain.ReadRecord, 0, len(evts))
+	for i, evt := range evts {
+		// 阅读时间以消息的时间为准，老版本的 kafka 没有消息时间
+		ctime := msgs[i].Timestamp
+		if ctime.IsZero() {
+			ctime = time.Now()
+		}
+		records = append(records, domain.ReadRecord{Uid: evt.Uid, Aid: evt.Aid, Ctime: ctime})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	return r.recorder.Record(ctx, records)
+}
@@ -1,19 +1,35 @@
 package article
 
 import (
-	"encoding/json"
+	"context"
 	"github.com/IBM/sarama"
+	"github.com/Tuanzi-bug/tuan-book/internal/events/schema"
 )
 
-const TopicReadEvent = "article_read_event"
+// topic 和事件结构体定义在 schema 包里面，dao 写 outbox 的时候也用同一份
+const (
+	TopicReadEvent      = schema.TopicReadEvent
+	TopicLikeEvent      = schema.TopicLikeEvent
+	TopicCollectEvent   = schema.TopicCollectEvent
+	TopicPublishedEvent = schema.TopicPublishedEvent
+	TopicWithdrawnEvent = schema.TopicWithdrawnEvent
+)
 
-type ReadEvent struct {
-	Aid int64
-	Uid int64
-}
+type (
+	ReadEvent      = schema.ReadEvent
+	LikeEvent      = schema.LikeEvent
+	CollectEvent   = schema.CollectEvent
+	PublishedEvent = schema.PublishedEvent
+	WithdrawnEvent = schema.WithdrawnEvent
+)
 
+//go:generate mockgen -source=./producer.go -package=evtmocks -destination=./mocks/producer.mock.go Producer
 type Producer interface {
-	ProduceReadEvent(evt ReadEvent) error
+	ProduceReadEvent(ctx context.Context, evt ReadEvent) error
+	ProduceLikeEvent(ctx context.Context, evt LikeEvent) error
+	ProduceCollectEvent(ctx context.Context, evt CollectEvent) error
+	ProducePublishedEvent(ctx context.Context, evt PublishedEvent) error
+	ProduceWithdrawnEvent(ctx context.Context, evt WithdrawnEvent) error
 }
 
 type SaramaSyncProducer struct {
@@ -21,15 +37,41 @@ type SaramaSyncProducer struct {
 }
 
 // ProduceReadEvent 生产阅读事件
-func (s *SaramaSyncProducer) ProduceReadEvent(evt ReadEvent) error {
+func (s *SaramaSyncProducer) ProduceReadEvent(ctx context.Context, evt ReadEvent) error {
+	return s.produce(ctx, TopicReadEvent, evt)
+}
+
+// ProduceLikeEvent 生产点赞事件
+func (s *SaramaSyncProducer) ProduceLikeEvent(ctx context.Context, evt LikeEvent) error {
+	return s.produce(ctx, TopicLikeEvent, evt)
+}
+
+// ProduceCollectEvent 生产收藏事件
+func (s *SaramaSyncProducer) ProduceCollectEvent(ctx context.Context, evt CollectEvent) error {
+	return s.produce(ctx, TopicCollectEvent, evt)
+}
+
+// ProducePublishedEvent 生产文章发表事件
+func (s *SaramaSyncProducer) ProducePublishedEvent(ctx context.Context, evt PublishedEvent) error {
+	return s.produce(ctx, TopicPublishedEvent, evt)
+}
+
+// ProduceWithdrawnEvent 生产文章撤回事件
+func (s *SaramaSyncProducer) ProduceWithdrawnEvent(ctx context.Context, evt WithdrawnEvent) error {
+	return s.produce(ctx, TopicWithdrawnEvent, evt)
+}
+
+// produce ctx 里面的链路 id 会写进信封和消息头
+func (s *SaramaSyncProducer) produce(ctx context.Context, topic string, evt any) error {
 	// 序列化
-	val, err := json.Marshal(evt)
+	env, val, err := schema.Marshal(ctx, topic, evt)
 	if err != nil {
 		return err
 	}
 	_, _, err = s.producer.SendMessage(&sarama.ProducerMessage{
-		Topic: TopicReadEvent,
-		Value: sarama.ByteEncoder(val),
+		Topic:   topic,
+		Value:   sarama.ByteEncoder(val),
+		Headers: env.Headers(),
 	})
 	return err
 }
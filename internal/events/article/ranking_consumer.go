@@ -0,0 +1,105 @@
+package article
+
+import (
+	"context"
+	"github.com/IBM/sarama"
+	"github.com/Tuanzi-bug/tuan-book/internal/repository"
+	"github.com/Tuanzi-bug/tuan-book/pkg/log"
+	"github.com/Tuanzi-bug/tuan-book/pkg/saramax"
+	"go.uber.org/zap"
+	"time"
+)
+
+// RankingWeights 每一种交互事件给文章增加的热度
+type RankingWeights struct {
+	Read    float64
+	Like    float64
+	Collect float64
+}
+
+// rankingEvent 阅读、点赞、收藏、撤回事件的并集，具体是哪种事件由 topic 决定
+type rankingEvent struct {
+	Aid       int64
+	Uid       int64
+	Liked     bool
+	Cancelled bool
+}
+
+// RankingEventConsumer 消费交互事件，实时更新热榜中文章的热度，撤回的文章从热榜里面移除
+type RankingEventConsumer struct {
+	broker  saramax.Broker
+	repo    repository.RealTimeRankingRepository
+	boards  []string
+	weights RankingWeights
+	// 热度是累加的，重复投递的事件不能再算一次
+	dedup saramax.Deduplicator
+}
+
+func NewRankingEventConsumer(broker saramax.Broker, repo repository.RealTimeRankingRepository,
+	boards []string, weights RankingWeights, dedup saramax.Deduplicator) *RankingEventConsumer {
+	return &RankingEventConsumer{
+		broker:  broker,
+		repo:    repo,
+		boards:  boards,
+		weights: weights,
+		dedup:   dedup,
+	}
+}
+
+// Start 启动消费者
+func (r *RankingEventConsumer) Start() error {
+	cg, err := r.broker.ConsumerGroup("ranking")
+	if err != nil {
+		return err
+	}
+	topics := []string{TopicReadEvent, TopicLikeEvent, TopicCollectEvent, TopicWithdrawnEvent}
+	go func() {
+		for {
+			err := cg.Consume(context.Background(), topics,
+				saramax.NewBatchHandler[rankingEvent](r.BatchConsume).WithName("ranking").
+					WithDeduplicator(r.dedup))
+			if err != nil {
+				// 记录日志，不影响主流程
+				log.Error("consume ranking event failed", zap.Error(err))
+			}
+		}
+	}()
+	return nil
+}
+
+func (r *RankingEventConsumer) BatchConsume(msgs []*sarama.ConsumerMessage, evts []rankingEvent) error {
+	// 同一批里面同一篇文章的热度合并之后再写
+	deltas := make(map[int64]float64, len(evts))
+	var withdrawn []int64
+	for i, evt := range evts {
+		switch msgs[i].Topic {
+		case TopicReadEvent:
+			deltas[evt.Aid] += r.weights.Read
+		case TopicLikeEvent:
+			if evt.Liked {
+				deltas[evt.Aid] += r.weights.Like
+			} else {
+				deltas[evt.Aid] -= r.weights.Like
+			}
+		case TopicCollectEvent:
+			if evt.Cancelled {
+				deltas[evt.Aid] -= r.weights.Collect
+			} else {
+				deltas[evt.Aid] += r.weights.Collect
+			}
+		case TopicWithdrawnEvent:
+			withdrawn = append(withdrawn, evt.Aid)
+		}
+	}
+	// 撤回的文章不再加分，否则又会回到榜单里面
+	for _, aid := range withdrawn {
+		delete(deltas, aid)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	err := r.repo.IncrScores(ctx, r.boards, deltas)
+	if err != nil {
+		return err
+	}
+	return r.repo.Remove(ctx, r.boards, withdrawn)
+}
@@ -0,0 +1,62 @@
+package article
+
+import (
+	"context"
+	"github.com/IBM/sarama"
+	"github.com/Tuanzi-bug/tuan-book/internal/domain"
+	"github.com/Tuanzi-bug/tuan-book/pkg/log"
+	"github.com/Tuanzi-bug/tuan-book/pkg/saramax"
+	"go.uber.org/zap"
+	"time"
+)
+
+// UniqueReaderRecorder 由 service.UniqueReaderService 实现
+type UniqueReaderRecorder interface {
+	Record(ctx context.Context, records []domain.ReadRecord) error
+}
+
+// UniqueReaderConsumer 消费阅读事件，按天统计每篇文章的独立读者
+// 和 InteractiveReadEventConsumer 使用不同的消费组，互不影响
+type UniqueReaderConsumer struct {
+	broker   saramax.Broker
+	recorder UniqueReaderRecorder
+}
+
+func NewUniqueReaderConsumer(broker saramax.Broker, recorder UniqueReaderRecorder) *UniqueReaderConsumer {
+	return &UniqueReaderConsumer{
+		broker:   broker,
+		recorder: recorder,
+	}
+}
+
+func (r *UniqueReaderConsumer) Start() error {
+	cg, err := r.broker.ConsumerGroup("unique_reader")
+	if err != nil {
+		return err
+	}
+	go func() {
+		for {
+			err := cg.Consume(context.Background(), []string{TopicReadEvent},
+				saramax.NewBatchHandler[ReadEvent](r.BatchConsume).WithName("unique_reader"))
+			if err != nil {
+				log.Error("consume read event for unique reader failed", zap.Error(err))
+			}
+		}
+	}()
+	return nil
+}
+
+func (r *UniqueReaderConsumer) BatchConsume(msgs []*sarama.ConsumerMessage, evts []ReadEvent) error {
+	records := make([]domain.ReadRecord, 0, len(evts))
+	for i, evt := range evts {
+		// 按照消息的时间决定算在哪一天
+		ctime := msgs[i].Timestamp
+		if ctime.IsZero() {
+			ctime = time.Now()
+		}
+		records = append(records, domain.ReadRecord{Uid: evt.Uid, Aid: evt.Aid, Ctime: ctime})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	return r.recorder.Record(ctx, records)
+}
@@ -0,0 +1,84 @@
+package article
+
+import (
+	"context"
+	"github.com/IBM/sarama"
+	"github.com/Tuanzi-bug/tuan-book/pkg/log"
+	"github.com/Tuanzi-bug/tuan-book/pkg/saramax"
+	"go.uber.org/zap"
+	"time"
+)
+
+// ArticleIndexer 由 service.SearchService 实现，这里单独定义是为了避免循环引用
+type ArticleIndexer interface {
+	SyncArticles(ctx context.Context, ids []int64) error
+	Rebuild(ctx context.Context) error
+}
+
+// statusEvent 发表和撤回事件的并集，处理的时候都会去线上库查最新状态
+type statusEvent struct {
+	Aid int64
+	Uid int64
+}
+
+// SearchIndexConsumer 消费发表和撤回事件，更新搜索索引
+type SearchIndexConsumer struct {
+	broker  saramax.Broker
+	indexer ArticleIndexer
+	// 进程内的索引每个节点都要收到全部的事件，所以每个节点用不同的消费者组
+	group string
+}
+
+func NewSearchIndexConsumer(broker saramax.Broker, indexer ArticleIndexer, group string) *SearchIndexConsumer {
+	return &SearchIndexConsumer{
+		broker:  broker,
+		indexer: indexer,
+		group:   group,
+	}
+}
+
+// Start 启动消费者，同时从线上库全量构建一次索引
+func (s *SearchIndexConsumer) Start() error {
+	cg, err := s.broker.ConsumerGroup(s.group)
+	if err != nil {
+		return err
+	}
+	topics := []string{TopicPublishedEvent, TopicWithdrawnEvent}
+	go func() {
+		for {
+			err := cg.Consume(context.Background(), topics,
+				saramax.NewBatchHandler[statusEvent](s.BatchConsume).WithName(s.group))
+			if err != nil {
+				log.Error("consume article status event failed", zap.Error(err))
+			}
+		}
+	}()
+	// 先开始消费再构建，构建期间的变更也不会丢。
+	// 构建的时候每一页都会重新查最新状态，和消费者串行写索引，不会把撤回的文章写回去
+	go func() {
+		start := time.Now()
+		err := s.indexer.Rebuild(context.Background())
+		if err != nil {
+			log.Error("rebuild search index failed", zap.Error(err))
+			return
+		}
+		log.Info("rebuild search index done", zap.Duration("cost", time.Since(start)))
+	}()
+	return nil
+}
+
+func (s *SearchIndexConsumer) BatchConsume(msgs []*sarama.ConsumerMessage, evts []statusEvent) error {
+	// 同一篇文章在一批里面只需要处理一次
+	seen := make(map[int64]struct{}, len(evts))
+	ids := make([]int64, 0, len(evts))
+	for _, evt := range evts {
+		if _, ok := seen[evt.Aid]; ok {
+			continue
+		}
+		seen[evt.Aid] = struct{}{}
+		ids = append(ids, evt.Aid)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	return s.indexer.SyncArticles(ctx, ids)
+}
@@ -0,0 +1,232 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"github.com/IBM/sarama"
+	"github.com/Tuanzi-bug/tuan-book/internal/domain"
+	"github.com/Tuanzi-bug/tuan-book/internal/repository"
+	"github.com/Tuanzi-bug/tuan-book/pkg/log"
+	"github.com/Tuanzi-bug/tuan-book/pkg/saramax"
+	rlock "github.com/gotomicro/redis-lock"
+	"time"
+)
+
+// OutboxRelay 把 outbox 表里面待发送的消息投递到 kafka。
+// 同一时刻只有拿到分布式锁的节点在发送，同一个 key 的消息按照 id 顺序发送，
+// 前面的消息没有成功之前后面的消息不会发送。投递是至少一次的，消费者需要能够处理重复消息
+type OutboxRelay struct {
+	repo     repository.OutboxRepository
+	producer sarama.SyncProducer
+	client   *rlock.Client
+	// 每次从数据库里面取多少条
+	batchSize int
+	// 两轮之间的间隔
+	interval time.Duration
+	// 超过这个次数就不再重试
+	maxRetries int
+	// 第一次重试的间隔，之后每次翻倍，最多 maxBackoff
+	backoff    time.Duration
+	maxBackoff time.Duration
+	// 一轮发送的最长时间，也是分布式锁的过期时间
+	lease time.Duration
+	key   string
+}
+
+func NewOutboxRelay(repo repository.OutboxRepository, producer sarama.SyncProducer, client *rlock.Client,
+	batchSize int, interval time.Duration, maxRetries int) *OutboxRelay {
+	return &OutboxRelay{
+		repo:       repo,
+		producer:   producer,
+		client:     client,
+		batchSize:  batchSize,
+		interval:   interval,
+		maxRetries: maxRetries,
+		backoff:    time.Second,
+		maxBackoff: time.Minute * 5,
+		lease:      time.Second * 30,
+		key:        "rlock:outbox:relay",
+	}
+}
+
+// Start 和消费者一起启动
+func (r *OutboxRelay) Start() error {
+	go func() {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			r.relayOnce()
+		}
+	}()
+	return nil
+}
+
+func (r *OutboxRelay) relayOnce() {
+	ctx, cancel := context.WithTimeout(context.Background(), r.lease)
+	defer cancel()
+	lock, err := r.client.TryLock(ctx, r.key, r.lease)
+	if errors.Is(err, rlock.ErrFailedToPreemptLock) {
+		// 别的节点正在发送
+		return
+	}
+	if err != nil {
+		log.Error("获取 outbox 分布式锁失败", log.Err(err))
+		return
+	}
+	defer func() {
+		er := lock.Unlock(context.Background())
+		if er != nil {
+			log.Warn("释放 outbox 分布式锁失败", log.Err(er))
+		}
+	}()
+	cnt, err := r.Relay(ctx, time.Now())
+	if err != nil {
+		log.Error("发送 outbox 消息失败", log.Err(err))
+		return
+	}
+	if cnt > 0 {
+		log.Debug("发送 outbox 消息", log.Int("cnt", cnt))
+	}
+}
+
+// Relay 发送一轮，返回发送成功的条数
+func (r *OutboxRelay) Relay(ctx context.Context, now time.Time) (int, error) {
+	// 前面的消息还没有发送成功的 key，这一轮后面的消息都不能发送
+	blocked := make(map[string]struct{})
+	var (
+		afterId int64
+		sent    int
+	)
+	for {
+		msgs, err := r.repo.FindPending(ctx, afterId, r.batchSize)
+		if err != nil {
+			return sent, err
+		}
+		delivered := r.relayPage(ctx, msgs, blocked, now)
+		// 标记失败的话下一轮会重复发送
+		err = r.repo.MarkDelivered(ctx, delivered)
+		if err != nil {
+			return sent, err
+		}
+		sent += len(delivered)
+		if len(msgs) < r.batchSize {
+			return sent, nil
+		}
+		afterId = msgs[len(msgs)-1].Id
+	}
+}
+
+// relayPage 按照 key 分组，每一波从每个 key 里面取一条，一波调用一次 SendMessages。
+// 同一波里面没有相同的 key，所以一波里面的消息不需要保证顺序，
+// 某个 key 发送失败之后后面的波次就跳过这个 key
+func (r *OutboxRelay) relayPage(ctx context.Context, msgs []domain.OutboxMessage,
+	blocked map[string]struct{}, now time.Time) []int64 {
+	groups := make([][]domain.OutboxMessage, 0, len(msgs))
+	idx := make(map[string]int, len(msgs))
+	for _, msg := range msgs {
+		i, ok := idx[msg.Key]
+		// 没有 key 的消息不需要保证顺序，每条单独一组
+		if !ok || msg.Key == "" {
+			i = len(groups)
+			groups = append(groups, nil)
+			idx[msg.Key] = i
+		}
+		groups[i] = append(groups[i], msg)
+	}
+	delivered := make([]int64, 0, len(msgs))
+	for wave := 0; ; wave++ {
+		batch := make([]domain.OutboxMessage, 0, len(groups))
+		for _, g := range groups {
+			if wave >= len(g) {
+				continue
+			}
+			msg := g[wave]
+			if _, ok := blocked[msg.Key]; ok {
+				continue
+			}
+			if msg.NextTime.After(now) {
+				r.block(blocked, msg.Key)
+				continue
+			}
+			batch = append(batch, msg)
+		}
+		if len(batch) == 0 {
+			return delivered
+		}
+		errs := r.send(batch)
+		for i, msg := range batch {
+			if errs[i] != nil {
+				r.block(blocked, msg.Key)
+				r.retry(ctx, msg, now, errs[i])
+				continue
+			}
+			delivered = append(delivered, msg.Id)
+		}
+	}
+}
+
+// block 没有 key 的消息不需要保证顺序
+func (r *OutboxRelay) block(blocked map[string]struct{}, key string) {
+	if key != "" {
+		blocked[key] = struct{}{}
+	}
+}
+
+// send 返回每条消息的错误，下标和 msgs 一一对应
+func (r *OutboxRelay) send(msgs []domain.OutboxMessage) []error {
+	pmsgs := make([]*sarama.ProducerMessage, 0, len(msgs))
+	for _, msg := range msgs {
+		pmsg := &sarama.ProducerMessage{
+			Topic: msg.Topic,
+			Value: sarama.ByteEncoder(msg.Payload),
+			// 事件的元数据放到消息头里面
+			Headers: saramax.EnvelopeHeaders(msg.Payload),
+		}
+		if msg.Key != "" {
+			// 同一个 key 的消息落在同一个分区
+			pmsg.Key = sarama.StringEncoder(msg.Key)
+		}
+		pmsgs = append(pmsgs, pmsg)
+	}
+	errs := make([]error, len(msgs))
+	err := r.producer.SendMessages(pmsgs)
+	if err == nil {
+		return errs
+	}
+	var perrs sarama.ProducerErrors
+	if !errors.As(err, &perrs) {
+		// 不知道哪些成功了，都当作失败，重复发送由消费者处理
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+	failed := make(map[*sarama.ProducerMessage]error, len(perrs))
+	for _, perr := range perrs {
+		failed[perr.Msg] = perr.Err
+	}
+	for i, pmsg := range pmsgs {
+		errs[i] = failed[pmsg]
+	}
+	return errs
+}
+
+func (r *OutboxRelay) retry(ctx context.Context, msg domain.OutboxMessage, now time.Time, cause error) {
+	var err error
+	if msg.Retries+1 >= r.maxRetries {
+		log.Error("outbox 消息重试次数用完", log.Int64("id", msg.Id),
+			log.String("topic", msg.Topic), log.String("key", msg.Key), log.Err(cause))
+		err = r.repo.MarkFailed(ctx, msg.Id)
+	} else {
+		backoff := r.backoff
+		for i := 0; i < msg.Retries && backoff < r.maxBackoff; i++ {
+			backoff *= 2
+		}
+		log.Warn("outbox 消息发送失败，稍后重试", log.Int64("id", msg.Id),
+			log.String("topic", msg.Topic), log.Int("retries", msg.Retries), log.Err(cause))
+		err = r.repo.MarkRetry(ctx, msg.Id, now.Add(min(backoff, r.maxBackoff)))
+	}
+	if err != nil {
+		log.Error("更新 outbox 消息状态失败", log.Int64("id", msg.Id), log.Err(err))
+	}
+}
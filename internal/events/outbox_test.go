@@ -0,0 +1,123 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"github.com/IBM/sarama"
+	"github.com/Tuanzi-bug/tuan-book/internal/domain"
+	repomocks "github.com/Tuanzi-bug/tuan-book/internal/repository/mocks"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"testing"
+	"time"
+)
+
+// batchProducer 记录每一次 SendMessages 发送的 key，failKeys 里面的 key 发送失败
+type batchProducer struct {
+	sarama.SyncProducer
+	failKeys map[string]error
+	// 没有 key 的消息记录为空字符串
+	batches [][]string
+}
+
+func (p *batchProducer) SendMessages(msgs []*sarama.ProducerMessage) error {
+	var (
+		keys []string
+		errs sarama.ProducerErrors
+	)
+	for _, msg := range msgs {
+		var key string
+		if msg.Key != nil {
+			k, _ := msg.Key.Encode()
+			key = string(k)
+		}
+		keys = append(keys, key)
+		if err, ok := p.failKeys[key]; ok {
+			errs = append(errs, &sarama.ProducerError{Msg: msg, Err: err})
+		}
+	}
+	p.batches = append(p.batches, keys)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func TestOutboxRelay_Relay(t *testing.T) {
+	now := time.UnixMilli(1700000000000)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	repo := repomocks.NewMockOutboxRepository(ctrl)
+	producer := &batchProducer{failKeys: map[string]error{
+		"2": errors.New("mock error"),
+		"4": errors.New("mock error"),
+	}}
+	relay := NewOutboxRelay(repo, producer, nil, 10, time.Second, 3)
+
+	repo.EXPECT().FindPending(gomock.Any(), int64(0), 10).Return([]domain.OutboxMessage{
+		{Id: 1, Topic: "t", Key: "1", Payload: []byte("a"), NextTime: now},
+		// 发送失败，同一个 key 后面的消息这一轮不能发送
+		{Id: 2, Topic: "t", Key: "2", Payload: []byte("b"), Retries: 1, NextTime: now},
+		{Id: 3, Topic: "t", Key: "2", Payload: []byte("c"), NextTime: now},
+		// 还没到重试时间
+		{Id: 4, Topic: "t", Key: "3", Payload: []byte("d"), NextTime: now.Add(time.Second)},
+		{Id: 5, Topic: "t", Key: "3", Payload: []byte("e"), NextTime: now},
+		// 重试次数用完
+		{Id: 6, Topic: "t", Key: "4", Payload: []byte("f"), Retries: 2, NextTime: now},
+		{Id: 7, Topic: "t", Payload: []byte("g"), NextTime: now},
+		// 同一个 key 的第二条在下一波发送
+		{Id: 8, Topic: "t", Key: "1", Payload: []byte("h"), NextTime: now},
+		{Id: 9, Topic: "t", Payload: []byte("i"), NextTime: now},
+	}, nil)
+	// 第二次重试，间隔翻倍
+	repo.EXPECT().MarkRetry(gomock.Any(), int64(2), now.Add(time.Second*2)).Return(nil)
+	repo.EXPECT().MarkFailed(gomock.Any(), int64(6)).Return(nil)
+	repo.EXPECT().MarkDelivered(gomock.Any(), []int64{1, 7, 9, 8}).Return(nil)
+
+	cnt, err := relay.Relay(context.Background(), now)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, cnt)
+	assert.Equal(t, [][]string{{"1", "2", "4", "", ""}, {"1"}}, producer.batches)
+}
+
+func TestOutboxRelay_RelayPages(t *testing.T) {
+	now := time.UnixMilli(1700000000000)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	repo := repomocks.NewMockOutboxRepository(ctrl)
+	producer := &batchProducer{}
+	relay := NewOutboxRelay(repo, producer, nil, 2, time.Second, 3)
+
+	// 上一页被阻塞的 key 在下一页也不能发送
+	repo.EXPECT().FindPending(gomock.Any(), int64(0), 2).Return([]domain.OutboxMessage{
+		{Id: 1, Topic: "t", Key: "1", NextTime: now.Add(time.Second)},
+		{Id: 2, Topic: "t", Key: "2", NextTime: now},
+	}, nil)
+	repo.EXPECT().FindPending(gomock.Any(), int64(2), 2).Return([]domain.OutboxMessage{
+		{Id: 3, Topic: "t", Key: "1", NextTime: now},
+	}, nil)
+	repo.EXPECT().MarkDelivered(gomock.Any(), []int64{2}).Return(nil)
+	repo.EXPECT().MarkDelivered(gomock.Any(), []int64{}).Return(nil)
+
+	cnt, err := relay.Relay(context.Background(), now)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, cnt)
+	assert.Equal(t, [][]string{{"2"}}, producer.batches)
+}
+
+// TestOutboxRelay_SendError 不是 sarama.ProducerErrors 的时候整批都当作失败
+func TestOutboxRelay_SendError(t *testing.T) {
+	relay := NewOutboxRelay(nil, &errProducer{}, nil, 10, time.Second, 3)
+	errs := relay.send([]domain.OutboxMessage{{Id: 1, Topic: "t"}, {Id: 2, Topic: "t"}})
+	assert.Equal(t, []error{errMockSend, errMockSend}, errs)
+}
+
+var errMockSend = errors.New("mock error")
+
+type errProducer struct {
+	sarama.SyncProducer
+}
+
+func (p *errProducer) SendMessages(msgs []*sarama.ProducerMessage) error {
+	return errMockSend
+}
@@ -0,0 +1,88 @@
+// Package schema 文章相关的 topic 和事件结构体。生产者、dao 写 outbox 都用这里的定义，
+// 不依赖项目里面的其他包，谁都可以引用
+package schema
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Tuanzi-bug/tuan-book/pkg/saramax"
+)
+
+const (
+	TopicReadEvent    = "article_read_event"
+	TopicLikeEvent    = "article_like_event"
+	TopicCollectEvent = "article_collect_event"
+	// TopicPublishedEvent 文章发表，包括定时发表到点
+	TopicPublishedEvent = "article_published_event"
+	TopicWithdrawnEvent = "article_withdrawn_event"
+)
+
+// EventMeta 写在信封里面的事件类型和版本
+type EventMeta struct {
+	Type    string
+	Version int
+}
+
+// topicEvents 每个 topic 只有一种事件。修改了事件结构体之后版本加一，
+// 并且用 saramax.RegisterUpcaster 注册从旧版本升级的函数
+var topicEvents = map[string]EventMeta{
+	TopicReadEvent:      {Type: "article.read", Version: 1},
+	TopicLikeEvent:      {Type: "article.like", Version: 1},
+	TopicCollectEvent:   {Type: "article.collect", Version: 1},
+	TopicPublishedEvent: {Type: "article.published", Version: 1},
+	TopicWithdrawnEvent: {Type: "article.withdrawn", Version: 1},
+}
+
+// Meta 返回 topic 上的事件类型和版本
+func Meta(topic string) (EventMeta, bool) {
+	meta, ok := topicEvents[topic]
+	return meta, ok
+}
+
+// Marshal 把事件装进信封
+func Marshal(ctx context.Context, topic string, evt any) (saramax.Envelope, []byte, error) {
+	meta, ok := topicEvents[topic]
+	if !ok {
+		return saramax.Envelope{}, nil, fmt.Errorf("未知的 topic %s", topic)
+	}
+	env, err := saramax.NewEnvelope(ctx, meta.Type, meta.Version, evt)
+	if err != nil {
+		return env, nil, err
+	}
+	val, err := json.Marshal(env)
+	return env, val, err
+}
+
+type ReadEvent struct {
+	Aid int64
+	Uid int64
+}
+
+// LikeEvent 点赞或者取消点赞
+type LikeEvent struct {
+	Aid   int64
+	Uid   int64
+	Liked bool
+}
+
+// CollectEvent 收藏或者取消收藏
+type CollectEvent struct {
+	Aid int64
+	Uid int64
+	Cid int64
+	// 老的事件没有这个字段，所以用 false 表示收藏
+	Cancelled bool
+}
+
+// PublishedEvent 文章发表到线上库
+type PublishedEvent struct {
+	Aid int64
+	Uid int64
+}
+
+// WithdrawnEvent 文章从线上库撤回
+type WithdrawnEvent struct {
+	Aid int64
+	Uid int64
+}
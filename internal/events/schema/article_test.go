@@ -0,0 +1,40 @@
+package schema
+
+import (
+	"context"
+	"github.com/Tuanzi-bug/tuan-book/pkg/saramax"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"reflect"
+	"testing"
+)
+
+func TestMarshal(t *testing.T) {
+	testCases := []struct {
+		topic string
+		evt   any
+		want  any
+	}{
+		{topic: TopicReadEvent, evt: ReadEvent{Aid: 1, Uid: 2}, want: &ReadEvent{}},
+		{topic: TopicLikeEvent, evt: LikeEvent{Aid: 1, Uid: 2, Liked: true}, want: &LikeEvent{}},
+		{topic: TopicCollectEvent, evt: CollectEvent{Aid: 1, Uid: 2, Cid: 3}, want: &CollectEvent{}},
+		{topic: TopicPublishedEvent, evt: PublishedEvent{Aid: 1, Uid: 2}, want: &PublishedEvent{}},
+		{topic: TopicWithdrawnEvent, evt: WithdrawnEvent{Aid: 1, Uid: 2}, want: &WithdrawnEvent{}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.topic, func(t *testing.T) {
+			meta, ok := Meta(tc.topic)
+			require.True(t, ok)
+			env, val, err := Marshal(context.Background(), tc.topic, tc.evt)
+			require.NoError(t, err)
+			assert.Equal(t, meta.Type, env.Type)
+			got, err := saramax.Unmarshal(val, tc.want)
+			require.NoError(t, err)
+			assert.Equal(t, env.Id, got.Id)
+			assert.Equal(t, meta.Version, got.Version)
+			assert.Equal(t, tc.evt, reflect.ValueOf(tc.want).Elem().Interface())
+		})
+	}
+	_, _, err := Marshal(context.Background(), "unknown", ReadEvent{})
+	assert.Error(t, err)
+}
@@ -305,7 +305,7 @@ func (s *InteractiveTestSuite) TestLike() {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			tc.before(t)
-			err := svc.Like(context.Background(), tc.biz, tc.bizId, tc.uid)
+			_, err := svc.Like(context.Background(), tc.biz, tc.bizId, tc.uid)
 			assert.NoError(t, err)
 			tc.after(t)
 		})
@@ -397,13 +397,41 @@ func (s *InteractiveTestSuite) TestDislike() {
 			bizId: 2,
 			uid:   123,
 		},
+		{
+			name: "取消点赞-没有点赞过，不扣减",
+			before: func(t *testing.T) {
+				err := s.db.Create(dao.Interactive{
+					Id:    5,
+					Biz:   "test",
+					BizId: 5,
+					Ctime: 6,
+					Utime: 7,
+				}).Error
+				assert.NoError(t, err)
+			},
+			after: func(t *testing.T) {
+				var data dao.Interactive
+				err := s.db.Where("id = ?", 5).First(&data).Error
+				assert.NoError(t, err)
+				assert.Equal(t, dao.Interactive{
+					Id:    5,
+					Biz:   "test",
+					BizId: 5,
+					Ctime: 6,
+					Utime: 7,
+				}, data)
+			},
+			biz:   "test",
+			bizId: 5,
+			uid:   125,
+		},
 	}
 
 	svc := startup.InitInteractiveService()
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			tc.before(t)
-			err := svc.CancelLike(context.Background(), tc.biz, tc.bizId, tc.uid)
+			_, err := svc.CancelLike(context.Background(), tc.biz, tc.bizId, tc.uid)
 			assert.NoError(t, err)
 			tc.after(t)
 		})
@@ -2,6 +2,8 @@ package integration
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/Tuanzi-bug/tuan-book/internal/domain"
 	"github.com/Tuanzi-bug/tuan-book/internal/integration/startup"
 	"github.com/Tuanzi-bug/tuan-book/internal/job"
@@ -27,6 +29,8 @@ func (s *SchedulerTestSuite) SetupSuite() {
 func (s *SchedulerTestSuite) TearDownSuite() {
 	err := s.db.Exec("TRUNCATE TABLE `jobs`").Error
 	assert.NoError(s.T(), err)
+	err = s.db.Exec("TRUNCATE TABLE `job_runs`").Error
+	assert.NoError(s.T(), err)
 }
 
 // TestSchedule 测试调度
@@ -85,6 +89,18 @@ func (s *SchedulerTestSuite) TestSchedule() {
 					// 抢占会导致版本升高
 					Version: 1,
 				}, j)
+
+				// 记录了一次成功的执行
+				var runs []dao.JobRun
+				err = s.db.Where("jid=?", 1).Find(&runs).Error
+				assert.NoError(t, err)
+				assert.Len(t, runs, 1)
+				run := runs[0]
+				assert.NotEmpty(t, run.Node)
+				assert.True(t, run.EndTime >= run.StartTime)
+				assert.Equal(t, 2, run.Status)
+				assert.Equal(t, 1, run.Attempt)
+				assert.Empty(t, run.Err)
 			},
 			wantErr: context.DeadlineExceeded,
 			// 运行了一次
@@ -111,6 +127,145 @@ func (s *SchedulerTestSuite) TestSchedule() {
 	}
 }
 
+// TestReclaim 模拟抢占了任务之后挂掉的节点：没有释放，也不再续约
+func (s *SchedulerTestSuite) TestReclaim() {
+	now := time.Now().UnixMilli()
+	// 租约早就过期了
+	dead := dao.Job{
+		Id:         2,
+		Name:       "dead_node_job",
+		Executor:   "local",
+		Expression: "@every 1h",
+		Status:     1,
+		Owner:      "dead-node",
+		Version:    3,
+		NextTime:   now - time.Hour.Milliseconds(),
+		Ctime:      123,
+		Utime:      now - (time.Minute * 10).Milliseconds(),
+	}
+	// 刚刚续约过，节点还活着
+	alive := dao.Job{
+		Id:         3,
+		Name:       "alive_node_job",
+		Executor:   "local",
+		Expression: "@every 1h",
+		Status:     1,
+		Owner:      "alive-node",
+		Version:    3,
+		NextTime:   now - time.Hour.Milliseconds(),
+		Ctime:      123,
+		Utime:      now,
+	}
+	t := s.T()
+	assert.NoError(t, s.db.Create(&dead).Error)
+	assert.NoError(t, s.db.Create(&alive).Error)
+	// 挂掉的节点没来得及记录执行结果
+	assert.NoError(t, s.db.Create(&dao.JobRun{
+		Jid: 2, Node: "dead-node", Status: 1, Attempt: 1, StartTime: dead.Utime,
+	}).Error)
+
+	exec := job.NewLocalFuncExecutor()
+	deadJob, aliveJob := &testJob{}, &testJob{}
+	exec.RegisterFunc("dead_node_job", deadJob.Do)
+	exec.RegisterFunc("alive_node_job", aliveJob.Do)
+	s.scheduler.RegisterExecutor(exec)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, s.scheduler.Schedule(ctx))
+	assert.Equal(t, 1, deadJob.cnt)
+	assert.Equal(t, 0, aliveJob.cnt)
+
+	var j dao.Job
+	assert.NoError(t, s.db.Where("id=?", 2).First(&j).Error)
+	// 执行完之后释放了，下一次按照表达式执行
+	assert.Equal(t, 0, j.Status)
+	assert.Equal(t, "", j.Owner)
+	assert.Equal(t, 4, j.Version)
+	assert.True(t, j.NextTime > now)
+
+	assert.NoError(t, s.db.Where("id=?", 3).First(&j).Error)
+	assert.Equal(t, 1, j.Status)
+	assert.Equal(t, "alive-node", j.Owner)
+	assert.Equal(t, 3, j.Version)
+
+	var runs []dao.JobRun
+	assert.NoError(t, s.db.Where("jid=?", 2).Order("id ASC").Find(&runs).Error)
+	assert.Len(t, runs, 2)
+	// 挂掉的节点的执行记录标记成失败
+	assert.Equal(t, 3, runs[0].Status)
+	assert.Contains(t, runs[0].Err, "dead-node")
+	assert.True(t, runs[0].EndTime > 0)
+	assert.Equal(t, 2, runs[1].Status)
+	assert.NotEqual(t, "dead-node", runs[1].Node)
+}
+
+// TestReclaimThenFinish 模拟执行太久被回收的节点：执行完之后的结果不能覆盖新的节点
+func (s *SchedulerTestSuite) TestReclaimThenFinish() {
+	testCases := []struct {
+		name string
+		id   int64
+		err  error
+	}{
+		{
+			name: "执行成功",
+			id:   4,
+		},
+		{
+			// 只允许执行一次，失败之后会停止调度
+			name: "执行失败",
+			id:   5,
+			err:  errors.New("模拟执行失败"),
+		},
+	}
+	jobDAO := dao.NewGORMJobDAO(s.db)
+	for _, tc := range testCases {
+		s.T().Run(tc.name, func(t *testing.T) {
+			now := time.Now().UnixMilli()
+			j := dao.Job{
+				Id:          tc.id,
+				Name:        fmt.Sprintf("reclaimed_job_%d", tc.id),
+				Executor:    "local",
+				Expression:  "@every 1h",
+				MaxAttempts: 1,
+				NextTime:    now,
+				Ctime:       now,
+				Utime:       now,
+			}
+			assert.NoError(t, s.db.Create(&j).Error)
+			exec := job.NewLocalFuncExecutor()
+			exec.RegisterFunc(j.Name, func(ctx context.Context, _ domain.Job) error {
+				// 一直没有续约，被别的节点回收了
+				err := s.db.Model(&dao.Job{}).Where("id=?", tc.id).
+					Update("utime", now-(time.Minute*10).Milliseconds()).Error
+				assert.NoError(t, err)
+				reclaimed, err := jobDAO.Preempt(context.Background(), "new-node")
+				assert.NoError(t, err)
+				assert.Equal(t, tc.id, reclaimed.Id)
+				return tc.err
+			})
+			s.scheduler.RegisterExecutor(exec)
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			assert.Equal(t, context.DeadlineExceeded, s.scheduler.Schedule(ctx))
+
+			var res dao.Job
+			assert.NoError(t, s.db.Where("id=?", tc.id).First(&res).Error)
+			// 还在新的节点手里，旧的节点什么也没有改
+			assert.Equal(t, 1, res.Status)
+			assert.Equal(t, "new-node", res.Owner)
+			assert.Equal(t, 0, res.Failures)
+			assert.Equal(t, now, res.NextTime)
+
+			var runs []dao.JobRun
+			assert.NoError(t, s.db.Where("jid=?", tc.id).Find(&runs).Error)
+			assert.Len(t, runs, 1)
+			// 回收的时候记录的结果不会被覆盖
+			assert.Equal(t, 3, runs[0].Status)
+			assert.Contains(t, runs[0].Err, "租约过期")
+		})
+	}
+}
+
 func TestScheduler(t *testing.T) {
 	suite.Run(t, &SchedulerTestSuite{})
 }
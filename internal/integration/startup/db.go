@@ -21,7 +21,10 @@ func InitDB() *gorm.DB {
 		panic(err)
 	}
 
-	err = db.AutoMigrate(&dao.User{}, &dao.Article{}, &dao.PublishedArticle{}, dao.Interactive{}, dao.UserLikeBiz{}, dao.UserCollectionBiz{})
+	err = db.AutoMigrate(&dao.User{}, &dao.Article{}, &dao.PublishedArticle{}, dao.Interactive{}, dao.UserLikeBiz{}, dao.UserCollectionBiz{}, &dao.ArticleRevision{},
+		&dao.Tag{}, &dao.ArticleTag{}, &dao.PublishedArticleTag{}, &dao.Comment{},
+		&dao.FollowRelation{}, &dao.FollowStatistic{}, &dao.FeedInbox{}, &dao.Collection{}, &dao.DailyReader{},
+		&dao.OutboxMessage{}, &dao.Job{}, &dao.JobRun{})
 	if err != nil {
 		panic(err)
 	}
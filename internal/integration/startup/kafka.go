@@ -1,19 +1,17 @@
 package startup
 
-import "github.com/IBM/sarama"
+import (
+	"github.com/IBM/sarama"
+	"github.com/Tuanzi-bug/tuan-book/pkg/saramax"
+)
 
-func InitSaramaClient() sarama.Client {
-	scfg := sarama.NewConfig()
-	scfg.Producer.Return.Successes = true
-	client, err := sarama.NewClient([]string{"192.168.1.3:9094"}, scfg)
-	if err != nil {
-		panic(err)
-	}
-	return client
+// InitBroker 集成测试使用进程内的 broker，不需要启动 kafka
+func InitBroker() saramax.Broker {
+	return saramax.NewMemoryBroker(0, 0)
 }
 
-func InitSyncProducer(c sarama.Client) sarama.SyncProducer {
-	p, err := sarama.NewSyncProducerFromClient(c)
+func InitSyncProducer(broker saramax.Broker) sarama.SyncProducer {
+	p, err := broker.SyncProducer()
 	if err != nil {
 		panic(err)
 	}
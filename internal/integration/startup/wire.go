@@ -21,7 +21,7 @@ var thirdPartySet = wire.NewSet(
 	InitRedis,
 	ioc.InitDB,
 	// ioc.InitLogger,
-	InitSaramaClient,
+	InitBroker,
 	InitSyncProducer,
 )
 
@@ -42,9 +42,47 @@ var articlSvcProvider = wire.NewSet(
 var interactiveSvcSet = wire.NewSet(dao.NewGORMInteractiveDAO,
 	cache.NewInteractiveRedisCache,
 	repository.NewCachedInteractiveRepository,
+	dao.NewGORMCollectionDAO,
+	repository.NewCachedCollectionRepository,
 	service.NewInteractiveService,
 )
 
+var rankingSvcSet = wire.NewSet(
+	cache.NewRankingRedisCache,
+	cache.NewRankingLocalCache,
+	cache.NewRankingRedisZSetCache,
+	repository.NewCachedRankingRepository,
+	repository.NewCachedRealTimeRankingRepository,
+	ioc.InitRankingBoards,
+	ioc.InitRankingService,
+)
+
+var commentSvcSet = wire.NewSet(
+	dao.NewGORMCommentDAO,
+	cache.NewCommentRedisCache,
+	repository.NewCachedCommentRepository,
+	service.NewCommentService,
+)
+
+var followSvcSet = wire.NewSet(
+	dao.NewGORMFollowDAO,
+	cache.NewFollowRedisCache,
+	repository.NewCachedFollowRepository,
+	service.NewFollowService,
+)
+
+var feedSvcSet = wire.NewSet(
+	dao.NewGORMFeedDAO,
+	repository.NewInboxFeedRepository,
+	ioc.InitFeedService,
+)
+
+var historySvcSet = wire.NewSet(
+	ioc.InitReadHistoryCache,
+	repository.NewRedisReadHistoryRepository,
+	service.NewReadHistoryService,
+)
+
 var jobProviderSet = wire.NewSet(
 	service.NewCronJobService,
 	repository.NewPreemptJobRepository,
@@ -65,6 +103,13 @@ func InitWebServer() *gin.Engine {
 		userSvcProvider,
 		articlSvcProvider,
 		interactiveSvcSet,
+		rankingSvcSet,
+		repository.NewLocalArticleSearchRepository,
+		service.NewArticleSearchService,
+		commentSvcSet,
+		followSvcSet,
+		feedSvcSet,
+		historySvcSet,
 		// 数据层
 		//dao.NewUserDAO,
 		// 缓存
@@ -81,10 +126,20 @@ func InitWebServer() *gin.Engine {
 		// 控制层
 		web.NewUserHandler,
 		web.NewArticleHandler,
+		web.NewSearchHandler,
+		web.NewCommentHandler,
+		web.NewFollowHandler,
+		web.NewCollectionHandler,
+		web.NewPersonalHandler,
+		service.NewCollectionService,
+		web.NewFeedHandler,
+		web.NewJobHandler,
+		jobProviderSet,
 		myjwt.NewRedisJWTHandler,
 		// 初始化服务
 		ioc.InitWebServer,
 		ioc.InitMiddlewares,
+		ioc.InitAdminMiddleware,
 	)
 	return new(gin.Engine)
 }
@@ -105,6 +160,9 @@ func InitArticleHandler(dao dao.ArticleDAO) *web.ArticleHandler {
 		thirdPartySet,
 		userSvcProvider,
 		interactiveSvcSet,
+		rankingSvcSet,
+		commentSvcSet,
+		followSvcSet,
 		repository.NewCacheArticleRepository,
 		cache.NewArticleRedisCache,
 		service.NewArticleService,
@@ -115,5 +173,5 @@ func InitArticleHandler(dao dao.ArticleDAO) *web.ArticleHandler {
 
 func InitInteractiveService() service.InteractiveService {
 	wire.Build(thirdPartySet, interactiveSvcSet)
-	return service.NewInteractiveService(nil)
+	return service.NewInteractiveService(nil, nil)
 }
@@ -48,16 +48,53 @@ func InitWebServer() *gin.Engine {
 	articleDAO := dao.NewGORMArticleDAO(db)
 	articleCache := cache.NewArticleRedisCache(cmdable)
 	articleRepository := repository.NewCacheArticleRepository(articleDAO, articleCache, userRepository)
-	client := InitSaramaClient()
-	syncProducer := InitSyncProducer(client)
+	broker := InitBroker()
+	syncProducer := InitSyncProducer(broker)
 	producer := article.NewSaramaSyncProducer(syncProducer)
 	articleService := service.NewArticleService(articleRepository, producer)
 	interactiveDAO := dao.NewGORMInteractiveDAO(db)
 	interactiveCache := cache.NewInteractiveRedisCache(cmdable)
 	interactiveRepository := repository.NewCachedInteractiveRepository(interactiveDAO, interactiveCache)
-	interactiveService := service.NewInteractiveService(interactiveRepository)
-	articleHandler := web.NewArticleHandler(articleService, interactiveService)
-	engine := ioc.InitWebServer(v, userHandler, articleHandler)
+	collectionDAO := dao.NewGORMCollectionDAO(db)
+	collectionRepository := repository.NewCachedCollectionRepository(collectionDAO, interactiveCache)
+	interactiveService := service.NewInteractiveService(interactiveRepository, collectionRepository)
+	rankingRedisCache := cache.NewRankingRedisCache(cmdable)
+	rankingLocalCache := cache.NewRankingLocalCache()
+	rankingRepository := repository.NewCachedRankingRepository(rankingRedisCache, rankingLocalCache)
+	rankingZSetCache := cache.NewRankingRedisZSetCache(cmdable)
+	realTimeRankingRepository := repository.NewCachedRealTimeRankingRepository(rankingZSetCache)
+	v2 := ioc.InitRankingBoards()
+	rankingService := ioc.InitRankingService(interactiveService, articleService, rankingRepository, realTimeRankingRepository, v2)
+	commentDAO := dao.NewGORMCommentDAO(db)
+	commentCache := cache.NewCommentRedisCache(cmdable)
+	commentRepository := repository.NewCachedCommentRepository(commentDAO, commentCache)
+	commentService := service.NewCommentService(commentRepository, articleRepository)
+	followDAO := dao.NewGORMFollowDAO(db)
+	followCache := cache.NewFollowRedisCache(cmdable)
+	followRepository := repository.NewCachedFollowRepository(followDAO, followCache)
+	followService := service.NewFollowService(followRepository, userRepository)
+	articleHandler := web.NewArticleHandler(articleService, interactiveService, rankingService, commentService, followService)
+	articleSearchRepository := repository.NewLocalArticleSearchRepository()
+	searchService := service.NewArticleSearchService(articleSearchRepository, articleService)
+	searchHandler := web.NewSearchHandler(searchService)
+	commentHandler := web.NewCommentHandler(commentService)
+	followHandler := web.NewFollowHandler(followService)
+	feedDAO := dao.NewGORMFeedDAO(db)
+	feedRepository := repository.NewInboxFeedRepository(feedDAO)
+	feedService := ioc.InitFeedService(feedRepository, followRepository, articleRepository)
+	feedHandler := web.NewFeedHandler(feedService)
+	collectionService := service.NewCollectionService(collectionRepository)
+	collectionHandler := web.NewCollectionHandler(collectionService)
+	readHistoryCache := ioc.InitReadHistoryCache(cmdable)
+	readHistoryRepository := repository.NewRedisReadHistoryRepository(readHistoryCache)
+	readHistoryService := service.NewReadHistoryService(readHistoryRepository)
+	personalHandler := web.NewPersonalHandler(articleService, interactiveService, readHistoryService)
+	jobDAO := dao.NewGORMJobDAO(db)
+	cronJobRepository := repository.NewPreemptJobRepository(jobDAO)
+	cronJobService := service.NewCronJobService(cronJobRepository)
+	adminMiddlewareBuilder := ioc.InitAdminMiddleware()
+	jobHandler := web.NewJobHandler(cronJobService, adminMiddlewareBuilder)
+	engine := ioc.InitWebServer(v, userHandler, articleHandler, searchHandler, commentHandler, followHandler, feedHandler, collectionHandler, personalHandler, jobHandler)
 	return engine
 }
 
@@ -69,15 +106,32 @@ func InitArticleHandler(dao2 dao.ArticleDAO) *web.ArticleHandler {
 	userCache := cache.NewUserCache(cmdable)
 	userRepository := repository.NewCacheUserRepository(userDAO, userCache)
 	articleRepository := repository.NewCacheArticleRepository(dao2, articleCache, userRepository)
-	client := InitSaramaClient()
-	syncProducer := InitSyncProducer(client)
+	broker := InitBroker()
+	syncProducer := InitSyncProducer(broker)
 	producer := article.NewSaramaSyncProducer(syncProducer)
 	articleService := service.NewArticleService(articleRepository, producer)
 	interactiveDAO := dao.NewGORMInteractiveDAO(db)
 	interactiveCache := cache.NewInteractiveRedisCache(cmdable)
 	interactiveRepository := repository.NewCachedInteractiveRepository(interactiveDAO, interactiveCache)
-	interactiveService := service.NewInteractiveService(interactiveRepository)
-	articleHandler := web.NewArticleHandler(articleService, interactiveService)
+	collectionDAO := dao.NewGORMCollectionDAO(db)
+	collectionRepository := repository.NewCachedCollectionRepository(collectionDAO, interactiveCache)
+	interactiveService := service.NewInteractiveService(interactiveRepository, collectionRepository)
+	rankingRedisCache := cache.NewRankingRedisCache(cmdable)
+	rankingLocalCache := cache.NewRankingLocalCache()
+	rankingRepository := repository.NewCachedRankingRepository(rankingRedisCache, rankingLocalCache)
+	rankingZSetCache := cache.NewRankingRedisZSetCache(cmdable)
+	realTimeRankingRepository := repository.NewCachedRealTimeRankingRepository(rankingZSetCache)
+	v := ioc.InitRankingBoards()
+	rankingService := ioc.InitRankingService(interactiveService, articleService, rankingRepository, realTimeRankingRepository, v)
+	commentDAO := dao.NewGORMCommentDAO(db)
+	commentCache := cache.NewCommentRedisCache(cmdable)
+	commentRepository := repository.NewCachedCommentRepository(commentDAO, commentCache)
+	commentService := service.NewCommentService(commentRepository, articleRepository)
+	followDAO := dao.NewGORMFollowDAO(db)
+	followCache := cache.NewFollowRedisCache(cmdable)
+	followRepository := repository.NewCachedFollowRepository(followDAO, followCache)
+	followService := service.NewFollowService(followRepository, userRepository)
+	articleHandler := web.NewArticleHandler(articleService, interactiveService, rankingService, commentService, followService)
 	return articleHandler
 }
 
@@ -87,7 +141,9 @@ func InitInteractiveService() service.InteractiveService {
 	cmdable := InitRedis()
 	interactiveCache := cache.NewInteractiveRedisCache(cmdable)
 	interactiveRepository := repository.NewCachedInteractiveRepository(interactiveDAO, interactiveCache)
-	interactiveService := service.NewInteractiveService(interactiveRepository)
+	collectionDAO := dao.NewGORMCollectionDAO(db)
+	collectionRepository := repository.NewCachedCollectionRepository(collectionDAO, interactiveCache)
+	interactiveService := service.NewInteractiveService(interactiveRepository, collectionRepository)
 	return interactiveService
 }
 
@@ -95,7 +151,7 @@ func InitInteractiveService() service.InteractiveService {
 
 // 第三方基础依赖
 var thirdPartySet = wire.NewSet(
-	InitRedis, ioc.InitDB, InitSaramaClient,
+	InitRedis, ioc.InitDB, InitBroker,
 	InitSyncProducer,
 )
 
@@ -103,6 +159,16 @@ var userSvcProvider = wire.NewSet(dao.NewUserDAO, cache.NewUserCache, repository
 
 var articlSvcProvider = wire.NewSet(repository.NewCacheArticleRepository, cache.NewArticleRedisCache, dao.NewGORMArticleDAO, service.NewArticleService, article.NewSaramaSyncProducer)
 
-var interactiveSvcSet = wire.NewSet(dao.NewGORMInteractiveDAO, cache.NewInteractiveRedisCache, repository.NewCachedInteractiveRepository, service.NewInteractiveService)
+var interactiveSvcSet = wire.NewSet(dao.NewGORMInteractiveDAO, cache.NewInteractiveRedisCache, repository.NewCachedInteractiveRepository, dao.NewGORMCollectionDAO, repository.NewCachedCollectionRepository, service.NewInteractiveService)
+
+var rankingSvcSet = wire.NewSet(cache.NewRankingRedisCache, cache.NewRankingLocalCache, cache.NewRankingRedisZSetCache, repository.NewCachedRankingRepository, repository.NewCachedRealTimeRankingRepository, ioc.InitRankingBoards, ioc.InitRankingService)
+
+var commentSvcSet = wire.NewSet(dao.NewGORMCommentDAO, cache.NewCommentRedisCache, repository.NewCachedCommentRepository, service.NewCommentService)
+
+var followSvcSet = wire.NewSet(dao.NewGORMFollowDAO, cache.NewFollowRedisCache, repository.NewCachedFollowRepository, service.NewFollowService)
+
+var feedSvcSet = wire.NewSet(dao.NewGORMFeedDAO, repository.NewInboxFeedRepository, ioc.InitFeedService)
+
+var historySvcSet = wire.NewSet(ioc.InitReadHistoryCache, repository.NewRedisReadHistoryRepository, service.NewReadHistoryService)
 
 var jobProviderSet = wire.NewSet(service.NewCronJobService, repository.NewPreemptJobRepository, dao.NewGORMJobDAO)
@@ -0,0 +1,41 @@
+package job
+
+import (
+	"context"
+	"github.com/Tuanzi-bug/tuan-book/internal/domain"
+	"github.com/Tuanzi-bug/tuan-book/internal/service"
+	"github.com/Tuanzi-bug/tuan-book/pkg/log"
+	"time"
+)
+
+// ScheduledPublishExecutor 发表到期的定时文章，依赖 Scheduler 的抢占保证同一时刻只有一个节点在执行
+type ScheduledPublishExecutor struct {
+	svc       service.ArticleService
+	batchSize int
+}
+
+func NewScheduledPublishExecutor(svc service.ArticleService) *ScheduledPublishExecutor {
+	return &ScheduledPublishExecutor{svc: svc, batchSize: 100}
+}
+
+func (e *ScheduledPublishExecutor) Name() string {
+	return "scheduled_publish"
+}
+
+func (e *ScheduledPublishExecutor) Exec(ctx context.Context, j domain.Job) error {
+	now := time.Now()
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		cnt, err := e.svc.PublishDue(ctx, now, e.batchSize)
+		if err != nil {
+			return err
+		}
+		log.Debug("发表定时文章", log.String("name", j.Name), log.Int("cnt", cnt))
+		// 一批都没有发表成功的话，说明剩下的要么没有了，要么一直失败，留给下一轮
+		if cnt < e.batchSize {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package job
+
+import (
+	"context"
+	"github.com/Tuanzi-bug/tuan-book/internal/domain"
+	"github.com/Tuanzi-bug/tuan-book/internal/service"
+	"github.com/Tuanzi-bug/tuan-book/pkg/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"sync/atomic"
+)
+
+var (
+	reconcileScanned = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tuan_book",
+		Subsystem: "interactive",
+		Name:      "reconcile_scanned_total",
+		Help:      "交互数据对账扫描的行数",
+	})
+	reconcileDrift = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tuan_book",
+		Subsystem: "interactive",
+		Name:      "reconcile_drift_total",
+		Help:      "交互数据对账发现的不一致",
+	}, []string{"source", "field"})
+)
+
+func init() {
+	prometheus.MustRegister(reconcileScanned, reconcileDrift)
+}
+
+// InteractiveReconcileExecutor 定时对账交互数据：点赞数、收藏数以明细表为准，修复数据库和缓存。
+// 每次最多扫描 maxRows 行，下一次接着上一次的位置继续，扫完一轮之后从头开始
+type InteractiveReconcileExecutor struct {
+	svc       service.InteractiveService
+	batchSize int
+	maxRows   int
+	// 下一次从哪一行开始扫描，只在本地内存里面，换了节点就从头开始
+	cursor atomic.Int64
+}
+
+func NewInteractiveReconcileExecutor(svc service.InteractiveService, batchSize int, maxRows int) *InteractiveReconcileExecutor {
+	return &InteractiveReconcileExecutor{
+		svc:       svc,
+		batchSize: batchSize,
+		maxRows:   maxRows,
+	}
+}
+
+func (e *InteractiveReconcileExecutor) Name() string {
+	return "interactive_reconcile"
+}
+
+func (e *InteractiveReconcileExecutor) Exec(ctx context.Context, j domain.Job) error {
+	cursor := e.cursor.Load()
+	for scanned := 0; scanned < e.maxRows; {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		res, err := e.svc.Reconcile(ctx, cursor, e.batchSize)
+		if err != nil {
+			return err
+		}
+		reconcileScanned.Add(float64(res.Scanned))
+		for _, d := range res.Drifts {
+			reconcileDrift.WithLabelValues(d.Source, d.Field).Inc()
+			log.Warn("交互数据不一致", log.String("biz", d.Biz), log.Int64("bizId", d.BizId),
+				log.String("source", d.Source), log.String("field", d.Field),
+				log.Int64("expected", d.Expected), log.Int64("actual", d.Actual))
+		}
+		scanned += res.Scanned
+		if res.Scanned < e.batchSize {
+			// 扫完一轮了，下一次从头开始
+			cursor = 0
+			break
+		}
+		cursor = res.LastId
+	}
+	e.cursor.Store(cursor)
+	log.Debug("交互数据对账", log.String("name", j.Name), log.Int64("cursor", cursor))
+	return nil
+}
@@ -6,7 +6,9 @@ import (
 	"github.com/Tuanzi-bug/tuan-book/internal/domain"
 	"github.com/Tuanzi-bug/tuan-book/internal/service"
 	"github.com/Tuanzi-bug/tuan-book/pkg/log"
+	"github.com/prometheus/client_golang/prometheus"
 	"golang.org/x/sync/semaphore"
+	"os"
 	"time"
 )
 
@@ -41,10 +43,26 @@ func NewLocalFuncExecutor() *LocalFuncExecutor {
 	return &LocalFuncExecutor{funcs: make(map[string]func(ctx context.Context, j domain.Job) error)}
 }
 
+// reclaimedVec 从挂掉的节点那里回收的任务
+var reclaimedVec = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "tuan_book",
+	Subsystem: "job",
+	Name:      "reclaimed_total",
+	Help:      "租约过期被回收的任务",
+}, []string{"name"})
+
+func init() {
+	prometheus.MustRegister(reclaimedVec)
+}
+
 type Scheduler struct {
 	dbTimeout time.Duration
+	// 没有可以抢占的任务时，等待多久再试
+	interval  time.Duration
 	svc       service.CronJobService
 	executors map[string]Executor
+	// node 抢占任务的时候作为租约的持有者，也记录在执行记录里面
+	node string
 
 	// 信号量，限制并发执行的任务数量
 	limiter *semaphore.Weighted
@@ -53,12 +71,23 @@ type Scheduler struct {
 func NewScheduler(svc service.CronJobService) *Scheduler {
 	return &Scheduler{
 		dbTimeout: time.Second,
+		interval:  time.Second,
 		svc:       svc,
 		executors: make(map[string]Executor),
+		node:      nodeName(),
 		limiter:   semaphore.NewWeighted(100),
 	}
 }
 
+// nodeName 主机名加上进程 id，同一台机器上可能有多个实例
+func nodeName() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
 func (s *Scheduler) RegisterExecutor(executor Executor) {
 	s.executors[executor.Name()] = executor
 }
@@ -74,37 +103,68 @@ func (s *Scheduler) Schedule(ctx context.Context) error {
 		}
 		dbCtx, cancel := context.WithTimeout(ctx, s.dbTimeout)
 		// 从数据库中获取一个任务
-		j, err := s.svc.Preempt(dbCtx)
-		//cancel()
+		j, err := s.svc.Preempt(dbCtx, s.node)
+		cancel()
 		if err != nil {
+			// 没有任务或者数据库出错，歇一会再抢
+			s.limiter.Release(1)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(s.interval):
+			}
 			continue
 		}
-		// 调度执行
-		executor, ok := s.executors[j.Executor]
-		if !ok {
-			log.Error("未找到执行器", log.String("executor", j.Executor))
-			continue
+		if j.ReclaimedFrom != "" {
+			reclaimedVec.WithLabelValues(j.Name).Inc()
 		}
+		// 调度执行
 		go func() {
 			defer func() {
 				s.limiter.Release(1)
 				// 释放资源
 				j.CancelFunc()
 			}()
-			// 执行任务
-			er := executor.Exec(ctx, j)
-			log.Debug("执行任务", log.String("name", j.Name), log.Err(er))
-			if er != nil {
-				log.Error("执行任务失败", log.Err(er))
-				return
-			}
-			ctx, cancel = context.WithTimeout(context.Background(), time.Second)
-			defer cancel()
-			// 执行成功，更新任务状态
-			er = s.svc.ResetNextTime(ctx, j)
-			if er != nil {
-				log.Error("更新任务状态失败", log.Err(er))
-			}
+			s.run(ctx, j)
 		}()
 	}
 }
+
+// run 执行任务并且记录执行结果，不管成功还是失败都要更新下一次执行的时间，
+// 否则失败的任务释放之后马上又会被抢占
+func (s *Scheduler) run(ctx context.Context, j domain.Job) {
+	dbCtx, cancel := context.WithTimeout(context.Background(), s.dbTimeout)
+	runId, err := s.svc.StartRun(dbCtx, j, s.node)
+	cancel()
+	if err != nil {
+		// 执行记录只是用来排查问题的，记录失败也继续执行
+		log.Error("记录任务执行失败", log.Err(err), log.Int64("id", j.Id))
+	}
+
+	var er error
+	executor, ok := s.executors[j.Executor]
+	if ok {
+		er = executor.Exec(ctx, j)
+	} else {
+		er = fmt.Errorf("未找到执行器 %s", j.Executor)
+	}
+	log.Debug("执行任务", log.String("name", j.Name), log.Err(er))
+
+	dbCtx, cancel = context.WithTimeout(context.Background(), s.dbTimeout)
+	defer cancel()
+	if runId > 0 {
+		if err = s.svc.FinishRun(dbCtx, runId, er); err != nil {
+			log.Error("记录任务执行结果失败", log.Err(err), log.Int64("id", j.Id))
+		}
+	}
+	if er != nil {
+		log.Error("执行任务失败", log.Err(er), log.Int64("id", j.Id))
+		err = s.svc.Fail(dbCtx, j, s.node)
+	} else {
+		// 执行成功，更新任务状态
+		err = s.svc.ResetNextTime(dbCtx, j, s.node)
+	}
+	if err != nil {
+		log.Error("更新任务状态失败", log.Err(err), log.Int64("id", j.Id))
+	}
+}
@@ -0,0 +1,46 @@
+package job
+
+import (
+	"context"
+	"github.com/Tuanzi-bug/tuan-book/internal/domain"
+	"github.com/Tuanzi-bug/tuan-book/internal/repository"
+	"github.com/Tuanzi-bug/tuan-book/pkg/log"
+	"time"
+)
+
+// OutboxCleanupExecutor 删除已经发送成功的 outbox 消息，保留一段时间方便排查问题
+type OutboxCleanupExecutor struct {
+	repo      repository.OutboxRepository
+	retention time.Duration
+	// 每次删除多少行
+	batchSize int
+}
+
+func NewOutboxCleanupExecutor(repo repository.OutboxRepository, retention time.Duration) *OutboxCleanupExecutor {
+	return &OutboxCleanupExecutor{
+		repo:      repo,
+		retention: retention,
+		batchSize: 1000,
+	}
+}
+
+func (e *OutboxCleanupExecutor) Name() string {
+	return "outbox_cleanup"
+}
+
+func (e *OutboxCleanupExecutor) Exec(ctx context.Context, j domain.Job) error {
+	before := time.Now().Add(-e.retention)
+	var total int64
+	for {
+		cnt, err := e.repo.DeleteDelivered(ctx, before, e.batchSize)
+		if err != nil {
+			return err
+		}
+		total += cnt
+		if cnt < int64(e.batchSize) {
+			break
+		}
+	}
+	log.Debug("清理 outbox 消息", log.String("name", j.Name), log.Int64("cnt", total))
+	return nil
+}
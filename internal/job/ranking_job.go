@@ -2,6 +2,7 @@ package job
 
 import (
 	"context"
+	"fmt"
 	"github.com/Tuanzi-bug/tuan-book/internal/service"
 	"github.com/Tuanzi-bug/tuan-book/pkg/log"
 	rlock "github.com/gotomicro/redis-lock"
@@ -12,10 +13,12 @@ import (
 /*
 目前多个节点都会进行计算，目前保证一个时刻只有一个节点进行计算。
 使用分布式锁，保证只有一个节点进行计算。
+每一个榜单都是一个单独的任务，使用各自的分布式锁。
 */
 
 type RankingJob struct {
 	svc       service.RankingService
+	board     string
 	timeout   time.Duration
 	client    *rlock.Client
 	lock      *rlock.Lock
@@ -24,10 +27,11 @@ type RankingJob struct {
 }
 
 func (r *RankingJob) Name() string {
-	return "RankingJob"
+	return "RankingJob:" + r.board
 }
 
 func (r *RankingJob) Run() error {
+	r.localLock.Lock()
 	lock := r.lock
 	// 为了保证其他实例不会去计算热榜，扩大加锁的范围，保证只有一个节点进行计算
 	if lock == nil {
@@ -35,13 +39,14 @@ func (r *RankingJob) Run() error {
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second*4)
 		defer cancel()
 		// 设置重试策略：重试3次，每次间隔100微秒
-		lock, err := r.client.Lock(ctx, r.key, r.timeout, &rlock.FixIntervalRetry{
+		var err error
+		lock, err = r.client.Lock(ctx, r.key, r.timeout, &rlock.FixIntervalRetry{
 			Interval: time.Microsecond * 100,
 			Max:      3,
 		}, time.Second)
 		if err != nil {
 			r.localLock.Unlock()
-			log.Warn("获取分布式锁失败", log.Err(err))
+			log.Warn("获取分布式锁失败", log.String("board", r.board), log.Err(err))
 			return nil
 		}
 		// 拿到分布式锁
@@ -56,26 +61,33 @@ func (r *RankingJob) Run() error {
 				r.localLock.Unlock()
 			}
 		}()
+	} else {
+		r.localLock.Unlock()
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
 	defer cancel()
-	return r.svc.TopN(ctx)
+	return r.svc.TopN(ctx, r.board)
 }
 
 // Close 考虑关闭的时候，释放锁
 func (r *RankingJob) Close() error {
 	r.localLock.Lock()
 	lock := r.lock
+	r.lock = nil
 	r.localLock.Unlock()
+	if lock == nil {
+		return nil
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
 	return lock.Unlock(ctx)
 }
 
-func NewRankingJob(svc service.RankingService, timeout time.Duration, client *rlock.Client) Job {
+func NewRankingJob(svc service.RankingService, board string, timeout time.Duration, client *rlock.Client) *RankingJob {
 	return &RankingJob{
 		svc:       svc,
-		key:       "rlock:corn:ranking-job",
+		board:     board,
+		key:       fmt.Sprintf("rlock:cron:ranking-job:%s", board),
 		timeout:   timeout,
 		client:    client,
 		localLock: &sync.Mutex{},
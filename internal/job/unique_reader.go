@@ -0,0 +1,35 @@
+package job
+
+import (
+	"context"
+	"github.com/Tuanzi-bug/tuan-book/internal/domain"
+	"github.com/Tuanzi-bug/tuan-book/internal/service"
+	"github.com/Tuanzi-bug/tuan-book/pkg/log"
+	"time"
+)
+
+// UniqueReaderSyncExecutor 把 redis 里面的每日独立读者数同步到数据库
+type UniqueReaderSyncExecutor struct {
+	svc service.UniqueReaderService
+}
+
+func NewUniqueReaderSyncExecutor(svc service.UniqueReaderService) *UniqueReaderSyncExecutor {
+	return &UniqueReaderSyncExecutor{svc: svc}
+}
+
+func (e *UniqueReaderSyncExecutor) Name() string {
+	return "unique_reader_sync"
+}
+
+func (e *UniqueReaderSyncExecutor) Exec(ctx context.Context, j domain.Job) error {
+	now := time.Now()
+	// 零点前后的阅读可能还没有同步，昨天的也要再同步一次
+	for _, day := range []time.Time{now.AddDate(0, 0, -1), now} {
+		cnt, err := e.svc.Sync(ctx, day)
+		if err != nil {
+			return err
+		}
+		log.Debug("同步独立读者数", log.String("name", j.Name), log.Int("cnt", cnt))
+	}
+	return nil
+}
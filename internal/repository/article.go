@@ -8,9 +8,16 @@ import (
 	"github.com/Tuanzi-bug/tuan-book/pkg/log"
 	"github.com/ecodeclub/ekit/slice"
 	"go.uber.org/zap"
+	"slices"
 	"time"
 )
 
+var (
+	ErrArticleNotFound     = dao.ErrRecordNotFound
+	ErrRevisionNotFound    = dao.ErrRecordNotFound
+	ErrArticleNotScheduled = dao.ErrArticleNotScheduled
+)
+
 //go:generate mockgen -source=./article.go -package=repomocks -destination=./mocks/article.mock.go ArticleRepository
 type ArticleRepository interface {
 	Create(ctx context.Context, art domain.Article) (int64, error)
@@ -21,8 +28,22 @@ type ArticleRepository interface {
 	GetById(ctx context.Context, id int64) (domain.Article, error)
 	GetPubById(ctx context.Context, id int64) (domain.Article, error)
 	ListPub(ctx context.Context, start time.Time, offset int, limit int) ([]domain.Article, error)
+	GetPubByIds(ctx context.Context, ids []int64) ([]domain.Article, error)
+	ListRevisions(ctx context.Context, aid int64, offset int, limit int) ([]domain.ArticleRevision, error)
+	GetRevision(ctx context.Context, id int64) (domain.ArticleRevision, error)
+	ListDueScheduled(ctx context.Context, now time.Time, limit int) ([]domain.Article, error)
+	PublishScheduled(ctx context.Context, id int64, now time.Time) (domain.Article, error)
+	Reschedule(ctx context.Context, uid int64, id int64, publishAt time.Time) error
+	CancelSchedule(ctx context.Context, uid int64, id int64) error
+	AuthorTags(ctx context.Context, uid int64, exceptAid int64) ([]string, error)
+	ListPubByTag(ctx context.Context, tag string, cursor int64, limit int) ([]domain.Article, error)
+	// ListPubByAuthors 按照第一次发表的时间倒序，before 为零值表示第一页
+	ListPubByAuthors(ctx context.Context, uids []int64, before domain.FeedCursor, limit int) ([]domain.Article, error)
 }
 
+// tagFirstPageSize 按标签浏览的第一页缓存多少篇文章
+const tagFirstPageSize = 50
+
 type CacheArticleRepository struct {
 	dao   dao.ArticleDAO
 	cache cache.ArticleCache
@@ -41,6 +62,48 @@ func (repo *CacheArticleRepository) ListPub(ctx context.Context, start time.Time
 	}), nil
 }
 
+func (repo *CacheArticleRepository) ListPubByAuthors(ctx context.Context, uids []int64, before domain.FeedCursor, limit int) ([]domain.Article, error) {
+	var beforeMs int64
+	if !before.Ctime.IsZero() {
+		beforeMs = before.Ctime.UnixMilli()
+	}
+	arts, err := repo.dao.ListPubByAuthors(ctx, uids, beforeMs, before.Aid, limit)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map[dao.PublishedArticle, domain.Article](arts, func(idx int, src dao.PublishedArticle) domain.Article {
+		return repo.toDomain(dao.Article(src))
+	}), nil
+}
+
+func (repo *CacheArticleRepository) GetPubByIds(ctx context.Context, ids []int64) ([]domain.Article, error) {
+	arts, err := repo.dao.GetPubByIds(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map[dao.PublishedArticle, domain.Article](arts, func(idx int, src dao.PublishedArticle) domain.Article {
+		return repo.toDomain(dao.Article(src))
+	}), nil
+}
+
+func (repo *CacheArticleRepository) ListRevisions(ctx context.Context, aid int64, offset int, limit int) ([]domain.ArticleRevision, error) {
+	revs, err := repo.dao.ListRevisions(ctx, aid, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map[dao.ArticleRevision, domain.ArticleRevision](revs, func(idx int, src dao.ArticleRevision) domain.ArticleRevision {
+		return repo.revisionToDomain(src)
+	}), nil
+}
+
+func (repo *CacheArticleRepository) GetRevision(ctx context.Context, id int64) (domain.ArticleRevision, error) {
+	rev, err := repo.dao.GetRevision(ctx, id)
+	if err != nil {
+		return domain.ArticleRevision{}, err
+	}
+	return repo.revisionToDomain(rev), nil
+}
+
 func NewCacheArticleRepository(dao dao.ArticleDAO, articleCache cache.ArticleCache, userRepo UserRepository) ArticleRepository {
 	return &CacheArticleRepository{
 		dao:      dao,
@@ -63,24 +126,156 @@ func (repo *CacheArticleRepository) Create(ctx context.Context, art domain.Artic
 func (repo *CacheArticleRepository) Update(ctx context.Context, art domain.Article) error {
 	err := repo.dao.UpdateById(ctx, repo.toEntity(art))
 	if err == nil {
-		er := repo.cache.DelFirstPage(ctx, art.Author.Id)
-		if er != nil {
-			log.Error("Update 删除缓存失败", zap.Error(er), zap.Int64("uid", art.Author.Id))
-		}
+		repo.invalidate(ctx, art.Author.Id, art.Id)
 	}
 	return err
 }
 
 func (repo *CacheArticleRepository) Sync(ctx context.Context, art domain.Article) (int64, error) {
+	// 第一次发表的时候还没有线上库的标签
+	oldTags := repo.pubTags(ctx, art.Id)
 	id, err := repo.dao.Sync(ctx, repo.toEntity(art))
+	if err != nil {
+		return id, err
+	}
+	repo.invalidate(ctx, art.Author.Id, id)
+	art.Id = id
+	art.Tags = repo.invalidateTags(ctx, id, oldTags...)
+	repo.warmPub(art)
+	return id, nil
+}
+
+func (repo *CacheArticleRepository) SyncStatus(ctx context.Context, uid int64, id int64, status domain.ArticleStatus) error {
+	err := repo.dao.SyncStatus(ctx, uid, id, status.ToUint8())
 	if err == nil {
-		er := repo.cache.DelFirstPage(ctx, art.Author.Id)
+		repo.invalidate(ctx, uid, id)
+		// 线上库的状态也变了，例如撤回之后不能再从缓存里读到
+		er := repo.cache.DelPub(ctx, id)
 		if er != nil {
-			// 也要记录日志
-			log.Error("Sync 删除缓存失败", zap.Error(er), zap.Int64("uid", art.Author.Id))
+			log.Error("SyncStatus 删除线上库缓存失败", zap.Error(er), zap.Int64("id", id))
 		}
+		repo.invalidateTags(ctx, id)
 	}
-	// 当新帖子发布时候，就会被人访问，考虑当做缓存预热
+	return err
+}
+
+func (repo *CacheArticleRepository) ListDueScheduled(ctx context.Context, now time.Time, limit int) ([]domain.Article, error) {
+	arts, err := repo.dao.ListDueScheduled(ctx, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map[dao.Article, domain.Article](arts, func(idx int, src dao.Article) domain.Article {
+		return repo.toDomain(src)
+	}), nil
+}
+
+func (repo *CacheArticleRepository) PublishScheduled(ctx context.Context, id int64, now time.Time) (domain.Article, error) {
+	oldTags := repo.pubTags(ctx, id)
+	art, err := repo.dao.PublishScheduled(ctx, id, now)
+	if err != nil {
+		return domain.Article{}, err
+	}
+	res := repo.toDomain(art)
+	repo.invalidate(ctx, res.Author.Id, id)
+	res.Tags = repo.invalidateTags(ctx, id, oldTags...)
+	repo.warmPub(res)
+	return res, nil
+}
+
+func (repo *CacheArticleRepository) Reschedule(ctx context.Context, uid int64, id int64, publishAt time.Time) error {
+	err := repo.dao.UpdateSchedule(ctx, uid, id, publishAt.UnixMilli())
+	if err == nil {
+		repo.invalidate(ctx, uid, id)
+	}
+	return err
+}
+
+func (repo *CacheArticleRepository) CancelSchedule(ctx context.Context, uid int64, id int64) error {
+	err := repo.dao.CancelSchedule(ctx, uid, id)
+	if err == nil {
+		repo.invalidate(ctx, uid, id)
+	}
+	return err
+}
+
+// invalidate 制作库发生变化之后，删除创作者的第一页缓存和文章详情缓存
+func (repo *CacheArticleRepository) invalidate(ctx context.Context, uid int64, id int64) {
+	er := repo.cache.DelFirstPage(ctx, uid)
+	if er != nil {
+		log.Error("删除第一页缓存失败", zap.Error(er), zap.Int64("uid", uid))
+	}
+	er = repo.cache.Del(ctx, id)
+	if er != nil {
+		log.Error("删除文章缓存失败", zap.Error(er), zap.Int64("id", id))
+	}
+}
+
+// invalidateTags 线上库发生变化之后，删除文章现在的标签和 oldTags 的第一页缓存，返回线上库的标签。
+// 去掉的标签只在 oldTags 里面，不删的话旧标签的第一页还能看到这篇文章
+func (repo *CacheArticleRepository) invalidateTags(ctx context.Context, id int64, oldTags ...string) []string {
+	tags, er := repo.dao.GetPubTags(ctx, id)
+	if er != nil {
+		log.Error("查询文章标签失败", zap.Error(er), zap.Int64("id", id))
+	}
+	er = repo.cache.DelTagFirstPage(ctx, slice.UnionSet(tags, oldTags)...)
+	if er != nil {
+		log.Error("删除标签第一页缓存失败", zap.Error(er), zap.Int64("id", id))
+	}
+	return tags
+}
+
+// pubTags 修改线上库之前先查出来旧的标签，查询失败只记录日志
+func (repo *CacheArticleRepository) pubTags(ctx context.Context, id int64) []string {
+	if id == 0 {
+		return nil
+	}
+	tags, er := repo.dao.GetPubTags(ctx, id)
+	if er != nil {
+		log.Error("查询文章旧标签失败", zap.Error(er), zap.Int64("id", id))
+	}
+	return tags
+}
+
+func (repo *CacheArticleRepository) AuthorTags(ctx context.Context, uid int64, exceptAid int64) ([]string, error) {
+	return repo.dao.AuthorTags(ctx, uid, exceptAid)
+}
+
+func (repo *CacheArticleRepository) ListPubByTag(ctx context.Context, tag string, cursor int64, limit int) ([]domain.Article, error) {
+	// 第一页只要不超过缓存的大小都可以走缓存
+	if cursor == 0 && limit <= tagFirstPageSize {
+		res, err := repo.cache.GetTagFirstPage(ctx, tag)
+		if err == nil {
+			return res[:min(limit, len(res))], nil
+		}
+		arts, err := repo.listPubByTag(ctx, tag, 0, tagFirstPageSize)
+		if err != nil {
+			return nil, err
+		}
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			er := repo.cache.SetTagFirstPage(ctx, tag, slices.Clone(arts))
+			if er != nil {
+				log.Error("标签第一页缓存写入失败", zap.Error(er), zap.String("tag", tag))
+			}
+		}()
+		return arts[:min(limit, len(arts))], nil
+	}
+	return repo.listPubByTag(ctx, tag, cursor, limit)
+}
+
+func (repo *CacheArticleRepository) listPubByTag(ctx context.Context, tag string, cursor int64, limit int) ([]domain.Article, error) {
+	arts, err := repo.dao.ListPubByTag(ctx, tag, cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map[dao.PublishedArticle, domain.Article](arts, func(idx int, src dao.PublishedArticle) domain.Article {
+		return repo.toDomain(dao.Article(src))
+	}), nil
+}
+
+// warmPub 当新帖子发布时候，就会被人访问，考虑当做缓存预热
+func (repo *CacheArticleRepository) warmPub(art domain.Article) {
 	go func() {
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 		defer cancel()
@@ -96,22 +291,9 @@ func (repo *CacheArticleRepository) Sync(ctx context.Context, art domain.Article
 		}
 		er = repo.cache.SetPub(ctx, art)
 		if er != nil {
-			log.Error("Sync 预热缓存失败", zap.Error(er), zap.Int64("id", art.Id))
+			log.Error("预热缓存失败", zap.Error(er), zap.Int64("id", art.Id))
 		}
 	}()
-
-	return id, err
-}
-
-func (repo *CacheArticleRepository) SyncStatus(ctx context.Context, uid int64, id int64, status domain.ArticleStatus) error {
-	err := repo.dao.SyncStatus(ctx, uid, id, status.ToUint8())
-	if err == nil {
-		er := repo.cache.DelFirstPage(ctx, uid)
-		if er != nil {
-			log.Error("SyncStatus 删除缓存失败", zap.Error(er), zap.Int64("uid", uid))
-		}
-	}
-	return err
 }
 
 func (repo *CacheArticleRepository) GetByAuthor(ctx context.Context, uid int64, offset int, limit int) ([]domain.Article, error) {
@@ -165,6 +347,10 @@ func (repo *CacheArticleRepository) GetById(ctx context.Context, id int64) (doma
 		return domain.Article{}, err
 	}
 	res = repo.toDomain(art)
+	res.Tags, err = repo.dao.GetTags(ctx, id)
+	if err != nil {
+		return domain.Article{}, err
+	}
 	// 缓存数据
 	go func() {
 
@@ -187,6 +373,10 @@ func (repo *CacheArticleRepository) GetPubById(ctx context.Context, id int64) (d
 		return domain.Article{}, err
 	}
 	res = repo.toDomain(dao.Article(art))
+	res.Tags, err = repo.dao.GetPubTags(ctx, id)
+	if err != nil {
+		return domain.Article{}, err
+	}
 	// 还需要获取创作者的信息
 	author, err := repo.userRepo.FindById(ctx, art.AuthorId)
 	if err != nil {
@@ -219,25 +409,47 @@ func (repo *CacheArticleRepository) preCache(ctx context.Context, arts []domain.
 }
 
 func (repo *CacheArticleRepository) toDomain(art dao.Article) domain.Article {
-	return domain.Article{
+	res := domain.Article{
 		Id:      art.Id,
 		Title:   art.Title,
 		Content: art.Content,
 		Author: domain.Author{
-			Id: art.Id,
+			Id: art.AuthorId,
 		},
 		Ctime:  time.UnixMilli(art.Ctime),
 		Utime:  time.UnixMilli(art.Utime),
 		Status: domain.ArticleStatus(art.Status),
 	}
+	if art.PublishAt > 0 {
+		res.PublishAt = time.UnixMilli(art.PublishAt)
+	}
+	return res
+}
+
+func (repo *CacheArticleRepository) revisionToDomain(rev dao.ArticleRevision) domain.ArticleRevision {
+	return domain.ArticleRevision{
+		Id:          rev.Id,
+		ArticleId:   rev.ArticleId,
+		Author:      domain.Author{Id: rev.AuthorId},
+		Title:       rev.Title,
+		Content:     rev.Content,
+		ContentHash: rev.ContentHash,
+		Status:      domain.ArticleStatus(rev.Status),
+		Ctime:       time.UnixMilli(rev.Ctime),
+	}
 }
 
 func (repo *CacheArticleRepository) toEntity(article domain.Article) dao.Article {
-	return dao.Article{
+	res := dao.Article{
 		Id:       article.Id,
 		Title:    article.Title,
 		Content:  article.Content,
 		AuthorId: article.Author.Id,
 		Status:   article.Status.ToUint8(),
+		Tags:     article.Tags,
+	}
+	if !article.PublishAt.IsZero() {
+		res.PublishAt = article.PublishAt.UnixMilli()
 	}
+	return res
 }
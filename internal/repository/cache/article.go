@@ -18,8 +18,14 @@ type ArticleCache interface {
 	// 进行业务预加载,相当于对于某些场景进行预测，预加载列表第一个详细数据
 	Get(ctx context.Context, id int64) (domain.Article, error)
 	Set(ctx context.Context, art domain.Article) error
+	Del(ctx context.Context, id int64) error
 	GetPub(ctx context.Context, id int64) (domain.Article, error)
 	SetPub(ctx context.Context, art domain.Article) error
+	DelPub(ctx context.Context, id int64) error
+	// 按标签浏览的第一页
+	GetTagFirstPage(ctx context.Context, tag string) ([]domain.Article, error)
+	SetTagFirstPage(ctx context.Context, tag string, arts []domain.Article) error
+	DelTagFirstPage(ctx context.Context, tags ...string) error
 }
 
 type ArticleRedisCache struct {
@@ -79,6 +85,10 @@ func (a *ArticleRedisCache) Set(ctx context.Context, art domain.Article) error {
 	return a.client.Set(ctx, a.key(art.Id), val, time.Minute*10).Err()
 }
 
+func (a *ArticleRedisCache) Del(ctx context.Context, id int64) error {
+	return a.client.Del(ctx, a.key(id)).Err()
+}
+
 func (a *ArticleRedisCache) GetPub(ctx context.Context, id int64) (domain.Article, error) {
 	val, err := a.client.Get(ctx, a.pubKey(id)).Result()
 	if err != nil {
@@ -99,10 +109,51 @@ func (a *ArticleRedisCache) SetPub(ctx context.Context, art domain.Article) erro
 	return a.client.Set(ctx, a.pubKey(art.Id), val, time.Minute*10).Err()
 }
 
+func (a *ArticleRedisCache) DelPub(ctx context.Context, id int64) error {
+	return a.client.Del(ctx, a.pubKey(id)).Err()
+}
+
+func (a *ArticleRedisCache) GetTagFirstPage(ctx context.Context, tag string) ([]domain.Article, error) {
+	val, err := a.client.Get(ctx, a.tagFirstKey(tag)).Bytes()
+	if err != nil {
+		return nil, err
+	}
+	var articles []domain.Article
+	err = json.Unmarshal(val, &articles)
+	return articles, err
+}
+
+func (a *ArticleRedisCache) SetTagFirstPage(ctx context.Context, tag string, articles []domain.Article) error {
+	for i := 0; i < len(articles); i++ {
+		articles[i].Content = articles[i].Abstract()
+	}
+	val, err := json.Marshal(articles)
+	if err != nil {
+		return err
+	}
+	// 文章的标签变化的时候新旧标签的缓存都会删掉，过期时间短一点是为了兜底删除失败的情况
+	return a.client.Set(ctx, a.tagFirstKey(tag), val, time.Minute*3).Err()
+}
+
+func (a *ArticleRedisCache) DelTagFirstPage(ctx context.Context, tags ...string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		keys = append(keys, a.tagFirstKey(tag))
+	}
+	return a.client.Del(ctx, keys...).Err()
+}
+
 func (a *ArticleRedisCache) firstKey(uid int64) string {
 	return fmt.Sprintf("article:first_page:%d", uid)
 }
 
+func (a *ArticleRedisCache) tagFirstKey(tag string) string {
+	return fmt.Sprintf("article:tag_first_page:%s", tag)
+}
+
 func (a *ArticleRedisCache) key(id int64) string {
 	return fmt.Sprintf("article:detail:%d", id)
 }
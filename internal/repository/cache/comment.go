@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Tuanzi-bug/tuan-book/internal/domain"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"time"
+)
+
+//go:generate mockgen -source=./comment.go -package=cachemocks -destination=./mocks/comment.mock.go CommentCache
+type CommentCache interface {
+	// 热门资源的第一页根评论，包括预先加载的回复
+	GetFirstPage(ctx context.Context, biz string, bizId int64) ([]domain.Comment, error)
+	SetFirstPage(ctx context.Context, biz string, bizId int64, cs []domain.Comment) error
+	DelFirstPage(ctx context.Context, biz string, bizId int64) error
+	// GetCnts 批量取评论数，缓存里面没有的 id 不会出现在结果里
+	GetCnts(ctx context.Context, biz string, bizIds []int64) (map[int64]int64, error)
+	SetCnts(ctx context.Context, biz string, cnts map[int64]int64) error
+	DelCnt(ctx context.Context, biz string, bizId int64) error
+}
+
+type CommentRedisCache struct {
+	client     redis.Cmdable
+	expiration time.Duration
+}
+
+func NewCommentRedisCache(client redis.Cmdable) CommentCache {
+	return &CommentRedisCache{client: client, expiration: time.Minute * 10}
+}
+
+func (c *CommentRedisCache) GetFirstPage(ctx context.Context, biz string, bizId int64) ([]domain.Comment, error) {
+	val, err := c.client.Get(ctx, c.firstKey(biz, bizId)).Bytes()
+	if err != nil {
+		return nil, err
+	}
+	var cs []domain.Comment
+	err = json.Unmarshal(val, &cs)
+	return cs, err
+}
+
+func (c *CommentRedisCache) SetFirstPage(ctx context.Context, biz string, bizId int64, cs []domain.Comment) error {
+	val, err := json.Marshal(cs)
+	if err != nil {
+		return err
+	}
+	return c.client.Set(ctx, c.firstKey(biz, bizId), val, c.expiration).Err()
+}
+
+func (c *CommentRedisCache) DelFirstPage(ctx context.Context, biz string, bizId int64) error {
+	return c.client.Del(ctx, c.firstKey(biz, bizId)).Err()
+}
+
+func (c *CommentRedisCache) GetCnts(ctx context.Context, biz string, bizIds []int64) (map[int64]int64, error) {
+	keys := make([]string, 0, len(bizIds))
+	for _, id := range bizIds {
+		keys = append(keys, c.cntKey(biz, id))
+	}
+	vals, err := c.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[int64]int64, len(bizIds))
+	for idx, val := range vals {
+		str, ok := val.(string)
+		if !ok {
+			continue
+		}
+		cnt, er := strconv.ParseInt(str, 10, 64)
+		if er != nil {
+			continue
+		}
+		res[bizIds[idx]] = cnt
+	}
+	return res, nil
+}
+
+func (c *CommentRedisCache) SetCnts(ctx context.Context, biz string, cnts map[int64]int64) error {
+	if len(cnts) == 0 {
+		return nil
+	}
+	pipe := c.client.Pipeline()
+	for id, cnt := range cnts {
+		pipe.Set(ctx, c.cntKey(biz, id), cnt, c.expiration)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (c *CommentRedisCache) DelCnt(ctx context.Context, biz string, bizId int64) error {
+	return c.client.Del(ctx, c.cntKey(biz, bizId)).Err()
+}
+
+func (c *CommentRedisCache) cntKey(biz string, bizId int64) string {
+	return fmt.Sprintf("comment:cnt:%s:%d", biz, bizId)
+}
+
+func (c *CommentRedisCache) firstKey(biz string, bizId int64) string {
+	return fmt.Sprintf("comment:first_page:%s:%d", biz, bizId)
+}
@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"github.com/Tuanzi-bug/tuan-book/internal/domain"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"time"
+)
+
+const fieldFollowers = "followers"
+const fieldFollowees = "followees"
+
+//go:generate mockgen -source=./follow.go -package=cachemocks -destination=./mocks/follow.mock.go FollowCache
+type FollowCache interface {
+	// Follow 关注者的关注数和被关注者的粉丝数加一，缓存不存在的时候什么都不做
+	Follow(ctx context.Context, follower, followee int64) error
+	Unfollow(ctx context.Context, follower, followee int64) error
+	GetStatistic(ctx context.Context, uid int64) (domain.FollowStatistic, error)
+	SetStatistic(ctx context.Context, s domain.FollowStatistic) error
+}
+
+type FollowRedisCache struct {
+	client     redis.Cmdable
+	expiration time.Duration
+}
+
+func NewFollowRedisCache(client redis.Cmdable) FollowCache {
+	return &FollowRedisCache{client: client, expiration: time.Minute * 15}
+}
+
+func (c *FollowRedisCache) Follow(ctx context.Context, follower, followee int64) error {
+	return c.incr(ctx, follower, followee, 1)
+}
+
+func (c *FollowRedisCache) Unfollow(ctx context.Context, follower, followee int64) error {
+	return c.incr(ctx, follower, followee, -1)
+}
+
+// incr 和交互数据一样，只在缓存存在的时候自增，不存在的等下次回查数据库
+func (c *FollowRedisCache) incr(ctx context.Context, follower, followee int64, delta int64) error {
+	err := c.client.Eval(ctx, luaIncrCnt, []string{c.key(follower)}, fieldFollowees, delta).Err()
+	if err != nil {
+		return err
+	}
+	return c.client.Eval(ctx, luaIncrCnt, []string{c.key(followee)}, fieldFollowers, delta).Err()
+}
+
+func (c *FollowRedisCache) GetStatistic(ctx context.Context, uid int64) (domain.FollowStatistic, error) {
+	res, err := c.client.HGetAll(ctx, c.key(uid)).Result()
+	if err != nil {
+		return domain.FollowStatistic{}, err
+	}
+	if len(res) == 0 {
+		return domain.FollowStatistic{}, ErrKeyNotExist
+	}
+	s := domain.FollowStatistic{Uid: uid}
+	// 这边是可以忽略错误的
+	s.Followers, _ = strconv.ParseInt(res[fieldFollowers], 10, 64)
+	s.Followees, _ = strconv.ParseInt(res[fieldFollowees], 10, 64)
+	return s, nil
+}
+
+func (c *FollowRedisCache) SetStatistic(ctx context.Context, s domain.FollowStatistic) error {
+	key := c.key(s.Uid)
+	err := c.client.HSet(ctx, key, map[string]any{
+		fieldFollowers: s.Followers,
+		fieldFollowees: s.Followees,
+	}).Err()
+	if err != nil {
+		return err
+	}
+	return c.client.Expire(ctx, key, c.expiration).Err()
+}
+
+func (c *FollowRedisCache) key(uid int64) string {
+	return fmt.Sprintf("follow:statistic:%d", uid)
+}
@@ -0,0 +1,97 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"github.com/Tuanzi-bug/tuan-book/internal/domain"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"time"
+)
+
+// ReadHistoryCache 每个用户一个 zset，member 是文章 ID，score 是阅读时间
+// 阅读记录只保存在 redis 里面，超过保留期限或者数量上限的会被清理掉
+//
+//go:generate mockgen -source=./history.go -package=cachemocks -destination=./mocks/history.mock.go ReadHistoryCache
+type ReadHistoryCache interface {
+	Add(ctx context.Context, records []domain.ReadRecord) error
+	// List 按照阅读时间倒序，before 是上一页最后一条的时间，0 表示第一页
+	List(ctx context.Context, uid int64, before int64, limit int) ([]domain.ReadRecord, error)
+	Clear(ctx context.Context, uid int64) error
+}
+
+type ReadHistoryRedisCache struct {
+	client redis.Cmdable
+	// 每个用户最多保留多少条
+	capacity int64
+	// 保留多长时间
+	retention time.Duration
+}
+
+func NewReadHistoryRedisCache(client redis.Cmdable, capacity int64, retention time.Duration) ReadHistoryCache {
+	return &ReadHistoryRedisCache{
+		client:    client,
+		capacity:  capacity,
+		retention: retention,
+	}
+}
+
+func (c *ReadHistoryRedisCache) Add(ctx context.Context, records []domain.ReadRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	// 同一个用户的记录放在一起，每个用户只需要清理一次
+	byUid := make(map[int64][]redis.Z, len(records))
+	for _, r := range records {
+		byUid[r.Uid] = append(byUid[r.Uid], redis.Z{
+			Score:  float64(r.Ctime.UnixMilli()),
+			Member: strconv.FormatInt(r.Aid, 10),
+		})
+	}
+	expired := strconv.FormatInt(time.Now().Add(-c.retention).UnixMilli(), 10)
+	pipe := c.client.Pipeline()
+	for uid, zs := range byUid {
+		key := c.key(uid)
+		pipe.ZAdd(ctx, key, zs...)
+		pipe.ZRemRangeByScore(ctx, key, "-inf", "("+expired)
+		// 只保留最新的 capacity 条
+		pipe.ZRemRangeByRank(ctx, key, 0, -c.capacity-1)
+		pipe.Expire(ctx, key, c.retention)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (c *ReadHistoryRedisCache) List(ctx context.Context, uid int64, before int64, limit int) ([]domain.ReadRecord, error) {
+	maxScore := "+inf"
+	if before > 0 {
+		maxScore = "(" + strconv.FormatInt(before, 10)
+	}
+	zs, err := c.client.ZRevRangeByScoreWithScores(ctx, c.key(uid), &redis.ZRangeBy{
+		Max:   maxScore,
+		Min:   "-inf",
+		Count: int64(limit),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.ReadRecord, 0, len(zs))
+	for _, z := range zs {
+		m, _ := z.Member.(string)
+		aid, er := strconv.ParseInt(m, 10, 64)
+		if er != nil {
+			// 不是我们写进去的数据，跳过
+			continue
+		}
+		res = append(res, domain.ReadRecord{Uid: uid, Aid: aid, Ctime: time.UnixMilli(int64(z.Score))})
+	}
+	return res, nil
+}
+
+func (c *ReadHistoryRedisCache) Clear(ctx context.Context, uid int64) error {
+	return c.client.Del(ctx, c.key(uid)).Err()
+}
+
+func (c *ReadHistoryRedisCache) key(uid int64) string {
+	return fmt.Sprintf("history:read:%d", uid)
+}
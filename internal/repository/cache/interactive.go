@@ -13,19 +13,28 @@ import (
 const fieldReadCnt = "read_cnt"
 const fieldLikeCnt = "like_cnt"
 const fieldCollectCnt = "collect_cnt"
+const fieldReaderCnt = "reader_cnt"
 
 var (
 	//go:embed lua/incr_cnt.lua
 	luaIncrCnt string
 )
 
+//go:generate mockgen -source=./interactive.go -package=cachemocks -destination=./mocks/interactive.mock.go InteractiveCache
 type InteractiveCache interface {
 	IncrReadCntIfPresent(ctx context.Context, biz string, bizId int64) error
+	IncrReaderCntIfPresent(ctx context.Context, biz string, bizId int64, delta int64) error
+	// BatchIncrReadCntIfPresent 三个切片一一对应，用 pipeline 一次发出去
+	BatchIncrReadCntIfPresent(ctx context.Context, bizs []string, bizIds []int64, cnts []int64) error
 	IncrLikeCntIfPresent(ctx context.Context, biz string, bizId int64) error
 	DecrLikeCntIfPresent(ctx context.Context, biz string, bizId int64) error
 	IncrCollectCntIfPresent(ctx context.Context, biz string, bizId int64) error
+	DecrCollectCntIfPresent(ctx context.Context, biz string, bizId int64) error
 	Get(ctx context.Context, biz string, id int64) (domain.Interactive, error)
+	// GetByIds 用 pipeline 一次取回，缓存里面没有的 id 不会出现在结果里
+	GetByIds(ctx context.Context, biz string, ids []int64) (map[int64]domain.Interactive, error)
 	Set(ctx context.Context, biz string, id int64, res domain.Interactive) error
+	Delete(ctx context.Context, biz string, id int64) error
 }
 
 type InteractiveRedisCache struct {
@@ -37,6 +46,7 @@ func (i *InteractiveRedisCache) Set(ctx context.Context, biz string, id int64, r
 		fieldCollectCnt: res.CollectCnt,
 		fieldLikeCnt:    res.LikeCnt,
 		fieldReadCnt:    res.ReadCnt,
+		fieldReaderCnt:  res.ReaderCnt,
 	}).Err()
 	if err != nil {
 		return err
@@ -45,6 +55,10 @@ func (i *InteractiveRedisCache) Set(ctx context.Context, biz string, id int64, r
 	return i.client.Expire(ctx, i.key(biz, id), time.Minute*15).Err()
 }
 
+func (i *InteractiveRedisCache) Delete(ctx context.Context, biz string, id int64) error {
+	return i.client.Del(ctx, i.key(biz, id)).Err()
+}
+
 func (i *InteractiveRedisCache) Get(ctx context.Context, biz string, id int64) (domain.Interactive, error) {
 	res, err := i.client.HGetAll(ctx, i.key(biz, id)).Result()
 	if err != nil {
@@ -53,18 +67,47 @@ func (i *InteractiveRedisCache) Get(ctx context.Context, biz string, id int64) (
 	if len(res) == 0 {
 		return domain.Interactive{}, ErrKeyNotExist
 	}
-	var intr domain.Interactive
+	return i.toDomain(id, res), nil
+}
+
+func (i *InteractiveRedisCache) GetByIds(ctx context.Context, biz string, ids []int64) (map[int64]domain.Interactive, error) {
+	pipe := i.client.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, 0, len(ids))
+	for _, id := range ids {
+		cmds = append(cmds, pipe.HGetAll(ctx, i.key(biz, id)))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	res := make(map[int64]domain.Interactive, len(ids))
+	for idx, cmd := range cmds {
+		val := cmd.Val()
+		if len(val) == 0 {
+			continue
+		}
+		res[ids[idx]] = i.toDomain(ids[idx], val)
+	}
+	return res, nil
+}
+
+func (i *InteractiveRedisCache) toDomain(id int64, res map[string]string) domain.Interactive {
+	intr := domain.Interactive{BizId: id}
 	// 这边是可以忽略错误的
 	intr.CollectCnt, _ = strconv.ParseInt(res[fieldCollectCnt], 10, 64)
 	intr.LikeCnt, _ = strconv.ParseInt(res[fieldLikeCnt], 10, 64)
 	intr.ReadCnt, _ = strconv.ParseInt(res[fieldReadCnt], 10, 64)
-	return intr, nil
+	intr.ReaderCnt, _ = strconv.ParseInt(res[fieldReaderCnt], 10, 64)
+	return intr
 }
 
 func (i *InteractiveRedisCache) IncrCollectCntIfPresent(ctx context.Context, biz string, bizId int64) error {
 	return i.client.Eval(ctx, luaIncrCnt, []string{i.key(biz, bizId)}, fieldCollectCnt, 1).Err()
 }
 
+func (i *InteractiveRedisCache) DecrCollectCntIfPresent(ctx context.Context, biz string, bizId int64) error {
+	return i.client.Eval(ctx, luaIncrCnt, []string{i.key(biz, bizId)}, fieldCollectCnt, -1).Err()
+}
+
 func (i *InteractiveRedisCache) IncrLikeCntIfPresent(ctx context.Context, biz string, bizId int64) error {
 	return i.client.Eval(ctx, luaIncrCnt, []string{i.key(biz, bizId)}, fieldLikeCnt, 1).Err()
 }
@@ -90,6 +133,22 @@ func (i *InteractiveRedisCache) IncrReadCntIfPresent(ctx context.Context, biz st
 	return i.client.Eval(ctx, luaIncrCnt, []string{i.key(biz, bizId)}, fieldReadCnt, 1).Err()
 }
 
+func (i *InteractiveRedisCache) BatchIncrReadCntIfPresent(ctx context.Context, bizs []string, bizIds []int64, cnts []int64) error {
+	if len(bizs) == 0 {
+		return nil
+	}
+	pipe := i.client.Pipeline()
+	for idx, biz := range bizs {
+		pipe.Eval(ctx, luaIncrCnt, []string{i.key(biz, bizIds[idx])}, fieldReadCnt, cnts[idx])
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (i *InteractiveRedisCache) IncrReaderCntIfPresent(ctx context.Context, biz string, bizId int64, delta int64) error {
+	return i.client.Eval(ctx, luaIncrCnt, []string{i.key(biz, bizId)}, fieldReaderCnt, delta).Err()
+}
+
 func NewInteractiveRedisCache(client redis.Cmdable) InteractiveCache {
 	return &InteractiveRedisCache{
 		client: client,
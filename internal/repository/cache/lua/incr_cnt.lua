@@ -8,8 +8,12 @@ local delta = tonumber(ARGV[2])
 -- 判断是否存在
 local exists = redis.call('EXISTS', key)
 if exists==1 then
-    redis.call('HINCRBY', key, cntKey, delta)
+    local val = redis.call('HINCRBY', key, cntKey, delta)
+    -- 计数不能是负数
+    if val < 0 then
+        redis.call('HSET', key, cntKey, 0)
+    end
     return 1
 else
     return 0
-end
\ No newline at end of file
+end
@@ -0,0 +1,33 @@
+-- 实时热榜的 zset
+local key = KEYS[1]
+-- 记录上一次衰减时间的 key
+local decayKey = KEYS[2]
+-- 当前时间，毫秒
+local now = tonumber(ARGV[1])
+-- 半衰期，毫秒，0 表示不衰减只裁剪
+local halfLife = tonumber(ARGV[2])
+-- 低于这个分数的直接移除
+local minScore = tonumber(ARGV[3])
+-- 最多保留多少个
+local capacity = tonumber(ARGV[4])
+
+local last = tonumber(redis.call('GET', decayKey))
+redis.call('SET', decayKey, now)
+local cnt = 0
+-- 第一次衰减只记录时间
+if halfLife > 0 and last ~= nil and now > last then
+    local factor = math.pow(0.5, (now - last) / halfLife)
+    local items = redis.call('ZRANGE', key, 0, -1, 'WITHSCORES')
+    for i = 1, #items, 2 do
+        local score = tonumber(items[i + 1]) * factor
+        if score < minScore then
+            redis.call('ZREM', key, items[i])
+        else
+            redis.call('ZADD', key, score, items[i])
+        end
+    end
+    cnt = #items / 2
+end
+-- 只保留分数最高的 capacity 个
+redis.call('ZREMRANGEBYRANK', key, 0, -(capacity + 1))
+return cnt
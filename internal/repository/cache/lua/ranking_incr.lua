@@ -0,0 +1,13 @@
+-- 实时热榜的 zset
+local key = KEYS[1]
+
+-- ARGV 是 member、delta 交替出现
+for i = 1, #ARGV, 2 do
+    local score = tonumber(redis.call('ZINCRBY', key, ARGV[i + 1], ARGV[i]))
+    -- 取消点赞、收藏扣的是没有衰减过的分数，可能比当前的热度还多，
+    -- 热度不能是负数，扣到 0 以下直接从榜单里面移除
+    if score <= 0 then
+        redis.call('ZREM', key, ARGV[i])
+    end
+end
+return 0
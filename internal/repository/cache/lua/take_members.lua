@@ -0,0 +1,4 @@
+-- 取出集合里面所有的元素并删除集合，保证取出之后新加的元素不会丢
+local members = redis.call('SMEMBERS', KEYS[1])
+redis.call('DEL', KEYS[1])
+return members
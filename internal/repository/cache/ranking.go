@@ -4,54 +4,73 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/Tuanzi-bug/tuan-book/internal/domain"
-	"github.com/ecodeclub/ekit/syncx/atomicx"
 	"github.com/redis/go-redis/v9"
+	"sync"
 	"time"
 )
 
+var ErrLocalCacheExpired = errors.New("本地缓存失效了")
+
 type RankingCache interface {
-	Set(ctx context.Context, arts []domain.Article) error
-	Get(ctx context.Context) ([]domain.Article, error)
+	Set(ctx context.Context, board string, arts []domain.Article) error
+	Get(ctx context.Context, board string) ([]domain.Article, error)
 }
 
 type RankingLocalCache struct {
-	// 原子操作保证并发安全
-	topN       *atomicx.Value[[]domain.Article]
-	ddl        *atomicx.Value[time.Time]
+	// board => rankingLocalItem，每个榜单整体替换，保证并发安全
+	boards     sync.Map
 	expiration time.Duration
 }
 
-func (r *RankingLocalCache) Set(ctx context.Context, arts []domain.Article) error {
-	r.topN.Store(arts)
-	r.ddl.Store(time.Now().Add(r.expiration))
+type rankingLocalItem struct {
+	topN []domain.Article
+	ddl  time.Time
+}
+
+func (r *RankingLocalCache) Set(ctx context.Context, board string, arts []domain.Article) error {
+	r.boards.Store(board, rankingLocalItem{
+		topN: arts,
+		ddl:  time.Now().Add(r.expiration),
+	})
 	return nil
 }
 
-func (r *RankingLocalCache) Get(ctx context.Context) ([]domain.Article, error) {
-	ddl := r.ddl.Load()
-	arts := r.topN.Load()
-	if ddl.Before(time.Now()) || len(arts) == 0 {
-		return nil, errors.New("本地缓存失效了")
+func (r *RankingLocalCache) Get(ctx context.Context, board string) ([]domain.Article, error) {
+	val, ok := r.boards.Load(board)
+	if !ok {
+		return nil, ErrLocalCacheExpired
 	}
-	return arts, nil
+	item := val.(rankingLocalItem)
+	if item.ddl.Before(time.Now()) || len(item.topN) == 0 {
+		return nil, ErrLocalCacheExpired
+	}
+	return item.topN, nil
 }
 
-func NewRankingLocalCache() RankingCache {
+// ForceGet 忽略过期时间，只要本地有数据就返回，用于 redis 出问题时候兜底
+func (r *RankingLocalCache) ForceGet(ctx context.Context, board string) ([]domain.Article, error) {
+	val, ok := r.boards.Load(board)
+	if !ok || len(val.(rankingLocalItem).topN) == 0 {
+		return nil, ErrLocalCacheExpired
+	}
+	return val.(rankingLocalItem).topN, nil
+}
+
+func NewRankingLocalCache() *RankingLocalCache {
 	return &RankingLocalCache{
-		topN:       atomicx.NewValue[[]domain.Article](),
-		ddl:        atomicx.NewValue[time.Time](),
-		expiration: time.Hour * 24,
+		// 只有计算热榜的节点会主动刷新本地缓存，其余节点依赖过期之后回查 redis，所以过期时间不能太长
+		expiration: time.Minute * 3,
 	}
 }
 
 type RankingRedisCache struct {
 	client     redis.Cmdable
-	key        string
 	expiration time.Duration
 }
 
-func (r *RankingRedisCache) Set(ctx context.Context, arts []domain.Article) error {
+func (r *RankingRedisCache) Set(ctx context.Context, board string, arts []domain.Article) error {
 	// 存储信息不用全部存储，只存储部分信息（title和abstract）
 	for i := 0; i < len(arts); i++ {
 		arts[i].Content = arts[i].Abstract()
@@ -61,11 +80,11 @@ func (r *RankingRedisCache) Set(ctx context.Context, arts []domain.Article) erro
 	if err != nil {
 		return err
 	}
-	return r.client.Set(ctx, r.key, data, r.expiration).Err()
+	return r.client.Set(ctx, r.key(board), data, r.expiration).Err()
 }
 
-func (r *RankingRedisCache) Get(ctx context.Context) ([]domain.Article, error) {
-	artsBytes, err := r.client.Get(ctx, r.key).Bytes()
+func (r *RankingRedisCache) Get(ctx context.Context, board string) ([]domain.Article, error) {
+	artsBytes, err := r.client.Get(ctx, r.key(board)).Bytes()
 	if err != nil {
 		return nil, err
 	}
@@ -77,10 +96,13 @@ func (r *RankingRedisCache) Get(ctx context.Context) ([]domain.Article, error) {
 	return arts, nil
 }
 
-func NewRankingRedisCache(client redis.Cmdable) RankingCache {
+func (r *RankingRedisCache) key(board string) string {
+	return fmt.Sprintf("ranking:topN:%s", board)
+}
+
+func NewRankingRedisCache(client redis.Cmdable) *RankingRedisCache {
 	return &RankingRedisCache{
 		client:     client,
-		key:        "ranking:topN",
 		expiration: time.Hour * 24, // 设置一天的过期时间
 	}
 }
@@ -0,0 +1,105 @@
+package cache
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"time"
+)
+
+var (
+	//go:embed lua/ranking_decay.lua
+	luaRankingDecay string
+	//go:embed lua/ranking_incr.lua
+	luaRankingIncr string
+)
+
+// RankingZSetCache 使用 redis zset 维护实时热榜，member 是文章 ID，score 是热度
+type RankingZSetCache interface {
+	// IncrScores 给多个榜单中的多个文章加分，bizId => delta，热度扣到 0 以下的文章会被移除
+	IncrScores(ctx context.Context, boards []string, deltas map[int64]float64) error
+	// TopN 按照分数从高到低返回前 n 个文章 ID
+	TopN(ctx context.Context, board string, n int) ([]int64, error)
+	// Decay 按照半衰期进行衰减，并且只保留前 capacity 个
+	Decay(ctx context.Context, board string, halfLife time.Duration, capacity int) error
+	// Remove 把文章从多个榜单里面移除
+	Remove(ctx context.Context, boards []string, ids []int64) error
+}
+
+type RankingRedisZSetCache struct {
+	client redis.Cmdable
+	// 衰减后低于这个分数的文章会被移除
+	minScore float64
+}
+
+func NewRankingRedisZSetCache(client redis.Cmdable) RankingZSetCache {
+	return &RankingRedisZSetCache{
+		client:   client,
+		minScore: 0.01,
+	}
+}
+
+func (r *RankingRedisZSetCache) IncrScores(ctx context.Context, boards []string, deltas map[int64]float64) error {
+	if len(deltas) == 0 {
+		return nil
+	}
+	args := make([]any, 0, len(deltas)*2)
+	for id, delta := range deltas {
+		args = append(args, strconv.FormatInt(id, 10), delta)
+	}
+	// 一次网络往返完成所有的加分，每个榜单一个脚本
+	pipe := r.client.Pipeline()
+	for _, board := range boards {
+		pipe.Eval(ctx, luaRankingIncr, []string{r.key(board)}, args...)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (r *RankingRedisZSetCache) TopN(ctx context.Context, board string, n int) ([]int64, error) {
+	members, err := r.client.ZRevRange(ctx, r.key(board), 0, int64(n-1)).Result()
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int64, 0, len(members))
+	for _, m := range members {
+		id, er := strconv.ParseInt(m, 10, 64)
+		if er != nil {
+			// 不是我们写进去的数据，跳过
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (r *RankingRedisZSetCache) Decay(ctx context.Context, board string, halfLife time.Duration, capacity int) error {
+	return r.client.Eval(ctx, luaRankingDecay, []string{r.key(board), r.decayKey(board)},
+		time.Now().UnixMilli(), halfLife.Milliseconds(), r.minScore, capacity).Err()
+}
+
+func (r *RankingRedisZSetCache) Remove(ctx context.Context, boards []string, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	members := make([]any, 0, len(ids))
+	for _, id := range ids {
+		members = append(members, strconv.FormatInt(id, 10))
+	}
+	pipe := r.client.Pipeline()
+	for _, board := range boards {
+		pipe.ZRem(ctx, r.key(board), members...)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (r *RankingRedisZSetCache) key(board string) string {
+	return fmt.Sprintf("ranking:realtime:%s", board)
+}
+
+func (r *RankingRedisZSetCache) decayKey(board string) string {
+	return fmt.Sprintf("ranking:realtime:%s:decay_at", board)
+}
@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"time"
+)
+
+var (
+	//go:embed lua/take_members.lua
+	luaTakeMembers string
+)
+
+// UniqueReaderCache 每篇文章每天一个 HyperLogLog 统计独立读者，
+// 另外每天一个 set 记录哪些文章的读者有变化，定时任务只需要同步这些文章
+//
+//go:generate mockgen -source=./reader.go -package=cachemocks -destination=./mocks/reader.mock.go UniqueReaderCache
+type UniqueReaderCache interface {
+	// Add readers 是 bizId 到读者 uid 的映射
+	Add(ctx context.Context, biz string, day string, readers map[int64][]int64) error
+	// TakeDirty 取出 day 这一天读者有变化的 id，取出之后就不再是脏数据了
+	TakeDirty(ctx context.Context, biz string, day string) ([]int64, error)
+	// MarkDirty 同步失败的时候放回去，等下一次同步
+	MarkDirty(ctx context.Context, biz string, day string, ids []int64) error
+	Count(ctx context.Context, biz string, day string, ids []int64) (map[int64]int64, error)
+}
+
+type UniqueReaderRedisCache struct {
+	client redis.Cmdable
+	// 过期时间要比同步的间隔长，否则没有同步的数据会丢
+	expiration time.Duration
+}
+
+func NewUniqueReaderRedisCache(client redis.Cmdable) UniqueReaderCache {
+	return &UniqueReaderRedisCache{
+		client:     client,
+		expiration: time.Hour * 48,
+	}
+}
+
+func (c *UniqueReaderRedisCache) Add(ctx context.Context, biz string, day string, readers map[int64][]int64) error {
+	if len(readers) == 0 {
+		return nil
+	}
+	dirty := make([]any, 0, len(readers))
+	pipe := c.client.Pipeline()
+	for bizId, uids := range readers {
+		key := c.key(biz, bizId, day)
+		members := make([]any, 0, len(uids))
+		for _, uid := range uids {
+			members = append(members, uid)
+		}
+		pipe.PFAdd(ctx, key, members...)
+		pipe.Expire(ctx, key, c.expiration)
+		dirty = append(dirty, bizId)
+	}
+	pipe.SAdd(ctx, c.dirtyKey(biz, day), dirty...)
+	pipe.Expire(ctx, c.dirtyKey(biz, day), c.expiration)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (c *UniqueReaderRedisCache) TakeDirty(ctx context.Context, biz string, day string) ([]int64, error) {
+	members, err := c.client.Eval(ctx, luaTakeMembers, []string{c.dirtyKey(biz, day)}).StringSlice()
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int64, 0, len(members))
+	for _, m := range members {
+		id, er := strconv.ParseInt(m, 10, 64)
+		if er != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (c *UniqueReaderRedisCache) MarkDirty(ctx context.Context, biz string, day string, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	members := make([]any, 0, len(ids))
+	for _, id := range ids {
+		members = append(members, id)
+	}
+	return c.client.SAdd(ctx, c.dirtyKey(biz, day), members...).Err()
+}
+
+func (c *UniqueReaderRedisCache) Count(ctx context.Context, biz string, day string, ids []int64) (map[int64]int64, error) {
+	pipe := c.client.Pipeline()
+	cmds := make([]*redis.IntCmd, 0, len(ids))
+	for _, id := range ids {
+		cmds = append(cmds, pipe.PFCount(ctx, c.key(biz, id, day)))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	res := make(map[int64]int64, len(ids))
+	for i, cmd := range cmds {
+		res[ids[i]] = cmd.Val()
+	}
+	return res, nil
+}
+
+func (c *UniqueReaderRedisCache) key(biz string, bizId int64, day string) string {
+	return fmt.Sprintf("interactive:reader:%s:%d:%s", biz, bizId, day)
+}
+
+func (c *UniqueReaderRedisCache) dirtyKey(biz string, day string) string {
+	return fmt.Sprintf("interactive:reader:dirty:%s:%s", biz, day)
+}
@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"context"
+	"github.com/Tuanzi-bug/tuan-book/internal/domain"
+	"github.com/Tuanzi-bug/tuan-book/internal/repository/cache"
+	"github.com/Tuanzi-bug/tuan-book/internal/repository/dao"
+	"github.com/Tuanzi-bug/tuan-book/pkg/log"
+	"github.com/ecodeclub/ekit/slice"
+	"go.uber.org/zap"
+	"time"
+)
+
+var (
+	ErrCollectionNotFound  = dao.ErrRecordNotFound
+	ErrCollectionDuplicate = dao.ErrCollectionDuplicate
+)
+
+//go:generate mockgen -source=./collection.go -package=repomocks -destination=./mocks/collection.mock.go CollectionRepository
+type CollectionRepository interface {
+	Create(ctx context.Context, c domain.Collection) (int64, error)
+	Rename(ctx context.Context, uid int64, id int64, name string) error
+	Delete(ctx context.Context, uid int64, id int64) error
+	FindById(ctx context.Context, id int64) (domain.Collection, error)
+	// FindByUid 带上每个收藏夹的内容数量
+	FindByUid(ctx context.Context, uid int64) ([]domain.Collection, error)
+	FindItems(ctx context.Context, uid int64, cid int64, offset int, limit int) ([]domain.CollectionItem, error)
+	MoveItems(ctx context.Context, uid int64, biz string, bizIds []int64, to int64) (int64, error)
+}
+
+type CachedCollectionRepository struct {
+	dao dao.CollectionDAO
+	// 删除收藏夹会扣减收藏数，需要同步更新交互数据的缓存
+	intrCache cache.InteractiveCache
+}
+
+func NewCachedCollectionRepository(dao dao.CollectionDAO, intrCache cache.InteractiveCache) CollectionRepository {
+	return &CachedCollectionRepository{dao: dao, intrCache: intrCache}
+}
+
+func (repo *CachedCollectionRepository) Create(ctx context.Context, c domain.Collection) (int64, error) {
+	return repo.dao.Insert(ctx, dao.Collection{
+		Uid:  c.Uid,
+		Name: c.Name,
+	})
+}
+
+func (repo *CachedCollectionRepository) Rename(ctx context.Context, uid int64, id int64, name string) error {
+	return repo.dao.UpdateName(ctx, uid, id, name)
+}
+
+func (repo *CachedCollectionRepository) Delete(ctx context.Context, uid int64, id int64) error {
+	items, err := repo.dao.Delete(ctx, uid, id)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		if er := repo.intrCache.DecrCollectCntIfPresent(ctx, item.Biz, item.BizId); er != nil {
+			// 记录日志，不影响主流程
+			log.Error("cache DecrCollectCntIfPresent failed", zap.Error(er),
+				zap.String("biz", item.Biz), zap.Int64("id", item.BizId), zap.Int64("cid", id))
+		}
+	}
+	return nil
+}
+
+func (repo *CachedCollectionRepository) FindById(ctx context.Context, id int64) (domain.Collection, error) {
+	c, err := repo.dao.FindById(ctx, id)
+	if err != nil {
+		return domain.Collection{}, err
+	}
+	return repo.toDomain(c), nil
+}
+
+func (repo *CachedCollectionRepository) FindByUid(ctx context.Context, uid int64) ([]domain.Collection, error) {
+	cs, err := repo.dao.FindByUid(ctx, uid)
+	if err != nil || len(cs) == 0 {
+		return []domain.Collection{}, err
+	}
+	ids := slice.Map[dao.Collection, int64](cs, func(idx int, src dao.Collection) int64 {
+		return src.Id
+	})
+	cnts, err := repo.dao.CountItems(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map[dao.Collection, domain.Collection](cs, func(idx int, src dao.Collection) domain.Collection {
+		res := repo.toDomain(src)
+		res.ItemCnt = cnts[src.Id]
+		return res
+	}), nil
+}
+
+func (repo *CachedCollectionRepository) FindItems(ctx context.Context, uid int64, cid int64, offset int, limit int) ([]domain.CollectionItem, error) {
+	items, err := repo.dao.FindItems(ctx, uid, cid, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map[dao.CollectionItem, domain.CollectionItem](items, func(idx int, src dao.CollectionItem) domain.CollectionItem {
+		return domain.CollectionItem{
+			Biz:   src.Biz,
+			BizId: src.BizId,
+			Cid:   src.Cid,
+			Title: src.Title,
+			Ctime: time.UnixMilli(src.Ctime),
+		}
+	}), nil
+}
+
+func (repo *CachedCollectionRepository) MoveItems(ctx context.Context, uid int64, biz string, bizIds []int64, to int64) (int64, error) {
+	return repo.dao.MoveItems(ctx, uid, biz, bizIds, to)
+}
+
+func (repo *CachedCollectionRepository) toDomain(c dao.Collection) domain.Collection {
+	return domain.Collection{
+		Id:    c.Id,
+		Uid:   c.Uid,
+		Name:  c.Name,
+		Ctime: time.UnixMilli(c.Ctime),
+		Utime: time.UnixMilli(c.Utime),
+	}
+}
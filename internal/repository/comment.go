@@ -0,0 +1,213 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"github.com/Tuanzi-bug/tuan-book/internal/domain"
+	"github.com/Tuanzi-bug/tuan-book/internal/repository/cache"
+	"github.com/Tuanzi-bug/tuan-book/internal/repository/dao"
+	"github.com/Tuanzi-bug/tuan-book/pkg/log"
+	"github.com/ecodeclub/ekit/slice"
+	"go.uber.org/zap"
+	"slices"
+	"time"
+)
+
+var ErrCommentNotFound = dao.ErrRecordNotFound
+
+const (
+	// commentFirstPageSize 第一页缓存多少条根评论
+	commentFirstPageSize = 20
+	// commentHotThreshold 评论数超过这个值才缓存第一页
+	commentHotThreshold = 100
+)
+
+//go:generate mockgen -source=./comment.go -package=repomocks -destination=./mocks/comment.mock.go CommentRepository
+type CommentRepository interface {
+	Create(ctx context.Context, c domain.Comment) (int64, error)
+	FindById(ctx context.Context, id int64) (domain.Comment, error)
+	Delete(ctx context.Context, c domain.Comment) error
+	// FindRoots 根评论按照时间倒序，每条根评论预先加载最早的 replyN 条回复
+	FindRoots(ctx context.Context, biz string, bizId int64, cursor int64, limit int, replyN int) ([]domain.Comment, error)
+	FindReplies(ctx context.Context, rootId int64, cursor int64, limit int) ([]domain.Comment, error)
+	// CountByBiz 每个 bizId 都有结果，先查缓存，缓存里面没有的再一次性查数据库
+	CountByBiz(ctx context.Context, biz string, bizIds []int64) (map[int64]int64, error)
+}
+
+type CachedCommentRepository struct {
+	dao   dao.CommentDAO
+	cache cache.CommentCache
+}
+
+func NewCachedCommentRepository(dao dao.CommentDAO, cache cache.CommentCache) CommentRepository {
+	return &CachedCommentRepository{dao: dao, cache: cache}
+}
+
+func (repo *CachedCommentRepository) Create(ctx context.Context, c domain.Comment) (int64, error) {
+	id, err := repo.dao.Insert(ctx, repo.toEntity(c))
+	if err == nil {
+		repo.delFirstPage(ctx, c.Biz, c.BizId)
+	}
+	return id, err
+}
+
+func (repo *CachedCommentRepository) FindById(ctx context.Context, id int64) (domain.Comment, error) {
+	c, err := repo.dao.FindById(ctx, id)
+	if err != nil {
+		return domain.Comment{}, err
+	}
+	return repo.toDomain(c), nil
+}
+
+func (repo *CachedCommentRepository) Delete(ctx context.Context, c domain.Comment) error {
+	err := repo.dao.Delete(ctx, repo.toEntity(c))
+	if err == nil {
+		repo.delFirstPage(ctx, c.Biz, c.BizId)
+	}
+	return err
+}
+
+func (repo *CachedCommentRepository) FindRoots(ctx context.Context, biz string, bizId int64,
+	cursor int64, limit int, replyN int) ([]domain.Comment, error) {
+	if cursor != 0 || limit > commentFirstPageSize {
+		return repo.findRoots(ctx, biz, bizId, cursor, limit, replyN)
+	}
+	res, err := repo.cache.GetFirstPage(ctx, biz, bizId)
+	if err == nil {
+		return res[:min(limit, len(res))], nil
+	}
+	res, err = repo.findRoots(ctx, biz, bizId, 0, commentFirstPageSize, replyN)
+	if err != nil {
+		return nil, err
+	}
+	// 只有热门的资源才缓存第一页
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		cnts, er := repo.dao.CountByBiz(ctx, biz, []int64{bizId})
+		if er != nil || cnts[bizId] < commentHotThreshold {
+			return
+		}
+		er = repo.cache.SetFirstPage(ctx, biz, bizId, res)
+		if er != nil {
+			log.Error("评论第一页缓存写入失败", zap.Error(er), zap.String("biz", biz), zap.Int64("bizId", bizId))
+		}
+	}()
+	return res[:min(limit, len(res))], nil
+}
+
+func (repo *CachedCommentRepository) findRoots(ctx context.Context, biz string, bizId int64,
+	cursor int64, limit int, replyN int) ([]domain.Comment, error) {
+	roots, err := repo.dao.FindRoots(ctx, biz, bizId, cursor, limit)
+	if err != nil || len(roots) == 0 {
+		return []domain.Comment{}, err
+	}
+	ids := slice.Map[dao.Comment, int64](roots, func(idx int, src dao.Comment) int64 {
+		return src.Id
+	})
+	replies, err := repo.dao.FindFirstReplies(ctx, ids, replyN)
+	if err != nil {
+		return nil, err
+	}
+	cnts, err := repo.dao.CountReplies(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	grouped := make(map[int64][]domain.Comment, len(roots))
+	for _, r := range replies {
+		grouped[r.RootId] = append(grouped[r.RootId], repo.toDomain(r))
+	}
+	return slice.Map[dao.Comment, domain.Comment](roots, func(idx int, src dao.Comment) domain.Comment {
+		c := repo.toDomain(src)
+		c.Replies = grouped[src.Id]
+		// UNION ALL 不保证顺序
+		slices.SortFunc(c.Replies, func(a, b domain.Comment) int {
+			return cmp.Compare(a.Id, b.Id)
+		})
+		c.ReplyCnt = cnts[src.Id]
+		return c
+	}), nil
+}
+
+func (repo *CachedCommentRepository) FindReplies(ctx context.Context, rootId int64, cursor int64, limit int) ([]domain.Comment, error) {
+	cs, err := repo.dao.FindReplies(ctx, rootId, cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map[dao.Comment, domain.Comment](cs, func(idx int, src dao.Comment) domain.Comment {
+		return repo.toDomain(src)
+	}), nil
+}
+
+func (repo *CachedCommentRepository) CountByBiz(ctx context.Context, biz string, bizIds []int64) (map[int64]int64, error) {
+	if len(bizIds) == 0 {
+		return map[int64]int64{}, nil
+	}
+	res, err := repo.cache.GetCnts(ctx, biz, bizIds)
+	if err != nil {
+		// 缓存出错就全部走数据库
+		log.Error("获取评论数缓存失败", zap.Error(err), zap.String("biz", biz))
+		res = make(map[int64]int64, len(bizIds))
+	}
+	missed := make([]int64, 0, len(bizIds))
+	for _, id := range bizIds {
+		if _, ok := res[id]; !ok {
+			missed = append(missed, id)
+		}
+	}
+	if len(missed) == 0 {
+		return res, nil
+	}
+	cnts, err := repo.dao.CountByBiz(ctx, biz, missed)
+	if err != nil {
+		return nil, err
+	}
+	// 没有评论的也要缓存，不然每次都会查数据库
+	loaded := make(map[int64]int64, len(missed))
+	for _, id := range missed {
+		loaded[id] = cnts[id]
+		res[id] = cnts[id]
+	}
+	if er := repo.cache.SetCnts(ctx, biz, loaded); er != nil {
+		log.Error("回写评论数缓存失败", zap.Error(er), zap.String("biz", biz))
+	}
+	return res, nil
+}
+
+// delFirstPage 评论发生变化之后删除第一页缓存和评论数缓存
+func (repo *CachedCommentRepository) delFirstPage(ctx context.Context, biz string, bizId int64) {
+	er := repo.cache.DelFirstPage(ctx, biz, bizId)
+	if er != nil {
+		log.Error("删除评论第一页缓存失败", zap.Error(er), zap.String("biz", biz), zap.Int64("bizId", bizId))
+	}
+	er = repo.cache.DelCnt(ctx, biz, bizId)
+	if er != nil {
+		log.Error("删除评论数缓存失败", zap.Error(er), zap.String("biz", biz), zap.Int64("bizId", bizId))
+	}
+}
+
+func (repo *CachedCommentRepository) toDomain(c dao.Comment) domain.Comment {
+	return domain.Comment{
+		Id:       c.Id,
+		Uid:      c.Uid,
+		Biz:      c.Biz,
+		BizId:    c.BizId,
+		RootId:   c.RootId,
+		ParentId: c.ParentId,
+		Content:  c.Content,
+		Ctime:    time.UnixMilli(c.Ctime),
+		Utime:    time.UnixMilli(c.Utime),
+	}
+}
+
+func (repo *CachedCommentRepository) toEntity(c domain.Comment) dao.Comment {
+	return dao.Comment{
+		Id:       c.Id,
+		Uid:      c.Uid,
+		Biz:      c.Biz,
+		BizId:    c.BizId,
+		RootId:   c.RootId,
+		ParentId: c.ParentId,
+		Content:  c.Content,
+	}
+}
@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/Tuanzi-bug/tuan-book/internal/repository/cache"
+	cachemocks "github.com/Tuanzi-bug/tuan-book/internal/repository/cache/mocks"
+	"github.com/Tuanzi-bug/tuan-book/internal/repository/dao"
+	daomocks "github.com/Tuanzi-bug/tuan-book/internal/repository/dao/mocks"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"testing"
+)
+
+func TestCachedCommentRepository_CountByBiz(t *testing.T) {
+	testCases := []struct {
+		name string
+
+		mock func(ctrl *gomock.Controller) (dao.CommentDAO, cache.CommentCache)
+
+		ids     []int64
+		wantRes map[int64]int64
+		wantErr error
+	}{
+		{
+			name: "全部命中缓存",
+			mock: func(ctrl *gomock.Controller) (dao.CommentDAO, cache.CommentCache) {
+				d := daomocks.NewMockCommentDAO(ctrl)
+				c := cachemocks.NewMockCommentCache(ctrl)
+				c.EXPECT().GetCnts(gomock.Any(), "article", []int64{1, 2}).
+					Return(map[int64]int64{1: 3, 2: 0}, nil)
+				return d, c
+			},
+			ids:     []int64{1, 2},
+			wantRes: map[int64]int64{1: 3, 2: 0},
+		},
+		{
+			name: "部分命中，没有评论的也回写缓存",
+			mock: func(ctrl *gomock.Controller) (dao.CommentDAO, cache.CommentCache) {
+				d := daomocks.NewMockCommentDAO(ctrl)
+				c := cachemocks.NewMockCommentCache(ctrl)
+				c.EXPECT().GetCnts(gomock.Any(), "article", []int64{1, 2, 3}).
+					Return(map[int64]int64{1: 3}, nil)
+				d.EXPECT().CountByBiz(gomock.Any(), "article", []int64{2, 3}).
+					Return(map[int64]int64{2: 5}, nil)
+				c.EXPECT().SetCnts(gomock.Any(), "article", map[int64]int64{2: 5, 3: 0}).Return(nil)
+				return d, c
+			},
+			ids:     []int64{1, 2, 3},
+			wantRes: map[int64]int64{1: 3, 2: 5, 3: 0},
+		},
+		{
+			name: "缓存失败，全部查数据库",
+			mock: func(ctrl *gomock.Controller) (dao.CommentDAO, cache.CommentCache) {
+				d := daomocks.NewMockCommentDAO(ctrl)
+				c := cachemocks.NewMockCommentCache(ctrl)
+				c.EXPECT().GetCnts(gomock.Any(), "article", []int64{1}).
+					Return(nil, errors.New("mock error"))
+				d.EXPECT().CountByBiz(gomock.Any(), "article", []int64{1}).
+					Return(map[int64]int64{1: 2}, nil)
+				c.EXPECT().SetCnts(gomock.Any(), "article", map[int64]int64{1: 2}).Return(nil)
+				return d, c
+			},
+			ids:     []int64{1},
+			wantRes: map[int64]int64{1: 2},
+		},
+		{
+			name: "数据库失败",
+			mock: func(ctrl *gomock.Controller) (dao.CommentDAO, cache.CommentCache) {
+				d := daomocks.NewMockCommentDAO(ctrl)
+				c := cachemocks.NewMockCommentCache(ctrl)
+				c.EXPECT().GetCnts(gomock.Any(), "article", []int64{1}).Return(map[int64]int64{}, nil)
+				d.EXPECT().CountByBiz(gomock.Any(), "article", []int64{1}).
+					Return(nil, errors.New("db error"))
+				return d, c
+			},
+			ids:     []int64{1},
+			wantErr: errors.New("db error"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			repo := NewCachedCommentRepository(tc.mock(ctrl))
+			res, err := repo.CountByBiz(context.Background(), "article", tc.ids)
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantRes, res)
+		})
+	}
+}
@@ -2,7 +2,10 @@ package dao
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"github.com/Tuanzi-bug/tuan-book/internal/events/schema"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 	"time"
@@ -16,13 +19,40 @@ type Article struct {
 	AuthorId int64 `gorm:"index"`
 	// 状态
 	Status uint8
-	Ctime  int64
+	// 定时发表的时间，只有定时发表状态下才有意义
+	PublishAt int64 `gorm:"index"`
+	// 标签存在关联表里，nil 表示不修改标签
+	Tags  []string `gorm:"-"`
+	Ctime int64
 	// 更新时间
 	Utime int64
 }
 
 type PublishedArticle Article
 
+// ArticleRevision 文章的历史版本，每次保存和发表都会追加一条，不会修改
+type ArticleRevision struct {
+	Id        int64 `gorm:"primaryKey,autoIncrement"`
+	ArticleId int64 `gorm:"index"`
+	AuthorId  int64
+	Title     string `gorm:"type=varchar(4096)"`
+	Content   string `gorm:"type=BLOB"`
+	// 内容的 sha256，用于快速判断两个版本内容是否一致
+	ContentHash string `gorm:"type:char(64)"`
+	// 产生这个版本时文章的状态，区分保存和发表
+	Status uint8
+	Ctime  int64
+}
+
+// 和 domain.ArticleStatus 保持一致
+const (
+	articleStatusUnpublished = 1
+	articleStatusPublished   = 2
+	articleStatusScheduled   = 4
+)
+
+var ErrArticleNotScheduled = errors.New("文章不是定时发表状态")
+
 //go:generate mockgen -source=./article.go -package=daomocks -destination=./mocks/article.mock.go ArticleDAO
 type ArticleDAO interface {
 	Insert(ctx context.Context, art Article) (int64, error)
@@ -33,6 +63,25 @@ type ArticleDAO interface {
 	GetById(ctx context.Context, id int64) (Article, error)
 	GetPubById(ctx context.Context, id int64) (PublishedArticle, error)
 	ListPub(ctx context.Context, start time.Time, offset int, limit int) ([]PublishedArticle, error)
+	GetPubByIds(ctx context.Context, ids []int64) ([]PublishedArticle, error)
+	// ListRevisions 按照时间倒序返回历史版本，不包含内容
+	ListRevisions(ctx context.Context, aid int64, offset int, limit int) ([]ArticleRevision, error)
+	GetRevision(ctx context.Context, id int64) (ArticleRevision, error)
+	// ListDueScheduled 到期的定时发表文章，只有 id 和 author_id
+	ListDueScheduled(ctx context.Context, now time.Time, limit int) ([]Article, error)
+	// PublishScheduled 发表一篇到期的定时文章，已经取消或者没到期的返回 ErrRecordNotFound
+	PublishScheduled(ctx context.Context, id int64, now time.Time) (Article, error)
+	UpdateSchedule(ctx context.Context, uid int64, id int64, publishAt int64) error
+	CancelSchedule(ctx context.Context, uid int64, id int64) error
+	GetTags(ctx context.Context, aid int64) ([]string, error)
+	GetPubTags(ctx context.Context, aid int64) ([]string, error)
+	// AuthorTags 创作者除了 exceptAid 之外的文章用到的所有标签
+	AuthorTags(ctx context.Context, uid int64, exceptAid int64) ([]string, error)
+	// ListPubByTag 按照 id 倒序，cursor 是上一页最后一篇文章的 id
+	ListPubByTag(ctx context.Context, tag string, cursor int64, limit int) ([]PublishedArticle, error)
+	// ListPubByAuthors 这些作者发表的文章，按照第一次发表的时间和 id 倒序，
+	// beforeCtime 和 beforeId 是上一页最后一篇，都是 0 表示第一页
+	ListPubByAuthors(ctx context.Context, uids []int64, beforeCtime int64, beforeId int64, limit int) ([]PublishedArticle, error)
 }
 
 type GROMArticleDAO struct {
@@ -41,8 +90,9 @@ type GROMArticleDAO struct {
 
 func (dao *GROMArticleDAO) ListPub(ctx context.Context, start time.Time, offset int, limit int) ([]PublishedArticle, error) {
 	var arts []PublishedArticle
-	const ArticleStatusPublished = 2
-	err := dao.db.WithContext(ctx).Where("utime < ? and status = ?", start.UnixMilli(), ArticleStatusPublished).Offset(offset).Limit(limit).Find(&arts).Error
+	// 按照更新时间倒序，调用方依赖这个顺序判断是否超出了时间窗口
+	err := dao.db.WithContext(ctx).Where("utime < ? and status = ?", start.UnixMilli(), articleStatusPublished).
+		Order("utime DESC").Offset(offset).Limit(limit).Find(&arts).Error
 	return arts, err
 }
 
@@ -51,21 +101,49 @@ func NewGORMArticleDAO(db *gorm.DB) ArticleDAO {
 }
 
 func (dao *GROMArticleDAO) Insert(ctx context.Context, art Article) (int64, error) {
+	var id int64
+	err := dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		id, err = dao.insert(tx, art)
+		return err
+	})
+	return id, err
+}
+
+func (dao *GROMArticleDAO) UpdateById(ctx context.Context, article Article) error {
+	return dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return dao.updateById(tx, article)
+	})
+}
+
+// insert 在事务中插入制作库，并且记录一个版本
+func (dao *GROMArticleDAO) insert(tx *gorm.DB, art Article) (int64, error) {
 	now := time.Now().UnixMilli()
 	art.Ctime = now
 	art.Utime = now
-	err := dao.db.WithContext(ctx).Create(&art).Error
-	return art.Id, err
+	err := tx.Create(&art).Error
+	if err != nil {
+		return 0, err
+	}
+	if art.Tags != nil {
+		err = dao.setTags(tx, art.Id, art.AuthorId, art.Tags)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return art.Id, dao.appendRevision(tx, art, now)
 }
 
-func (dao *GROMArticleDAO) UpdateById(ctx context.Context, article Article) error {
+// updateById 在事务中更新制作库，并且记录一个版本
+func (dao *GROMArticleDAO) updateById(tx *gorm.DB, article Article) error {
 	now := time.Now().UnixMilli()
 	article.Utime = now
-	res := dao.db.WithContext(ctx).Model(&article).Where("id=? and author_id=?", article.Id, article.AuthorId).Updates(map[string]interface{}{
-		"Title":   article.Title,
-		"Content": article.Content,
-		"Utime":   article.Utime,
-		"status":  article.Status,
+	res := tx.Model(&article).Where("id=? and author_id=?", article.Id, article.AuthorId).Updates(map[string]interface{}{
+		"Title":      article.Title,
+		"Content":    article.Content,
+		"Utime":      article.Utime,
+		"status":     article.Status,
+		"publish_at": article.PublishAt,
 	})
 	if res.Error != nil {
 		return res.Error
@@ -73,44 +151,139 @@ func (dao *GROMArticleDAO) UpdateById(ctx context.Context, article Article) erro
 	if res.RowsAffected == 0 {
 		return errors.New("id 不正确 或者 创作者不正确")
 	}
-	return nil
+	if article.Tags != nil {
+		err := dao.setTags(tx, article.Id, article.AuthorId, article.Tags)
+		if err != nil {
+			return err
+		}
+	}
+	return dao.appendRevision(tx, article, now)
+}
+
+func (dao *GROMArticleDAO) appendRevision(tx *gorm.DB, art Article, now int64) error {
+	hash := sha256.Sum256([]byte(art.Content))
+	return tx.Create(&ArticleRevision{
+		ArticleId:   art.Id,
+		AuthorId:    art.AuthorId,
+		Title:       art.Title,
+		Content:     art.Content,
+		ContentHash: hex.EncodeToString(hash[:]),
+		Status:      art.Status,
+		Ctime:       now,
+	}).Error
 }
 
 func (dao *GROMArticleDAO) Sync(ctx context.Context, article Article) (int64, error) {
 	var id = article.Id
 	err := dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		var err error
-		dao := NewGORMArticleDAO(tx)
 		// 先对制作库进行更新
 		if id > 0 {
-			err = dao.UpdateById(ctx, article)
+			err = dao.updateById(tx, article)
 		} else {
-			id, err = dao.Insert(ctx, article)
+			id, err = dao.insert(tx, article)
 		}
 		if err != nil {
 			return err
 		}
 		article.Id = id
-		now := time.Now().UnixMilli()
-		pubArt := PublishedArticle(article)
-		pubArt.Ctime = now
-		pubArt.Utime = now
-		// 接下来对线上库进行更新。不存在就创建，存在就修改部分值
-		err = tx.Clauses(
-			clause.OnConflict{
-				Columns: []clause.Column{{Name: "id"}},
-				DoUpdates: clause.Assignments(map[string]interface{}{
-					"title":   pubArt.Title,
-					"content": pubArt.Content,
-					"utime":   now,
-					"status":  article.Status,
-				}),
-			}).Create(&pubArt).Error
-		return err
+		err = dao.upsertPub(tx, article)
+		if err != nil {
+			return err
+		}
+		err = dao.syncPubTags(tx, id)
+		if err != nil {
+			return err
+		}
+		return insertOutbox(tx, schema.TopicPublishedEvent, id, schema.PublishedEvent{Aid: id, Uid: article.AuthorId})
 	})
 	return id, err
 }
 
+// upsertPub 同步线上库。不存在就创建，存在就修改部分值
+func (dao *GROMArticleDAO) upsertPub(tx *gorm.DB, article Article) error {
+	now := time.Now().UnixMilli()
+	pubArt := PublishedArticle(article)
+	pubArt.Ctime = now
+	pubArt.Utime = now
+	return tx.Clauses(
+		clause.OnConflict{
+			Columns: []clause.Column{{Name: "id"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"title":   pubArt.Title,
+				"content": pubArt.Content,
+				"utime":   now,
+				"status":  article.Status,
+			}),
+		}).Create(&pubArt).Error
+}
+
+func (dao *GROMArticleDAO) ListDueScheduled(ctx context.Context, now time.Time, limit int) ([]Article, error) {
+	var arts []Article
+	err := dao.db.WithContext(ctx).Select("id", "author_id").
+		Where("status = ? AND publish_at <= ?", articleStatusScheduled, now.UnixMilli()).
+		Order("publish_at ASC").Limit(limit).Find(&arts).Error
+	return arts, err
+}
+
+func (dao *GROMArticleDAO) PublishScheduled(ctx context.Context, id int64, now time.Time) (Article, error) {
+	var art Article
+	err := dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// 锁住这一行，防止和作者取消、改期并发
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND status = ? AND publish_at <= ?", id, articleStatusScheduled, now.UnixMilli()).
+			First(&art).Error
+		if err != nil {
+			return err
+		}
+		art.Status = articleStatusPublished
+		art.PublishAt = 0
+		err = dao.updateById(tx, art)
+		if err != nil {
+			return err
+		}
+		err = dao.upsertPub(tx, art)
+		if err != nil {
+			return err
+		}
+		err = dao.syncPubTags(tx, id)
+		if err != nil {
+			return err
+		}
+		return insertOutbox(tx, schema.TopicPublishedEvent, id, schema.PublishedEvent{Aid: id, Uid: art.AuthorId})
+	})
+	return art, err
+}
+
+func (dao *GROMArticleDAO) UpdateSchedule(ctx context.Context, uid int64, id int64, publishAt int64) error {
+	return dao.updateScheduled(ctx, uid, id, map[string]any{
+		"publish_at": publishAt,
+		"utime":      time.Now().UnixMilli(),
+	})
+}
+
+func (dao *GROMArticleDAO) CancelSchedule(ctx context.Context, uid int64, id int64) error {
+	return dao.updateScheduled(ctx, uid, id, map[string]any{
+		"status":     articleStatusUnpublished,
+		"publish_at": 0,
+		"utime":      time.Now().UnixMilli(),
+	})
+}
+
+// updateScheduled 只修改仍处于定时发表状态的文章
+func (dao *GROMArticleDAO) updateScheduled(ctx context.Context, uid int64, id int64, vals map[string]any) error {
+	res := dao.db.WithContext(ctx).Model(&Article{}).
+		Where("id = ? AND author_id = ? AND status = ?", id, uid, articleStatusScheduled).
+		Updates(vals)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrArticleNotScheduled
+	}
+	return nil
+}
+
 func (dao *GROMArticleDAO) SyncStatus(ctx context.Context, uid int64, id int64, status uint8) error {
 	now := time.Now().UnixMilli()
 	return dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
@@ -126,10 +299,17 @@ func (dao *GROMArticleDAO) SyncStatus(ctx context.Context, uid int64, id int64,
 			return errors.New("ID 不对或者创作者不对")
 		}
 		// 再修改线上库的状态
-		return tx.Model(&PublishedArticle{}).Where("id=? and author_id=?", id, uid).Updates(map[string]any{
+		err := tx.Model(&PublishedArticle{}).Where("id=? and author_id=?", id, uid).Updates(map[string]any{
 			"utime":  now,
 			"status": status,
 		}).Error
+		if err != nil {
+			return err
+		}
+		if status == articleStatusPublished {
+			return insertOutbox(tx, schema.TopicPublishedEvent, id, schema.PublishedEvent{Aid: id, Uid: uid})
+		}
+		return insertOutbox(tx, schema.TopicWithdrawnEvent, id, schema.WithdrawnEvent{Aid: id, Uid: uid})
 	})
 }
 
@@ -155,3 +335,37 @@ func (dao *GROMArticleDAO) GetPubById(ctx context.Context, id int64) (PublishedA
 	err := dao.db.WithContext(ctx).Where("id=?", id).First(&art).Error
 	return art, err
 }
+
+func (dao *GROMArticleDAO) ListPubByAuthors(ctx context.Context, uids []int64, beforeCtime int64, beforeId int64, limit int) ([]PublishedArticle, error) {
+	query := dao.db.WithContext(ctx).Where("author_id IN ? AND status = ?", uids, articleStatusPublished)
+	if beforeCtime > 0 || beforeId > 0 {
+		query = query.Where("ctime < ? OR (ctime = ? AND id < ?)", beforeCtime, beforeCtime, beforeId)
+	}
+	var arts []PublishedArticle
+	err := query.Order("ctime DESC, id DESC").Limit(limit).Find(&arts).Error
+	return arts, err
+}
+
+func (dao *GROMArticleDAO) GetPubByIds(ctx context.Context, ids []int64) ([]PublishedArticle, error) {
+	var arts []PublishedArticle
+	err := dao.db.WithContext(ctx).Where("id IN ? AND status = ?", ids, articleStatusPublished).Find(&arts).Error
+	return arts, err
+}
+
+func (dao *GROMArticleDAO) ListRevisions(ctx context.Context, aid int64, offset int, limit int) ([]ArticleRevision, error) {
+	var revs []ArticleRevision
+	// 列表不需要内容，内容可能很大
+	err := dao.db.WithContext(ctx).
+		Select("id", "article_id", "author_id", "title", "content_hash", "status", "ctime").
+		Where("article_id = ?", aid).
+		Order("id DESC").
+		Offset(offset).Limit(limit).
+		Find(&revs).Error
+	return revs, err
+}
+
+func (dao *GROMArticleDAO) GetRevision(ctx context.Context, id int64) (ArticleRevision, error) {
+	var rev ArticleRevision
+	err := dao.db.WithContext(ctx).Where("id = ?", id).First(&rev).Error
+	return rev, err
+}
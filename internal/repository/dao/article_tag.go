@@ -0,0 +1,136 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// Tag 标签，所有创作者共用
+type Tag struct {
+	Id    int64  `gorm:"primaryKey,autoIncrement"`
+	Name  string `gorm:"type:varchar(64);unique"`
+	Ctime int64
+}
+
+// ArticleTag 制作库文章和标签的关联
+type ArticleTag struct {
+	Id        int64 `gorm:"primaryKey,autoIncrement"`
+	ArticleId int64 `gorm:"uniqueIndex:article_tag_aid_tid"`
+	TagId     int64 `gorm:"uniqueIndex:article_tag_aid_tid"`
+	// 用于统计创作者用了多少个标签
+	AuthorId int64 `gorm:"index"`
+	Ctime    int64
+}
+
+// PublishedArticleTag 线上库文章和标签的关联，发表的时候从制作库同步过来
+type PublishedArticleTag struct {
+	Id        int64 `gorm:"primaryKey,autoIncrement"`
+	ArticleId int64 `gorm:"uniqueIndex:pub_article_tag_aid_tid;index:pub_article_tag_tid_aid,priority:2"`
+	TagId     int64 `gorm:"uniqueIndex:pub_article_tag_aid_tid;index:pub_article_tag_tid_aid,priority:1"`
+	Ctime     int64
+}
+
+func (dao *GROMArticleDAO) GetTags(ctx context.Context, aid int64) ([]string, error) {
+	var names []string
+	err := dao.db.WithContext(ctx).Model(&Tag{}).
+		Joins("JOIN article_tags ON article_tags.tag_id = tags.id").
+		Where("article_tags.article_id = ?", aid).
+		Order("article_tags.id").Pluck("tags.name", &names).Error
+	return names, err
+}
+
+func (dao *GROMArticleDAO) GetPubTags(ctx context.Context, aid int64) ([]string, error) {
+	var names []string
+	err := dao.db.WithContext(ctx).Model(&Tag{}).
+		Joins("JOIN published_article_tags ON published_article_tags.tag_id = tags.id").
+		Where("published_article_tags.article_id = ?", aid).
+		Order("published_article_tags.id").Pluck("tags.name", &names).Error
+	return names, err
+}
+
+func (dao *GROMArticleDAO) AuthorTags(ctx context.Context, uid int64, exceptAid int64) ([]string, error) {
+	var names []string
+	err := dao.db.WithContext(ctx).Model(&Tag{}).Distinct("tags.name").
+		Joins("JOIN article_tags ON article_tags.tag_id = tags.id").
+		Where("article_tags.author_id = ? AND article_tags.article_id <> ?", uid, exceptAid).
+		Pluck("tags.name", &names).Error
+	return names, err
+}
+
+func (dao *GROMArticleDAO) ListPubByTag(ctx context.Context, tag string, cursor int64, limit int) ([]PublishedArticle, error) {
+	db := dao.db.WithContext(ctx)
+	var t Tag
+	err := db.Where("name = ?", tag).First(&t).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return []PublishedArticle{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	query := db.Model(&PublishedArticle{}).
+		Joins("JOIN published_article_tags ON published_article_tags.article_id = published_articles.id").
+		Where("published_article_tags.tag_id = ? AND published_articles.status = ?", t.Id, articleStatusPublished)
+	// cursor 是上一页最后一篇文章的 id，0 表示第一页
+	if cursor > 0 {
+		query = query.Where("published_articles.id < ?", cursor)
+	}
+	var arts []PublishedArticle
+	err = query.Order("published_articles.id DESC").Limit(limit).Find(&arts).Error
+	return arts, err
+}
+
+// setTags 在事务中把文章的标签替换成 names
+func (dao *GROMArticleDAO) setTags(tx *gorm.DB, aid int64, uid int64, names []string) error {
+	err := tx.Where("article_id = ?", aid).Delete(&ArticleTag{}).Error
+	if err != nil || len(names) == 0 {
+		return err
+	}
+	ids, err := dao.tagIds(tx, names)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UnixMilli()
+	rels := make([]ArticleTag, 0, len(ids))
+	for _, id := range ids {
+		rels = append(rels, ArticleTag{ArticleId: aid, TagId: id, AuthorId: uid, Ctime: now})
+	}
+	return tx.Create(&rels).Error
+}
+
+// tagIds 不存在的标签会被创建
+func (dao *GROMArticleDAO) tagIds(tx *gorm.DB, names []string) ([]int64, error) {
+	now := time.Now().UnixMilli()
+	tags := make([]Tag, 0, len(names))
+	for _, name := range names {
+		tags = append(tags, Tag{Name: name, Ctime: now})
+	}
+	err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&tags).Error
+	if err != nil {
+		return nil, err
+	}
+	var ids []int64
+	err = tx.Model(&Tag{}).Where("name IN ?", names).Pluck("id", &ids).Error
+	return ids, err
+}
+
+// syncPubTags 在事务中把制作库的标签同步到线上库
+func (dao *GROMArticleDAO) syncPubTags(tx *gorm.DB, aid int64) error {
+	err := tx.Where("article_id = ?", aid).Delete(&PublishedArticleTag{}).Error
+	if err != nil {
+		return err
+	}
+	var rels []ArticleTag
+	err = tx.Where("article_id = ?", aid).Find(&rels).Error
+	if err != nil || len(rels) == 0 {
+		return err
+	}
+	now := time.Now().UnixMilli()
+	pubRels := make([]PublishedArticleTag, 0, len(rels))
+	for _, rel := range rels {
+		pubRels = append(pubRels, PublishedArticleTag{ArticleId: aid, TagId: rel.TagId, Ctime: now})
+	}
+	return tx.Create(&pubRels).Error
+}
@@ -0,0 +1,206 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"github.com/Tuanzi-bug/tuan-book/internal/events/schema"
+	"github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+	"time"
+)
+
+var (
+	ErrCollectionDuplicate = errors.New("收藏夹重名")
+	// ErrCollectItemDuplicate 同一个内容只能收藏到一个收藏夹里面
+	ErrCollectItemDuplicate = errors.New("已经收藏过了")
+)
+
+//go:generate mockgen -source=./collection.go -package=daomocks -destination=./mocks/collection.mock.go CollectionDAO
+type CollectionDAO interface {
+	Insert(ctx context.Context, c Collection) (int64, error)
+	// UpdateName 只能修改自己的收藏夹，找不到的时候返回 ErrRecordNotFound
+	UpdateName(ctx context.Context, uid int64, id int64, name string) error
+	// Delete 删除收藏夹以及里面收藏的内容，同时扣减收藏数，返回被删除的内容
+	Delete(ctx context.Context, uid int64, id int64) ([]UserCollectionBiz, error)
+	FindById(ctx context.Context, id int64) (Collection, error)
+	FindByUid(ctx context.Context, uid int64) ([]Collection, error)
+	// CountItems 每个收藏夹里面有多少内容
+	CountItems(ctx context.Context, cids []int64) (map[int64]int64, error)
+	// FindItems 收藏夹里面的文章，带上线上库的标题，按照收藏时间倒序
+	FindItems(ctx context.Context, uid int64, cid int64, offset int, limit int) ([]CollectionItem, error)
+	// MoveItems 把 bizIds 移动到收藏夹 to，返回实际移动的数量
+	MoveItems(ctx context.Context, uid int64, biz string, bizIds []int64, to int64) (int64, error)
+}
+
+type GORMCollectionDAO struct {
+	db *gorm.DB
+}
+
+func NewGORMCollectionDAO(db *gorm.DB) CollectionDAO {
+	return &GORMCollectionDAO{db: db}
+}
+
+func (dao *GORMCollectionDAO) Insert(ctx context.Context, c Collection) (int64, error) {
+	now := time.Now().UnixMilli()
+	c.Ctime = now
+	c.Utime = now
+	err := dao.db.WithContext(ctx).Create(&c).Error
+	return c.Id, dao.duplicateErr(err)
+}
+
+func (dao *GORMCollectionDAO) UpdateName(ctx context.Context, uid int64, id int64, name string) error {
+	res := dao.db.WithContext(ctx).Model(&Collection{}).Where("id = ? AND uid = ?", id, uid).
+		Updates(map[string]any{
+			"name":  name,
+			"utime": time.Now().UnixMilli(),
+		})
+	if res.Error != nil {
+		return dao.duplicateErr(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		// 名字没变的时候也会走到这里，所以再确认一次是不是真的不存在
+		var cnt int64
+		err := dao.db.WithContext(ctx).Model(&Collection{}).Where("id = ? AND uid = ?", id, uid).Count(&cnt).Error
+		if err != nil {
+			return err
+		}
+		if cnt == 0 {
+			return ErrRecordNotFound
+		}
+	}
+	return nil
+}
+
+func (dao *GORMCollectionDAO) Delete(ctx context.Context, uid int64, id int64) ([]UserCollectionBiz, error) {
+	now := time.Now().UnixMilli()
+	var items []UserCollectionBiz
+	err := dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("id = ? AND uid = ?", id, uid).Delete(&Collection{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrRecordNotFound
+		}
+		err := tx.Where("uid = ? AND cid = ?", uid, id).Find(&items).Error
+		if err != nil || len(items) == 0 {
+			return err
+		}
+		err = tx.Where("uid = ? AND cid = ?", uid, id).Delete(&UserCollectionBiz{}).Error
+		if err != nil {
+			return err
+		}
+		// 和取消收藏一样扣减收藏数，同一个用户同一个内容只会收藏一次，所以每个 biz 一条 UPDATE 就够了
+		bizIds := make(map[string][]int64, 1)
+		for _, item := range items {
+			bizIds[item.Biz] = append(bizIds[item.Biz], item.BizId)
+		}
+		for biz, ids := range bizIds {
+			if err = decrCollectCnt(tx, biz, ids, now); err != nil {
+				return err
+			}
+		}
+		// 每一篇文章都要发取消收藏的事件，否则热榜这些消费者的数据就对不上了
+		for _, item := range items {
+			if item.Biz != bizArticle {
+				continue
+			}
+			err = insertOutbox(tx, schema.TopicCollectEvent, item.BizId,
+				schema.CollectEvent{Aid: item.BizId, Uid: uid, Cid: id, Cancelled: true})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return items, err
+}
+
+func (dao *GORMCollectionDAO) FindById(ctx context.Context, id int64) (Collection, error) {
+	var c Collection
+	err := dao.db.WithContext(ctx).Where("id = ?", id).First(&c).Error
+	return c, err
+}
+
+func (dao *GORMCollectionDAO) FindByUid(ctx context.Context, uid int64) ([]Collection, error) {
+	var res []Collection
+	err := dao.db.WithContext(ctx).Where("uid = ?", uid).Order("id ASC").Find(&res).Error
+	return res, err
+}
+
+func (dao *GORMCollectionDAO) CountItems(ctx context.Context, cids []int64) (map[int64]int64, error) {
+	type Row struct {
+		Cid int64
+		Cnt int64
+	}
+	var rows []Row
+	err := dao.db.WithContext(ctx).Model(&UserCollectionBiz{}).
+		Select("cid, COUNT(*) AS cnt").Where("cid IN ?", cids).
+		Group("cid").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[int64]int64, len(rows))
+	for _, row := range rows {
+		res[row.Cid] = row.Cnt
+	}
+	return res, nil
+}
+
+func (dao *GORMCollectionDAO) FindItems(ctx context.Context, uid int64, cid int64, offset int, limit int) ([]CollectionItem, error) {
+	var res []CollectionItem
+	// 目前只有文章可以收藏，标题以线上库为准，撤回的文章标题为空
+	err := dao.db.WithContext(ctx).Model(&UserCollectionBiz{}).
+		Select("user_collection_bizs.biz, user_collection_bizs.biz_id, user_collection_bizs.cid, "+
+			"user_collection_bizs.ctime, published_articles.title").
+		Joins("LEFT JOIN published_articles ON user_collection_bizs.biz = ? AND published_articles.id = user_collection_bizs.biz_id "+
+			"AND published_articles.status = ?", "article", articleStatusPublished).
+		Where("user_collection_bizs.uid = ? AND user_collection_bizs.cid = ?", uid, cid).
+		Order("user_collection_bizs.id DESC").
+		Offset(offset).Limit(limit).
+		Scan(&res).Error
+	return res, err
+}
+
+func (dao *GORMCollectionDAO) MoveItems(ctx context.Context, uid int64, biz string, bizIds []int64, to int64) (int64, error) {
+	res := dao.db.WithContext(ctx).Model(&UserCollectionBiz{}).
+		Where("uid = ? AND biz = ? AND biz_id IN ?", uid, biz, bizIds).
+		Updates(map[string]any{
+			"cid":   to,
+			"utime": time.Now().UnixMilli(),
+		})
+	return res.RowsAffected, res.Error
+}
+
+// duplicateErr 把唯一索引冲突转换成 ErrCollectionDuplicate
+func (dao *GORMCollectionDAO) duplicateErr(err error) error {
+	if isUniqueConflict(err) {
+		return ErrCollectionDuplicate
+	}
+	return err
+}
+
+// isUniqueConflict 是否违反了唯一索引
+func isUniqueConflict(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	const uniqueConflictsErrNo uint16 = 1062
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == uniqueConflictsErrNo
+}
+
+// Collection 收藏夹，同一个用户的收藏夹不能重名
+type Collection struct {
+	Id    int64  `gorm:"primaryKey,autoIncrement"`
+	Uid   int64  `gorm:"uniqueIndex:uid_name"`
+	Name  string `gorm:"type:varchar(128);uniqueIndex:uid_name"`
+	Ctime int64
+	Utime int64
+}
+
+// CollectionItem 收藏夹里面的一条内容，不是表
+type CollectionItem struct {
+	Biz   string
+	BizId int64
+	Cid   int64
+	Title string
+	Ctime int64
+}
@@ -0,0 +1,51 @@
+package dao
+
+import (
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"testing"
+)
+
+func TestGORMCollectionDAO_Delete(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM `collections` WHERE id = \\? AND uid = \\?").
+		WithArgs(1, 123).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT \\* FROM `user_collection_bizs` WHERE uid = \\? AND cid = \\?").
+		WithArgs(123, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "uid", "biz", "biz_id", "cid"}).
+			AddRow(10, 123, "article", 2, 1).
+			AddRow(11, 123, "article", 3, 1))
+	mock.ExpectExec("DELETE FROM `user_collection_bizs` WHERE uid = \\? AND cid = \\?").
+		WithArgs(123, 1).WillReturnResult(sqlmock.NewResult(0, 2))
+	// 一条语句扣减所有文章的收藏数，不会扣成负数
+	mock.ExpectExec("UPDATE `interactives` SET .* WHERE biz = \\? AND biz_id IN \\(\\?,\\?\\) AND collect_cnt > 0").
+		WithArgs(1, sqlmock.AnyArg(), "article", 2, 3).WillReturnResult(sqlmock.NewResult(0, 2))
+	// 每一篇文章一条取消收藏的事件
+	mock.ExpectExec("INSERT INTO `outbox_messages`").
+		WithArgs("article_collect_event", "2", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+			sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO `outbox_messages`").
+		WithArgs("article_collect_event", "3", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+			sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectCommit()
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		Conn:                      sqlDB,
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+	})
+	assert.NoError(t, err)
+	dao := NewGORMCollectionDAO(db)
+	items, err := dao.Delete(context.Background(), 123, 1)
+	assert.NoError(t, err)
+	assert.Len(t, items, 2)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
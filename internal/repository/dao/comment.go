@@ -0,0 +1,133 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+//go:generate mockgen -source=./comment.go -package=daomocks -destination=./mocks/comment.mock.go CommentDAO
+type CommentDAO interface {
+	Insert(ctx context.Context, c Comment) (int64, error)
+	FindById(ctx context.Context, id int64) (Comment, error)
+	// Delete 删除一条评论，如果是根评论会连同它下面的回复一起删除
+	Delete(ctx context.Context, c Comment) error
+	// FindRoots 按照 id 倒序，cursor 是上一页最后一条评论的 id，0 表示第一页
+	FindRoots(ctx context.Context, biz string, bizId int64, cursor int64, limit int) ([]Comment, error)
+	// FindReplies 按照 id 正序，cursor 是上一页最后一条回复的 id，0 表示第一页
+	FindReplies(ctx context.Context, rootId int64, cursor int64, limit int) ([]Comment, error)
+	// FindFirstReplies 每个根评论最早的 n 条回复
+	FindFirstReplies(ctx context.Context, rootIds []int64, n int) ([]Comment, error)
+	// CountReplies 每个根评论下面的回复数量
+	CountReplies(ctx context.Context, rootIds []int64) (map[int64]int64, error)
+	// CountByBiz 每个资源下面的评论数量，包括回复
+	CountByBiz(ctx context.Context, biz string, bizIds []int64) (map[int64]int64, error)
+}
+
+type GORMCommentDAO struct {
+	db *gorm.DB
+}
+
+func NewGORMCommentDAO(db *gorm.DB) CommentDAO {
+	return &GORMCommentDAO{db: db}
+}
+
+func (dao *GORMCommentDAO) Insert(ctx context.Context, c Comment) (int64, error) {
+	now := time.Now().UnixMilli()
+	c.Ctime = now
+	c.Utime = now
+	err := dao.db.WithContext(ctx).Create(&c).Error
+	return c.Id, err
+}
+
+func (dao *GORMCommentDAO) FindById(ctx context.Context, id int64) (Comment, error) {
+	var c Comment
+	err := dao.db.WithContext(ctx).Where("id = ?", id).First(&c).Error
+	return c, err
+}
+
+func (dao *GORMCommentDAO) Delete(ctx context.Context, c Comment) error {
+	db := dao.db.WithContext(ctx)
+	if c.RootId == 0 {
+		return db.Where("id = ? OR root_id = ?", c.Id, c.Id).Delete(&Comment{}).Error
+	}
+	return db.Where("id = ?", c.Id).Delete(&Comment{}).Error
+}
+
+func (dao *GORMCommentDAO) FindRoots(ctx context.Context, biz string, bizId int64, cursor int64, limit int) ([]Comment, error) {
+	query := dao.db.WithContext(ctx).Where("biz = ? AND biz_id = ? AND root_id = 0", biz, bizId)
+	if cursor > 0 {
+		query = query.Where("id < ?", cursor)
+	}
+	var res []Comment
+	err := query.Order("id DESC").Limit(limit).Find(&res).Error
+	return res, err
+}
+
+func (dao *GORMCommentDAO) FindReplies(ctx context.Context, rootId int64, cursor int64, limit int) ([]Comment, error) {
+	var res []Comment
+	err := dao.db.WithContext(ctx).Where("root_id = ? AND id > ?", rootId, cursor).
+		Order("id ASC").Limit(limit).Find(&res).Error
+	return res, err
+}
+
+func (dao *GORMCommentDAO) FindFirstReplies(ctx context.Context, rootIds []int64, n int) ([]Comment, error) {
+	if len(rootIds) == 0 || n <= 0 {
+		return []Comment{}, nil
+	}
+	// 每个根评论单独 LIMIT，用 UNION ALL 合成一次查询
+	parts := make([]string, 0, len(rootIds))
+	args := make([]any, 0, len(rootIds)*2)
+	for _, id := range rootIds {
+		parts = append(parts, "(SELECT * FROM comments WHERE root_id = ? ORDER BY id ASC LIMIT ?)")
+		args = append(args, id, n)
+	}
+	var res []Comment
+	err := dao.db.WithContext(ctx).Raw(strings.Join(parts, " UNION ALL "), args...).Scan(&res).Error
+	return res, err
+}
+
+func (dao *GORMCommentDAO) CountReplies(ctx context.Context, rootIds []int64) (map[int64]int64, error) {
+	return dao.count("root_id", dao.db.WithContext(ctx).Where("root_id IN ?", rootIds))
+}
+
+func (dao *GORMCommentDAO) CountByBiz(ctx context.Context, biz string, bizIds []int64) (map[int64]int64, error) {
+	return dao.count("biz_id", dao.db.WithContext(ctx).Where("biz = ? AND biz_id IN ?", biz, bizIds))
+}
+
+// count 按照 col 分组计数
+func (dao *GORMCommentDAO) count(col string, query *gorm.DB) (map[int64]int64, error) {
+	type Row struct {
+		Id  int64
+		Cnt int64
+	}
+	var rows []Row
+	err := query.Model(&Comment{}).Select(fmt.Sprintf("%s AS id, COUNT(*) AS cnt", col)).
+		Group(col).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[int64]int64, len(rows))
+	for _, row := range rows {
+		res[row.Id] = row.Cnt
+	}
+	return res, nil
+}
+
+// Comment 评论，和 Interactive 一样用 <biz, biz_id> 表示评论的资源
+type Comment struct {
+	Id  int64 `gorm:"primaryKey,autoIncrement"`
+	Uid int64 `gorm:"index"`
+	// 查询某个资源的根评论
+	Biz     string `gorm:"type:varchar(128);index:comment_biz_type_id"`
+	BizId   int64  `gorm:"index:comment_biz_type_id"`
+	Content string `gorm:"type:text"`
+	// 根评论的 id，根评论自己是 0。所有回复都挂在根评论下面，不再继续嵌套
+	RootId int64 `gorm:"index"`
+	// 直接回复的评论 id，根评论是 0
+	ParentId int64
+	Ctime    int64
+	Utime    int64
+}
@@ -0,0 +1,56 @@
+package dao
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+//go:generate mockgen -source=./feed.go -package=daomocks -destination=./mocks/feed.mock.go FeedDAO
+type FeedDAO interface {
+	// InsertInbox 同一个用户的收件箱里面同一篇文章只有一条，重复推送什么也不做
+	InsertInbox(ctx context.Context, items []FeedInbox) error
+	// FindInbox 按照时间和文章 id 倒序，beforeCtime 和 beforeAid 是上一页最后一条，都是 0 表示第一页
+	FindInbox(ctx context.Context, uid int64, beforeCtime int64, beforeAid int64, limit int) ([]FeedInbox, error)
+}
+
+type GORMFeedDAO struct {
+	db *gorm.DB
+}
+
+func NewGORMFeedDAO(db *gorm.DB) FeedDAO {
+	return &GORMFeedDAO{db: db}
+}
+
+func (dao *GORMFeedDAO) InsertInbox(ctx context.Context, items []FeedInbox) error {
+	if len(items) == 0 {
+		return nil
+	}
+	// 修改之后重新发表不会把旧文章顶到前面
+	return dao.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "uid"}, {Name: "aid"}},
+		DoNothing: true,
+	}).Create(&items).Error
+}
+
+func (dao *GORMFeedDAO) FindInbox(ctx context.Context, uid int64, beforeCtime int64, beforeAid int64, limit int) ([]FeedInbox, error) {
+	query := dao.db.WithContext(ctx).Where("uid = ?", uid)
+	if beforeCtime > 0 || beforeAid > 0 {
+		query = query.Where("ctime < ? OR (ctime = ? AND aid < ?)", beforeCtime, beforeCtime, beforeAid)
+	}
+	var res []FeedInbox
+	err := query.Order("ctime DESC, aid DESC").Limit(limit).Find(&res).Error
+	return res, err
+}
+
+// FeedInbox 推模式下每个粉丝的收件箱，一篇文章发表之后给每个粉丝写一条
+type FeedInbox struct {
+	Id int64 `gorm:"primaryKey,autoIncrement"`
+	// 按照时间倒序查询某个人的收件箱
+	Uid int64 `gorm:"uniqueIndex:feed_uid_aid;index:feed_uid_ctime,priority:1;index:feed_uid_author,priority:1"`
+	Aid int64 `gorm:"uniqueIndex:feed_uid_aid;index:feed_uid_ctime,priority:3"`
+	// 取消关注的时候按照作者删除
+	AuthorId int64 `gorm:"index:feed_uid_author,priority:2"`
+	// 文章第一次发表的时间，也是 feed 排序的依据
+	Ctime int64 `gorm:"index:feed_uid_ctime,priority:2"`
+}
@@ -0,0 +1,194 @@
+package dao
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+const (
+	followStatusInactive uint8 = 0
+	followStatusActive   uint8 = 1
+)
+
+//go:generate mockgen -source=./follow.go -package=daomocks -destination=./mocks/follow.mock.go FollowDAO
+type FollowDAO interface {
+	// Follow 返回关注关系是否发生了变化，已经关注过的时候返回 false
+	Follow(ctx context.Context, follower, followee int64) (bool, error)
+	// Unfollow 返回关注关系是否发生了变化，本来就没有关注的时候返回 false。
+	// 同时删掉推到 follower 收件箱里面的 followee 的文章
+	Unfollow(ctx context.Context, follower, followee int64) (bool, error)
+	// FindRelation 只会找有效的关注关系
+	FindRelation(ctx context.Context, follower, followee int64) (FollowRelation, error)
+	// FindFollowers 按照 id 倒序，cursor 是上一页最后一条关系的 id，0 表示第一页
+	FindFollowers(ctx context.Context, followee int64, cursor int64, limit int) ([]FollowRelation, error)
+	FindFollowees(ctx context.Context, follower int64, cursor int64, limit int) ([]FollowRelation, error)
+	GetStatistic(ctx context.Context, uid int64) (FollowStatistic, error)
+	// FindFolloweesByFollowers follower 关注的人里面粉丝数不少于 minFollowers 的
+	FindFolloweesByFollowers(ctx context.Context, follower int64, minFollowers int64) ([]int64, error)
+}
+
+type GORMFollowDAO struct {
+	db *gorm.DB
+}
+
+func NewGORMFollowDAO(db *gorm.DB) FollowDAO {
+	return &GORMFollowDAO{db: db}
+}
+
+func (dao *GORMFollowDAO) Follow(ctx context.Context, follower, followee int64) (bool, error) {
+	now := time.Now().UnixMilli()
+	changed := false
+	err := dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// 第一次关注直接插入，已经有关系的时候什么都不做，不需要先锁再插入
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&FollowRelation{
+			Follower: follower,
+			Followee: followee,
+			Status:   followStatusActive,
+			Ctime:    now,
+			Utime:    now,
+		})
+		if res.Error != nil {
+			return res.Error
+		}
+		changed = res.RowsAffected > 0
+		if !changed {
+			// 之前取消过关注的重新关注，已经关注的不会命中
+			res = tx.Model(&FollowRelation{}).
+				Where("follower = ? AND followee = ? AND status = ?", follower, followee, followStatusInactive).
+				Updates(map[string]any{
+					"status": followStatusActive,
+					"utime":  now,
+				})
+			if res.Error != nil {
+				return res.Error
+			}
+			changed = res.RowsAffected > 0
+		}
+		if !changed {
+			return nil
+		}
+		return dao.incrStatistic(tx, follower, followee, 1, now)
+	})
+	return changed, err
+}
+
+func (dao *GORMFollowDAO) Unfollow(ctx context.Context, follower, followee int64) (bool, error) {
+	now := time.Now().UnixMilli()
+	changed := false
+	err := dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// 只有真的从关注变成取消关注才修改计数
+		res := tx.Model(&FollowRelation{}).
+			Where("follower = ? AND followee = ? AND status = ?", follower, followee, followStatusActive).
+			Updates(map[string]any{
+				"status": followStatusInactive,
+				"utime":  now,
+			})
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		changed = true
+		err := dao.incrStatistic(tx, follower, followee, -1, now)
+		if err != nil {
+			return err
+		}
+		return tx.Where("uid = ? AND author_id = ?", follower, followee).Delete(&FeedInbox{}).Error
+	})
+	return changed, err
+}
+
+// incrStatistic 关注者的关注数和被关注者的粉丝数一起修改
+func (dao *GORMFollowDAO) incrStatistic(tx *gorm.DB, follower, followee int64, delta int64, now int64) error {
+	err := tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "uid"}},
+		DoUpdates: clause.Assignments(map[string]any{
+			"followees": gorm.Expr("followees + ?", delta),
+			"utime":     now,
+		}),
+	}).Create(&FollowStatistic{
+		Uid:       follower,
+		Followees: max(delta, 0),
+		Ctime:     now,
+		Utime:     now,
+	}).Error
+	if err != nil {
+		return err
+	}
+	return tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "uid"}},
+		DoUpdates: clause.Assignments(map[string]any{
+			"followers": gorm.Expr("followers + ?", delta),
+			"utime":     now,
+		}),
+	}).Create(&FollowStatistic{
+		Uid:       followee,
+		Followers: max(delta, 0),
+		Ctime:     now,
+		Utime:     now,
+	}).Error
+}
+
+func (dao *GORMFollowDAO) FindRelation(ctx context.Context, follower, followee int64) (FollowRelation, error) {
+	var rel FollowRelation
+	err := dao.db.WithContext(ctx).
+		Where("follower = ? AND followee = ? AND status = ?", follower, followee, followStatusActive).
+		First(&rel).Error
+	return rel, err
+}
+
+func (dao *GORMFollowDAO) FindFollowers(ctx context.Context, followee int64, cursor int64, limit int) ([]FollowRelation, error) {
+	return dao.findList(dao.db.WithContext(ctx).Where("followee = ?", followee), cursor, limit)
+}
+
+func (dao *GORMFollowDAO) FindFollowees(ctx context.Context, follower int64, cursor int64, limit int) ([]FollowRelation, error) {
+	return dao.findList(dao.db.WithContext(ctx).Where("follower = ?", follower), cursor, limit)
+}
+
+func (dao *GORMFollowDAO) FindFolloweesByFollowers(ctx context.Context, follower int64, minFollowers int64) ([]int64, error) {
+	var res []int64
+	err := dao.db.WithContext(ctx).Model(&FollowRelation{}).
+		Joins("JOIN follow_statistics ON follow_statistics.uid = follow_relations.followee").
+		Where("follow_relations.follower = ? AND follow_relations.status = ? AND follow_statistics.followers >= ?",
+			follower, followStatusActive, minFollowers).
+		Pluck("follow_relations.followee", &res).Error
+	return res, err
+}
+
+func (dao *GORMFollowDAO) findList(query *gorm.DB, cursor int64, limit int) ([]FollowRelation, error) {
+	query = query.Where("status = ?", followStatusActive)
+	if cursor > 0 {
+		query = query.Where("id < ?", cursor)
+	}
+	var res []FollowRelation
+	err := query.Order("id DESC").Limit(limit).Find(&res).Error
+	return res, err
+}
+
+func (dao *GORMFollowDAO) GetStatistic(ctx context.Context, uid int64) (FollowStatistic, error) {
+	var s FollowStatistic
+	err := dao.db.WithContext(ctx).Where("uid = ?", uid).First(&s).Error
+	return s, err
+}
+
+// FollowRelation 关注关系，取消关注的时候只修改状态
+type FollowRelation struct {
+	Id int64 `gorm:"primaryKey,autoIncrement"`
+	// 查询某个人关注了谁
+	Follower int64 `gorm:"uniqueIndex:follower_followee"`
+	// 查询某个人的粉丝
+	Followee int64 `gorm:"uniqueIndex:follower_followee;index"`
+	Status   uint8
+	Ctime    int64
+	Utime    int64
+}
+
+// FollowStatistic 关注数和粉丝数
+type FollowStatistic struct {
+	Id        int64 `gorm:"primaryKey,autoIncrement"`
+	Uid       int64 `gorm:"unique"`
+	Followers int64
+	Followees int64
+	Ctime     int64
+	Utime     int64
+}
@@ -0,0 +1,76 @@
+package dao
+
+import (
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"testing"
+)
+
+func TestGORMFollowDAO_Follow(t *testing.T) {
+	testCases := []struct {
+		name string
+
+		mock func(mock sqlmock.Sqlmock)
+
+		wantChanged bool
+	}{
+		{
+			name: "第一次关注",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec("INSERT INTO `follow_relations` .* ON DUPLICATE KEY UPDATE `id`=`id`").
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec("INSERT INTO `follow_statistics`").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec("INSERT INTO `follow_statistics`").WillReturnResult(sqlmock.NewResult(2, 1))
+				mock.ExpectCommit()
+			},
+			wantChanged: true,
+		},
+		{
+			name: "取消过关注的重新关注",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec("INSERT INTO `follow_relations`").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec("UPDATE `follow_relations` SET .* WHERE follower = \\? AND followee = \\? AND status = \\?").
+					WithArgs(followStatusActive, sqlmock.AnyArg(), 123, 456, followStatusInactive).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("INSERT INTO `follow_statistics`").WillReturnResult(sqlmock.NewResult(1, 2))
+				mock.ExpectExec("INSERT INTO `follow_statistics`").WillReturnResult(sqlmock.NewResult(2, 2))
+				mock.ExpectCommit()
+			},
+			wantChanged: true,
+		},
+		{
+			name: "已经关注过，不修改计数",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec("INSERT INTO `follow_relations`").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec("UPDATE `follow_relations`").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sqlDB, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			tc.mock(mock)
+			db, err := gorm.Open(mysql.New(mysql.Config{
+				Conn:                      sqlDB,
+				SkipInitializeWithVersion: true,
+			}), &gorm.Config{
+				DisableAutomaticPing:   true,
+				SkipDefaultTransaction: true,
+			})
+			assert.NoError(t, err)
+			dao := NewGORMFollowDAO(db)
+			changed, err := dao.Follow(context.Background(), 123, 456)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantChanged, changed)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
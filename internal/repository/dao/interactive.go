@@ -1,22 +1,47 @@
 package dao
 
 import (
+	"cmp"
 	"context"
+	"github.com/Tuanzi-bug/tuan-book/internal/events/schema"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
+	"slices"
+	"strings"
 	"time"
 )
 
+//go:generate mockgen -source=./interactive.go -package=daomocks -destination=./mocks/interactive.mock.go InteractiveDAO
 type InteractiveDAO interface {
 	IncrReadCnt(ctx context.Context, biz string, bizId int64) error
-	InsertLikeInfo(ctx context.Context, biz string, id int64, uid int64) error
-	DeleteLikeInfo(ctx context.Context, biz string, id int64, uid int64) error
+	// InsertLikeInfo 点赞，返回点赞状态是否发生了变化以及最新的点赞数，已经点赞过的不会重复计数
+	InsertLikeInfo(ctx context.Context, biz string, id int64, uid int64) (bool, int64, error)
+	// DeleteLikeInfo 取消点赞，返回值和 InsertLikeInfo 一样，没有点赞过的不会扣减
+	DeleteLikeInfo(ctx context.Context, biz string, id int64, uid int64) (bool, int64, error)
+	// InsertCollectionBiz 收藏，已经收藏过的返回 ErrCollectItemDuplicate
 	InsertCollectionBiz(ctx context.Context, cb UserCollectionBiz) error
+	// DeleteCollectionBiz 取消收藏，没有收藏过的时候返回 ErrRecordNotFound
+	DeleteCollectionBiz(ctx context.Context, biz string, id int64, uid int64) error
 	Get(ctx context.Context, biz string, id int64) (Interactive, error)
 	GetLikeInfo(ctx context.Context, biz string, id int64, uid int64) (UserLikeBiz, error)
+	// FindLikes 用户点赞过的内容，按照点赞时间倒序，before 是上一页最后一条的时间，0 表示第一页
+	FindLikes(ctx context.Context, biz string, uid int64, before int64, limit int) ([]UserLikeBiz, error)
 	GetCollectInfo(ctx context.Context, biz string, id int64, uid int64) (UserCollectionBiz, error)
-	BatchIncrReadCnt(ctx context.Context, bizs []string, ids []int64) error
+	// GetLikeInfos uid 在 ids 里面点赞过的记录，没有点赞的不会返回
+	GetLikeInfos(ctx context.Context, biz string, ids []int64, uid int64) ([]UserLikeBiz, error)
+	// GetCollectInfos uid 在 ids 里面收藏过的记录，没有收藏的不会返回
+	GetCollectInfos(ctx context.Context, biz string, ids []int64, uid int64) ([]UserCollectionBiz, error)
+	// BatchIncrReadCnt 三个切片一一对应，同一个 biz 和 id 只能出现一次
+	BatchIncrReadCnt(ctx context.Context, bizs []string, ids []int64, cnts []int64) error
 	GetByIds(ctx context.Context, biz string, ids []int64) ([]Interactive, error)
+	// ListAfter 按照 id 顺序扫描，afterId 为 0 表示从头开始
+	ListAfter(ctx context.Context, afterId int64, limit int) ([]Interactive, error)
+	// CountLikes 从点赞明细统计每个 id 的点赞数，没有点赞的不会返回
+	CountLikes(ctx context.Context, biz string, ids []int64) (map[int64]int64, error)
+	// CountCollects 从收藏明细统计每个 id 的收藏数，没有收藏的不会返回
+	CountCollects(ctx context.Context, biz string, ids []int64) (map[int64]int64, error)
+	// RepairCnt 锁住这一行，按照明细表重新计算点赞数和收藏数，返回修复之后的数据
+	RepairCnt(ctx context.Context, biz string, bizId int64) (Interactive, error)
 }
 
 type GROMInteractiveDAO struct {
@@ -29,17 +54,103 @@ func (G *GROMInteractiveDAO) GetByIds(ctx context.Context, biz string, ids []int
 	return inters, err
 }
 
-func (G *GROMInteractiveDAO) BatchIncrReadCnt(ctx context.Context, bizs []string, ids []int64) error {
-	return G.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		txdao := NewGORMInteractiveDAO(tx)
-		for i, biz := range bizs {
-			err := txdao.IncrReadCnt(ctx, biz, ids[i])
-			if err != nil {
-				return err
-			}
+func (G *GROMInteractiveDAO) ListAfter(ctx context.Context, afterId int64, limit int) ([]Interactive, error) {
+	var res []Interactive
+	err := G.db.WithContext(ctx).Where("id > ?", afterId).
+		Order("id ASC").Limit(limit).Find(&res).Error
+	return res, err
+}
+
+func (G *GROMInteractiveDAO) CountLikes(ctx context.Context, biz string, ids []int64) (map[int64]int64, error) {
+	return G.countBiz(G.db.WithContext(ctx).Model(&UserLikeBiz{}).
+		Where("biz = ? AND biz_id IN ? AND status = ?", biz, ids, 1))
+}
+
+func (G *GROMInteractiveDAO) CountCollects(ctx context.Context, biz string, ids []int64) (map[int64]int64, error) {
+	return G.countBiz(G.db.WithContext(ctx).Model(&UserCollectionBiz{}).
+		Where("biz = ? AND biz_id IN ?", biz, ids))
+}
+
+func (G *GROMInteractiveDAO) countBiz(query *gorm.DB) (map[int64]int64, error) {
+	type bizCnt struct {
+		BizId int64
+		Cnt   int64
+	}
+	var cnts []bizCnt
+	err := query.Select("biz_id, COUNT(*) AS cnt").Group("biz_id").Scan(&cnts).Error
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[int64]int64, len(cnts))
+	for _, c := range cnts {
+		res[c.BizId] = c.Cnt
+	}
+	return res, nil
+}
+
+func (G *GROMInteractiveDAO) RepairCnt(ctx context.Context, biz string, bizId int64) (Interactive, error) {
+	var intr Interactive
+	err := G.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// 点赞和收藏的事务最后都会更新这一行，先锁住这一行，
+		// 正在进行中的点赞会等我们提交之后再加一，统计出来的数就不会被覆盖
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("biz = ? AND biz_id = ?", biz, bizId).First(&intr).Error
+		if err != nil {
+			return err
+		}
+		var likeCnt, collectCnt int64
+		err = tx.Model(&UserLikeBiz{}).
+			Where("biz = ? AND biz_id = ? AND status = ?", biz, bizId, 1).Count(&likeCnt).Error
+		if err != nil {
+			return err
 		}
+		err = tx.Model(&UserCollectionBiz{}).
+			Where("biz = ? AND biz_id = ?", biz, bizId).Count(&collectCnt).Error
+		if err != nil {
+			return err
+		}
+		if intr.LikeCnt == likeCnt && intr.CollectCnt == collectCnt {
+			return nil
+		}
+		intr.LikeCnt, intr.CollectCnt = likeCnt, collectCnt
+		intr.Utime = time.Now().UnixMilli()
+		return tx.Model(&Interactive{}).Where("id = ?", intr.Id).Updates(map[string]any{
+			"like_cnt":    likeCnt,
+			"collect_cnt": collectCnt,
+			"utime":       intr.Utime,
+		}).Error
+	})
+	return intr, err
+}
+
+func (G *GROMInteractiveDAO) BatchIncrReadCnt(ctx context.Context, bizs []string, ids []int64, cnts []int64) error {
+	if len(bizs) == 0 {
 		return nil
+	}
+	now := time.Now().UnixMilli()
+	intrs := make([]Interactive, 0, len(bizs))
+	for i, biz := range bizs {
+		intrs = append(intrs, Interactive{
+			Biz:     biz,
+			BizId:   ids[i],
+			ReadCnt: cnts[i],
+			Utime:   now,
+			Ctime:   now,
+		})
+	}
+	// 多个消费者同时写的时候，按照相同的顺序加锁避免死锁
+	slices.SortFunc(intrs, func(a, b Interactive) int {
+		if c := strings.Compare(a.Biz, b.Biz); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.BizId, b.BizId)
 	})
+	// 一条 INSERT ... ON DUPLICATE KEY UPDATE 写完一整批
+	// read_cnt = read_cnt + VALUES(read_cnt)
+	return G.db.WithContext(ctx).Clauses(clause.OnConflict{DoUpdates: clause.Assignments(map[string]interface{}{
+		"read_cnt": gorm.Expr("read_cnt + VALUES(read_cnt)"),
+		"utime":    now,
+	})}).Create(&intrs).Error
 }
 
 func (G *GROMInteractiveDAO) GetCollectInfo(ctx context.Context, biz string, id int64, uid int64) (UserCollectionBiz, error) {
@@ -48,12 +159,38 @@ func (G *GROMInteractiveDAO) GetCollectInfo(ctx context.Context, biz string, id
 	return ucb, err
 }
 
+func (G *GROMInteractiveDAO) GetLikeInfos(ctx context.Context, biz string, ids []int64, uid int64) ([]UserLikeBiz, error) {
+	var res []UserLikeBiz
+	err := G.db.WithContext(ctx).
+		Where("uid = ? AND biz = ? AND biz_id IN ? AND status = ?", uid, biz, ids, 1).
+		Find(&res).Error
+	return res, err
+}
+
+func (G *GROMInteractiveDAO) GetCollectInfos(ctx context.Context, biz string, ids []int64, uid int64) ([]UserCollectionBiz, error) {
+	var res []UserCollectionBiz
+	err := G.db.WithContext(ctx).
+		Where("uid = ? AND biz = ? AND biz_id IN ?", uid, biz, ids).
+		Find(&res).Error
+	return res, err
+}
+
 func (G *GROMInteractiveDAO) GetLikeInfo(ctx context.Context, biz string, id int64, uid int64) (UserLikeBiz, error) {
 	var ulb UserLikeBiz
 	err := G.db.WithContext(ctx).Where("biz = ? AND biz_id = ? AND uid = ? AND status = ?", biz, id, uid, 1).First(&ulb).Error
 	return ulb, err
 }
 
+func (G *GROMInteractiveDAO) FindLikes(ctx context.Context, biz string, uid int64, before int64, limit int) ([]UserLikeBiz, error) {
+	query := G.db.WithContext(ctx).Where("uid = ? AND biz = ? AND status = ?", uid, biz, 1)
+	if before > 0 {
+		query = query.Where("utime < ?", before)
+	}
+	var res []UserLikeBiz
+	err := query.Order("utime DESC").Limit(limit).Find(&res).Error
+	return res, err
+}
+
 func (G *GROMInteractiveDAO) Get(ctx context.Context, biz string, id int64) (Interactive, error) {
 	var intr Interactive
 	err := G.db.WithContext(ctx).Where("biz = ? AND biz_id = ?", biz, id).First(&intr).Error
@@ -65,10 +202,14 @@ func (G *GROMInteractiveDAO) InsertCollectionBiz(ctx context.Context, cb UserCol
 	now := time.Now().UnixMilli()
 	return G.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		err := tx.Create(&cb).Error
+		if isUniqueConflict(err) {
+			// 已经收藏在某个收藏夹里面了，不能重复计数
+			return ErrCollectItemDuplicate
+		}
 		if err != nil {
 			return err
 		}
-		return tx.WithContext(ctx).Clauses(clause.OnConflict{DoUpdates: clause.Assignments(map[string]interface{}{
+		err = tx.WithContext(ctx).Clauses(clause.OnConflict{DoUpdates: clause.Assignments(map[string]interface{}{
 			// collect_cnt = collect_cnt + 1
 			"collect_cnt": gorm.Expr("collect_cnt + ?", 1),
 			"utime":       now,
@@ -79,67 +220,164 @@ func (G *GROMInteractiveDAO) InsertCollectionBiz(ctx context.Context, cb UserCol
 			Utime:      now,
 			Ctime:      now,
 		}).Error
+		if err != nil || cb.Biz != bizArticle {
+			return err
+		}
+		return insertOutbox(tx, schema.TopicCollectEvent, cb.BizId, schema.CollectEvent{Aid: cb.BizId, Uid: cb.Uid, Cid: cb.Cid})
 	})
 }
 
-func (G *GROMInteractiveDAO) DeleteLikeInfo(ctx context.Context, biz string, id int64, uid int64) error {
-	// 对点赞数据的删除，如果真实删除会导致磁盘有很多空洞影响性能
-	// 同时希望保留用户的点赞记录，所以采用逻辑删除
-	// 需要修改两个表：总数据表和用户点赞表，需要使用事务保证数据一致性
+func (G *GROMInteractiveDAO) DeleteCollectionBiz(ctx context.Context, biz string, id int64, uid int64) error {
+	// 和 InsertCollectionBiz 对称，收藏记录直接删除，同时扣减收藏数
 	now := time.Now().UnixMilli()
 	return G.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		// 更新用户点赞表
-		err := tx.Model(&UserLikeBiz{}).Where("uid = ? AND biz_id = ? AND biz = ?", uid, id, biz).Updates(map[string]interface{}{
-			"status": 0,
-			"utime":  now,
-		}).Error
-		if err != nil {
+		res := tx.Where("uid = ? AND biz_id = ? AND biz = ?", uid, id, biz).Delete(&UserCollectionBiz{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrRecordNotFound
+		}
+		err := decrCollectCnt(tx, biz, []int64{id}, now)
+		if err != nil || biz != bizArticle {
 			return err
 		}
-		// 更新总数据表
-		return tx.Model(&Interactive{}).Where("biz_id = ? AND biz = ?", id, biz).Updates(map[string]interface{}{
-			"like_cnt": gorm.Expr("like_cnt - ?", 1),
-			"utime":    now,
-		}).Error
+		return insertOutbox(tx, schema.TopicCollectEvent, id, schema.CollectEvent{Aid: id, Uid: uid, Cancelled: true})
 	})
 }
 
-func (G *GROMInteractiveDAO) InsertLikeInfo(ctx context.Context, biz string, id int64, uid int64) error {
-	// 点赞数据可能不存在，所以需要考虑upsert语义
+// decrCollectCnt 取消收藏之后每个 id 的收藏数减一，不会减成负数
+func decrCollectCnt(tx *gorm.DB, biz string, ids []int64, now int64) error {
+	return tx.Model(&Interactive{}).Where("biz = ? AND biz_id IN ? AND collect_cnt > 0", biz, ids).
+		Updates(map[string]interface{}{
+			"collect_cnt": gorm.Expr("collect_cnt - ?", 1),
+			"utime":       now,
+		}).Error
+}
+
+func (G *GROMInteractiveDAO) DeleteLikeInfo(ctx context.Context, biz string, id int64, uid int64) (bool, int64, error) {
+	// 对点赞数据的删除，如果真实删除会导致磁盘有很多空洞影响性能
+	// 同时希望保留用户的点赞记录，所以采用逻辑删除
 	// 需要修改两个表：总数据表和用户点赞表，需要使用事务保证数据一致性
 	now := time.Now().UnixMilli()
-	return G.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		// 更新用户点赞表
-		err := tx.Clauses(clause.OnConflict{
-			DoUpdates: clause.Assignments(map[string]interface{}{
+	var (
+		changed bool
+		likeCnt int64
+	)
+	err := G.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// 只有从点赞变成取消点赞才修改总数，重复取消或者没有点赞过都不会扣减
+		res := tx.Model(&UserLikeBiz{}).
+			Where("uid = ? AND biz_id = ? AND biz = ? AND status = ?", uid, id, biz, 1).
+			Updates(map[string]interface{}{
+				"status": 0,
 				"utime":  now,
-				"status": 1,
-			}),
-		}).Create(&UserLikeBiz{
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected > 0 {
+			changed = true
+			// 更新总数据表，已经是 0 的不再扣减
+			err := tx.Model(&Interactive{}).Where("biz_id = ? AND biz = ? AND like_cnt > 0", id, biz).
+				Updates(map[string]interface{}{
+					"like_cnt": gorm.Expr("like_cnt - ?", 1),
+					"utime":    now,
+				}).Error
+			if err != nil {
+				return err
+			}
+			err = G.insertLikeEvent(tx, biz, id, uid, false)
+			if err != nil {
+				return err
+			}
+		}
+		var er error
+		likeCnt, er = G.likeCnt(tx, biz, id)
+		return er
+	})
+	return changed, likeCnt, err
+}
+
+func (G *GROMInteractiveDAO) InsertLikeInfo(ctx context.Context, biz string, id int64, uid int64) (bool, int64, error) {
+	// 需要修改两个表：总数据表和用户点赞表，需要使用事务保证数据一致性
+	now := time.Now().UnixMilli()
+	var (
+		changed bool
+		likeCnt int64
+	)
+	err := G.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// 第一次点赞直接插入，已经有记录的时候什么都不做
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&UserLikeBiz{
 			Uid:    uid,
 			BizId:  id,
 			Biz:    biz,
 			Status: 1,
 			Utime:  now,
 			Ctime:  now,
-		}).Error
-		if err != nil {
-			return err
+		})
+		if res.Error != nil {
+			return res.Error
 		}
-		// 更新总数据表
-		return tx.WithContext(ctx).Clauses(clause.OnConflict{
-			DoUpdates: clause.Assignments(map[string]interface{}{
-				// like_cnt = like_cnt + 1
-				"like_cnt": gorm.Expr("like_cnt + ?", 1),
-				"utime":    now,
-			})}).Create(&Interactive{
-			BizId:   id,
-			Biz:     biz,
-			LikeCnt: 1,
-			Utime:   now,
-			Ctime:   now,
-		}).Error
+		changed = res.RowsAffected > 0
+		if !changed {
+			// 之前取消过点赞的重新点赞，已经点赞的不会命中
+			res = tx.Model(&UserLikeBiz{}).
+				Where("uid = ? AND biz_id = ? AND biz = ? AND status = ?", uid, id, biz, 0).
+				Updates(map[string]interface{}{
+					"status": 1,
+					"utime":  now,
+				})
+			if res.Error != nil {
+				return res.Error
+			}
+			changed = res.RowsAffected > 0
+		}
+		if changed {
+			// 更新总数据表
+			err := tx.Clauses(clause.OnConflict{
+				DoUpdates: clause.Assignments(map[string]interface{}{
+					// like_cnt = like_cnt + 1
+					"like_cnt": gorm.Expr("like_cnt + ?", 1),
+					"utime":    now,
+				})}).Create(&Interactive{
+				BizId:   id,
+				Biz:     biz,
+				LikeCnt: 1,
+				Utime:   now,
+				Ctime:   now,
+			}).Error
+			if err != nil {
+				return err
+			}
+			err = G.insertLikeEvent(tx, biz, id, uid, true)
+			if err != nil {
+				return err
+			}
+		}
+		var er error
+		likeCnt, er = G.likeCnt(tx, biz, id)
+		return er
 	})
+	return changed, likeCnt, err
+}
+
+// insertLikeEvent 只有状态真的变化了才写事件，避免热榜重复计分
+func (G *GROMInteractiveDAO) insertLikeEvent(tx *gorm.DB, biz string, id int64, uid int64, liked bool) error {
+	if biz != bizArticle {
+		return nil
+	}
+	return insertOutbox(tx, schema.TopicLikeEvent, id, schema.LikeEvent{Aid: id, Uid: uid, Liked: liked})
+}
+
+// likeCnt 没有交互数据的时候返回 0
+func (G *GROMInteractiveDAO) likeCnt(tx *gorm.DB, biz string, id int64) (int64, error) {
+	var cnts []int64
+	err := tx.Model(&Interactive{}).Where("biz_id = ? AND biz = ?", id, biz).
+		Limit(1).Pluck("like_cnt", &cnts).Error
+	if err != nil || len(cnts) == 0 {
+		return 0, err
+	}
+	return cnts[0], nil
 }
 
 func (G *GROMInteractiveDAO) IncrReadCnt(ctx context.Context, biz string, bizId int64) error {
@@ -176,20 +414,24 @@ type Interactive struct {
 	ReadCnt    int64
 	LikeCnt    int64
 	CollectCnt int64
-	Utime      int64
-	Ctime      int64
+	// 每日独立读者数的累计，由 UniqueReaderDAO 定期同步
+	ReaderCnt int64
+	Utime     int64
+	Ctime     int64
 }
 
 // UserLikeBiz 用户点赞业务表
 type UserLikeBiz struct {
-	Id    int64  `gorm:"primaryKey,autoIncrement"`
-	Uid   int64  `gorm:"uniqueIndex:uid_biz_type_id"`
+	Id int64 `gorm:"primaryKey,autoIncrement"`
+	// 查询用户最近点赞过的内容
+	Uid   int64  `gorm:"uniqueIndex:uid_biz_type_id;index:like_uid_utime,priority:1"`
 	BizId int64  `gorm:"uniqueIndex:uid_biz_type_id"`
 	Biz   string `gorm:"type:varchar(128);uniqueIndex:uid_biz_type_id"`
 	// 0：未点赞 1：已点赞
 	Status int
-	Utime  int64
-	Ctime  int64
+	// 最近一次点赞或者取消点赞的时间
+	Utime int64 `gorm:"index:like_uid_utime,priority:2"`
+	Ctime int64
 }
 
 type UserCollectionBiz struct {
@@ -0,0 +1,38 @@
+package dao
+
+import (
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"testing"
+)
+
+func TestGORMInteractiveDAO_BatchIncrReadCnt(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	// 一整批只有一条语句，按照 biz、biz_id 排好序
+	mock.ExpectExec("INSERT INTO `interactives` .* VALUES \\(.*\\),\\(.*\\),\\(.*\\) "+
+		"ON DUPLICATE KEY UPDATE `read_cnt`=read_cnt \\+ VALUES\\(read_cnt\\)").
+		WithArgs(
+			1, "article", 3, 0, 0, 0, sqlmock.AnyArg(), sqlmock.AnyArg(),
+			2, "article", 1, 0, 0, 0, sqlmock.AnyArg(), sqlmock.AnyArg(),
+			1, "user", 2, 0, 0, 0, sqlmock.AnyArg(), sqlmock.AnyArg(),
+			sqlmock.AnyArg(),
+		).
+		WillReturnResult(sqlmock.NewResult(1, 3))
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		Conn:                      sqlDB,
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+	})
+	assert.NoError(t, err)
+	dao := NewGORMInteractiveDAO(db)
+	err = dao.BatchIncrReadCnt(context.Background(),
+		[]string{"user", "article", "article"}, []int64{1, 2, 1}, []int64{2, 1, 3})
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
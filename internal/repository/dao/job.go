@@ -2,7 +2,10 @@ package dao
 
 import (
 	"context"
+	"errors"
+	"github.com/go-sql-driver/mysql"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"time"
 )
 
@@ -13,48 +16,114 @@ const (
 	jobStatusRunning
 	// jobStatusPaused 不再需要调度了
 	jobStatusPaused
+	// jobStatusFailed 连续失败太多次，不再调度了
+	jobStatusFailed
+)
+
+const (
+	jobRunStatusUnknown = iota
+	jobRunStatusRunning
+	jobRunStatusSuccess
+	jobRunStatusFailed
+)
+
+// defaultJobLeaseTimeout 正在执行的任务超过这么久没有续约，就认为抢占它的节点已经挂了，
+// 要比续约的间隔长很多，见 service.cronJobService 的 refreshInterval
+const defaultJobLeaseTimeout = time.Minute * 3
+
+var (
+	ErrJobDuplicate = errors.New("任务重名")
+	// ErrJobNotWaiting 任务已经被某个节点抢占了，或者已经不再调度
+	ErrJobNotWaiting = errors.New("任务不在等待调度")
 )
 
 type JobDAO interface {
-	Preempt(ctx context.Context) (Job, error)
-	Release(ctx context.Context, jid int64) error
-	UpdateUtime(ctx context.Context, id int64) error
+	// Preempt 抢占一个到期的任务，或者一个租约过期的任务。返回的是抢占之前的数据，
+	// 所以 Status 是 jobStatusRunning 的时候说明是从 Owner 那里回收的
+	Preempt(ctx context.Context, node string) (Job, error)
+	// Release 和 UpdateUtime 只对 node 自己抢占的任务生效，租约被回收之后什么也不做
+	Release(ctx context.Context, jid int64, node string) error
+	UpdateUtime(ctx context.Context, id int64, node string) error
+	// UpdateNextTime 只修改等待调度的任务，其他状态返回 ErrJobNotWaiting，
+	// 否则执行中的任务结束的时候会把 next_time 覆盖掉
 	UpdateNextTime(ctx context.Context, id int64, t time.Time) error
 	Stop(ctx context.Context, id int64) error
+	// Insert 同名任务已经存在的时候什么也不做
+	Insert(ctx context.Context, j Job) error
+	// Create 同名任务已经存在的时候返回 ErrJobDuplicate
+	Create(ctx context.Context, j Job) (int64, error)
+	FindById(ctx context.Context, id int64) (Job, error)
+	// List 按照 id 顺序分页
+	List(ctx context.Context, offset int, limit int) ([]Job, error)
+	// UpdateSchedule 修改表达式和配置，同时修改下一次执行的时间
+	UpdateSchedule(ctx context.Context, id int64, expression string, cfg string, nextTime int64) error
+	// Resume 只恢复暂停和失败的任务，同时清空连续失败的次数，没有可以恢复的任务时返回 ErrRecordNotFound
+	Resume(ctx context.Context, id int64, nextTime int64) error
+	Delete(ctx context.Context, id int64) error
+	UpdateRetryPolicy(ctx context.Context, id int64, maxAttempts int, backoff int64) error
+	// Succeed 执行成功，清空连续失败的次数。和 Fail 一样只对 node 自己抢占的任务生效，
+	// 租约被回收之后以新的 Owner 为准
+	Succeed(ctx context.Context, id int64, node string, nextTime int64) error
+	// Fail 执行失败，stop 为 true 的时候不再调度
+	Fail(ctx context.Context, id int64, node string, failures int, nextTime int64, stop bool) error
+
+	// InsertRun 记录一次执行，返回执行记录的 id
+	InsertRun(ctx context.Context, r JobRun) (int64, error)
+	// FinishRun 只更新还在执行中的记录，回收任务的时候已经记录过的不会被覆盖
+	FinishRun(ctx context.Context, id int64, status int, errMsg string, endTime int64) error
+	// FindRuns 按照 id 倒序分页，也就是最近的执行在前面
+	FindRuns(ctx context.Context, jid int64, offset int, limit int) ([]JobRun, error)
 }
 
 type GORMJobDAO struct {
-	db *gorm.DB
+	db           *gorm.DB
+	leaseTimeout time.Duration
 }
 
 func (G *GORMJobDAO) Stop(ctx context.Context, id int64) error {
-	return G.db.WithContext(ctx).
+	return G.db.WithContext(ctx).Model(&Job{}).
 		Where("id = ?", id).Updates(map[string]any{
 		"status": jobStatusPaused,
 		"utime":  time.Now().UnixMilli(),
 	}).Error
 }
 
-func (G *GORMJobDAO) Preempt(ctx context.Context) (Job, error) {
+func (G *GORMJobDAO) Preempt(ctx context.Context, node string) (Job, error) {
 	db := G.db.WithContext(ctx)
 	for {
 		var j Job
 		now := time.Now().UnixMilli()
-		// 首先先查是否存在未被抢占的任务
-		err := db.Where("status=? and next_time<=?", jobStatusWaiting, now).First(&j).Error
+		// 首先先查是否存在未被抢占的任务，或者抢占了但是很久没有续约的任务
+		err := db.Where("(status=? and next_time<=?) or (status=? and utime<?)",
+			jobStatusWaiting, now, jobStatusRunning, now-G.leaseTimeout.Milliseconds()).First(&j).Error
 		if err != nil {
 			return Job{}, err
 		}
-		// 尝试抢占
-		res := db.Model(&Job{}).Where("id=? and version=?", j.Id, j.Version).Updates(map[string]interface{}{
-			"status":  jobStatusRunning,
-			"version": j.Version + 1,
-			"utime":   now,
+		// 尝试抢占，version 保证只有一个节点能够成功
+		var affected int64
+		err = db.Transaction(func(tx *gorm.DB) error {
+			res := tx.Model(&Job{}).Where("id=? and version=?", j.Id, j.Version).Updates(map[string]interface{}{
+				"status":  jobStatusRunning,
+				"owner":   node,
+				"version": j.Version + 1,
+				"utime":   now,
+			})
+			affected = res.RowsAffected
+			if res.Error != nil || affected == 0 || j.Status != jobStatusRunning {
+				return res.Error
+			}
+			// 回收的任务，原来的节点没有机会记录执行结果了
+			return tx.Model(&JobRun{}).Where("jid=? and status=?", j.Id, jobRunStatusRunning).
+				Updates(map[string]any{
+					"status":   jobRunStatusFailed,
+					"err":      "节点 " + j.Owner + " 租约过期，任务被回收",
+					"end_time": now,
+				}).Error
 		})
-		if res.Error != nil {
-			return Job{}, res.Error
+		if err != nil {
+			return Job{}, err
 		}
-		if res.RowsAffected == 0 {
+		if affected == 0 {
 			// 说明已经被人抢占了
 			continue
 		}
@@ -62,31 +131,191 @@ func (G *GORMJobDAO) Preempt(ctx context.Context) (Job, error) {
 	}
 }
 
-func (G *GORMJobDAO) Release(ctx context.Context, jid int64) error {
+// Release 执行期间被暂停的任务保持暂停
+func (G *GORMJobDAO) Release(ctx context.Context, jid int64, node string) error {
 	now := time.Now().UnixMilli()
-	return G.db.WithContext(ctx).Model(&Job{}).Where("id=?", jid).Updates(map[string]interface{}{
+	return G.db.WithContext(ctx).Model(&Job{}).
+		Where("id=? and status=? and owner=?", jid, jobStatusRunning, node).Updates(map[string]interface{}{
 		"status": jobStatusWaiting,
+		"owner":  "",
 		"utime":  now,
 	}).Error
 }
 
-func (G *GORMJobDAO) UpdateUtime(ctx context.Context, id int64) error {
+func (G *GORMJobDAO) UpdateUtime(ctx context.Context, id int64, node string) error {
 	now := time.Now().UnixMilli()
-	return G.db.WithContext(ctx).Model(&Job{}).Where("id=?", id).Updates(map[string]interface{}{
+	return G.db.WithContext(ctx).Model(&Job{}).Where("id=? and owner=?", id, node).Updates(map[string]interface{}{
 		"utime": now,
 	}).Error
 }
 
 func (G *GORMJobDAO) UpdateNextTime(ctx context.Context, id int64, t time.Time) error {
 	now := time.Now().UnixMilli()
-	return G.db.WithContext(ctx).Model(&Job{}).Where("id=?", id).Updates(map[string]interface{}{
+	res := G.db.WithContext(ctx).Model(&Job{}).
+		Where("id = ? AND status = ?", id, jobStatusWaiting).Updates(map[string]interface{}{
 		"utime":     now,
 		"next_time": t.UnixMilli(),
+	})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrJobNotWaiting
+	}
+	return nil
+}
+
+func (G *GORMJobDAO) Insert(ctx context.Context, j Job) error {
+	now := time.Now().UnixMilli()
+	j.Ctime = now
+	j.Utime = now
+	return G.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "name"}},
+		DoNothing: true,
+	}).Create(&j).Error
+}
+
+func (G *GORMJobDAO) Create(ctx context.Context, j Job) (int64, error) {
+	now := time.Now().UnixMilli()
+	j.Status = jobStatusWaiting
+	j.Ctime = now
+	j.Utime = now
+	err := G.db.WithContext(ctx).Create(&j).Error
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		const uniqueConflictsErrNo uint16 = 1062
+		if mysqlErr.Number == uniqueConflictsErrNo {
+			return 0, ErrJobDuplicate
+		}
+	}
+	return j.Id, err
+}
+
+func (G *GORMJobDAO) FindById(ctx context.Context, id int64) (Job, error) {
+	var j Job
+	err := G.db.WithContext(ctx).Where("id = ?", id).First(&j).Error
+	return j, err
+}
+
+func (G *GORMJobDAO) List(ctx context.Context, offset int, limit int) ([]Job, error) {
+	var js []Job
+	err := G.db.WithContext(ctx).Order("id ASC").
+		Offset(offset).Limit(limit).Find(&js).Error
+	return js, err
+}
+
+func (G *GORMJobDAO) UpdateSchedule(ctx context.Context, id int64, expression string, cfg string, nextTime int64) error {
+	res := G.db.WithContext(ctx).Model(&Job{}).Where("id = ?", id).Updates(map[string]any{
+		"expression": expression,
+		"cfg":        cfg,
+		"next_time":  nextTime,
+		"utime":      time.Now().UnixMilli(),
+	})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func (G *GORMJobDAO) Resume(ctx context.Context, id int64, nextTime int64) error {
+	res := G.db.WithContext(ctx).Model(&Job{}).
+		Where("id = ? AND status IN ?", id, []int{jobStatusPaused, jobStatusFailed}).Updates(map[string]any{
+		"status":    jobStatusWaiting,
+		"failures":  0,
+		"next_time": nextTime,
+		"utime":     time.Now().UnixMilli(),
+	})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		// 任务被删掉了，或者已经被别人恢复了
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func (G *GORMJobDAO) UpdateRetryPolicy(ctx context.Context, id int64, maxAttempts int, backoff int64) error {
+	res := G.db.WithContext(ctx).Model(&Job{}).Where("id = ?", id).Updates(map[string]any{
+		"max_attempts": maxAttempts,
+		"backoff":      backoff,
+		"utime":        time.Now().UnixMilli(),
+	})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func (G *GORMJobDAO) Succeed(ctx context.Context, id int64, node string, nextTime int64) error {
+	return G.db.WithContext(ctx).Model(&Job{}).Where("id = ? AND owner = ?", id, node).Updates(map[string]any{
+		"failures":  0,
+		"next_time": nextTime,
+		"utime":     time.Now().UnixMilli(),
 	}).Error
 }
 
+// Fail 执行期间被暂停的任务保持暂停
+func (G *GORMJobDAO) Fail(ctx context.Context, id int64, node string, failures int, nextTime int64, stop bool) error {
+	if !stop {
+		return G.db.WithContext(ctx).Model(&Job{}).Where("id = ? AND owner = ?", id, node).Updates(map[string]any{
+			"failures":  failures,
+			"next_time": nextTime,
+			"utime":     time.Now().UnixMilli(),
+		}).Error
+	}
+	return G.db.WithContext(ctx).Model(&Job{}).
+		Where("id = ? AND owner = ? AND status IN ?", id, node, []int{jobStatusWaiting, jobStatusRunning}).
+		Updates(map[string]any{
+			"status":   jobStatusFailed,
+			"failures": failures,
+			"utime":    time.Now().UnixMilli(),
+		}).Error
+}
+
+func (G *GORMJobDAO) InsertRun(ctx context.Context, r JobRun) (int64, error) {
+	r.Status = jobRunStatusRunning
+	r.Ctime = time.Now().UnixMilli()
+	err := G.db.WithContext(ctx).Create(&r).Error
+	return r.Id, err
+}
+
+func (G *GORMJobDAO) FinishRun(ctx context.Context, id int64, status int, errMsg string, endTime int64) error {
+	return G.db.WithContext(ctx).Model(&JobRun{}).
+		Where("id = ? AND status = ?", id, jobRunStatusRunning).Updates(map[string]any{
+		"status":   status,
+		"err":      errMsg,
+		"end_time": endTime,
+	}).Error
+}
+
+func (G *GORMJobDAO) FindRuns(ctx context.Context, jid int64, offset int, limit int) ([]JobRun, error) {
+	var rs []JobRun
+	err := G.db.WithContext(ctx).Where("jid = ?", jid).Order("id DESC").
+		Offset(offset).Limit(limit).Find(&rs).Error
+	return rs, err
+}
+
+// Delete 正在执行的任务也会删掉，执行完之后的更新不会生效
+func (G *GORMJobDAO) Delete(ctx context.Context, id int64) error {
+	res := G.db.WithContext(ctx).Where("id = ?", id).Delete(&Job{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
 func NewGORMJobDAO(db *gorm.DB) JobDAO {
-	return &GORMJobDAO{db: db}
+	return &GORMJobDAO{db: db, leaseTimeout: defaultJobLeaseTimeout}
 }
 
 type Job struct {
@@ -99,9 +328,32 @@ type Job struct {
 	Status int
 
 	Version int
+	// Owner 抢占这个任务的节点，没有被抢占的时候是空字符串
+	Owner string `gorm:"type:varchar(128)"`
 
 	NextTime int64 `gorm:"index"`
 
+	// MaxAttempts 和 Backoff 是重试策略，0 表示使用默认值，Backoff 的单位是毫秒
+	MaxAttempts int
+	Backoff     int64
+	// Failures 连续失败的次数
+	Failures int
+
 	Utime int64
 	Ctime int64
 }
+
+// JobRun 任务的执行记录
+type JobRun struct {
+	Id  int64 `gorm:"primaryKey,autoIncrement"`
+	Jid int64 `gorm:"index"`
+	// Node 执行任务的节点
+	Node    string `gorm:"type:varchar(128)"`
+	Status  int
+	Attempt int
+	// Err 失败的时候记录错误信息
+	Err       string `gorm:"type:varchar(1024)"`
+	StartTime int64
+	EndTime   int64
+	Ctime     int64
+}
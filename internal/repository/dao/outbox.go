@@ -0,0 +1,121 @@
+package dao
+
+import (
+	"context"
+	"github.com/Tuanzi-bug/tuan-book/internal/events/schema"
+	"gorm.io/gorm"
+	"strconv"
+	"time"
+)
+
+const (
+	outboxStatusPending   = 1
+	outboxStatusDelivered = 2
+	// outboxStatusFailed 重试次数用完了，需要人工处理
+	outboxStatusFailed = 3
+)
+
+// 事件只发给文章，和 service 里面的判断保持一致
+const bizArticle = "article"
+
+//go:generate mockgen -source=./outbox.go -package=daomocks -destination=./mocks/outbox.mock.go OutboxDAO
+type OutboxDAO interface {
+	// FindPending 按照 id 顺序返回待发送的消息，包括还没到重试时间的，
+	// 调用方需要据此保证同一个 key 的顺序
+	FindPending(ctx context.Context, afterId int64, limit int) ([]OutboxMessage, error)
+	MarkDelivered(ctx context.Context, ids []int64) error
+	MarkRetry(ctx context.Context, id int64, nextTime int64) error
+	MarkFailed(ctx context.Context, id int64) error
+	// DeleteDelivered 删除 before 之前已经发送成功的消息，返回删除的行数
+	DeleteDelivered(ctx context.Context, before int64, limit int) (int64, error)
+}
+
+type GORMOutboxDAO struct {
+	db *gorm.DB
+}
+
+func NewGORMOutboxDAO(db *gorm.DB) OutboxDAO {
+	return &GORMOutboxDAO{db: db}
+}
+
+func (dao *GORMOutboxDAO) FindPending(ctx context.Context, afterId int64, limit int) ([]OutboxMessage, error) {
+	var msgs []OutboxMessage
+	err := dao.db.WithContext(ctx).
+		Where("status = ? AND id > ?", outboxStatusPending, afterId).
+		Order("id ASC").Limit(limit).Find(&msgs).Error
+	return msgs, err
+}
+
+func (dao *GORMOutboxDAO) MarkDelivered(ctx context.Context, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return dao.db.WithContext(ctx).Model(&OutboxMessage{}).
+		Where("id IN ? AND status = ?", ids, outboxStatusPending).
+		Updates(map[string]any{
+			"status": outboxStatusDelivered,
+			"utime":  time.Now().UnixMilli(),
+		}).Error
+}
+
+func (dao *GORMOutboxDAO) MarkRetry(ctx context.Context, id int64, nextTime int64) error {
+	return dao.db.WithContext(ctx).Model(&OutboxMessage{}).
+		Where("id = ? AND status = ?", id, outboxStatusPending).
+		Updates(map[string]any{
+			"retries":   gorm.Expr("retries + 1"),
+			"next_time": nextTime,
+			"utime":     time.Now().UnixMilli(),
+		}).Error
+}
+
+func (dao *GORMOutboxDAO) MarkFailed(ctx context.Context, id int64) error {
+	return dao.db.WithContext(ctx).Model(&OutboxMessage{}).
+		Where("id = ? AND status = ?", id, outboxStatusPending).
+		Updates(map[string]any{
+			"status": outboxStatusFailed,
+			"utime":  time.Now().UnixMilli(),
+		}).Error
+}
+
+func (dao *GORMOutboxDAO) DeleteDelivered(ctx context.Context, before int64, limit int) (int64, error) {
+	// 分批删除，避免一次删除太多行长时间锁表
+	res := dao.db.WithContext(ctx).
+		Where("status = ? AND utime < ?", outboxStatusDelivered, before).
+		Order("id ASC").Limit(limit).Delete(&OutboxMessage{})
+	return res.RowsAffected, res.Error
+}
+
+// insertOutbox 在业务的事务里面写入消息，业务修改和消息要么都成功要么都失败
+func insertOutbox(tx *gorm.DB, topic string, aid int64, evt any) error {
+	// 业务的事务是 WithContext 开出来的，链路 id 在 Statement 的 context 里面
+	_, val, err := schema.Marshal(tx.Statement.Context, topic, evt)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UnixMilli()
+	return tx.Create(&OutboxMessage{
+		Topic: topic,
+		// 同一篇文章的事件落在同一个分区，保证顺序
+		Key:      strconv.FormatInt(aid, 10),
+		Payload:  val,
+		Status:   outboxStatusPending,
+		NextTime: now,
+		Ctime:    now,
+		Utime:    now,
+	}).Error
+}
+
+// OutboxMessage 待发送到 kafka 的消息，和业务数据在同一个事务里面写入
+type OutboxMessage struct {
+	Id    int64  `gorm:"primaryKey,autoIncrement"`
+	Topic string `gorm:"type:varchar(128)"`
+	// Key 作为 kafka 消息的 key，同一个 key 的消息按照 id 顺序发送
+	Key     string `gorm:"type:varchar(128)"`
+	Payload []byte `gorm:"type:BLOB"`
+	Status  uint8  `gorm:"index"`
+	// 已经重试的次数，NextTime 之前不会再次发送
+	Retries  int
+	NextTime int64
+	Ctime    int64
+	Utime    int64
+}
@@ -0,0 +1,91 @@
+package dao
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+//go:generate mockgen -source=./reader.go -package=daomocks -destination=./mocks/reader.mock.go UniqueReaderDAO
+type UniqueReaderDAO interface {
+	// SyncDaily 用 HyperLogLog 算出来的每日独立读者数覆盖 day 这一天的记录，
+	// 同时把变化量累加到 interactives.reader_cnt 上，返回每个 id 的变化量
+	SyncDaily(ctx context.Context, biz string, day string, cnts map[int64]int64) (map[int64]int64, error)
+}
+
+type GORMUniqueReaderDAO struct {
+	db *gorm.DB
+}
+
+func NewGORMUniqueReaderDAO(db *gorm.DB) UniqueReaderDAO {
+	return &GORMUniqueReaderDAO{db: db}
+}
+
+func (dao *GORMUniqueReaderDAO) SyncDaily(ctx context.Context, biz string, day string, cnts map[int64]int64) (map[int64]int64, error) {
+	now := time.Now().UnixMilli()
+	deltas := make(map[int64]int64, len(cnts))
+	err := dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for bizId, cnt := range cnts {
+			// 锁住当天的记录，多个节点同时同步的时候不会重复累加
+			var old DailyReader
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("biz = ? AND biz_id = ? AND day = ?", biz, bizId, day).
+				Limit(1).Find(&old).Error
+			if err != nil {
+				return err
+			}
+			// HyperLogLog 的估算值基本只增不减，变小的时候不回退
+			delta := cnt - old.Cnt
+			if delta <= 0 {
+				continue
+			}
+			err = tx.Clauses(clause.OnConflict{
+				DoUpdates: clause.Assignments(map[string]any{
+					"cnt":   cnt,
+					"utime": now,
+				}),
+			}).Create(&DailyReader{
+				Biz:   biz,
+				BizId: bizId,
+				Day:   day,
+				Cnt:   cnt,
+				Ctime: now,
+				Utime: now,
+			}).Error
+			if err != nil {
+				return err
+			}
+			err = tx.Clauses(clause.OnConflict{
+				DoUpdates: clause.Assignments(map[string]any{
+					"reader_cnt": gorm.Expr("reader_cnt + ?", delta),
+					"utime":      now,
+				}),
+			}).Create(&Interactive{
+				Biz:       biz,
+				BizId:     bizId,
+				ReaderCnt: delta,
+				Ctime:     now,
+				Utime:     now,
+			}).Error
+			if err != nil {
+				return err
+			}
+			deltas[bizId] = delta
+		}
+		return nil
+	})
+	return deltas, err
+}
+
+// DailyReader 每天的独立读者数，同一个用户一天之内反复阅读只算一次
+type DailyReader struct {
+	Id    int64  `gorm:"primaryKey,autoIncrement"`
+	Biz   string `gorm:"type:varchar(128);uniqueIndex:biz_id_day"`
+	BizId int64  `gorm:"uniqueIndex:biz_id_day"`
+	// 20060102 格式
+	Day   string `gorm:"type:varchar(8);uniqueIndex:biz_id_day"`
+	Cnt   int64
+	Ctime int64
+	Utime int64
+}
@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"context"
+	"github.com/Tuanzi-bug/tuan-book/internal/domain"
+	"github.com/Tuanzi-bug/tuan-book/internal/repository/dao"
+	"github.com/ecodeclub/ekit/slice"
+	"time"
+)
+
+//go:generate mockgen -source=./feed.go -package=repomocks -destination=./mocks/feed.mock.go FeedRepository
+type FeedRepository interface {
+	// AddInbox 把 item 推送到 uids 的收件箱
+	AddInbox(ctx context.Context, item domain.FeedItem, uids []int64) error
+	// FindInbox before 为零值表示第一页
+	FindInbox(ctx context.Context, uid int64, before domain.FeedCursor, limit int) ([]domain.FeedItem, error)
+}
+
+type InboxFeedRepository struct {
+	dao dao.FeedDAO
+}
+
+func NewInboxFeedRepository(dao dao.FeedDAO) FeedRepository {
+	return &InboxFeedRepository{dao: dao}
+}
+
+func (repo *InboxFeedRepository) AddInbox(ctx context.Context, item domain.FeedItem, uids []int64) error {
+	ctime := item.Ctime.UnixMilli()
+	return repo.dao.InsertInbox(ctx, slice.Map[int64, dao.FeedInbox](uids, func(idx int, uid int64) dao.FeedInbox {
+		return dao.FeedInbox{
+			Uid:      uid,
+			Aid:      item.Aid,
+			AuthorId: item.AuthorId,
+			Ctime:    ctime,
+		}
+	}))
+}
+
+func (repo *InboxFeedRepository) FindInbox(ctx context.Context, uid int64, before domain.FeedCursor, limit int) ([]domain.FeedItem, error) {
+	var beforeMs int64
+	if !before.Ctime.IsZero() {
+		beforeMs = before.Ctime.UnixMilli()
+	}
+	items, err := repo.dao.FindInbox(ctx, uid, beforeMs, before.Aid, limit)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map[dao.FeedInbox, domain.FeedItem](items, func(idx int, src dao.FeedInbox) domain.FeedItem {
+		return domain.FeedItem{
+			Aid:      src.Aid,
+			AuthorId: src.AuthorId,
+			Ctime:    time.UnixMilli(src.Ctime),
+		}
+	}), nil
+}
@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/Tuanzi-bug/tuan-book/internal/domain"
+	"github.com/Tuanzi-bug/tuan-book/internal/repository/cache"
+	"github.com/Tuanzi-bug/tuan-book/internal/repository/dao"
+	"github.com/Tuanzi-bug/tuan-book/pkg/log"
+	"github.com/ecodeclub/ekit/slice"
+	"go.uber.org/zap"
+	"time"
+)
+
+//go:generate mockgen -source=./follow.go -package=repomocks -destination=./mocks/follow.mock.go FollowRepository
+type FollowRepository interface {
+	Follow(ctx context.Context, follower, followee int64) error
+	Unfollow(ctx context.Context, follower, followee int64) error
+	Followed(ctx context.Context, follower, followee int64) (bool, error)
+	FindFollowers(ctx context.Context, followee int64, cursor int64, limit int) ([]domain.FollowRelation, error)
+	FindFollowees(ctx context.Context, follower int64, cursor int64, limit int) ([]domain.FollowRelation, error)
+	GetStatistic(ctx context.Context, uid int64) (domain.FollowStatistic, error)
+	FindFolloweesByFollowers(ctx context.Context, follower int64, minFollowers int64) ([]int64, error)
+}
+
+type CachedFollowRepository struct {
+	dao   dao.FollowDAO
+	cache cache.FollowCache
+}
+
+func NewCachedFollowRepository(dao dao.FollowDAO, cache cache.FollowCache) FollowRepository {
+	return &CachedFollowRepository{dao: dao, cache: cache}
+}
+
+func (repo *CachedFollowRepository) Follow(ctx context.Context, follower, followee int64) error {
+	changed, err := repo.dao.Follow(ctx, follower, followee)
+	if err != nil || !changed {
+		return err
+	}
+	if er := repo.cache.Follow(ctx, follower, followee); er != nil {
+		// 记录日志，不影响主流程
+		log.Error("cache Follow failed", zap.Error(er), zap.Int64("follower", follower), zap.Int64("followee", followee))
+	}
+	return nil
+}
+
+func (repo *CachedFollowRepository) Unfollow(ctx context.Context, follower, followee int64) error {
+	changed, err := repo.dao.Unfollow(ctx, follower, followee)
+	if err != nil || !changed {
+		return err
+	}
+	if er := repo.cache.Unfollow(ctx, follower, followee); er != nil {
+		log.Error("cache Unfollow failed", zap.Error(er), zap.Int64("follower", follower), zap.Int64("followee", followee))
+	}
+	return nil
+}
+
+func (repo *CachedFollowRepository) Followed(ctx context.Context, follower, followee int64) (bool, error) {
+	_, err := repo.dao.FindRelation(ctx, follower, followee)
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.Is(err, dao.ErrRecordNotFound):
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+func (repo *CachedFollowRepository) FindFollowers(ctx context.Context, followee int64, cursor int64, limit int) ([]domain.FollowRelation, error) {
+	rels, err := repo.dao.FindFollowers(ctx, followee, cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map[dao.FollowRelation, domain.FollowRelation](rels, repo.toDomain), nil
+}
+
+func (repo *CachedFollowRepository) FindFollowees(ctx context.Context, follower int64, cursor int64, limit int) ([]domain.FollowRelation, error) {
+	rels, err := repo.dao.FindFollowees(ctx, follower, cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map[dao.FollowRelation, domain.FollowRelation](rels, repo.toDomain), nil
+}
+
+func (repo *CachedFollowRepository) GetStatistic(ctx context.Context, uid int64) (domain.FollowStatistic, error) {
+	s, err := repo.cache.GetStatistic(ctx, uid)
+	if err == nil {
+		return s, nil
+	}
+	se, err := repo.dao.GetStatistic(ctx, uid)
+	switch {
+	case err == nil:
+		s = domain.FollowStatistic{Uid: uid, Followers: se.Followers, Followees: se.Followees}
+	case errors.Is(err, dao.ErrRecordNotFound):
+		// 没有关注过别人也没有被关注过
+		s = domain.FollowStatistic{Uid: uid}
+	default:
+		return domain.FollowStatistic{}, err
+	}
+	// 回写缓存
+	if er := repo.cache.SetStatistic(ctx, s); er != nil {
+		log.Error("cache SetStatistic failed", zap.Error(er), zap.Int64("uid", uid))
+	}
+	return s, nil
+}
+
+func (repo *CachedFollowRepository) FindFolloweesByFollowers(ctx context.Context, follower int64, minFollowers int64) ([]int64, error) {
+	return repo.dao.FindFolloweesByFollowers(ctx, follower, minFollowers)
+}
+
+func (repo *CachedFollowRepository) toDomain(idx int, rel dao.FollowRelation) domain.FollowRelation {
+	return domain.FollowRelation{
+		Id:       rel.Id,
+		Follower: rel.Follower,
+		Followee: rel.Followee,
+		Ctime:    time.UnixMilli(rel.Ctime),
+	}
+}
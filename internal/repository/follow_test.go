@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/Tuanzi-bug/tuan-book/internal/domain"
+	"github.com/Tuanzi-bug/tuan-book/internal/repository/cache"
+	cachemocks "github.com/Tuanzi-bug/tuan-book/internal/repository/cache/mocks"
+	"github.com/Tuanzi-bug/tuan-book/internal/repository/dao"
+	daomocks "github.com/Tuanzi-bug/tuan-book/internal/repository/dao/mocks"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"testing"
+)
+
+func TestCachedFollowRepository_Follow(t *testing.T) {
+	testCases := []struct {
+		name string
+
+		mock func(ctrl *gomock.Controller) (dao.FollowDAO, cache.FollowCache)
+
+		wantErr error
+	}{
+		{
+			name: "关注成功，更新缓存计数",
+			mock: func(ctrl *gomock.Controller) (dao.FollowDAO, cache.FollowCache) {
+				d := daomocks.NewMockFollowDAO(ctrl)
+				c := cachemocks.NewMockFollowCache(ctrl)
+				d.EXPECT().Follow(gomock.Any(), int64(1), int64(2)).Return(true, nil)
+				c.EXPECT().Follow(gomock.Any(), int64(1), int64(2)).Return(nil)
+				return d, c
+			},
+		},
+		{
+			name: "重复关注，不更新缓存计数",
+			mock: func(ctrl *gomock.Controller) (dao.FollowDAO, cache.FollowCache) {
+				d := daomocks.NewMockFollowDAO(ctrl)
+				c := cachemocks.NewMockFollowCache(ctrl)
+				d.EXPECT().Follow(gomock.Any(), int64(1), int64(2)).Return(false, nil)
+				return d, c
+			},
+		},
+		{
+			name: "缓存失败不影响结果",
+			mock: func(ctrl *gomock.Controller) (dao.FollowDAO, cache.FollowCache) {
+				d := daomocks.NewMockFollowDAO(ctrl)
+				c := cachemocks.NewMockFollowCache(ctrl)
+				d.EXPECT().Follow(gomock.Any(), int64(1), int64(2)).Return(true, nil)
+				c.EXPECT().Follow(gomock.Any(), int64(1), int64(2)).Return(errors.New("mock error"))
+				return d, c
+			},
+		},
+		{
+			name: "数据库失败",
+			mock: func(ctrl *gomock.Controller) (dao.FollowDAO, cache.FollowCache) {
+				d := daomocks.NewMockFollowDAO(ctrl)
+				c := cachemocks.NewMockFollowCache(ctrl)
+				d.EXPECT().Follow(gomock.Any(), int64(1), int64(2)).Return(false, errors.New("mock error"))
+				return d, c
+			},
+			wantErr: errors.New("mock error"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			repo := NewCachedFollowRepository(tc.mock(ctrl))
+			err := repo.Follow(context.Background(), 1, 2)
+			assert.Equal(t, tc.wantErr, err)
+		})
+	}
+}
+
+func TestCachedFollowRepository_GetStatistic(t *testing.T) {
+	testCases := []struct {
+		name string
+
+		mock func(ctrl *gomock.Controller) (dao.FollowDAO, cache.FollowCache)
+
+		want    domain.FollowStatistic
+		wantErr error
+	}{
+		{
+			name: "缓存命中",
+			mock: func(ctrl *gomock.Controller) (dao.FollowDAO, cache.FollowCache) {
+				d := daomocks.NewMockFollowDAO(ctrl)
+				c := cachemocks.NewMockFollowCache(ctrl)
+				c.EXPECT().GetStatistic(gomock.Any(), int64(1)).
+					Return(domain.FollowStatistic{Uid: 1, Followers: 10, Followees: 2}, nil)
+				return d, c
+			},
+			want: domain.FollowStatistic{Uid: 1, Followers: 10, Followees: 2},
+		},
+		{
+			name: "缓存未命中，回写缓存",
+			mock: func(ctrl *gomock.Controller) (dao.FollowDAO, cache.FollowCache) {
+				d := daomocks.NewMockFollowDAO(ctrl)
+				c := cachemocks.NewMockFollowCache(ctrl)
+				c.EXPECT().GetStatistic(gomock.Any(), int64(1)).
+					Return(domain.FollowStatistic{}, cache.ErrKeyNotExist)
+				d.EXPECT().GetStatistic(gomock.Any(), int64(1)).
+					Return(dao.FollowStatistic{Uid: 1, Followers: 10, Followees: 2}, nil)
+				c.EXPECT().SetStatistic(gomock.Any(), domain.FollowStatistic{Uid: 1, Followers: 10, Followees: 2}).
+					Return(nil)
+				return d, c
+			},
+			want: domain.FollowStatistic{Uid: 1, Followers: 10, Followees: 2},
+		},
+		{
+			name: "从来没有关注数据",
+			mock: func(ctrl *gomock.Controller) (dao.FollowDAO, cache.FollowCache) {
+				d := daomocks.NewMockFollowDAO(ctrl)
+				c := cachemocks.NewMockFollowCache(ctrl)
+				c.EXPECT().GetStatistic(gomock.Any(), int64(1)).
+					Return(domain.FollowStatistic{}, cache.ErrKeyNotExist)
+				d.EXPECT().GetStatistic(gomock.Any(), int64(1)).
+					Return(dao.FollowStatistic{}, dao.ErrRecordNotFound)
+				c.EXPECT().SetStatistic(gomock.Any(), domain.FollowStatistic{Uid: 1}).Return(nil)
+				return d, c
+			},
+			want: domain.FollowStatistic{Uid: 1},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			repo := NewCachedFollowRepository(tc.mock(ctrl))
+			s, err := repo.GetStatistic(context.Background(), 1)
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.want, s)
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"context"
+	"github.com/Tuanzi-bug/tuan-book/internal/domain"
+	"github.com/Tuanzi-bug/tuan-book/internal/repository/cache"
+	"time"
+)
+
+//go:generate mockgen -source=./history.go -package=repomocks -destination=./mocks/history.mock.go ReadHistoryRepository
+type ReadHistoryRepository interface {
+	Add(ctx context.Context, records []domain.ReadRecord) error
+	// List before 为零值表示第一页
+	List(ctx context.Context, uid int64, before time.Time, limit int) ([]domain.ReadRecord, error)
+	Clear(ctx context.Context, uid int64) error
+}
+
+// RedisReadHistoryRepository 阅读记录只存在 redis 里面，丢了也可以接受
+type RedisReadHistoryRepository struct {
+	cache cache.ReadHistoryCache
+}
+
+func NewRedisReadHistoryRepository(cache cache.ReadHistoryCache) ReadHistoryRepository {
+	return &RedisReadHistoryRepository{cache: cache}
+}
+
+func (repo *RedisReadHistoryRepository) Add(ctx context.Context, records []domain.ReadRecord) error {
+	return repo.cache.Add(ctx, records)
+}
+
+func (repo *RedisReadHistoryRepository) List(ctx context.Context, uid int64, before time.Time, limit int) ([]domain.ReadRecord, error) {
+	var beforeMs int64
+	if !before.IsZero() {
+		beforeMs = before.UnixMilli()
+	}
+	return repo.cache.List(ctx, uid, beforeMs, limit)
+}
+
+func (repo *RedisReadHistoryRepository) Clear(ctx context.Context, uid int64) error {
+	return repo.cache.Clear(ctx, uid)
+}
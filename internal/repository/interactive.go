@@ -9,18 +9,39 @@ import (
 	"github.com/Tuanzi-bug/tuan-book/pkg/log"
 	"github.com/ecodeclub/ekit/slice"
 	"go.uber.org/zap"
+	"time"
 )
 
+var (
+	// ErrCollectItemNotFound 取消收藏的时候没有收藏过
+	ErrCollectItemNotFound = dao.ErrRecordNotFound
+	// ErrCollectItemDuplicate 已经收藏在某个收藏夹里面了
+	ErrCollectItemDuplicate = dao.ErrCollectItemDuplicate
+)
+
+//go:generate mockgen -source=./interactive.go -package=repomocks -destination=./mocks/interactive.mock.go InteractiveRepository
 type InteractiveRepository interface {
 	IncrReadCnt(ctx context.Context, biz string, bizId int64) error
-	IncrLike(ctx context.Context, biz string, id int64, uid int64) error
-	DecrLike(ctx context.Context, biz string, id int64, uid int64) error
+	// IncrLike 返回点赞之后的状态和点赞数，以及点赞状态是否真的发生了变化
+	IncrLike(ctx context.Context, biz string, id int64, uid int64) (domain.Interactive, bool, error)
+	// DecrLike 返回值和 IncrLike 一样
+	DecrLike(ctx context.Context, biz string, id int64, uid int64) (domain.Interactive, bool, error)
 	AddCollectItem(ctx context.Context, biz string, id int64, cid int64, uid int64) error
+	DeleteCollectItem(ctx context.Context, biz string, id int64, uid int64) error
 	Get(ctx context.Context, biz string, id int64) (domain.Interactive, error)
 	Liked(ctx context.Context, biz string, id int64, uid int64) (bool, error)
+	// FindLikes before 为零值表示第一页
+	FindLikes(ctx context.Context, biz string, uid int64, before time.Time, limit int) ([]domain.LikeRecord, error)
 	Collected(ctx context.Context, biz string, id int64, uid int64) (bool, error)
+	// BatchLiked 返回 ids 里面 uid 点赞过的，只查一次
+	BatchLiked(ctx context.Context, biz string, ids []int64, uid int64) (map[int64]bool, error)
+	// BatchCollected 返回 ids 里面 uid 收藏过的，只查一次
+	BatchCollected(ctx context.Context, biz string, ids []int64, uid int64) (map[int64]bool, error)
 	BatchIncrReadCnt(ctx context.Context, bizs []string, bizIds []int64) error
 	GetByIds(ctx context.Context, biz string, ids []int64) ([]domain.Interactive, error)
+	// Reconcile 从 afterId 之后扫描 limit 行，用点赞、收藏明细修复数据库里的计数，
+	// 缓存里对不上的直接删掉，下一次读的时候重新加载
+	Reconcile(ctx context.Context, afterId int64, limit int) (domain.InteractiveReconcile, error)
 }
 type CachedInteractiveRepository struct {
 	dao   dao.InteractiveDAO
@@ -28,30 +49,171 @@ type CachedInteractiveRepository struct {
 }
 
 func (c *CachedInteractiveRepository) GetByIds(ctx context.Context, biz string, ids []int64) ([]domain.Interactive, error) {
-	inters, err := c.dao.GetByIds(ctx, biz, ids)
+	if len(ids) == 0 {
+		return []domain.Interactive{}, nil
+	}
+	// 先用 pipeline 从缓存里面批量取，取不到的再一次性查数据库
+	cached, err := c.cache.GetByIds(ctx, biz, ids)
+	if err != nil {
+		// 缓存出错就全部走数据库
+		log.Error("cache GetByIds failed", zap.Error(err), zap.String("biz", biz))
+		cached = nil
+	}
+	res := make([]domain.Interactive, 0, len(ids))
+	missed := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if intr, ok := cached[id]; ok {
+			res = append(res, intr)
+			continue
+		}
+		missed = append(missed, id)
+	}
+	if len(missed) == 0 {
+		return res, nil
+	}
+	// 批量查询不回写缓存，避免热榜计算这种全量扫描把缓存撑满
+	inters, err := c.dao.GetByIds(ctx, biz, missed)
 	if err != nil {
 		return nil, err
 	}
-	res := slice.Map[dao.Interactive, domain.Interactive](inters, func(idx int, src dao.Interactive) domain.Interactive {
-		return c.toDomain(src)
-	})
+	for _, inter := range inters {
+		res = append(res, c.toDomain(inter))
+	}
+	return res, nil
+}
+
+func (c *CachedInteractiveRepository) Reconcile(ctx context.Context, afterId int64, limit int) (domain.InteractiveReconcile, error) {
+	intrs, err := c.dao.ListAfter(ctx, afterId, limit)
+	if err != nil || len(intrs) == 0 {
+		return domain.InteractiveReconcile{}, err
+	}
+	res := domain.InteractiveReconcile{LastId: intrs[len(intrs)-1].Id, Scanned: len(intrs)}
+	byBiz := make(map[string][]int64)
+	for _, intr := range intrs {
+		byBiz[intr.Biz] = append(byBiz[intr.Biz], intr.BizId)
+	}
+	likes := make(map[string]map[int64]int64, len(byBiz))
+	collects := make(map[string]map[int64]int64, len(byBiz))
+	cached := make(map[string]map[int64]domain.Interactive, len(byBiz))
+	for biz, ids := range byBiz {
+		likes[biz], err = c.dao.CountLikes(ctx, biz, ids)
+		if err != nil {
+			return res, err
+		}
+		collects[biz], err = c.dao.CountCollects(ctx, biz, ids)
+		if err != nil {
+			return res, err
+		}
+		cached[biz], err = c.cache.GetByIds(ctx, biz, ids)
+		if err != nil {
+			return res, err
+		}
+	}
+	for _, intr := range intrs {
+		expected := intr
+		if likes[intr.Biz][intr.BizId] != intr.LikeCnt || collects[intr.Biz][intr.BizId] != intr.CollectCnt {
+			// 上面的统计没有加锁，可能刚好碰上并发的点赞，加锁之后再统计一次
+			expected, err = c.dao.RepairCnt(ctx, intr.Biz, intr.BizId)
+			if err != nil {
+				return res, err
+			}
+			res.Drifts = appendDrift(res.Drifts, intr, driftSourceDB, expected, intr)
+		}
+		ci, ok := cached[intr.Biz][intr.BizId]
+		if !ok {
+			continue
+		}
+		drifts := appendDrift(nil, intr, driftSourceCache, expected, dao.Interactive{
+			LikeCnt:    ci.LikeCnt,
+			CollectCnt: ci.CollectCnt,
+		})
+		if len(drifts) == 0 {
+			continue
+		}
+		res.Drifts = append(res.Drifts, drifts...)
+		// 缓存的计数是在事务之外更新的，刚好在途的更新也可能被算进来，删掉缓存总是安全的
+		if er := c.cache.Delete(ctx, intr.Biz, intr.BizId); er != nil {
+			log.Error("cache Delete failed", zap.Error(er), zap.String("biz", intr.Biz), zap.Int64("id", intr.BizId))
+		}
+	}
+	return res, nil
+}
+
+const (
+	driftSourceDB    = "db"
+	driftSourceCache = "cache"
+)
+
+func appendDrift(drifts []domain.InteractiveDrift, intr dao.Interactive, source string,
+	expected, actual dao.Interactive) []domain.InteractiveDrift {
+	if expected.LikeCnt != actual.LikeCnt {
+		drifts = append(drifts, domain.InteractiveDrift{
+			Biz: intr.Biz, BizId: intr.BizId, Source: source, Field: "like_cnt",
+			Expected: expected.LikeCnt, Actual: actual.LikeCnt,
+		})
+	}
+	if expected.CollectCnt != actual.CollectCnt {
+		drifts = append(drifts, domain.InteractiveDrift{
+			Biz: intr.Biz, BizId: intr.BizId, Source: source, Field: "collect_cnt",
+			Expected: expected.CollectCnt, Actual: actual.CollectCnt,
+		})
+	}
+	return drifts
+}
+
+func (c *CachedInteractiveRepository) BatchLiked(ctx context.Context, biz string, ids []int64, uid int64) (map[int64]bool, error) {
+	likes, err := c.dao.GetLikeInfos(ctx, biz, ids, uid)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[int64]bool, len(likes))
+	for _, like := range likes {
+		res[like.BizId] = true
+	}
+	return res, nil
+}
+
+func (c *CachedInteractiveRepository) BatchCollected(ctx context.Context, biz string, ids []int64, uid int64) (map[int64]bool, error) {
+	collects, err := c.dao.GetCollectInfos(ctx, biz, ids, uid)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[int64]bool, len(collects))
+	for _, collect := range collects {
+		res[collect.BizId] = true
+	}
 	return res, nil
 }
 
 func (c *CachedInteractiveRepository) BatchIncrReadCnt(ctx context.Context, bizs []string, bizIds []int64) error {
-	err := c.dao.BatchIncrReadCnt(ctx, bizs, bizIds)
+	// 热门文章在一批里面会出现很多次，先合并成每篇文章一个增量，再一次性写入
+	type key struct {
+		biz   string
+		bizId int64
+	}
+	idx := make(map[key]int, len(bizs))
+	aggBizs := make([]string, 0, len(bizs))
+	aggIds := make([]int64, 0, len(bizs))
+	cnts := make([]int64, 0, len(bizs))
+	for i, biz := range bizs {
+		k := key{biz: biz, bizId: bizIds[i]}
+		if j, ok := idx[k]; ok {
+			cnts[j]++
+			continue
+		}
+		idx[k] = len(cnts)
+		aggBizs = append(aggBizs, biz)
+		aggIds = append(aggIds, bizIds[i])
+		cnts = append(cnts, 1)
+	}
+	err := c.dao.BatchIncrReadCnt(ctx, aggBizs, aggIds, cnts)
 	if err != nil {
 		return err
 	}
-	//// 添加缓存方案
-	//go func() {
-	//	for i, biz := range bizs {
-	//		er := c.cache.IncrReadCntIfPresent(ctx, biz, bizIds[i])
-	//		if er != nil {
-	//			log.Error("cache IncrReadCntIfPresent failed", zap.Error(er), zap.String("biz", biz), zap.Int64("id", bizIds[i]))
-	//		}
-	//	}
-	//}()
+	if er := c.cache.BatchIncrReadCntIfPresent(ctx, aggBizs, aggIds, cnts); er != nil {
+		// 记录日志，不影响主流程
+		log.Error("cache BatchIncrReadCntIfPresent failed", zap.Error(er), zap.Int("cnt", len(aggBizs)))
+	}
 	return nil
 }
 
@@ -104,6 +266,25 @@ func (c *CachedInteractiveRepository) Liked(ctx context.Context, biz string, id
 	}
 }
 
+func (c *CachedInteractiveRepository) FindLikes(ctx context.Context, biz string, uid int64, before time.Time, limit int) ([]domain.LikeRecord, error) {
+	var beforeMs int64
+	if !before.IsZero() {
+		beforeMs = before.UnixMilli()
+	}
+	likes, err := c.dao.FindLikes(ctx, biz, uid, beforeMs, limit)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map[dao.UserLikeBiz, domain.LikeRecord](likes, func(idx int, src dao.UserLikeBiz) domain.LikeRecord {
+		return domain.LikeRecord{
+			Biz:   src.Biz,
+			BizId: src.BizId,
+			Uid:   src.Uid,
+			Utime: time.UnixMilli(src.Utime),
+		}
+	}), nil
+}
+
 func (c *CachedInteractiveRepository) AddCollectItem(ctx context.Context, biz string, id int64, cid int64, uid int64) error {
 	err := c.dao.InsertCollectionBiz(ctx, dao.UserCollectionBiz{
 		Biz:   biz,
@@ -111,43 +292,67 @@ func (c *CachedInteractiveRepository) AddCollectItem(ctx context.Context, biz st
 		Cid:   cid,
 		Uid:   uid,
 	})
-	go func() {
-		er := c.cache.IncrCollectCntIfPresent(ctx, biz, id)
-		if er != nil {
-			// 记录日志，不影响主流程
-			log.Error("cache IncrCollectCntIfPresent failed", zap.Error(er),
-				zap.String("biz", biz),
-				zap.Int64("id", id),
-				zap.Int64("uid", uid),
-				zap.Int64("cid", cid))
-		}
-	}()
-	return err
+	if err != nil {
+		// 没有插入成功的时候不能动缓存里的收藏数
+		return err
+	}
+	if er := c.cache.IncrCollectCntIfPresent(ctx, biz, id); er != nil {
+		// 记录日志，不影响主流程
+		log.Error("cache IncrCollectCntIfPresent failed", zap.Error(er),
+			zap.String("biz", biz),
+			zap.Int64("id", id),
+			zap.Int64("uid", uid),
+			zap.Int64("cid", cid))
+	}
+	return nil
+}
+
+func (c *CachedInteractiveRepository) DeleteCollectItem(ctx context.Context, biz string, id int64, uid int64) error {
+	err := c.dao.DeleteCollectionBiz(ctx, biz, id, uid)
+	if err != nil {
+		return err
+	}
+	if er := c.cache.DecrCollectCntIfPresent(ctx, biz, id); er != nil {
+		// 记录日志，不影响主流程
+		log.Error("cache DecrCollectCntIfPresent failed", zap.Error(er), zap.String("biz", biz), zap.Int64("id", id), zap.Int64("uid", uid))
+	}
+	return nil
 }
 
-func (c *CachedInteractiveRepository) IncrLike(ctx context.Context, biz string, id int64, uid int64) error {
+func (c *CachedInteractiveRepository) IncrLike(ctx context.Context, biz string, id int64, uid int64) (domain.Interactive, bool, error) {
 	// 点赞是一个高频的访问数据，需要考虑缓存方案
-	err := c.dao.InsertLikeInfo(ctx, biz, id, uid)
-	go func() {
-		er := c.cache.IncrLikeCntIfPresent(ctx, biz, id)
-		if er != nil {
-			// 记录日志，不影响主流程
-			log.Error("cache IncrLikeCntIfPresent failed", zap.Error(er), zap.String("biz", biz), zap.Int64("id", id), zap.Int64("uid", uid))
-		}
-	}()
-	return err
+	changed, likeCnt, err := c.dao.InsertLikeInfo(ctx, biz, id, uid)
+	if err != nil {
+		return domain.Interactive{}, false, err
+	}
+	// 重复点赞不需要更新缓存
+	if changed {
+		go func() {
+			er := c.cache.IncrLikeCntIfPresent(ctx, biz, id)
+			if er != nil {
+				// 记录日志，不影响主流程
+				log.Error("cache IncrLikeCntIfPresent failed", zap.Error(er), zap.String("biz", biz), zap.Int64("id", id), zap.Int64("uid", uid))
+			}
+		}()
+	}
+	return domain.Interactive{BizId: id, LikeCnt: likeCnt, Liked: true}, changed, nil
 }
 
-func (c *CachedInteractiveRepository) DecrLike(ctx context.Context, biz string, id int64, uid int64) error {
-	err := c.dao.DeleteLikeInfo(ctx, biz, id, uid)
-	go func() {
-		er := c.cache.DecrLikeCntIfPresent(ctx, biz, id)
-		if er != nil {
-			// 记录日志，不影响主流程
-			log.Error("cache DecrLikeCntIfPresent failed", zap.Error(er), zap.String("biz", biz), zap.Int64("id", id), zap.Int64("uid", uid))
-		}
-	}()
-	return err
+func (c *CachedInteractiveRepository) DecrLike(ctx context.Context, biz string, id int64, uid int64) (domain.Interactive, bool, error) {
+	changed, likeCnt, err := c.dao.DeleteLikeInfo(ctx, biz, id, uid)
+	if err != nil {
+		return domain.Interactive{}, false, err
+	}
+	if changed {
+		go func() {
+			er := c.cache.DecrLikeCntIfPresent(ctx, biz, id)
+			if er != nil {
+				// 记录日志，不影响主流程
+				log.Error("cache DecrLikeCntIfPresent failed", zap.Error(er), zap.String("biz", biz), zap.Int64("id", id), zap.Int64("uid", uid))
+			}
+		}()
+	}
+	return domain.Interactive{BizId: id, LikeCnt: likeCnt}, changed, nil
 }
 
 func (c *CachedInteractiveRepository) IncrReadCnt(ctx context.Context, biz string, bizId int64) error {
@@ -174,8 +379,10 @@ func NewCachedInteractiveRepository(dao dao.InteractiveDAO, cache cache.Interact
 }
 func (c *CachedInteractiveRepository) toDomain(ie dao.Interactive) domain.Interactive {
 	return domain.Interactive{
+		BizId:      ie.BizId,
 		ReadCnt:    ie.ReadCnt,
 		LikeCnt:    ie.LikeCnt,
 		CollectCnt: ie.CollectCnt,
+		ReaderCnt:  ie.ReaderCnt,
 	}
 }
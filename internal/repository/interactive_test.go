@@ -0,0 +1,210 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/Tuanzi-bug/tuan-book/internal/domain"
+	"github.com/Tuanzi-bug/tuan-book/internal/repository/cache"
+	cachemocks "github.com/Tuanzi-bug/tuan-book/internal/repository/cache/mocks"
+	"github.com/Tuanzi-bug/tuan-book/internal/repository/dao"
+	daomocks "github.com/Tuanzi-bug/tuan-book/internal/repository/dao/mocks"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"testing"
+)
+
+func TestCachedInteractiveRepository_GetByIds(t *testing.T) {
+	testCases := []struct {
+		name string
+
+		mock func(ctrl *gomock.Controller) (dao.InteractiveDAO, cache.InteractiveCache)
+
+		ids     []int64
+		wantRes []domain.Interactive
+		wantErr error
+	}{
+		{
+			name: "全部命中缓存",
+			mock: func(ctrl *gomock.Controller) (dao.InteractiveDAO, cache.InteractiveCache) {
+				d := daomocks.NewMockInteractiveDAO(ctrl)
+				c := cachemocks.NewMockInteractiveCache(ctrl)
+				c.EXPECT().GetByIds(gomock.Any(), "article", []int64{1, 2}).Return(map[int64]domain.Interactive{
+					1: {BizId: 1, ReadCnt: 10},
+					2: {BizId: 2, LikeCnt: 3},
+				}, nil)
+				return d, c
+			},
+			ids:     []int64{1, 2},
+			wantRes: []domain.Interactive{{BizId: 1, ReadCnt: 10}, {BizId: 2, LikeCnt: 3}},
+		},
+		{
+			name: "部分命中，剩下的查数据库",
+			mock: func(ctrl *gomock.Controller) (dao.InteractiveDAO, cache.InteractiveCache) {
+				d := daomocks.NewMockInteractiveDAO(ctrl)
+				c := cachemocks.NewMockInteractiveCache(ctrl)
+				c.EXPECT().GetByIds(gomock.Any(), "article", []int64{1, 2, 3}).Return(map[int64]domain.Interactive{
+					1: {BizId: 1, ReadCnt: 10},
+				}, nil)
+				d.EXPECT().GetByIds(gomock.Any(), "article", []int64{2, 3}).Return([]dao.Interactive{
+					{BizId: 2, Biz: "article", CollectCnt: 4},
+				}, nil)
+				return d, c
+			},
+			ids:     []int64{1, 2, 3},
+			wantRes: []domain.Interactive{{BizId: 1, ReadCnt: 10}, {BizId: 2, CollectCnt: 4}},
+		},
+		{
+			name: "缓存失败，全部查数据库",
+			mock: func(ctrl *gomock.Controller) (dao.InteractiveDAO, cache.InteractiveCache) {
+				d := daomocks.NewMockInteractiveDAO(ctrl)
+				c := cachemocks.NewMockInteractiveCache(ctrl)
+				c.EXPECT().GetByIds(gomock.Any(), "article", []int64{1, 2, 3}).Return(nil, errors.New("mock error"))
+				d.EXPECT().GetByIds(gomock.Any(), "article", []int64{1, 2, 3}).Return([]dao.Interactive{
+					{BizId: 1, Biz: "article", ReadCnt: 10},
+				}, nil)
+				return d, c
+			},
+			ids:     []int64{1, 2, 3},
+			wantRes: []domain.Interactive{{BizId: 1, ReadCnt: 10}},
+		},
+		{
+			name: "数据库失败",
+			mock: func(ctrl *gomock.Controller) (dao.InteractiveDAO, cache.InteractiveCache) {
+				d := daomocks.NewMockInteractiveDAO(ctrl)
+				c := cachemocks.NewMockInteractiveCache(ctrl)
+				c.EXPECT().GetByIds(gomock.Any(), "article", []int64{1, 2, 3}).Return(map[int64]domain.Interactive{}, nil)
+				d.EXPECT().GetByIds(gomock.Any(), "article", []int64{1, 2, 3}).Return(nil, errors.New("mock error"))
+				return d, c
+			},
+			ids:     []int64{1, 2, 3},
+			wantErr: errors.New("mock error"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			repo := NewCachedInteractiveRepository(tc.mock(ctrl))
+			res, err := repo.GetByIds(context.Background(), "article", tc.ids)
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantRes, res)
+		})
+	}
+}
+
+func TestCachedInteractiveRepository_AddCollectItem(t *testing.T) {
+	testCases := []struct {
+		name string
+
+		mock func(ctrl *gomock.Controller) (dao.InteractiveDAO, cache.InteractiveCache)
+
+		wantErr error
+	}{
+		{
+			name: "收藏成功，更新缓存",
+			mock: func(ctrl *gomock.Controller) (dao.InteractiveDAO, cache.InteractiveCache) {
+				d := daomocks.NewMockInteractiveDAO(ctrl)
+				c := cachemocks.NewMockInteractiveCache(ctrl)
+				d.EXPECT().InsertCollectionBiz(gomock.Any(), dao.UserCollectionBiz{
+					Biz: "article", BizId: 1, Cid: 10, Uid: 123,
+				}).Return(nil)
+				c.EXPECT().IncrCollectCntIfPresent(gomock.Any(), "article", int64(1)).Return(nil)
+				return d, c
+			},
+		},
+		{
+			name: "已经收藏过，不动缓存",
+			mock: func(ctrl *gomock.Controller) (dao.InteractiveDAO, cache.InteractiveCache) {
+				d := daomocks.NewMockInteractiveDAO(ctrl)
+				c := cachemocks.NewMockInteractiveCache(ctrl)
+				d.EXPECT().InsertCollectionBiz(gomock.Any(), gomock.Any()).Return(dao.ErrCollectItemDuplicate)
+				return d, c
+			},
+			wantErr: ErrCollectItemDuplicate,
+		},
+		{
+			name: "缓存失败不影响结果",
+			mock: func(ctrl *gomock.Controller) (dao.InteractiveDAO, cache.InteractiveCache) {
+				d := daomocks.NewMockInteractiveDAO(ctrl)
+				c := cachemocks.NewMockInteractiveCache(ctrl)
+				d.EXPECT().InsertCollectionBiz(gomock.Any(), gomock.Any()).Return(nil)
+				c.EXPECT().IncrCollectCntIfPresent(gomock.Any(), "article", int64(1)).Return(errors.New("mock error"))
+				return d, c
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			d, c := tc.mock(ctrl)
+			repo := NewCachedInteractiveRepository(d, c)
+			err := repo.AddCollectItem(context.Background(), "article", 1, 10, 123)
+			assert.Equal(t, tc.wantErr, err)
+		})
+	}
+}
+
+func TestCachedInteractiveRepository_BatchIncrReadCnt(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	d := daomocks.NewMockInteractiveDAO(ctrl)
+	c := cachemocks.NewMockInteractiveCache(ctrl)
+	repo := NewCachedInteractiveRepository(d, c)
+
+	// 同一篇文章合并成一个增量
+	d.EXPECT().BatchIncrReadCnt(gomock.Any(), []string{"article", "article", "user"},
+		[]int64{1, 2, 1}, []int64{3, 1, 1}).Return(nil)
+	c.EXPECT().BatchIncrReadCntIfPresent(gomock.Any(), []string{"article", "article", "user"},
+		[]int64{1, 2, 1}, []int64{3, 1, 1}).Return(errors.New("mock error"))
+	err := repo.BatchIncrReadCnt(context.Background(),
+		[]string{"article", "article", "article", "user", "article"}, []int64{1, 2, 1, 1, 1})
+	// 缓存失败不影响结果
+	assert.NoError(t, err)
+
+	d.EXPECT().BatchIncrReadCnt(gomock.Any(), []string{"article"}, []int64{1}, []int64{1}).
+		Return(errors.New("mock error"))
+	err = repo.BatchIncrReadCnt(context.Background(), []string{"article"}, []int64{1})
+	assert.Equal(t, errors.New("mock error"), err)
+}
+
+func TestCachedInteractiveRepository_Reconcile(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	d := daomocks.NewMockInteractiveDAO(ctrl)
+	c := cachemocks.NewMockInteractiveCache(ctrl)
+	repo := NewCachedInteractiveRepository(d, c)
+
+	d.EXPECT().ListAfter(gomock.Any(), int64(0), 3).Return([]dao.Interactive{
+		{Id: 1, Biz: "article", BizId: 11, LikeCnt: 2, CollectCnt: 1},
+		{Id: 2, Biz: "article", BizId: 12, LikeCnt: 5},
+		{Id: 3, Biz: "article", BizId: 13, LikeCnt: 1},
+	}, nil)
+	d.EXPECT().CountLikes(gomock.Any(), "article", []int64{11, 12, 13}).
+		Return(map[int64]int64{11: 2, 12: 4, 13: 1}, nil)
+	d.EXPECT().CountCollects(gomock.Any(), "article", []int64{11, 12, 13}).
+		Return(map[int64]int64{11: 1}, nil)
+	c.EXPECT().GetByIds(gomock.Any(), "article", []int64{11, 12, 13}).Return(map[int64]domain.Interactive{
+		11: {BizId: 11, LikeCnt: 2, CollectCnt: 1},
+		12: {BizId: 12, LikeCnt: 5},
+		13: {BizId: 13, LikeCnt: 3},
+	}, nil)
+	// 12 的数据库计数多了一个，加锁之后修复
+	d.EXPECT().RepairCnt(gomock.Any(), "article", int64(12)).
+		Return(dao.Interactive{Id: 2, Biz: "article", BizId: 12, LikeCnt: 4}, nil)
+	// 12 的缓存和修复之后的对不上，13 的缓存本身就对不上
+	c.EXPECT().Delete(gomock.Any(), "article", int64(12)).Return(nil)
+	c.EXPECT().Delete(gomock.Any(), "article", int64(13)).Return(nil)
+
+	res, err := repo.Reconcile(context.Background(), 0, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, domain.InteractiveReconcile{
+		LastId:  3,
+		Scanned: 3,
+		Drifts: []domain.InteractiveDrift{
+			{Biz: "article", BizId: 12, Source: "db", Field: "like_cnt", Expected: 4, Actual: 5},
+			{Biz: "article", BizId: 12, Source: "cache", Field: "like_cnt", Expected: 4, Actual: 5},
+			{Biz: "article", BizId: 13, Source: "cache", Field: "like_cnt", Expected: 1, Actual: 3},
+		},
+	}, res)
+}
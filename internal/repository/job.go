@@ -7,13 +7,42 @@ import (
 	"time"
 )
 
+var (
+	ErrJobNotFound  = dao.ErrRecordNotFound
+	ErrJobDuplicate = dao.ErrJobDuplicate
+	// ErrJobNotWaiting 任务已经被抢占或者不再调度
+	ErrJobNotWaiting = dao.ErrJobNotWaiting
+)
+
+//go:generate mockgen -source=./job.go -package=repomocks -destination=./mocks/job.mock.go CronJobRepository
 type CronJobRepository interface {
-	Preempt(ctx context.Context) (domain.Job, error)
-	Release(ctx context.Context, jid int64) error
-	UpdateUtime(ctx context.Context, id int64) error
+	// Preempt 抢占到期的任务，或者回收租约过期的任务
+	Preempt(ctx context.Context, node string) (domain.Job, error)
+	Release(ctx context.Context, jid int64, node string) error
+	UpdateUtime(ctx context.Context, id int64, node string) error
 	UpdateNextTime(ctx context.Context, id int64, time time.Time) error
 	Stop(ctx context.Context, id int64) error
+	Create(ctx context.Context, j domain.Job, nextTime time.Time) error
+	// Add 同名任务已经存在的时候返回 ErrJobDuplicate
+	Add(ctx context.Context, j domain.Job, nextTime time.Time) (int64, error)
+	FindById(ctx context.Context, id int64) (domain.Job, error)
+	List(ctx context.Context, offset int, limit int) ([]domain.Job, error)
+	UpdateSchedule(ctx context.Context, id int64, expression string, cfg string, nextTime time.Time) error
+	Resume(ctx context.Context, id int64, nextTime time.Time) error
+	Delete(ctx context.Context, id int64) error
+	UpdateRetryPolicy(ctx context.Context, id int64, maxAttempts int, backoff time.Duration) error
+	// Succeed 执行成功，清空连续失败的次数，只对 node 自己抢占的任务生效
+	Succeed(ctx context.Context, id int64, node string, nextTime time.Time) error
+	// Fail 执行失败，stop 为 true 的时候不再调度，nextTime 会被忽略
+	Fail(ctx context.Context, id int64, node string, failures int, nextTime time.Time, stop bool) error
+	AddRun(ctx context.Context, r domain.JobRun) (int64, error)
+	FinishRun(ctx context.Context, r domain.JobRun) error
+	FindRuns(ctx context.Context, jid int64, offset int, limit int) ([]domain.JobRun, error)
 }
+
+// maxJobRunErrLen 和 dao.JobRun.Err 的长度保持一致
+const maxJobRunErrLen = 1024
+
 type PreemptJobRepository struct {
 	dao dao.JobDAO
 }
@@ -22,28 +51,159 @@ func (p *PreemptJobRepository) Stop(ctx context.Context, id int64) error {
 	return p.dao.Stop(ctx, id)
 }
 
-func (p *PreemptJobRepository) Preempt(ctx context.Context) (domain.Job, error) {
-	j, err := p.dao.Preempt(ctx)
-	return domain.Job{
-		Id:         j.Id,
-		Expression: j.Expression,
-		Executor:   j.Executor,
-		Name:       j.Name,
-	}, err
+func (p *PreemptJobRepository) Preempt(ctx context.Context, node string) (domain.Job, error) {
+	j, err := p.dao.Preempt(ctx, node)
+	if err != nil {
+		return domain.Job{}, err
+	}
+	res := p.toDomain(j)
+	// dao 返回的是抢占之前的数据
+	if res.Status == domain.JobStatusRunning {
+		res.ReclaimedFrom = j.Owner
+	}
+	res.Status = domain.JobStatusRunning
+	res.Owner = node
+	return res, nil
 }
 
-func (p *PreemptJobRepository) Release(ctx context.Context, jid int64) error {
-	return p.dao.Release(ctx, jid)
+func (p *PreemptJobRepository) Release(ctx context.Context, jid int64, node string) error {
+	return p.dao.Release(ctx, jid, node)
 }
 
-func (p *PreemptJobRepository) UpdateUtime(ctx context.Context, id int64) error {
-	return p.dao.UpdateUtime(ctx, id)
+func (p *PreemptJobRepository) UpdateUtime(ctx context.Context, id int64, node string) error {
+	return p.dao.UpdateUtime(ctx, id, node)
 }
 
 func (p *PreemptJobRepository) UpdateNextTime(ctx context.Context, id int64, time time.Time) error {
 	return p.dao.UpdateNextTime(ctx, id, time)
 }
 
+func (p *PreemptJobRepository) Create(ctx context.Context, j domain.Job, nextTime time.Time) error {
+	return p.dao.Insert(ctx, dao.Job{
+		Name:       j.Name,
+		Executor:   j.Executor,
+		Expression: j.Expression,
+		Cfg:        j.Cfg,
+		NextTime:   nextTime.UnixMilli(),
+	})
+}
+
+func (p *PreemptJobRepository) Add(ctx context.Context, j domain.Job, nextTime time.Time) (int64, error) {
+	return p.dao.Create(ctx, dao.Job{
+		Name:       j.Name,
+		Executor:   j.Executor,
+		Expression: j.Expression,
+		Cfg:        j.Cfg,
+		NextTime:   nextTime.UnixMilli(),
+		// 重试策略只有管理后台创建的任务才有
+		MaxAttempts: j.MaxAttempts,
+		Backoff:     j.Backoff.Milliseconds(),
+	})
+}
+
+func (p *PreemptJobRepository) FindById(ctx context.Context, id int64) (domain.Job, error) {
+	j, err := p.dao.FindById(ctx, id)
+	if err != nil {
+		return domain.Job{}, err
+	}
+	return p.toDomain(j), nil
+}
+
+func (p *PreemptJobRepository) List(ctx context.Context, offset int, limit int) ([]domain.Job, error) {
+	js, err := p.dao.List(ctx, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.Job, 0, len(js))
+	for _, j := range js {
+		res = append(res, p.toDomain(j))
+	}
+	return res, nil
+}
+
+func (p *PreemptJobRepository) UpdateSchedule(ctx context.Context, id int64, expression string, cfg string, nextTime time.Time) error {
+	return p.dao.UpdateSchedule(ctx, id, expression, cfg, nextTime.UnixMilli())
+}
+
+func (p *PreemptJobRepository) Resume(ctx context.Context, id int64, nextTime time.Time) error {
+	return p.dao.Resume(ctx, id, nextTime.UnixMilli())
+}
+
+func (p *PreemptJobRepository) Delete(ctx context.Context, id int64) error {
+	return p.dao.Delete(ctx, id)
+}
+
+func (p *PreemptJobRepository) UpdateRetryPolicy(ctx context.Context, id int64, maxAttempts int, backoff time.Duration) error {
+	return p.dao.UpdateRetryPolicy(ctx, id, maxAttempts, backoff.Milliseconds())
+}
+
+func (p *PreemptJobRepository) Succeed(ctx context.Context, id int64, node string, nextTime time.Time) error {
+	return p.dao.Succeed(ctx, id, node, nextTime.UnixMilli())
+}
+
+func (p *PreemptJobRepository) Fail(ctx context.Context, id int64, node string, failures int, nextTime time.Time, stop bool) error {
+	return p.dao.Fail(ctx, id, node, failures, nextTime.UnixMilli(), stop)
+}
+
+func (p *PreemptJobRepository) AddRun(ctx context.Context, r domain.JobRun) (int64, error) {
+	return p.dao.InsertRun(ctx, dao.JobRun{
+		Jid:       r.Jid,
+		Node:      r.Node,
+		Attempt:   r.Attempt,
+		StartTime: r.StartTime.UnixMilli(),
+	})
+}
+
+func (p *PreemptJobRepository) FinishRun(ctx context.Context, r domain.JobRun) error {
+	errMsg := r.Err
+	if len(errMsg) > maxJobRunErrLen {
+		errMsg = errMsg[:maxJobRunErrLen]
+	}
+	return p.dao.FinishRun(ctx, r.Id, int(r.Status), errMsg, r.EndTime.UnixMilli())
+}
+
+func (p *PreemptJobRepository) FindRuns(ctx context.Context, jid int64, offset int, limit int) ([]domain.JobRun, error) {
+	rs, err := p.dao.FindRuns(ctx, jid, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.JobRun, 0, len(rs))
+	for _, r := range rs {
+		run := domain.JobRun{
+			Id:        r.Id,
+			Jid:       r.Jid,
+			Node:      r.Node,
+			Status:    domain.JobRunStatus(r.Status),
+			Attempt:   r.Attempt,
+			Err:       r.Err,
+			StartTime: time.UnixMilli(r.StartTime),
+		}
+		if r.EndTime > 0 {
+			run.EndTime = time.UnixMilli(r.EndTime)
+		}
+		res = append(res, run)
+	}
+	return res, nil
+}
+
+func (p *PreemptJobRepository) toDomain(j dao.Job) domain.Job {
+	return domain.Job{
+		Id:           j.Id,
+		Name:         j.Name,
+		Expression:   j.Expression,
+		Executor:     j.Executor,
+		Cfg:          j.Cfg,
+		MaxAttempts:  j.MaxAttempts,
+		Backoff:      time.Duration(j.Backoff) * time.Millisecond,
+		Failures:     j.Failures,
+		Owner:        j.Owner,
+		Status:       domain.JobStatus(j.Status),
+		NextExecTime: time.UnixMilli(j.NextTime),
+		Ctime:        time.UnixMilli(j.Ctime),
+		Utime:        time.UnixMilli(j.Utime),
+	}
+}
+
 func NewPreemptJobRepository(dao dao.JobDAO) CronJobRepository {
 	return &PreemptJobRepository{dao: dao}
 }
@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"github.com/Tuanzi-bug/tuan-book/internal/domain"
+	"github.com/Tuanzi-bug/tuan-book/internal/repository/dao"
+	"time"
+)
+
+//go:generate mockgen -source=./outbox.go -package=repomocks -destination=./mocks/outbox.mock.go OutboxRepository
+type OutboxRepository interface {
+	// FindPending 按照 id 顺序返回 afterId 之后待发送的消息，包括还没到重试时间的
+	FindPending(ctx context.Context, afterId int64, limit int) ([]domain.OutboxMessage, error)
+	MarkDelivered(ctx context.Context, ids []int64) error
+	MarkRetry(ctx context.Context, id int64, nextTime time.Time) error
+	// MarkFailed 不再重试，同一个 key 后面的消息可以继续发送
+	MarkFailed(ctx context.Context, id int64) error
+	DeleteDelivered(ctx context.Context, before time.Time, limit int) (int64, error)
+}
+
+type GORMOutboxRepository struct {
+	dao dao.OutboxDAO
+}
+
+func NewGORMOutboxRepository(dao dao.OutboxDAO) OutboxRepository {
+	return &GORMOutboxRepository{dao: dao}
+}
+
+func (repo *GORMOutboxRepository) FindPending(ctx context.Context, afterId int64, limit int) ([]domain.OutboxMessage, error) {
+	msgs, err := repo.dao.FindPending(ctx, afterId, limit)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.OutboxMessage, 0, len(msgs))
+	for _, msg := range msgs {
+		res = append(res, domain.OutboxMessage{
+			Id:       msg.Id,
+			Topic:    msg.Topic,
+			Key:      msg.Key,
+			Payload:  msg.Payload,
+			Retries:  msg.Retries,
+			NextTime: time.UnixMilli(msg.NextTime),
+		})
+	}
+	return res, nil
+}
+
+func (repo *GORMOutboxRepository) MarkDelivered(ctx context.Context, ids []int64) error {
+	return repo.dao.MarkDelivered(ctx, ids)
+}
+
+func (repo *GORMOutboxRepository) MarkRetry(ctx context.Context, id int64, nextTime time.Time) error {
+	return repo.dao.MarkRetry(ctx, id, nextTime.UnixMilli())
+}
+
+func (repo *GORMOutboxRepository) MarkFailed(ctx context.Context, id int64) error {
+	return repo.dao.MarkFailed(ctx, id)
+}
+
+func (repo *GORMOutboxRepository) DeleteDelivered(ctx context.Context, before time.Time, limit int) (int64, error) {
+	return repo.dao.DeleteDelivered(ctx, before.UnixMilli(), limit)
+}
@@ -2,27 +2,53 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"github.com/Tuanzi-bug/tuan-book/internal/domain"
 	"github.com/Tuanzi-bug/tuan-book/internal/repository/cache"
+	"github.com/Tuanzi-bug/tuan-book/pkg/log"
+	"go.uber.org/zap"
 )
 
+//go:generate mockgen -source=./ranking.go -package=repomocks -destination=./mocks/ranking.mock.go RankingRepository
 type RankingRepository interface {
-	ReplaceTopN(ctx context.Context, arts []domain.Article) error // 替换排行榜
-	GetTopN(ctx context.Context) ([]domain.Article, error)
+	ReplaceTopN(ctx context.Context, board string, arts []domain.Article) error // 替换排行榜
+	GetTopN(ctx context.Context, board string) ([]domain.Article, error)
 }
 
 type CachedRankingRepository struct {
-	cache cache.RankingCache
+	// 这里直接依赖具体实现，需要区分本地缓存和 redis 缓存
+	redis *cache.RankingRedisCache
+	local *cache.RankingLocalCache
 }
 
-func NewCachedRankingRepository(cache cache.RankingCache) RankingRepository {
-	return &CachedRankingRepository{cache: cache}
+func NewCachedRankingRepository(redis *cache.RankingRedisCache, local *cache.RankingLocalCache) RankingRepository {
+	return &CachedRankingRepository{redis: redis, local: local}
 }
 
-func (c *CachedRankingRepository) ReplaceTopN(ctx context.Context, arts []domain.Article) error {
-	return c.cache.Set(ctx, arts)
+func (c *CachedRankingRepository) ReplaceTopN(ctx context.Context, board string, arts []domain.Article) error {
+	// 本地缓存基本不会失败，以 redis 的结果为准
+	_ = c.local.Set(ctx, board, arts)
+	return c.redis.Set(ctx, board, arts)
 }
 
-func (c *CachedRankingRepository) GetTopN(ctx context.Context) ([]domain.Article, error) {
-	return c.cache.Get(ctx)
+func (c *CachedRankingRepository) GetTopN(ctx context.Context, board string) ([]domain.Article, error) {
+	// 先查本地缓存，再查 redis
+	arts, err := c.local.Get(ctx, board)
+	if err == nil {
+		return arts, nil
+	}
+	arts, err = c.redis.Get(ctx, board)
+	if err == nil {
+		// 回写本地缓存
+		_ = c.local.Set(ctx, board, arts)
+		return arts, nil
+	}
+	if !errors.Is(err, cache.ErrKeyNotExist) {
+		// redis 出问题了，尝试用本地过期的数据兜底
+		log.Error("查询 redis 热榜失败", zap.String("board", board), zap.Error(err))
+		if res, er := c.local.ForceGet(ctx, board); er == nil {
+			return res, nil
+		}
+	}
+	return nil, err
 }
@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"context"
+	"github.com/Tuanzi-bug/tuan-book/internal/repository/cache"
+	"time"
+)
+
+// RealTimeRankingRepository 实时热榜，只维护文章 ID 和热度
+//
+//go:generate mockgen -source=./ranking_realtime.go -package=repomocks -destination=./mocks/ranking_realtime.mock.go RealTimeRankingRepository
+type RealTimeRankingRepository interface {
+	IncrScores(ctx context.Context, boards []string, deltas map[int64]float64) error
+	TopIds(ctx context.Context, board string, n int) ([]int64, error)
+	Decay(ctx context.Context, board string, halfLife time.Duration, capacity int) error
+	// Remove 撤回的文章从所有榜单里面移除
+	Remove(ctx context.Context, boards []string, ids []int64) error
+}
+
+type CachedRealTimeRankingRepository struct {
+	cache cache.RankingZSetCache
+}
+
+func NewCachedRealTimeRankingRepository(cache cache.RankingZSetCache) RealTimeRankingRepository {
+	return &CachedRealTimeRankingRepository{cache: cache}
+}
+
+func (c *CachedRealTimeRankingRepository) IncrScores(ctx context.Context, boards []string, deltas map[int64]float64) error {
+	return c.cache.IncrScores(ctx, boards, deltas)
+}
+
+func (c *CachedRealTimeRankingRepository) TopIds(ctx context.Context, board string, n int) ([]int64, error) {
+	return c.cache.TopN(ctx, board, n)
+}
+
+func (c *CachedRealTimeRankingRepository) Decay(ctx context.Context, board string, halfLife time.Duration, capacity int) error {
+	return c.cache.Decay(ctx, board, halfLife, capacity)
+}
+
+func (c *CachedRealTimeRankingRepository) Remove(ctx context.Context, boards []string, ids []int64) error {
+	return c.cache.Remove(ctx, boards, ids)
+}
@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"context"
+	"github.com/Tuanzi-bug/tuan-book/internal/domain"
+	"github.com/Tuanzi-bug/tuan-book/internal/repository/cache"
+	"github.com/Tuanzi-bug/tuan-book/internal/repository/dao"
+	"github.com/Tuanzi-bug/tuan-book/pkg/log"
+	"go.uber.org/zap"
+	"time"
+)
+
+// readerDayLayout 按天统计独立读者，使用本地时间划分
+const readerDayLayout = "20060102"
+
+//go:generate mockgen -source=./reader.go -package=repomocks -destination=./mocks/reader.mock.go UniqueReaderRepository
+type UniqueReaderRepository interface {
+	// AddReaders 按照阅读时间所在的那一天记录读者
+	AddReaders(ctx context.Context, biz string, records []domain.ReadRecord) error
+	// Sync 把 day 这一天有变化的独立读者数同步到数据库，返回同步了多少条
+	Sync(ctx context.Context, biz string, day time.Time) (int, error)
+}
+
+type CachedUniqueReaderRepository struct {
+	dao       dao.UniqueReaderDAO
+	cache     cache.UniqueReaderCache
+	intrCache cache.InteractiveCache
+}
+
+func NewCachedUniqueReaderRepository(dao dao.UniqueReaderDAO, cache cache.UniqueReaderCache,
+	intrCache cache.InteractiveCache) UniqueReaderRepository {
+	return &CachedUniqueReaderRepository{
+		dao:       dao,
+		cache:     cache,
+		intrCache: intrCache,
+	}
+}
+
+func (c *CachedUniqueReaderRepository) AddReaders(ctx context.Context, biz string, records []domain.ReadRecord) error {
+	// 一批消息可能跨天
+	byDay := make(map[string]map[int64][]int64)
+	for _, r := range records {
+		day := r.Ctime.Format(readerDayLayout)
+		readers, ok := byDay[day]
+		if !ok {
+			readers = make(map[int64][]int64)
+			byDay[day] = readers
+		}
+		readers[r.Aid] = append(readers[r.Aid], r.Uid)
+	}
+	for day, readers := range byDay {
+		if err := c.cache.Add(ctx, biz, day, readers); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *CachedUniqueReaderRepository) Sync(ctx context.Context, biz string, day time.Time) (int, error) {
+	d := day.Format(readerDayLayout)
+	ids, err := c.cache.TakeDirty(ctx, biz, d)
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+	deltas, err := c.sync(ctx, biz, d, ids)
+	if err != nil {
+		// 放回去下一次再同步
+		if er := c.cache.MarkDirty(ctx, biz, d, ids); er != nil {
+			log.Error("cache MarkDirty failed", zap.Error(er), zap.String("biz", biz), zap.String("day", d))
+		}
+		return 0, err
+	}
+	for id, delta := range deltas {
+		er := c.intrCache.IncrReaderCntIfPresent(ctx, biz, id, delta)
+		if er != nil {
+			// 记录日志，不影响主流程
+			log.Error("cache IncrReaderCntIfPresent failed", zap.Error(er), zap.String("biz", biz), zap.Int64("id", id))
+		}
+	}
+	return len(ids), nil
+}
+
+func (c *CachedUniqueReaderRepository) sync(ctx context.Context, biz string, day string, ids []int64) (map[int64]int64, error) {
+	cnts, err := c.cache.Count(ctx, biz, day, ids)
+	if err != nil {
+		return nil, err
+	}
+	return c.dao.SyncDaily(ctx, biz, day, cnts)
+}
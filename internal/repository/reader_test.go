@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/Tuanzi-bug/tuan-book/internal/domain"
+	"github.com/Tuanzi-bug/tuan-book/internal/repository/cache"
+	cachemocks "github.com/Tuanzi-bug/tuan-book/internal/repository/cache/mocks"
+	"github.com/Tuanzi-bug/tuan-book/internal/repository/dao"
+	daomocks "github.com/Tuanzi-bug/tuan-book/internal/repository/dao/mocks"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"testing"
+	"time"
+)
+
+func TestCachedUniqueReaderRepository_AddReaders(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	c := cachemocks.NewMockUniqueReaderCache(ctrl)
+	repo := NewCachedUniqueReaderRepository(nil, c, nil)
+
+	day1 := time.Date(2024, 1, 1, 23, 59, 0, 0, time.Local)
+	day2 := time.Date(2024, 1, 2, 0, 1, 0, 0, time.Local)
+	// 跨天的一批按天分开记录
+	c.EXPECT().Add(gomock.Any(), "article", "20240101", map[int64][]int64{1: {123, 456}}).Return(nil)
+	c.EXPECT().Add(gomock.Any(), "article", "20240102", map[int64][]int64{1: {123}, 2: {123}}).Return(nil)
+	err := repo.AddReaders(context.Background(), "article", []domain.ReadRecord{
+		{Uid: 123, Aid: 1, Ctime: day1},
+		{Uid: 456, Aid: 1, Ctime: day1},
+		{Uid: 123, Aid: 1, Ctime: day2},
+		{Uid: 123, Aid: 2, Ctime: day2},
+	})
+	assert.NoError(t, err)
+}
+
+func TestCachedUniqueReaderRepository_Sync(t *testing.T) {
+	day := time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local)
+	testCases := []struct {
+		name string
+
+		mock func(ctrl *gomock.Controller) (dao.UniqueReaderDAO, cache.UniqueReaderCache, cache.InteractiveCache)
+
+		wantCnt int
+		wantErr error
+	}{
+		{
+			name: "同步成功，更新缓存里面的读者数",
+			mock: func(ctrl *gomock.Controller) (dao.UniqueReaderDAO, cache.UniqueReaderCache, cache.InteractiveCache) {
+				d := daomocks.NewMockUniqueReaderDAO(ctrl)
+				c := cachemocks.NewMockUniqueReaderCache(ctrl)
+				ic := cachemocks.NewMockInteractiveCache(ctrl)
+				c.EXPECT().TakeDirty(gomock.Any(), "article", "20240101").Return([]int64{1, 2}, nil)
+				c.EXPECT().Count(gomock.Any(), "article", "20240101", []int64{1, 2}).
+					Return(map[int64]int64{1: 10, 2: 3}, nil)
+				// 2 没有变化
+				d.EXPECT().SyncDaily(gomock.Any(), "article", "20240101", map[int64]int64{1: 10, 2: 3}).
+					Return(map[int64]int64{1: 4}, nil)
+				ic.EXPECT().IncrReaderCntIfPresent(gomock.Any(), "article", int64(1), int64(4)).Return(nil)
+				return d, c, ic
+			},
+			wantCnt: 2,
+		},
+		{
+			name: "没有需要同步的",
+			mock: func(ctrl *gomock.Controller) (dao.UniqueReaderDAO, cache.UniqueReaderCache, cache.InteractiveCache) {
+				c := cachemocks.NewMockUniqueReaderCache(ctrl)
+				c.EXPECT().TakeDirty(gomock.Any(), "article", "20240101").Return([]int64{}, nil)
+				return nil, c, nil
+			},
+		},
+		{
+			name: "数据库失败，放回去下一次同步",
+			mock: func(ctrl *gomock.Controller) (dao.UniqueReaderDAO, cache.UniqueReaderCache, cache.InteractiveCache) {
+				d := daomocks.NewMockUniqueReaderDAO(ctrl)
+				c := cachemocks.NewMockUniqueReaderCache(ctrl)
+				c.EXPECT().TakeDirty(gomock.Any(), "article", "20240101").Return([]int64{1}, nil)
+				c.EXPECT().Count(gomock.Any(), "article", "20240101", []int64{1}).
+					Return(map[int64]int64{1: 10}, nil)
+				d.EXPECT().SyncDaily(gomock.Any(), "article", "20240101", map[int64]int64{1: 10}).
+					Return(nil, errors.New("mock error"))
+				c.EXPECT().MarkDirty(gomock.Any(), "article", "20240101", []int64{1}).Return(nil)
+				return d, c, nil
+			},
+			wantErr: errors.New("mock error"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			repo := NewCachedUniqueReaderRepository(tc.mock(ctrl))
+			cnt, err := repo.Sync(context.Background(), "article", day)
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantCnt, cnt)
+		})
+	}
+}
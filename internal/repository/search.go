@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"context"
+	"github.com/Tuanzi-bug/tuan-book/internal/domain"
+	"github.com/Tuanzi-bug/tuan-book/pkg/fulltext"
+	"sync"
+)
+
+// ArticleSearchRepository 文章的全文搜索，以后换成远程的搜索引擎只需要换掉实现
+//
+//go:generate mockgen -source=./search.go -package=repomocks -destination=./mocks/search.mock.go ArticleSearchRepository
+type ArticleSearchRepository interface {
+	// InputArticles 添加或者更新文章的索引
+	InputArticles(ctx context.Context, arts []domain.Article) error
+	DeleteArticles(ctx context.Context, ids []int64) error
+	// SearchArticle 返回这一页命中的文章和命中总数
+	SearchArticle(ctx context.Context, query string, offset, limit int) ([]domain.ArticleSearchHit, int, error)
+}
+
+const (
+	// 标题命中比内容命中更重要
+	searchTitleWeight   = 2
+	searchContentWeight = 1
+	// 内容高亮截取的长度
+	searchSnippetRunes = 120
+)
+
+// LocalArticleSearchRepository 进程内的倒排索引，每个节点各自维护一份完整的索引
+type LocalArticleSearchRepository struct {
+	index *fulltext.Index
+	// 文章除了内容以外的信息，内容在索引里面
+	metas sync.Map
+}
+
+func NewLocalArticleSearchRepository() ArticleSearchRepository {
+	return &LocalArticleSearchRepository{
+		index: fulltext.NewIndex(searchTitleWeight, searchContentWeight),
+	}
+}
+
+func (l *LocalArticleSearchRepository) InputArticles(ctx context.Context, arts []domain.Article) error {
+	for _, art := range arts {
+		l.index.Put(fulltext.Doc{Id: art.Id, Fields: []string{art.Title, art.Content}})
+		art.Content = ""
+		l.metas.Store(art.Id, art)
+	}
+	return nil
+}
+
+func (l *LocalArticleSearchRepository) DeleteArticles(ctx context.Context, ids []int64) error {
+	for _, id := range ids {
+		l.index.Delete(id)
+		l.metas.Delete(id)
+	}
+	return nil
+}
+
+func (l *LocalArticleSearchRepository) SearchArticle(ctx context.Context, query string, offset, limit int) ([]domain.ArticleSearchHit, int, error) {
+	hits, total := l.index.Search(query, offset, limit)
+	res := make([]domain.ArticleSearchHit, 0, len(hits))
+	for _, hit := range hits {
+		doc, ok := l.index.Get(hit.Id)
+		val, ok2 := l.metas.Load(hit.Id)
+		if !ok || !ok2 {
+			// 搜索之后被删除了
+			continue
+		}
+		res = append(res, domain.ArticleSearchHit{
+			Article:          val.(domain.Article),
+			Score:            hit.Score,
+			TitleHighlight:   fulltext.Highlight(doc.Fields[0], query, "<em>", "</em>", 0),
+			ContentHighlight: fulltext.Highlight(doc.Fields[1], query, "<em>", "</em>", searchSnippetRunes),
+		})
+	}
+	return res, total, nil
+}
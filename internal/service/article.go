@@ -2,12 +2,33 @@ package service
 
 import (
 	"context"
+	"errors"
 	"github.com/Tuanzi-bug/tuan-book/internal/domain"
 	events "github.com/Tuanzi-bug/tuan-book/internal/events/article"
 	"github.com/Tuanzi-bug/tuan-book/internal/repository"
 	"github.com/Tuanzi-bug/tuan-book/pkg/log"
+	"github.com/Tuanzi-bug/tuan-book/pkg/textdiff"
+	"github.com/Tuanzi-bug/tuan-book/pkg/trace"
 	"go.uber.org/zap"
+	"slices"
+	"strings"
 	"time"
+	"unicode/utf8"
+)
+
+var (
+	ErrRevisionNotFound    = repository.ErrRevisionNotFound
+	ErrRevisionNotBelong   = errors.New("版本不属于这篇文章")
+	ErrArticleNotScheduled = repository.ErrArticleNotScheduled
+	ErrInvalidPublishTime  = errors.New("定时发表的时间必须晚于当前时间")
+	ErrInvalidTag          = errors.New("标签不能为空，也不能太长")
+	ErrTooManyTags         = errors.New("创作者使用的标签太多")
+)
+
+const (
+	// maxTagsPerAuthor 一个创作者所有文章加起来最多使用多少个不同的标签
+	maxTagsPerAuthor = 50
+	maxTagLen        = 32
 )
 
 //go:generate mockgen -source=./article.go -package=svcmocks -destination=./mocks/article.mock.go ArticleService
@@ -19,6 +40,22 @@ type ArticleService interface {
 	GetById(ctx context.Context, id int64) (domain.Article, error)
 	GetPubById(ctx context.Context, id, uid int64) (domain.Article, error)
 	ListPub(ctx context.Context, start time.Time, offset, limit int) ([]domain.Article, error)
+	// GetPubByIds 批量获取线上库的文章，不会产生阅读事件
+	GetPubByIds(ctx context.Context, ids []int64) ([]domain.Article, error)
+	// ListRevisions 文章的历史版本，调用方需要先校验作者
+	ListRevisions(ctx context.Context, aid int64, offset, limit int) ([]domain.ArticleRevision, error)
+	// DiffRevisions 比较同一篇文章的两个版本，返回从 from 到 to 的按行差异
+	DiffRevisions(ctx context.Context, aid, from, to int64) (domain.ArticleRevision, domain.ArticleRevision, []textdiff.Line, error)
+	// RestoreRevision 把某个版本恢复成当前的草稿
+	RestoreRevision(ctx context.Context, uid, aid, revId int64) error
+	// SchedulePublish 保存草稿并且在 publishAt 的时候发表
+	SchedulePublish(ctx context.Context, art domain.Article, publishAt time.Time) (int64, error)
+	Reschedule(ctx context.Context, uid, id int64, publishAt time.Time) error
+	CancelSchedule(ctx context.Context, uid, id int64) error
+	// PublishDue 发表最多 limit 篇到期的定时文章，返回发表成功的数量
+	PublishDue(ctx context.Context, now time.Time, limit int) (int, error)
+	// ListPubByTag 按标签浏览线上库，cursor 是上一页最后一篇文章的 id，第一页传 0
+	ListPubByTag(ctx context.Context, tag string, cursor int64, limit int) ([]domain.Article, error)
 }
 
 type articleService struct {
@@ -30,6 +67,52 @@ func (s *articleService) ListPub(ctx context.Context, start time.Time, offset, l
 	return s.repo.ListPub(ctx, start, offset, limit)
 }
 
+func (s *articleService) GetPubByIds(ctx context.Context, ids []int64) ([]domain.Article, error) {
+	return s.repo.GetPubByIds(ctx, ids)
+}
+
+func (s *articleService) ListRevisions(ctx context.Context, aid int64, offset, limit int) ([]domain.ArticleRevision, error) {
+	return s.repo.ListRevisions(ctx, aid, offset, limit)
+}
+
+func (s *articleService) DiffRevisions(ctx context.Context, aid, from, to int64) (domain.ArticleRevision, domain.ArticleRevision, []textdiff.Line, error) {
+	fromRev, err := s.getRevision(ctx, aid, from)
+	if err != nil {
+		return domain.ArticleRevision{}, domain.ArticleRevision{}, nil, err
+	}
+	toRev, err := s.getRevision(ctx, aid, to)
+	if err != nil {
+		return domain.ArticleRevision{}, domain.ArticleRevision{}, nil, err
+	}
+	return fromRev, toRev, textdiff.Lines(fromRev.Content, toRev.Content), nil
+}
+
+func (s *articleService) RestoreRevision(ctx context.Context, uid, aid, revId int64) error {
+	rev, err := s.getRevision(ctx, aid, revId)
+	if err != nil {
+		return err
+	}
+	// 恢复等价于用旧版本的内容保存一次，会产生一个新的版本
+	_, err = s.Save(ctx, domain.Article{
+		Id:      aid,
+		Title:   rev.Title,
+		Content: rev.Content,
+		Author:  domain.Author{Id: uid},
+	})
+	return err
+}
+
+func (s *articleService) getRevision(ctx context.Context, aid, revId int64) (domain.ArticleRevision, error) {
+	rev, err := s.repo.GetRevision(ctx, revId)
+	if err != nil {
+		return domain.ArticleRevision{}, err
+	}
+	if rev.ArticleId != aid {
+		return domain.ArticleRevision{}, ErrRevisionNotBelong
+	}
+	return rev, nil
+}
+
 func NewArticleService(repo repository.ArticleRepository, events events.Producer) ArticleService {
 	return &articleService{
 		repo:     repo,
@@ -38,23 +121,123 @@ func NewArticleService(repo repository.ArticleRepository, events events.Producer
 }
 
 func (s *articleService) Withdraw(ctx context.Context, uid, id int64) error {
+	// 撤回事件和状态修改在同一个事务里面写入 outbox
 	return s.repo.SyncStatus(ctx, uid, id, domain.ArticleStatusPrivate)
 }
 
 func (s *articleService) Save(ctx context.Context, art domain.Article) (int64, error) {
+	err := s.checkTags(ctx, &art)
+	if err != nil {
+		return 0, err
+	}
 	art.Status = domain.ArticleStatusUnpublished
 	if art.Id > 0 {
-		err := s.repo.Update(ctx, art)
+		err = s.repo.Update(ctx, art)
 		return art.Id, err
 	}
 	return s.repo.Create(ctx, art)
 }
 
 func (s *articleService) Publish(ctx context.Context, article domain.Article) (int64, error) {
+	err := s.checkTags(ctx, &article)
+	if err != nil {
+		return 0, err
+	}
 	article.Status = domain.ArticleStatusPublished
+	// 发表事件和线上库在同一个事务里面写入 outbox
 	return s.repo.Sync(ctx, article)
 }
 
+func (s *articleService) SchedulePublish(ctx context.Context, art domain.Article, publishAt time.Time) (int64, error) {
+	if !publishAt.After(time.Now()) {
+		return 0, ErrInvalidPublishTime
+	}
+	err := s.checkTags(ctx, &art)
+	if err != nil {
+		return 0, err
+	}
+	// 定时发表的内容只保存在制作库，到点再同步到线上库
+	art.Status = domain.ArticleStatusScheduled
+	art.PublishAt = publishAt
+	if art.Id > 0 {
+		err = s.repo.Update(ctx, art)
+		return art.Id, err
+	}
+	return s.repo.Create(ctx, art)
+}
+
+func (s *articleService) Reschedule(ctx context.Context, uid, id int64, publishAt time.Time) error {
+	if !publishAt.After(time.Now()) {
+		return ErrInvalidPublishTime
+	}
+	return s.repo.Reschedule(ctx, uid, id, publishAt)
+}
+
+func (s *articleService) CancelSchedule(ctx context.Context, uid, id int64) error {
+	return s.repo.CancelSchedule(ctx, uid, id)
+}
+
+func (s *articleService) PublishDue(ctx context.Context, now time.Time, limit int) (int, error) {
+	arts, err := s.repo.ListDueScheduled(ctx, now, limit)
+	if err != nil {
+		return 0, err
+	}
+	cnt := 0
+	for _, art := range arts {
+		_, er := s.repo.PublishScheduled(ctx, art.Id, now)
+		switch {
+		case errors.Is(er, repository.ErrArticleNotFound):
+			// 在查询之后被作者取消或者改期了
+			log.Info("定时文章已经不需要发表", zap.Int64("aid", art.Id))
+		case er != nil:
+			// 单篇失败不影响其它文章，下一轮调度会重试
+			log.Error("发表定时文章失败", zap.Int64("aid", art.Id), zap.Error(er))
+		default:
+			cnt++
+		}
+	}
+	return cnt, nil
+}
+
+func (s *articleService) ListPubByTag(ctx context.Context, tag string, cursor int64, limit int) ([]domain.Article, error) {
+	return s.repo.ListPubByTag(ctx, strings.TrimSpace(tag), cursor, limit)
+}
+
+// checkTags 规整标签并且校验创作者的标签数量，nil 表示不修改标签，不需要校验
+func (s *articleService) checkTags(ctx context.Context, art *domain.Article) error {
+	if art.Tags == nil {
+		return nil
+	}
+	tags := make([]string, 0, len(art.Tags))
+	for _, tag := range art.Tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || utf8.RuneCountInString(tag) > maxTagLen {
+			return ErrInvalidTag
+		}
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	art.Tags = tags
+	if len(tags) == 0 {
+		return nil
+	}
+	used, err := s.repo.AuthorTags(ctx, art.Author.Id, art.Id)
+	if err != nil {
+		return err
+	}
+	total := len(used)
+	for _, tag := range tags {
+		if !slices.Contains(used, tag) {
+			total++
+		}
+	}
+	if total > maxTagsPerAuthor {
+		return ErrTooManyTags
+	}
+	return nil
+}
+
 func (s *articleService) GetByAuthor(ctx context.Context, uid int64, offset int, limit int) ([]domain.Article, error) {
 	return s.repo.GetByAuthor(ctx, uid, offset, limit)
 }
@@ -65,16 +248,19 @@ func (s *articleService) GetById(ctx context.Context, id int64) (domain.Article,
 
 func (s *articleService) GetPubById(ctx context.Context, id, uid int64) (domain.Article, error) {
 	res, err := s.repo.GetPubById(ctx, id)
+	if err != nil {
+		return res, err
+	}
+	// 阅读事件量太大，不走 outbox，丢了也只是少算几次阅读
+	evtCtx := trace.Detach(ctx)
 	go func() {
-		if err == nil {
-			er := s.producer.ProduceReadEvent(events.ReadEvent{
-				Aid: id,
-				Uid: uid,
-			})
-			if er != nil {
-				log.Error("produce read event failed", zap.Int64("aid", id), zap.Error(er))
-			}
+		er := s.producer.ProduceReadEvent(evtCtx, events.ReadEvent{
+			Aid: id,
+			Uid: uid,
+		})
+		if er != nil {
+			log.Error("produce read event failed", zap.Int64("aid", id), zap.Error(er))
 		}
 	}()
-	return res, err
+	return res, nil
 }
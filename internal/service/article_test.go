@@ -0,0 +1,320 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Tuanzi-bug/tuan-book/internal/domain"
+	events "github.com/Tuanzi-bug/tuan-book/internal/events/article"
+	evtmocks "github.com/Tuanzi-bug/tuan-book/internal/events/article/mocks"
+	"github.com/Tuanzi-bug/tuan-book/internal/repository"
+	repomocks "github.com/Tuanzi-bug/tuan-book/internal/repository/mocks"
+	"github.com/Tuanzi-bug/tuan-book/pkg/trace"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"testing"
+	"time"
+)
+
+func TestArticleService_PublishDue(t *testing.T) {
+	now := time.UnixMilli(1700000000000)
+	testCases := []struct {
+		name string
+
+		mock func(ctrl *gomock.Controller) (repository.ArticleRepository, events.Producer)
+
+		wantCnt int
+		wantErr error
+	}{
+		{
+			name: "全部发表成功",
+			mock: func(ctrl *gomock.Controller) (repository.ArticleRepository, events.Producer) {
+				repo := repomocks.NewMockArticleRepository(ctrl)
+				producer := evtmocks.NewMockProducer(ctrl)
+				repo.EXPECT().ListDueScheduled(gomock.Any(), now, 10).
+					Return([]domain.Article{{Id: 1}, {Id: 2}}, nil)
+				repo.EXPECT().PublishScheduled(gomock.Any(), int64(1), now).
+					Return(domain.Article{Id: 1, Author: domain.Author{Id: 123}}, nil)
+				repo.EXPECT().PublishScheduled(gomock.Any(), int64(2), now).
+					Return(domain.Article{Id: 2, Author: domain.Author{Id: 123}}, nil)
+				// 发表事件在 dao 的事务里面写入，这里不会再发送
+				return repo, producer
+			},
+			wantCnt: 2,
+		},
+		{
+			name: "跳过已经取消的和失败的",
+			mock: func(ctrl *gomock.Controller) (repository.ArticleRepository, events.Producer) {
+				repo := repomocks.NewMockArticleRepository(ctrl)
+				producer := evtmocks.NewMockProducer(ctrl)
+				repo.EXPECT().ListDueScheduled(gomock.Any(), now, 10).
+					Return([]domain.Article{{Id: 1}, {Id: 2}, {Id: 3}}, nil)
+				repo.EXPECT().PublishScheduled(gomock.Any(), int64(1), now).
+					Return(domain.Article{}, repository.ErrArticleNotFound)
+				repo.EXPECT().PublishScheduled(gomock.Any(), int64(2), now).
+					Return(domain.Article{}, errors.New("mock error"))
+				repo.EXPECT().PublishScheduled(gomock.Any(), int64(3), now).
+					Return(domain.Article{Id: 3, Author: domain.Author{Id: 123}}, nil)
+				return repo, producer
+			},
+			wantCnt: 1,
+		},
+		{
+			name: "查询失败",
+			mock: func(ctrl *gomock.Controller) (repository.ArticleRepository, events.Producer) {
+				repo := repomocks.NewMockArticleRepository(ctrl)
+				producer := evtmocks.NewMockProducer(ctrl)
+				repo.EXPECT().ListDueScheduled(gomock.Any(), now, 10).
+					Return(nil, errors.New("mock error"))
+				return repo, producer
+			},
+			wantErr: errors.New("mock error"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			svc := NewArticleService(tc.mock(ctrl))
+			cnt, err := svc.PublishDue(context.Background(), now, 10)
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantCnt, cnt)
+		})
+	}
+}
+
+func TestArticleService_SchedulePublish(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	repo := repomocks.NewMockArticleRepository(ctrl)
+	svc := NewArticleService(repo, nil)
+
+	_, err := svc.SchedulePublish(context.Background(), domain.Article{Id: 1}, time.Now().Add(-time.Minute))
+	assert.Equal(t, ErrInvalidPublishTime, err)
+
+	publishAt := time.Now().Add(time.Hour)
+	repo.EXPECT().Update(gomock.Any(), domain.Article{
+		Id:        1,
+		Status:    domain.ArticleStatusScheduled,
+		PublishAt: publishAt,
+	}).Return(nil)
+	id, err := svc.SchedulePublish(context.Background(), domain.Article{Id: 1}, publishAt)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), id)
+}
+
+func TestArticleService_GetPubById(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	repo := repomocks.NewMockArticleRepository(ctrl)
+	producer := evtmocks.NewMockProducer(ctrl)
+	svc := NewArticleService(repo, producer)
+
+	// 阅读事件异步发送，发送失败不影响阅读
+	repo.EXPECT().GetPubById(gomock.Any(), int64(1)).Return(domain.Article{Id: 1}, nil)
+	sent := make(chan struct{})
+	producer.EXPECT().ProduceReadEvent(gomock.Any(), events.ReadEvent{Aid: 1, Uid: 123}).
+		DoAndReturn(func(ctx context.Context, evt events.ReadEvent) error {
+			// 请求已经结束了，链路 id 还在
+			assert.Equal(t, "abc", trace.IdFromContext(ctx))
+			close(sent)
+			return errors.New("mock error")
+		})
+	art, err := svc.GetPubById(trace.WithId(context.Background(), "abc"), 1, 123)
+	assert.NoError(t, err)
+	assert.Equal(t, domain.Article{Id: 1}, art)
+	select {
+	case <-sent:
+	case <-time.After(time.Second):
+		t.Fatal("没有发送阅读事件")
+	}
+
+	// 文章不存在的时候不记录阅读
+	repo.EXPECT().GetPubById(gomock.Any(), int64(2)).Return(domain.Article{}, repository.ErrArticleNotFound)
+	_, err = svc.GetPubById(context.Background(), 2, 123)
+	assert.Equal(t, repository.ErrArticleNotFound, err)
+}
+
+func TestArticleService_SaveTags(t *testing.T) {
+	testCases := []struct {
+		name string
+
+		mock func(ctrl *gomock.Controller) repository.ArticleRepository
+
+		tags    []string
+		wantErr error
+	}{
+		{
+			name: "去掉空白和重复",
+			mock: func(ctrl *gomock.Controller) repository.ArticleRepository {
+				repo := repomocks.NewMockArticleRepository(ctrl)
+				repo.EXPECT().AuthorTags(gomock.Any(), int64(123), int64(1)).Return([]string{"go"}, nil)
+				repo.EXPECT().Update(gomock.Any(), domain.Article{
+					Id:     1,
+					Author: domain.Author{Id: 123},
+					Status: domain.ArticleStatusUnpublished,
+					Tags:   []string{"go", "redis"},
+				}).Return(nil)
+				return repo
+			},
+			tags: []string{" go", "redis ", "go"},
+		},
+		{
+			name: "不修改标签",
+			mock: func(ctrl *gomock.Controller) repository.ArticleRepository {
+				repo := repomocks.NewMockArticleRepository(ctrl)
+				repo.EXPECT().Update(gomock.Any(), domain.Article{
+					Id:     1,
+					Author: domain.Author{Id: 123},
+					Status: domain.ArticleStatusUnpublished,
+				}).Return(nil)
+				return repo
+			},
+		},
+		{
+			name: "空标签",
+			mock: func(ctrl *gomock.Controller) repository.ArticleRepository {
+				return repomocks.NewMockArticleRepository(ctrl)
+			},
+			tags:    []string{"go", " "},
+			wantErr: ErrInvalidTag,
+		},
+		{
+			name: "超过创作者的标签上限",
+			mock: func(ctrl *gomock.Controller) repository.ArticleRepository {
+				repo := repomocks.NewMockArticleRepository(ctrl)
+				used := make([]string, 0, maxTagsPerAuthor)
+				for i := 0; i < maxTagsPerAuthor; i++ {
+					used = append(used, fmt.Sprintf("tag%d", i))
+				}
+				repo.EXPECT().AuthorTags(gomock.Any(), int64(123), int64(1)).Return(used, nil)
+				return repo
+			},
+			// 已经用过的标签不算新的
+			tags:    []string{"tag1", "new"},
+			wantErr: ErrTooManyTags,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			svc := NewArticleService(tc.mock(ctrl), nil)
+			_, err := svc.Save(context.Background(), domain.Article{
+				Id:     1,
+				Author: domain.Author{Id: 123},
+				Tags:   tc.tags,
+			})
+			assert.Equal(t, tc.wantErr, err)
+		})
+	}
+}
+
+func TestArticleService_DiffRevisions(t *testing.T) {
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) repository.ArticleRepository
+
+		wantLines int
+		wantErr   error
+	}{
+		{
+			name: "比较成功",
+			mock: func(ctrl *gomock.Controller) repository.ArticleRepository {
+				repo := repomocks.NewMockArticleRepository(ctrl)
+				repo.EXPECT().GetRevision(gomock.Any(), int64(1)).
+					Return(domain.ArticleRevision{Id: 1, ArticleId: 10, Content: "a\nb"}, nil)
+				repo.EXPECT().GetRevision(gomock.Any(), int64(2)).
+					Return(domain.ArticleRevision{Id: 2, ArticleId: 10, Content: "a\nc"}, nil)
+				return repo
+			},
+			wantLines: 3,
+		},
+		{
+			name: "版本属于别的文章",
+			mock: func(ctrl *gomock.Controller) repository.ArticleRepository {
+				repo := repomocks.NewMockArticleRepository(ctrl)
+				repo.EXPECT().GetRevision(gomock.Any(), int64(1)).
+					Return(domain.ArticleRevision{Id: 1, ArticleId: 11}, nil)
+				return repo
+			},
+			wantErr: ErrRevisionNotBelong,
+		},
+		{
+			name: "版本不存在",
+			mock: func(ctrl *gomock.Controller) repository.ArticleRepository {
+				repo := repomocks.NewMockArticleRepository(ctrl)
+				repo.EXPECT().GetRevision(gomock.Any(), int64(1)).
+					Return(domain.ArticleRevision{Id: 1, ArticleId: 10}, nil)
+				repo.EXPECT().GetRevision(gomock.Any(), int64(2)).
+					Return(domain.ArticleRevision{}, repository.ErrRevisionNotFound)
+				return repo
+			},
+			wantErr: ErrRevisionNotFound,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			svc := NewArticleService(tc.mock(ctrl), nil)
+			_, _, lines, err := svc.DiffRevisions(context.Background(), 10, 1, 2)
+			assert.Equal(t, tc.wantErr, err)
+			assert.Len(t, lines, tc.wantLines)
+		})
+	}
+}
+
+func TestArticleService_RestoreRevision(t *testing.T) {
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) repository.ArticleRepository
+
+		wantErr error
+	}{
+		{
+			name: "用旧版本的内容保存草稿",
+			mock: func(ctrl *gomock.Controller) repository.ArticleRepository {
+				repo := repomocks.NewMockArticleRepository(ctrl)
+				repo.EXPECT().GetRevision(gomock.Any(), int64(1)).
+					Return(domain.ArticleRevision{Id: 1, ArticleId: 10, Title: "旧标题", Content: "旧内容"}, nil)
+				repo.EXPECT().Update(gomock.Any(), domain.Article{
+					Id:      10,
+					Title:   "旧标题",
+					Content: "旧内容",
+					Author:  domain.Author{Id: 123},
+					Status:  domain.ArticleStatusUnpublished,
+				}).Return(nil)
+				return repo
+			},
+		},
+		{
+			name: "版本不存在",
+			mock: func(ctrl *gomock.Controller) repository.ArticleRepository {
+				repo := repomocks.NewMockArticleRepository(ctrl)
+				repo.EXPECT().GetRevision(gomock.Any(), int64(1)).
+					Return(domain.ArticleRevision{}, repository.ErrRevisionNotFound)
+				return repo
+			},
+			wantErr: ErrRevisionNotFound,
+		},
+		{
+			name: "版本属于别的文章",
+			mock: func(ctrl *gomock.Controller) repository.ArticleRepository {
+				repo := repomocks.NewMockArticleRepository(ctrl)
+				repo.EXPECT().GetRevision(gomock.Any(), int64(1)).
+					Return(domain.ArticleRevision{Id: 1, ArticleId: 11}, nil)
+				return repo
+			},
+			wantErr: ErrRevisionNotBelong,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			svc := NewArticleService(tc.mock(ctrl), nil)
+			assert.Equal(t, tc.wantErr, svc.RestoreRevision(context.Background(), 123, 10, 1))
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/Tuanzi-bug/tuan-book/internal/domain"
+	"github.com/Tuanzi-bug/tuan-book/internal/repository"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	ErrCollectionNotFound     = repository.ErrCollectionNotFound
+	ErrCollectionDuplicate    = repository.ErrCollectionDuplicate
+	ErrAlreadyCollected       = repository.ErrCollectItemDuplicate
+	ErrInvalidCollectionName  = errors.New("收藏夹名字不能为空，也不能太长")
+	ErrInvalidCollectionItems = errors.New("没有要移动的内容")
+)
+
+const maxCollectionNameRunes = 64
+
+//go:generate mockgen -source=./collection.go -package=svcmocks -destination=./mocks/collection.mock.go CollectionService
+type CollectionService interface {
+	Create(ctx context.Context, uid int64, name string) (int64, error)
+	Rename(ctx context.Context, uid int64, id int64, name string) error
+	// Delete 删除收藏夹会连同里面收藏的内容一起删除
+	Delete(ctx context.Context, uid int64, id int64) error
+	List(ctx context.Context, uid int64) ([]domain.Collection, error)
+	// ListItems cid 为 0 表示默认收藏夹
+	ListItems(ctx context.Context, uid int64, cid int64, offset int, limit int) ([]domain.CollectionItem, error)
+	// MoveItems 把自己收藏的 bizIds 移动到收藏夹 to，to 为 0 表示默认收藏夹
+	MoveItems(ctx context.Context, uid int64, biz string, bizIds []int64, to int64) (int64, error)
+}
+
+type collectionService struct {
+	repo repository.CollectionRepository
+}
+
+func NewCollectionService(repo repository.CollectionRepository) CollectionService {
+	return &collectionService{repo: repo}
+}
+
+func (s *collectionService) Create(ctx context.Context, uid int64, name string) (int64, error) {
+	name, err := s.checkName(name)
+	if err != nil {
+		return 0, err
+	}
+	return s.repo.Create(ctx, domain.Collection{Uid: uid, Name: name})
+}
+
+func (s *collectionService) Rename(ctx context.Context, uid int64, id int64, name string) error {
+	name, err := s.checkName(name)
+	if err != nil {
+		return err
+	}
+	return s.repo.Rename(ctx, uid, id, name)
+}
+
+func (s *collectionService) Delete(ctx context.Context, uid int64, id int64) error {
+	return s.repo.Delete(ctx, uid, id)
+}
+
+func (s *collectionService) List(ctx context.Context, uid int64) ([]domain.Collection, error) {
+	return s.repo.FindByUid(ctx, uid)
+}
+
+func (s *collectionService) ListItems(ctx context.Context, uid int64, cid int64, offset int, limit int) ([]domain.CollectionItem, error) {
+	if err := checkCollectionOwner(ctx, s.repo, uid, cid); err != nil {
+		return nil, err
+	}
+	return s.repo.FindItems(ctx, uid, cid, offset, limit)
+}
+
+func (s *collectionService) MoveItems(ctx context.Context, uid int64, biz string, bizIds []int64, to int64) (int64, error) {
+	if len(bizIds) == 0 {
+		return 0, ErrInvalidCollectionItems
+	}
+	if err := checkCollectionOwner(ctx, s.repo, uid, to); err != nil {
+		return 0, err
+	}
+	return s.repo.MoveItems(ctx, uid, biz, bizIds, to)
+}
+
+func (s *collectionService) checkName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > maxCollectionNameRunes {
+		return "", ErrInvalidCollectionName
+	}
+	return name, nil
+}
+
+// checkCollectionOwner cid 为 0 是默认收藏夹，其他的必须是 uid 自己的
+// 别人的收藏夹也返回 ErrCollectionNotFound，不暴露收藏夹是否存在
+func checkCollectionOwner(ctx context.Context, repo repository.CollectionRepository, uid int64, cid int64) error {
+	if cid == 0 {
+		return nil
+	}
+	c, err := repo.FindById(ctx, cid)
+	if err != nil {
+		return err
+	}
+	if c.Uid != uid {
+		return ErrCollectionNotFound
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"github.com/Tuanzi-bug/tuan-book/internal/domain"
+	"github.com/Tuanzi-bug/tuan-book/internal/repository"
+	repomocks "github.com/Tuanzi-bug/tuan-book/internal/repository/mocks"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"testing"
+)
+
+func TestInteractiveService_Collect(t *testing.T) {
+	testCases := []struct {
+		name string
+
+		mock func(ctrl *gomock.Controller) (repository.InteractiveRepository, repository.CollectionRepository)
+
+		cid     int64
+		wantErr error
+	}{
+		{
+			name: "收藏到自己的收藏夹",
+			mock: func(ctrl *gomock.Controller) (repository.InteractiveRepository, repository.CollectionRepository) {
+				repo := repomocks.NewMockInteractiveRepository(ctrl)
+				collectionRepo := repomocks.NewMockCollectionRepository(ctrl)
+				collectionRepo.EXPECT().FindById(gomock.Any(), int64(10)).
+					Return(domain.Collection{Id: 10, Uid: 123}, nil)
+				repo.EXPECT().AddCollectItem(gomock.Any(), "user", int64(1), int64(10), int64(123)).Return(nil)
+				return repo, collectionRepo
+			},
+			cid: 10,
+		},
+		{
+			name: "默认收藏夹",
+			mock: func(ctrl *gomock.Controller) (repository.InteractiveRepository, repository.CollectionRepository) {
+				repo := repomocks.NewMockInteractiveRepository(ctrl)
+				collectionRepo := repomocks.NewMockCollectionRepository(ctrl)
+				repo.EXPECT().AddCollectItem(gomock.Any(), "user", int64(1), int64(0), int64(123)).Return(nil)
+				return repo, collectionRepo
+			},
+		},
+		{
+			name: "已经收藏到其他收藏夹",
+			mock: func(ctrl *gomock.Controller) (repository.InteractiveRepository, repository.CollectionRepository) {
+				repo := repomocks.NewMockInteractiveRepository(ctrl)
+				collectionRepo := repomocks.NewMockCollectionRepository(ctrl)
+				repo.EXPECT().AddCollectItem(gomock.Any(), "user", int64(1), int64(0), int64(123)).
+					Return(repository.ErrCollectItemDuplicate)
+				return repo, collectionRepo
+			},
+			wantErr: ErrAlreadyCollected,
+		},
+		{
+			name: "别人的收藏夹",
+			mock: func(ctrl *gomock.Controller) (repository.InteractiveRepository, repository.CollectionRepository) {
+				repo := repomocks.NewMockInteractiveRepository(ctrl)
+				collectionRepo := repomocks.NewMockCollectionRepository(ctrl)
+				collectionRepo.EXPECT().FindById(gomock.Any(), int64(10)).
+					Return(domain.Collection{Id: 10, Uid: 456}, nil)
+				return repo, collectionRepo
+			},
+			cid:     10,
+			wantErr: ErrCollectionNotFound,
+		},
+		{
+			name: "收藏夹不存在",
+			mock: func(ctrl *gomock.Controller) (repository.InteractiveRepository, repository.CollectionRepository) {
+				repo := repomocks.NewMockInteractiveRepository(ctrl)
+				collectionRepo := repomocks.NewMockCollectionRepository(ctrl)
+				collectionRepo.EXPECT().FindById(gomock.Any(), int64(10)).
+					Return(domain.Collection{}, repository.ErrCollectionNotFound)
+				return repo, collectionRepo
+			},
+			cid:     10,
+			wantErr: ErrCollectionNotFound,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			repo, collectionRepo := tc.mock(ctrl)
+			// 不是文章，不会发送收藏事件
+			svc := NewInteractiveService(repo, collectionRepo)
+			err := svc.Collect(&gin.Context{}, "user", 1, tc.cid, 123)
+			assert.Equal(t, tc.wantErr, err)
+		})
+	}
+}
+
+func TestInteractiveService_CancelCollect(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	repo := repomocks.NewMockInteractiveRepository(ctrl)
+	svc := NewInteractiveService(repo, nil)
+
+	// 没有收藏过也算成功
+	repo.EXPECT().DeleteCollectItem(gomock.Any(), "user", int64(1), int64(123)).
+		Return(repository.ErrCollectItemNotFound)
+	assert.NoError(t, svc.CancelCollect(context.Background(), "user", 1, 123))
+}
+
+func TestCollectionService_MoveItems(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	repo := repomocks.NewMockCollectionRepository(ctrl)
+	svc := NewCollectionService(repo)
+
+	_, err := svc.MoveItems(context.Background(), 123, "article", nil, 10)
+	assert.Equal(t, ErrInvalidCollectionItems, err)
+
+	repo.EXPECT().FindById(gomock.Any(), int64(10)).Return(domain.Collection{Id: 10, Uid: 456}, nil)
+	_, err = svc.MoveItems(context.Background(), 123, "article", []int64{1, 2}, 10)
+	assert.Equal(t, ErrCollectionNotFound, err)
+
+	repo.EXPECT().FindById(gomock.Any(), int64(10)).Return(domain.Collection{Id: 10, Uid: 123}, nil)
+	repo.EXPECT().MoveItems(gomock.Any(), int64(123), "article", []int64{1, 2}, int64(10)).Return(int64(2), nil)
+	cnt, err := svc.MoveItems(context.Background(), 123, "article", []int64{1, 2}, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), cnt)
+}
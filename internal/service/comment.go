@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/Tuanzi-bug/tuan-book/internal/domain"
+	"github.com/Tuanzi-bug/tuan-book/internal/repository"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	ErrCommentNotFound      = repository.ErrCommentNotFound
+	ErrInvalidComment       = errors.New("评论内容不能为空，也不能太长")
+	ErrCommentNoPermission  = errors.New("只能删除自己的评论")
+	ErrCommentBizNotSupport = errors.New("只能评论文章")
+	// ErrCommentArticleNotFound 文章不存在或者没有发表
+	ErrCommentArticleNotFound = errors.New("评论的文章不存在")
+)
+
+const (
+	// firstReplyCnt 根评论预先加载多少条回复
+	firstReplyCnt   = 3
+	maxCommentRunes = 1000
+	// commentBizArticle 目前只能评论线上库的文章
+	commentBizArticle = "article"
+)
+
+//go:generate mockgen -source=./comment.go -package=svcmocks -destination=./mocks/comment.mock.go CommentService
+type CommentService interface {
+	// Create ParentId 不为 0 的时候是回复，回复的资源必须和被回复的评论一致
+	Create(ctx context.Context, c domain.Comment) (int64, error)
+	// Delete 只有评论者自己可以删除，删除根评论会删除它下面的所有回复
+	Delete(ctx context.Context, uid, id int64) error
+	// ListRoots 根评论按照时间倒序，cursor 是上一页最后一条评论的 id，第一页传 0
+	ListRoots(ctx context.Context, biz string, bizId int64, cursor int64, limit int) ([]domain.Comment, error)
+	// ListReplies 回复按照时间正序，cursor 是上一页最后一条回复的 id，第一页传 0
+	ListReplies(ctx context.Context, rootId int64, cursor int64, limit int) ([]domain.Comment, error)
+	CountByBiz(ctx context.Context, biz string, bizIds []int64) (map[int64]int64, error)
+}
+
+type commentService struct {
+	repo    repository.CommentRepository
+	artRepo repository.ArticleRepository
+}
+
+func NewCommentService(repo repository.CommentRepository, artRepo repository.ArticleRepository) CommentService {
+	return &commentService{repo: repo, artRepo: artRepo}
+}
+
+func (s *commentService) Create(ctx context.Context, c domain.Comment) (int64, error) {
+	c.Content = strings.TrimSpace(c.Content)
+	if c.Content == "" || utf8.RuneCountInString(c.Content) > maxCommentRunes {
+		return 0, ErrInvalidComment
+	}
+	c.RootId = 0
+	if c.ParentId == 0 {
+		err := s.checkArticle(ctx, c)
+		if err != nil {
+			return 0, err
+		}
+	} else {
+		parent, err := s.repo.FindById(ctx, c.ParentId)
+		if err != nil {
+			return 0, err
+		}
+		// 回复的资源以被回复的评论为准
+		c.Biz = parent.Biz
+		c.BizId = parent.BizId
+		c.RootId = parent.RootId
+		if parent.RootId == 0 {
+			c.RootId = parent.Id
+		}
+	}
+	return s.repo.Create(ctx, c)
+}
+
+// checkArticle 根评论只能发在已经发表的文章下面，回复跟着被回复的评论走
+func (s *commentService) checkArticle(ctx context.Context, c domain.Comment) error {
+	if c.Biz == "" || c.BizId <= 0 {
+		return ErrInvalidComment
+	}
+	if c.Biz != commentBizArticle {
+		return ErrCommentBizNotSupport
+	}
+	art, err := s.artRepo.GetPubById(ctx, c.BizId)
+	if errors.Is(err, repository.ErrArticleNotFound) {
+		return ErrCommentArticleNotFound
+	}
+	if err != nil {
+		return err
+	}
+	// 撤回的文章还在线上库里面
+	if art.Status != domain.ArticleStatusPublished {
+		return ErrCommentArticleNotFound
+	}
+	return nil
+}
+
+func (s *commentService) Delete(ctx context.Context, uid, id int64) error {
+	c, err := s.repo.FindById(ctx, id)
+	if err != nil {
+		return err
+	}
+	if c.Uid != uid {
+		return ErrCommentNoPermission
+	}
+	return s.repo.Delete(ctx, c)
+}
+
+func (s *commentService) ListRoots(ctx context.Context, biz string, bizId int64, cursor int64, limit int) ([]domain.Comment, error) {
+	return s.repo.FindRoots(ctx, biz, bizId, cursor, limit, firstReplyCnt)
+}
+
+func (s *commentService) ListReplies(ctx context.Context, rootId int64, cursor int64, limit int) ([]domain.Comment, error) {
+	return s.repo.FindReplies(ctx, rootId, cursor, limit)
+}
+
+func (s *commentService) CountByBiz(ctx context.Context, biz string, bizIds []int64) (map[int64]int64, error) {
+	return s.repo.CountByBiz(ctx, biz, bizIds)
+}
@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"github.com/Tuanzi-bug/tuan-book/internal/domain"
+	"github.com/Tuanzi-bug/tuan-book/internal/repository"
+	repomocks "github.com/Tuanzi-bug/tuan-book/internal/repository/mocks"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"strings"
+	"testing"
+)
+
+func TestCommentService_Create(t *testing.T) {
+	testCases := []struct {
+		name string
+
+		mock func(ctrl *gomock.Controller) (repository.CommentRepository, repository.ArticleRepository)
+
+		comment domain.Comment
+		wantId  int64
+		wantErr error
+	}{
+		{
+			name: "根评论",
+			mock: func(ctrl *gomock.Controller) (repository.CommentRepository, repository.ArticleRepository) {
+				repo := repomocks.NewMockCommentRepository(ctrl)
+				artRepo := repomocks.NewMockArticleRepository(ctrl)
+				artRepo.EXPECT().GetPubById(gomock.Any(), int64(1)).
+					Return(domain.Article{Id: 1, Status: domain.ArticleStatusPublished}, nil)
+				repo.EXPECT().Create(gomock.Any(), domain.Comment{
+					Uid: 123, Biz: "article", BizId: 1, Content: "写得好",
+				}).Return(int64(10), nil)
+				return repo, artRepo
+			},
+			comment: domain.Comment{Uid: 123, Biz: "article", BizId: 1, Content: " 写得好 "},
+			wantId:  10,
+		},
+		{
+			name: "回复根评论",
+			mock: func(ctrl *gomock.Controller) (repository.CommentRepository, repository.ArticleRepository) {
+				repo := repomocks.NewMockCommentRepository(ctrl)
+				repo.EXPECT().FindById(gomock.Any(), int64(10)).
+					Return(domain.Comment{Id: 10, Biz: "article", BizId: 1}, nil)
+				repo.EXPECT().Create(gomock.Any(), domain.Comment{
+					Uid: 123, Biz: "article", BizId: 1, RootId: 10, ParentId: 10, Content: "同意",
+				}).Return(int64(11), nil)
+				return repo, repomocks.NewMockArticleRepository(ctrl)
+			},
+			// 客户端传的资源以被回复的评论为准
+			comment: domain.Comment{Uid: 123, Biz: "user", BizId: 2, ParentId: 10, Content: "同意"},
+			wantId:  11,
+		},
+		{
+			name: "回复别人的回复",
+			mock: func(ctrl *gomock.Controller) (repository.CommentRepository, repository.ArticleRepository) {
+				repo := repomocks.NewMockCommentRepository(ctrl)
+				repo.EXPECT().FindById(gomock.Any(), int64(11)).
+					Return(domain.Comment{Id: 11, Biz: "article", BizId: 1, RootId: 10, ParentId: 10}, nil)
+				repo.EXPECT().Create(gomock.Any(), domain.Comment{
+					Uid: 123, Biz: "article", BizId: 1, RootId: 10, ParentId: 11, Content: "同意",
+				}).Return(int64(12), nil)
+				return repo, repomocks.NewMockArticleRepository(ctrl)
+			},
+			comment: domain.Comment{Uid: 123, ParentId: 11, Content: "同意"},
+			wantId:  12,
+		},
+		{
+			name: "被回复的评论不存在",
+			mock: func(ctrl *gomock.Controller) (repository.CommentRepository, repository.ArticleRepository) {
+				repo := repomocks.NewMockCommentRepository(ctrl)
+				repo.EXPECT().FindById(gomock.Any(), int64(10)).
+					Return(domain.Comment{}, repository.ErrCommentNotFound)
+				return repo, repomocks.NewMockArticleRepository(ctrl)
+			},
+			comment: domain.Comment{Uid: 123, ParentId: 10, Content: "同意"},
+			wantErr: ErrCommentNotFound,
+		},
+		{
+			name: "内容为空",
+			mock: func(ctrl *gomock.Controller) (repository.CommentRepository, repository.ArticleRepository) {
+				return repomocks.NewMockCommentRepository(ctrl), repomocks.NewMockArticleRepository(ctrl)
+			},
+			comment: domain.Comment{Uid: 123, Biz: "article", BizId: 1, Content: "  "},
+			wantErr: ErrInvalidComment,
+		},
+		{
+			name: "内容太长",
+			mock: func(ctrl *gomock.Controller) (repository.CommentRepository, repository.ArticleRepository) {
+				return repomocks.NewMockCommentRepository(ctrl), repomocks.NewMockArticleRepository(ctrl)
+			},
+			comment: domain.Comment{Uid: 123, Biz: "article", BizId: 1,
+				Content: strings.Repeat("长", maxCommentRunes+1)},
+			wantErr: ErrInvalidComment,
+		},
+		{
+			name: "根评论没有资源",
+			mock: func(ctrl *gomock.Controller) (repository.CommentRepository, repository.ArticleRepository) {
+				return repomocks.NewMockCommentRepository(ctrl), repomocks.NewMockArticleRepository(ctrl)
+			},
+			comment: domain.Comment{Uid: 123, Content: "写得好"},
+			wantErr: ErrInvalidComment,
+		},
+		{
+			name: "不支持的资源",
+			mock: func(ctrl *gomock.Controller) (repository.CommentRepository, repository.ArticleRepository) {
+				return repomocks.NewMockCommentRepository(ctrl), repomocks.NewMockArticleRepository(ctrl)
+			},
+			comment: domain.Comment{Uid: 123, Biz: "user", BizId: 2, Content: "写得好"},
+			wantErr: ErrCommentBizNotSupport,
+		},
+		{
+			name: "文章不存在",
+			mock: func(ctrl *gomock.Controller) (repository.CommentRepository, repository.ArticleRepository) {
+				artRepo := repomocks.NewMockArticleRepository(ctrl)
+				artRepo.EXPECT().GetPubById(gomock.Any(), int64(1)).
+					Return(domain.Article{}, repository.ErrArticleNotFound)
+				return repomocks.NewMockCommentRepository(ctrl), artRepo
+			},
+			comment: domain.Comment{Uid: 123, Biz: "article", BizId: 1, Content: "写得好"},
+			wantErr: ErrCommentArticleNotFound,
+		},
+		{
+			name: "文章已经撤回",
+			mock: func(ctrl *gomock.Controller) (repository.CommentRepository, repository.ArticleRepository) {
+				artRepo := repomocks.NewMockArticleRepository(ctrl)
+				artRepo.EXPECT().GetPubById(gomock.Any(), int64(1)).
+					Return(domain.Article{Id: 1, Status: domain.ArticleStatusPrivate}, nil)
+				return repomocks.NewMockCommentRepository(ctrl), artRepo
+			},
+			comment: domain.Comment{Uid: 123, Biz: "article", BizId: 1, Content: "写得好"},
+			wantErr: ErrCommentArticleNotFound,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			repo, artRepo := tc.mock(ctrl)
+			svc := NewCommentService(repo, artRepo)
+			id, err := svc.Create(context.Background(), tc.comment)
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantId, id)
+		})
+	}
+}
+
+func TestCommentService_Delete(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	repo := repomocks.NewMockCommentRepository(ctrl)
+	svc := NewCommentService(repo, repomocks.NewMockArticleRepository(ctrl))
+
+	c := domain.Comment{Id: 10, Uid: 123, Biz: "article", BizId: 1}
+	repo.EXPECT().FindById(gomock.Any(), int64(10)).Return(c, nil).Times(2)
+	err := svc.Delete(context.Background(), 456, 10)
+	assert.Equal(t, ErrCommentNoPermission, err)
+
+	repo.EXPECT().Delete(gomock.Any(), c).Return(nil)
+	err = svc.Delete(context.Background(), 123, 10)
+	assert.NoError(t, err)
+}
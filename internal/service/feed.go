@@ -0,0 +1,166 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"github.com/Tuanzi-bug/tuan-book/internal/domain"
+	"github.com/Tuanzi-bug/tuan-book/internal/repository"
+	"github.com/ecodeclub/ekit/slice"
+	"golang.org/x/sync/errgroup"
+	"slices"
+)
+
+// feedPushBatch 推模式下每次查多少个粉丝、写多少条收件箱
+const feedPushBatch = 500
+
+//go:generate mockgen -source=./feed.go -package=svcmocks -destination=./mocks/feed.mock.go FeedService
+type FeedService interface {
+	// PushArticle 文章发表之后调用。粉丝不多的作者推到每个粉丝的收件箱，粉丝多的作者等读的时候再拉
+	PushArticle(ctx context.Context, aid int64) error
+	// ListFeed 关注的作者发表的文章，按照第一次发表的时间倒序，修改之后重新发表不会排到前面。
+	// cursor 是上一页返回的游标，第一页传零值；返回的游标为零值表示没有下一页
+	ListFeed(ctx context.Context, uid int64, cursor domain.FeedCursor, limit int) ([]domain.Article, domain.FeedCursor, error)
+}
+
+type feedService struct {
+	repo       repository.FeedRepository
+	followRepo repository.FollowRepository
+	artRepo    repository.ArticleRepository
+	// 粉丝数达到这个值的作者不再推送，改成读的时候拉
+	pushThreshold int64
+}
+
+func NewFeedService(repo repository.FeedRepository, followRepo repository.FollowRepository,
+	artRepo repository.ArticleRepository, pushThreshold int64) FeedService {
+	return &feedService{
+		repo:          repo,
+		followRepo:    followRepo,
+		artRepo:       artRepo,
+		pushThreshold: pushThreshold,
+	}
+}
+
+func (s *feedService) PushArticle(ctx context.Context, aid int64) error {
+	// 以线上库为准，已经撤回的不用推
+	arts, err := s.artRepo.GetPubByIds(ctx, []int64{aid})
+	if err != nil || len(arts) == 0 {
+		return err
+	}
+	art := arts[0]
+	stat, err := s.followRepo.GetStatistic(ctx, art.Author.Id)
+	if err != nil {
+		return err
+	}
+	if stat.Followers >= s.pushThreshold {
+		return nil
+	}
+	// 线上库的 Ctime 是第一次发表的时间
+	item := domain.FeedItem{Aid: art.Id, AuthorId: art.Author.Id, Ctime: art.Ctime}
+	var cursor int64
+	for {
+		rels, err := s.followRepo.FindFollowers(ctx, art.Author.Id, cursor, feedPushBatch)
+		if err != nil {
+			return err
+		}
+		if len(rels) == 0 {
+			return nil
+		}
+		uids := slice.Map[domain.FollowRelation, int64](rels, func(idx int, src domain.FollowRelation) int64 {
+			return src.Follower
+		})
+		if err = s.repo.AddInbox(ctx, item, uids); err != nil {
+			return err
+		}
+		if len(rels) < feedPushBatch {
+			return nil
+		}
+		cursor = rels[len(rels)-1].Id
+	}
+}
+
+func (s *feedService) ListFeed(ctx context.Context, uid int64, cursor domain.FeedCursor, limit int) ([]domain.Article, domain.FeedCursor, error) {
+	// 推过来的收件箱和拉模式的作者各取一页，合并之后再截断
+	var (
+		eg     errgroup.Group
+		inbox  []domain.FeedItem
+		pulled []domain.FeedItem
+	)
+	eg.Go(func() error {
+		var er error
+		inbox, er = s.repo.FindInbox(ctx, uid, cursor, limit)
+		return er
+	})
+	eg.Go(func() error {
+		authors, er := s.followRepo.FindFolloweesByFollowers(ctx, uid, s.pushThreshold)
+		if er != nil || len(authors) == 0 {
+			return er
+		}
+		arts, er := s.artRepo.ListPubByAuthors(ctx, authors, cursor, limit)
+		if er != nil {
+			return er
+		}
+		pulled = slice.Map[domain.Article, domain.FeedItem](arts, func(idx int, src domain.Article) domain.FeedItem {
+			return domain.FeedItem{Aid: src.Id, AuthorId: src.Author.Id, Ctime: src.Ctime}
+		})
+		return nil
+	})
+	if err := eg.Wait(); err != nil {
+		return nil, domain.FeedCursor{}, err
+	}
+	items := mergeFeed(limit, inbox, pulled)
+	if len(items) == 0 {
+		return []domain.Article{}, domain.FeedCursor{}, nil
+	}
+	var next domain.FeedCursor
+	// 不满一页说明没有下一页了
+	if len(items) == limit {
+		last := items[len(items)-1]
+		next = domain.FeedCursor{Ctime: last.Ctime, Aid: last.Aid}
+	}
+	ids := slice.Map[domain.FeedItem, int64](items, func(idx int, src domain.FeedItem) int64 {
+		return src.Aid
+	})
+	arts, err := s.artRepo.GetPubByIds(ctx, ids)
+	if err != nil {
+		return nil, domain.FeedCursor{}, err
+	}
+	artMap := make(map[int64]domain.Article, len(arts))
+	for _, art := range arts {
+		artMap[art.Id] = art
+	}
+	// 按照 feed 的顺序返回，已经撤回的文章查不到，直接跳过
+	res := make([]domain.Article, 0, len(items))
+	for _, item := range items {
+		if art, ok := artMap[item.Aid]; ok {
+			res = append(res, art)
+		}
+	}
+	return res, next, nil
+}
+
+// mergeFeed 合并之后按照时间和文章 id 倒序取前 limit 条，和 dao 的排序保持一致。
+// 作者的粉丝数跨过阈值前后，同一篇文章可能既在收件箱里面又被拉到，只保留一条
+func mergeFeed(limit int, lists ...[]domain.FeedItem) []domain.FeedItem {
+	latest := make(map[int64]domain.FeedItem)
+	for _, list := range lists {
+		for _, item := range list {
+			if old, ok := latest[item.Aid]; !ok || item.Ctime.After(old.Ctime) {
+				latest[item.Aid] = item
+			}
+		}
+	}
+	res := make([]domain.FeedItem, 0, len(latest))
+	for _, item := range latest {
+		res = append(res, item)
+	}
+	slices.SortFunc(res, func(a, b domain.FeedItem) int {
+		if c := b.Ctime.Compare(a.Ctime); c != 0 {
+			return c
+		}
+		return cmp.Compare(b.Aid, a.Aid)
+	})
+	if len(res) > limit {
+		res = res[:limit]
+	}
+	return res
+}
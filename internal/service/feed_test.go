@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"github.com/Tuanzi-bug/tuan-book/internal/domain"
+	"github.com/Tuanzi-bug/tuan-book/internal/repository"
+	repomocks "github.com/Tuanzi-bug/tuan-book/internal/repository/mocks"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"testing"
+	"time"
+)
+
+func TestFeedService_PushArticle(t *testing.T) {
+	now := time.UnixMilli(1700000000000)
+	testCases := []struct {
+		name string
+
+		mock func(ctrl *gomock.Controller) (repository.FeedRepository, repository.FollowRepository, repository.ArticleRepository)
+	}{
+		{
+			name: "推送给所有粉丝",
+			mock: func(ctrl *gomock.Controller) (repository.FeedRepository, repository.FollowRepository, repository.ArticleRepository) {
+				repo := repomocks.NewMockFeedRepository(ctrl)
+				followRepo := repomocks.NewMockFollowRepository(ctrl)
+				artRepo := repomocks.NewMockArticleRepository(ctrl)
+				artRepo.EXPECT().GetPubByIds(gomock.Any(), []int64{1}).
+					Return([]domain.Article{{Id: 1, Author: domain.Author{Id: 123}, Ctime: now, Utime: now.Add(time.Hour)}}, nil)
+				followRepo.EXPECT().GetStatistic(gomock.Any(), int64(123)).
+					Return(domain.FollowStatistic{Uid: 123, Followers: 2}, nil)
+				followRepo.EXPECT().FindFollowers(gomock.Any(), int64(123), int64(0), feedPushBatch).
+					Return([]domain.FollowRelation{{Id: 20, Follower: 2}, {Id: 10, Follower: 3}}, nil)
+				repo.EXPECT().AddInbox(gomock.Any(), domain.FeedItem{Aid: 1, AuthorId: 123, Ctime: now}, []int64{2, 3}).
+					Return(nil)
+				return repo, followRepo, artRepo
+			},
+		},
+		{
+			name: "粉丝太多不推送",
+			mock: func(ctrl *gomock.Controller) (repository.FeedRepository, repository.FollowRepository, repository.ArticleRepository) {
+				repo := repomocks.NewMockFeedRepository(ctrl)
+				followRepo := repomocks.NewMockFollowRepository(ctrl)
+				artRepo := repomocks.NewMockArticleRepository(ctrl)
+				artRepo.EXPECT().GetPubByIds(gomock.Any(), []int64{1}).
+					Return([]domain.Article{{Id: 1, Author: domain.Author{Id: 123}, Ctime: now, Utime: now.Add(time.Hour)}}, nil)
+				followRepo.EXPECT().GetStatistic(gomock.Any(), int64(123)).
+					Return(domain.FollowStatistic{Uid: 123, Followers: 10}, nil)
+				return repo, followRepo, artRepo
+			},
+		},
+		{
+			name: "已经撤回",
+			mock: func(ctrl *gomock.Controller) (repository.FeedRepository, repository.FollowRepository, repository.ArticleRepository) {
+				repo := repomocks.NewMockFeedRepository(ctrl)
+				followRepo := repomocks.NewMockFollowRepository(ctrl)
+				artRepo := repomocks.NewMockArticleRepository(ctrl)
+				artRepo.EXPECT().GetPubByIds(gomock.Any(), []int64{1}).Return([]domain.Article{}, nil)
+				return repo, followRepo, artRepo
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			repo, followRepo, artRepo := tc.mock(ctrl)
+			svc := NewFeedService(repo, followRepo, artRepo, 10)
+			err := svc.PushArticle(context.Background(), 1)
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestFeedService_ListFeed(t *testing.T) {
+	t1, t2, t3 := time.UnixMilli(1000), time.UnixMilli(2000), time.UnixMilli(3000)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	repo := repomocks.NewMockFeedRepository(ctrl)
+	followRepo := repomocks.NewMockFollowRepository(ctrl)
+	artRepo := repomocks.NewMockArticleRepository(ctrl)
+	svc := NewFeedService(repo, followRepo, artRepo, 10)
+
+	cursor := domain.FeedCursor{Ctime: time.UnixMilli(5000), Aid: 9}
+	repo.EXPECT().FindInbox(gomock.Any(), int64(123), cursor, 3).
+		Return([]domain.FeedItem{{Aid: 1, AuthorId: 11, Ctime: t3}, {Aid: 2, AuthorId: 22, Ctime: t1}}, nil)
+	followRepo.EXPECT().FindFolloweesByFollowers(gomock.Any(), int64(123), int64(10)).Return([]int64{33}, nil)
+	// 文章 2 的作者后来粉丝变多了，两边都有；文章 4 和文章 2 同一毫秒发表
+	artRepo.EXPECT().ListPubByAuthors(gomock.Any(), []int64{33}, cursor, 3).
+		Return([]domain.Article{{Id: 3, Author: domain.Author{Id: 33}, Ctime: t2},
+			{Id: 4, Author: domain.Author{Id: 33}, Ctime: t1},
+			{Id: 2, Author: domain.Author{Id: 22}, Ctime: t1}}, nil)
+	// 文章 3 已经撤回了
+	artRepo.EXPECT().GetPubByIds(gomock.Any(), []int64{1, 3, 4}).
+		Return([]domain.Article{{Id: 4}, {Id: 1}}, nil)
+
+	arts, next, err := svc.ListFeed(context.Background(), 123, cursor, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, []domain.Article{{Id: 1}, {Id: 4}}, arts)
+	// 下一页从同一毫秒里面 id 更小的文章 2 开始
+	assert.Equal(t, domain.FeedCursor{Ctime: t1, Aid: 4}, next)
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/Tuanzi-bug/tuan-book/internal/domain"
+	"github.com/Tuanzi-bug/tuan-book/internal/repository"
+)
+
+var (
+	ErrFollowSelf   = errors.New("不能关注自己")
+	ErrUserNotFound = repository.ErrUserNotFound
+)
+
+//go:generate mockgen -source=./follow.go -package=svcmocks -destination=./mocks/follow.mock.go FollowService
+type FollowService interface {
+	// Follow 重复关注不会报错
+	Follow(ctx context.Context, follower, followee int64) error
+	// Unfollow 没有关注的时候取消关注不会报错
+	Unfollow(ctx context.Context, follower, followee int64) error
+	Followed(ctx context.Context, follower, followee int64) (bool, error)
+	// ListFollowers 粉丝列表，cursor 是上一页最后一条关系的 id，第一页传 0
+	ListFollowers(ctx context.Context, followee int64, cursor int64, limit int) ([]domain.FollowRelation, error)
+	// ListFollowees 关注列表，cursor 是上一页最后一条关系的 id，第一页传 0
+	ListFollowees(ctx context.Context, follower int64, cursor int64, limit int) ([]domain.FollowRelation, error)
+	GetStatistic(ctx context.Context, uid int64) (domain.FollowStatistic, error)
+}
+
+type followService struct {
+	repo     repository.FollowRepository
+	userRepo repository.UserRepository
+}
+
+func NewFollowService(repo repository.FollowRepository, userRepo repository.UserRepository) FollowService {
+	return &followService{repo: repo, userRepo: userRepo}
+}
+
+func (s *followService) Follow(ctx context.Context, follower, followee int64) error {
+	if follower == followee {
+		return ErrFollowSelf
+	}
+	// 被关注的人必须存在
+	if _, err := s.userRepo.FindById(ctx, followee); err != nil {
+		return err
+	}
+	return s.repo.Follow(ctx, follower, followee)
+}
+
+func (s *followService) Unfollow(ctx context.Context, follower, followee int64) error {
+	return s.repo.Unfollow(ctx, follower, followee)
+}
+
+func (s *followService) Followed(ctx context.Context, follower, followee int64) (bool, error) {
+	if follower == followee {
+		return false, nil
+	}
+	return s.repo.Followed(ctx, follower, followee)
+}
+
+func (s *followService) ListFollowers(ctx context.Context, followee int64, cursor int64, limit int) ([]domain.FollowRelation, error) {
+	return s.repo.FindFollowers(ctx, followee, cursor, limit)
+}
+
+func (s *followService) ListFollowees(ctx context.Context, follower int64, cursor int64, limit int) ([]domain.FollowRelation, error) {
+	return s.repo.FindFollowees(ctx, follower, cursor, limit)
+}
+
+func (s *followService) GetStatistic(ctx context.Context, uid int64) (domain.FollowStatistic, error) {
+	return s.repo.GetStatistic(ctx, uid)
+}
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"context"
+	"github.com/Tuanzi-bug/tuan-book/internal/domain"
+	"github.com/Tuanzi-bug/tuan-book/internal/repository"
+	"time"
+)
+
+//go:generate mockgen -source=./history.go -package=svcmocks -destination=./mocks/history.mock.go ReadHistoryService
+type ReadHistoryService interface {
+	// Record 记录阅读，未登录的阅读会被忽略
+	Record(ctx context.Context, records []domain.ReadRecord) error
+	// List 按照阅读时间倒序，cursor 是上一页最后一条的阅读时间，第一页传 0
+	List(ctx context.Context, uid int64, cursor int64, limit int) ([]domain.ReadRecord, error)
+	Clear(ctx context.Context, uid int64) error
+}
+
+type readHistoryService struct {
+	repo repository.ReadHistoryRepository
+}
+
+func NewReadHistoryService(repo repository.ReadHistoryRepository) ReadHistoryService {
+	return &readHistoryService{repo: repo}
+}
+
+func (s *readHistoryService) Record(ctx context.Context, records []domain.ReadRecord) error {
+	res := make([]domain.ReadRecord, 0, len(records))
+	for _, r := range records {
+		if r.Uid > 0 {
+			res = append(res, r)
+		}
+	}
+	return s.repo.Add(ctx, res)
+}
+
+func (s *readHistoryService) List(ctx context.Context, uid int64, cursor int64, limit int) ([]domain.ReadRecord, error) {
+	var before time.Time
+	if cursor > 0 {
+		before = time.UnixMilli(cursor)
+	}
+	return s.repo.List(ctx, uid, before, limit)
+}
+
+func (s *readHistoryService) Clear(ctx context.Context, uid int64) error {
+	return s.repo.Clear(ctx, uid)
+}
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"context"
+	"github.com/Tuanzi-bug/tuan-book/internal/domain"
+	repomocks "github.com/Tuanzi-bug/tuan-book/internal/repository/mocks"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"testing"
+	"time"
+)
+
+func TestReadHistoryService_Record(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	repo := repomocks.NewMockReadHistoryRepository(ctrl)
+	svc := NewReadHistoryService(repo)
+
+	now := time.UnixMilli(1700000000000)
+	// 未登录的阅读不记录
+	repo.EXPECT().Add(gomock.Any(), []domain.ReadRecord{
+		{Uid: 123, Aid: 1, Ctime: now},
+	}).Return(nil)
+	err := svc.Record(context.Background(), []domain.ReadRecord{
+		{Uid: 0, Aid: 1, Ctime: now},
+		{Uid: 123, Aid: 1, Ctime: now},
+	})
+	assert.NoError(t, err)
+}
+
+func TestReadHistoryService_List(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	repo := repomocks.NewMockReadHistoryRepository(ctrl)
+	svc := NewReadHistoryService(repo)
+
+	// 第一页
+	repo.EXPECT().List(gomock.Any(), int64(123), time.Time{}, 10).Return(nil, nil)
+	_, err := svc.List(context.Background(), 123, 0, 10)
+	assert.NoError(t, err)
+
+	repo.EXPECT().List(gomock.Any(), int64(123), time.UnixMilli(1700000000000), 10).
+		Return([]domain.ReadRecord{{Uid: 123, Aid: 1}}, nil)
+	records, err := svc.List(context.Background(), 123, 1700000000000, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []domain.ReadRecord{{Uid: 123, Aid: 1}}, records)
+}
@@ -2,24 +2,39 @@ package service
 
 import (
 	"context"
+	"errors"
 	"github.com/Tuanzi-bug/tuan-book/internal/domain"
 	"github.com/Tuanzi-bug/tuan-book/internal/repository"
 	"github.com/gin-gonic/gin"
 	"golang.org/x/sync/errgroup"
+	"time"
 )
 
 //go:generate mockgen -source=./interactive.go -package=svcmocks -destination=./mocks/interactive.mock.go InteractiveService
 type InteractiveService interface {
 	IncrReadCnt(ctx context.Context, biz string, bizId int64) error
-	Like(ctx context.Context, biz string, bizId int64, uid int64) error
-	CancelLike(ctx context.Context, biz string, bizId int64, uid int64) error
+	// Like 重复点赞也返回成功，返回的 LikeCnt 和 Liked 可以直接用来更新页面
+	Like(ctx context.Context, biz string, bizId int64, uid int64) (domain.Interactive, error)
+	// CancelLike 没有点赞过也返回成功
+	CancelLike(ctx context.Context, biz string, bizId int64, uid int64) (domain.Interactive, error)
+	// Collect cid 必须是 uid 自己的收藏夹，0 表示默认收藏夹。
+	// 同一个内容只能收藏到一个收藏夹里面，已经收藏过的返回 ErrAlreadyCollected
 	Collect(ctx *gin.Context, biz string, bizId int64, cid int64, uid int64) error
+	// CancelCollect 没有收藏过的时候也返回成功
+	CancelCollect(ctx context.Context, biz string, bizId int64, uid int64) error
 	Get(ctx *gin.Context, biz string, id int64, uid int64) (domain.Interactive, error)
 	GetByIds(ctx context.Context, biz string, ids []int64) (map[int64]domain.Interactive, error)
+	// BatchGet 列表页使用，计数和 uid 的点赞、收藏状态一起返回，每个 id 都有结果，uid 为 0 的时候不查状态
+	BatchGet(ctx context.Context, biz string, ids []int64, uid int64) (map[int64]domain.Interactive, error)
+	// ListLikes 用户点赞过的内容，按照点赞时间倒序，cursor 是上一页最后一条的点赞时间，第一页传 0
+	ListLikes(ctx context.Context, biz string, uid int64, cursor int64, limit int) ([]domain.LikeRecord, error)
+	// Reconcile 对账一批交互数据，修复点赞数和收藏数
+	Reconcile(ctx context.Context, afterId int64, limit int) (domain.InteractiveReconcile, error)
 }
 
 type interactiveService struct {
-	repo repository.InteractiveRepository
+	repo           repository.InteractiveRepository
+	collectionRepo repository.CollectionRepository
 }
 
 func (i *interactiveService) GetByIds(ctx context.Context, biz string, ids []int64) (map[int64]domain.Interactive, error) {
@@ -34,6 +49,63 @@ func (i *interactiveService) GetByIds(ctx context.Context, biz string, ids []int
 	return res, nil
 }
 
+func (i *interactiveService) BatchGet(ctx context.Context, biz string, ids []int64, uid int64) (map[int64]domain.Interactive, error) {
+	res := make(map[int64]domain.Interactive, len(ids))
+	if len(ids) == 0 {
+		return res, nil
+	}
+	var (
+		eg        errgroup.Group
+		inters    []domain.Interactive
+		liked     map[int64]bool
+		collected map[int64]bool
+	)
+	eg.Go(func() error {
+		var er error
+		inters, er = i.repo.GetByIds(ctx, biz, ids)
+		return er
+	})
+	if uid > 0 {
+		eg.Go(func() error {
+			var er error
+			liked, er = i.repo.BatchLiked(ctx, biz, ids, uid)
+			return er
+		})
+		eg.Go(func() error {
+			var er error
+			collected, er = i.repo.BatchCollected(ctx, biz, ids, uid)
+			return er
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		res[id] = domain.Interactive{BizId: id}
+	}
+	for _, inter := range inters {
+		res[inter.BizId] = inter
+	}
+	for id, intr := range res {
+		intr.Liked = liked[id]
+		intr.Collected = collected[id]
+		res[id] = intr
+	}
+	return res, nil
+}
+
+func (i *interactiveService) Reconcile(ctx context.Context, afterId int64, limit int) (domain.InteractiveReconcile, error) {
+	return i.repo.Reconcile(ctx, afterId, limit)
+}
+
+func (i *interactiveService) ListLikes(ctx context.Context, biz string, uid int64, cursor int64, limit int) ([]domain.LikeRecord, error) {
+	var before time.Time
+	if cursor > 0 {
+		before = time.UnixMilli(cursor)
+	}
+	return i.repo.FindLikes(ctx, biz, uid, before, limit)
+}
+
 func (i *interactiveService) Get(ctx *gin.Context, biz string, id int64, uid int64) (domain.Interactive, error) {
 	intr, err := i.repo.Get(ctx, biz, id)
 	if err != nil {
@@ -55,23 +127,39 @@ func (i *interactiveService) Get(ctx *gin.Context, biz string, id int64, uid int
 }
 
 func (i *interactiveService) Collect(ctx *gin.Context, biz string, bizId int64, cid int64, uid int64) error {
+	if err := checkCollectionOwner(ctx, i.collectionRepo, uid, cid); err != nil {
+		return err
+	}
+	// 收藏事件和收藏记录在同一个事务里面写入 outbox
 	return i.repo.AddCollectItem(ctx, biz, bizId, cid, uid)
 }
 
-func (i *interactiveService) Like(ctx context.Context, biz string, bizId int64, uid int64) error {
-	return i.repo.IncrLike(ctx, biz, bizId, uid)
+func (i *interactiveService) CancelCollect(ctx context.Context, biz string, bizId int64, uid int64) error {
+	err := i.repo.DeleteCollectItem(ctx, biz, bizId, uid)
+	if errors.Is(err, repository.ErrCollectItemNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (i *interactiveService) Like(ctx context.Context, biz string, bizId int64, uid int64) (domain.Interactive, error) {
+	// 点赞事件只在状态变化的时候和点赞记录在同一个事务里面写入 outbox
+	intr, _, err := i.repo.IncrLike(ctx, biz, bizId, uid)
+	return intr, err
 }
 
-func (i *interactiveService) CancelLike(ctx context.Context, biz string, bizId int64, uid int64) error {
-	return i.repo.DecrLike(ctx, biz, bizId, uid)
+func (i *interactiveService) CancelLike(ctx context.Context, biz string, bizId int64, uid int64) (domain.Interactive, error) {
+	intr, _, err := i.repo.DecrLike(ctx, biz, bizId, uid)
+	return intr, err
 }
 
 func (i *interactiveService) IncrReadCnt(ctx context.Context, biz string, bizId int64) error {
 	return i.repo.IncrReadCnt(ctx, biz, bizId)
 }
 
-func NewInteractiveService(repo repository.InteractiveRepository) InteractiveService {
+func NewInteractiveService(repo repository.InteractiveRepository, collectionRepo repository.CollectionRepository) InteractiveService {
 	return &interactiveService{
-		repo: repo,
+		repo:           repo,
+		collectionRepo: collectionRepo,
 	}
 }
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/Tuanzi-bug/tuan-book/internal/domain"
+	repomocks "github.com/Tuanzi-bug/tuan-book/internal/repository/mocks"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"testing"
+)
+
+func TestInteractiveService_BatchGet(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	repo := repomocks.NewMockInteractiveRepository(ctrl)
+	svc := NewInteractiveService(repo, nil)
+	ids := []int64{1, 2, 3}
+
+	repo.EXPECT().GetByIds(gomock.Any(), "article", ids).Return([]domain.Interactive{
+		{BizId: 1, ReadCnt: 10, LikeCnt: 2},
+		{BizId: 2, CollectCnt: 1},
+	}, nil)
+	repo.EXPECT().BatchLiked(gomock.Any(), "article", ids, int64(123)).Return(map[int64]bool{1: true}, nil)
+	repo.EXPECT().BatchCollected(gomock.Any(), "article", ids, int64(123)).Return(map[int64]bool{2: true}, nil)
+	res, err := svc.BatchGet(context.Background(), "article", ids, 123)
+	assert.NoError(t, err)
+	// 没有交互数据的也要返回
+	assert.Equal(t, map[int64]domain.Interactive{
+		1: {BizId: 1, ReadCnt: 10, LikeCnt: 2, Liked: true},
+		2: {BizId: 2, CollectCnt: 1, Collected: true},
+		3: {BizId: 3},
+	}, res)
+
+	// 未登录不查状态
+	repo.EXPECT().GetByIds(gomock.Any(), "article", ids).Return(nil, nil)
+	res, err = svc.BatchGet(context.Background(), "article", ids, 0)
+	assert.NoError(t, err)
+	assert.Len(t, res, 3)
+
+	repo.EXPECT().GetByIds(gomock.Any(), "article", ids).Return(nil, nil)
+	repo.EXPECT().BatchLiked(gomock.Any(), "article", ids, int64(123)).Return(nil, errors.New("mock error"))
+	repo.EXPECT().BatchCollected(gomock.Any(), "article", ids, int64(123)).Return(nil, nil)
+	_, err = svc.BatchGet(context.Background(), "article", ids, 123)
+	assert.Equal(t, errors.New("mock error"), err)
+}
+
+func TestInteractiveService_Like(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	repo := repomocks.NewMockInteractiveRepository(ctrl)
+	svc := NewInteractiveService(repo, nil)
+
+	repo.EXPECT().IncrLike(gomock.Any(), "article", int64(1), int64(123)).
+		Return(domain.Interactive{BizId: 1, LikeCnt: 5, Liked: true}, false, nil)
+	intr, err := svc.Like(context.Background(), "article", 1, 123)
+	assert.NoError(t, err)
+	assert.Equal(t, domain.Interactive{BizId: 1, LikeCnt: 5, Liked: true}, intr)
+
+	repo.EXPECT().DecrLike(gomock.Any(), "article", int64(1), int64(123)).
+		Return(domain.Interactive{BizId: 1, LikeCnt: 5}, false, nil)
+	intr, err = svc.CancelLike(context.Background(), "article", 1, 123)
+	assert.NoError(t, err)
+	assert.Equal(t, domain.Interactive{BizId: 1, LikeCnt: 5}, intr)
+}
@@ -2,18 +2,68 @@ package service
 
 import (
 	"context"
+	"errors"
 	"github.com/Tuanzi-bug/tuan-book/internal/domain"
 	"github.com/Tuanzi-bug/tuan-book/internal/repository"
 	"github.com/Tuanzi-bug/tuan-book/pkg/log"
 	"time"
 )
 
+var (
+	ErrJobNotFound  = repository.ErrJobNotFound
+	ErrJobDuplicate = repository.ErrJobDuplicate
+	ErrJobPaused    = errors.New("任务已经暂停")
+	ErrJobFailed    = errors.New("任务连续失败太多次，已经停止调度")
+	ErrJobRunning   = errors.New("任务正在执行")
+	ErrInvalidJob   = errors.New("任务名字和执行器不能为空")
+	// ErrInvalidJobExpression 和 domain.Job.NextTime 使用同一个解析器校验
+	ErrInvalidJobExpression = errors.New("cron 表达式不合法")
+	ErrInvalidRetryPolicy   = errors.New("重试次数和重试间隔不能为负数")
+)
+
+const (
+	// defaultJobMaxAttempts 任务没有配置重试策略的时候，连续失败这么多次就不再调度
+	defaultJobMaxAttempts = 3
+	defaultJobBackoff     = time.Second * 10
+	// maxJobBackoff 重试间隔翻倍的上限
+	maxJobBackoff = time.Hour
+)
+
+//go:generate mockgen -source=./job.go -package=svcmocks -destination=./mocks/job.mock.go CronJobService
 type CronJobService interface {
-	// 从数据库中获取下一个要执行的任务
-	Preempt(ctx context.Context) (domain.Job, error)
-	ResetNextTime(ctx context.Context, j domain.Job) error
+	// 从数据库中获取下一个要执行的任务，node 是当前节点，用来续约和释放
+	Preempt(ctx context.Context, node string) (domain.Job, error)
+	// ResetNextTime 执行成功之后按照表达式计算下一次执行的时间，
+	// node 的租约已经被回收的话什么也不做
+	ResetNextTime(ctx context.Context, j domain.Job, node string) error
+	// Fail 执行失败之后按照重试策略退避，连续失败的次数达到上限就不再调度
+	Fail(ctx context.Context, j domain.Job, node string) error
+	// StartRun 记录开始执行，返回执行记录的 id
+	StartRun(ctx context.Context, j domain.Job, node string) (int64, error)
+	// FinishRun cause 为 nil 表示执行成功
+	FinishRun(ctx context.Context, runId int64, cause error) error
+	// AddJob 注册一个任务，同名任务已经存在的时候不会覆盖
+	AddJob(ctx context.Context, j domain.Job) error
 	//Release(ctx context.Context, job domain.Job) error
-	// 暴露 job 的增删改查方法
+
+	// 下面是给管理后台用的
+
+	// Create 创建任务，下一次执行的时间按照表达式计算
+	Create(ctx context.Context, j domain.Job) (int64, error)
+	List(ctx context.Context, offset int, limit int) ([]domain.Job, error)
+	// UpdateSchedule 修改表达式和配置，正在执行的任务下一次才会按照新的表达式执行
+	UpdateSchedule(ctx context.Context, id int64, expression string, cfg string) error
+	// Pause 正在执行的任务执行完之后不再调度
+	Pause(ctx context.Context, id int64) error
+	// Resume 从现在开始重新计算下一次执行的时间，没有暂停的任务什么也不做
+	Resume(ctx context.Context, id int64) error
+	// Trigger 马上执行一次，之后仍然按照表达式执行，正在执行的任务返回 ErrJobRunning
+	Trigger(ctx context.Context, id int64) error
+	Delete(ctx context.Context, id int64) error
+	// UpdateRetryPolicy 0 表示使用默认值
+	UpdateRetryPolicy(ctx context.Context, id int64, maxAttempts int, backoff time.Duration) error
+	// ListRuns 最近的执行记录在前面
+	ListRuns(ctx context.Context, jid int64, offset int, limit int) ([]domain.JobRun, error)
 }
 
 type cronJobService struct {
@@ -21,26 +71,37 @@ type cronJobService struct {
 	refreshInterval time.Duration
 }
 
-func (c *cronJobService) Preempt(ctx context.Context) (domain.Job, error) {
-	j, err := c.repo.Preempt(ctx)
+func (c *cronJobService) Preempt(ctx context.Context, node string) (domain.Job, error) {
+	j, err := c.repo.Preempt(ctx, node)
 	if err != nil {
 		return domain.Job{}, err
 	}
 	log.Debug("获取抢占任务", log.Int64("id", j.Id))
+	if j.ReclaimedFrom != "" {
+		log.Warn("回收租约过期的任务", log.Int64("id", j.Id),
+			log.String("name", j.Name), log.String("from", j.ReclaimedFrom))
+	}
 	// 续约机制
 	ticker := time.NewTicker(c.refreshInterval)
+	done := make(chan struct{})
 	go func() {
-		for range ticker.C {
-			c.refresh(j.Id)
+		for {
+			select {
+			case <-ticker.C:
+				c.refresh(j.Id, node)
+			case <-done:
+				return
+			}
 		}
 	}()
 	// 取消函数：释放任务+停止续约
 	j.CancelFunc = func() {
 		ticker.Stop()
+		close(done)
 		log.Info("释放任务", log.Int64("id", j.Id))
-		ctx, _ = context.WithTimeout(context.Background(), time.Second*10)
-		//defer cancel()
-		err = c.repo.Release(ctx, j.Id)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+		defer cancel()
+		err := c.repo.Release(ctx, j.Id, node)
 		if err != nil {
 			log.Error("释放任务失败", log.Err(err), log.Int64("id", j.Id))
 		}
@@ -48,23 +109,170 @@ func (c *cronJobService) Preempt(ctx context.Context) (domain.Job, error) {
 	return j, nil
 }
 
-func (c *cronJobService) ResetNextTime(ctx context.Context, j domain.Job) error {
+func (c *cronJobService) ResetNextTime(ctx context.Context, j domain.Job, node string) error {
 	nextTime := j.NextTime()
 	if nextTime.IsZero() {
 		return c.repo.Stop(ctx, j.Id)
 	}
-	return c.repo.UpdateNextTime(ctx, j.Id, nextTime)
+	return c.repo.Succeed(ctx, j.Id, node, nextTime)
+}
+
+func (c *cronJobService) Fail(ctx context.Context, j domain.Job, node string) error {
+	failures := j.Failures + 1
+	maxAttempts := j.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultJobMaxAttempts
+	}
+	if failures >= maxAttempts {
+		log.Warn("任务连续失败太多次，停止调度",
+			log.Int64("id", j.Id), log.Int("failures", failures))
+		return c.repo.Fail(ctx, j.Id, node, failures, time.Time{}, true)
+	}
+	nextTime := time.Now().Add(jobBackoff(j.Backoff, failures))
+	// 重试不会比正常调度更晚
+	if next := j.NextTime(); !next.IsZero() && next.Before(nextTime) {
+		nextTime = next
+	}
+	return c.repo.Fail(ctx, j.Id, node, failures, nextTime, false)
+}
+
+// jobBackoff 第 n 次失败之后等待 backoff * 2^(n-1)，不超过 maxJobBackoff
+func jobBackoff(backoff time.Duration, failures int) time.Duration {
+	if backoff <= 0 {
+		backoff = defaultJobBackoff
+	}
+	for i := 1; i < failures && backoff < maxJobBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, maxJobBackoff)
+}
+
+func (c *cronJobService) StartRun(ctx context.Context, j domain.Job, node string) (int64, error) {
+	return c.repo.AddRun(ctx, domain.JobRun{
+		Jid:       j.Id,
+		Node:      node,
+		Attempt:   j.Failures + 1,
+		StartTime: time.Now(),
+	})
+}
+
+func (c *cronJobService) FinishRun(ctx context.Context, runId int64, cause error) error {
+	r := domain.JobRun{
+		Id:      runId,
+		Status:  domain.JobRunStatusSuccess,
+		EndTime: time.Now(),
+	}
+	if cause != nil {
+		r.Status = domain.JobRunStatusFailed
+		r.Err = cause.Error()
+	}
+	return c.repo.FinishRun(ctx, r)
+}
+
+func (c *cronJobService) AddJob(ctx context.Context, j domain.Job) error {
+	s, err := domain.ParseJobExpression(j.Expression)
+	if err != nil {
+		return ErrInvalidJobExpression
+	}
+	return c.repo.Create(ctx, j, s.Next(time.Now()))
+}
+
+func (c *cronJobService) Create(ctx context.Context, j domain.Job) (int64, error) {
+	if j.Name == "" || j.Executor == "" {
+		return 0, ErrInvalidJob
+	}
+	s, err := domain.ParseJobExpression(j.Expression)
+	if err != nil {
+		return 0, ErrInvalidJobExpression
+	}
+	if j.MaxAttempts < 0 || j.Backoff < 0 {
+		return 0, ErrInvalidRetryPolicy
+	}
+	return c.repo.Add(ctx, j, s.Next(time.Now()))
+}
+
+func (c *cronJobService) List(ctx context.Context, offset int, limit int) ([]domain.Job, error) {
+	return c.repo.List(ctx, offset, limit)
+}
+
+func (c *cronJobService) UpdateSchedule(ctx context.Context, id int64, expression string, cfg string) error {
+	s, err := domain.ParseJobExpression(expression)
+	if err != nil {
+		return ErrInvalidJobExpression
+	}
+	return c.repo.UpdateSchedule(ctx, id, expression, cfg, s.Next(time.Now()))
+}
+
+func (c *cronJobService) Pause(ctx context.Context, id int64) error {
+	_, err := c.repo.FindById(ctx, id)
+	if err != nil {
+		return err
+	}
+	return c.repo.Stop(ctx, id)
+}
+
+func (c *cronJobService) Resume(ctx context.Context, id int64) error {
+	j, err := c.repo.FindById(ctx, id)
+	if err != nil {
+		return err
+	}
+	if j.Status != domain.JobStatusPaused && j.Status != domain.JobStatusFailed {
+		return nil
+	}
+	nextTime := j.NextTime()
+	if nextTime.IsZero() {
+		return ErrInvalidJobExpression
+	}
+	return c.repo.Resume(ctx, id, nextTime)
+}
+
+func (c *cronJobService) Trigger(ctx context.Context, id int64) error {
+	j, err := c.repo.FindById(ctx, id)
+	if err != nil {
+		return err
+	}
+	if j.Status == domain.JobStatusPaused {
+		return ErrJobPaused
+	}
+	if j.Status == domain.JobStatusFailed {
+		return ErrJobFailed
+	}
+	// 执行结束的时候会重新计算 next_time，这时候触发没有效果
+	if j.Status == domain.JobStatusRunning {
+		return ErrJobRunning
+	}
+	err = c.repo.UpdateNextTime(ctx, id, time.Now())
+	if errors.Is(err, repository.ErrJobNotWaiting) {
+		// 查询之后被某个节点抢占了
+		return ErrJobRunning
+	}
+	return err
+}
+
+func (c *cronJobService) Delete(ctx context.Context, id int64) error {
+	return c.repo.Delete(ctx, id)
+}
+
+func (c *cronJobService) UpdateRetryPolicy(ctx context.Context, id int64, maxAttempts int, backoff time.Duration) error {
+	if maxAttempts < 0 || backoff < 0 {
+		return ErrInvalidRetryPolicy
+	}
+	return c.repo.UpdateRetryPolicy(ctx, id, maxAttempts, backoff)
+}
+
+func (c *cronJobService) ListRuns(ctx context.Context, jid int64, offset int, limit int) ([]domain.JobRun, error) {
+	return c.repo.FindRuns(ctx, jid, offset, limit)
 }
 
 func NewCronJobService(repo repository.CronJobRepository) CronJobService {
 	return &cronJobService{repo: repo, refreshInterval: time.Minute}
 }
 
-func (c *cronJobService) refresh(id int64) {
+func (c *cronJobService) refresh(id int64, node string) {
 	// 本质上就是更新一下更新时间
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
-	err := c.repo.UpdateUtime(ctx, id)
+	err := c.repo.UpdateUtime(ctx, id, node)
 	if err != nil {
 		log.Error("更新更新时间失败", log.Err(err), log.Int64("id", id))
 	}
@@ -0,0 +1,320 @@
+package service
+
+import (
+	"context"
+	"github.com/Tuanzi-bug/tuan-book/internal/domain"
+	"github.com/Tuanzi-bug/tuan-book/internal/repository"
+	repomocks "github.com/Tuanzi-bug/tuan-book/internal/repository/mocks"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"testing"
+	"time"
+)
+
+// nextTimeBetween 下一次执行的时间在 [now+lo, now+hi] 之间
+func nextTimeBetween(lo, hi time.Duration) gomock.Matcher {
+	return gomock.Cond(func(x any) bool {
+		t, ok := x.(time.Time)
+		if !ok {
+			return false
+		}
+		d := time.Until(t)
+		return d >= lo-time.Second && d <= hi
+	})
+}
+
+func TestCronJobService_Create(t *testing.T) {
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) repository.CronJobRepository
+		job  domain.Job
+
+		wantId  int64
+		wantErr error
+	}{
+		{
+			name: "按照表达式计算下一次执行的时间",
+			mock: func(ctrl *gomock.Controller) repository.CronJobRepository {
+				repo := repomocks.NewMockCronJobRepository(ctrl)
+				repo.EXPECT().Add(gomock.Any(), gomock.Any(), nextTimeBetween(time.Minute, time.Minute)).
+					Return(int64(1), nil)
+				return repo
+			},
+			job:    domain.Job{Name: "test", Executor: "local", Expression: "@every 1m"},
+			wantId: 1,
+		},
+		{
+			name: "支持秒",
+			mock: func(ctrl *gomock.Controller) repository.CronJobRepository {
+				repo := repomocks.NewMockCronJobRepository(ctrl)
+				repo.EXPECT().Add(gomock.Any(), gomock.Any(), nextTimeBetween(0, time.Second*10)).
+					Return(int64(2), nil)
+				return repo
+			},
+			job:    domain.Job{Name: "test", Executor: "local", Expression: "*/10 * * * * *"},
+			wantId: 2,
+		},
+		{
+			name: "表达式不合法",
+			mock: func(ctrl *gomock.Controller) repository.CronJobRepository {
+				return repomocks.NewMockCronJobRepository(ctrl)
+			},
+			job:     domain.Job{Name: "test", Executor: "local", Expression: "* * *"},
+			wantErr: ErrInvalidJobExpression,
+		},
+		{
+			name: "没有执行器",
+			mock: func(ctrl *gomock.Controller) repository.CronJobRepository {
+				return repomocks.NewMockCronJobRepository(ctrl)
+			},
+			job:     domain.Job{Name: "test", Expression: "@every 1m"},
+			wantErr: ErrInvalidJob,
+		},
+		{
+			name: "重名",
+			mock: func(ctrl *gomock.Controller) repository.CronJobRepository {
+				repo := repomocks.NewMockCronJobRepository(ctrl)
+				repo.EXPECT().Add(gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(int64(0), repository.ErrJobDuplicate)
+				return repo
+			},
+			job:     domain.Job{Name: "test", Executor: "local", Expression: "@every 1m"},
+			wantErr: ErrJobDuplicate,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			svc := NewCronJobService(tc.mock(ctrl))
+			id, err := svc.Create(context.Background(), tc.job)
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantId, id)
+		})
+	}
+}
+
+func TestCronJobService_UpdateSchedule(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	repo := repomocks.NewMockCronJobRepository(ctrl)
+	repo.EXPECT().UpdateSchedule(gomock.Any(), int64(1), "@every 1h", "cfg",
+		nextTimeBetween(time.Hour, time.Hour)).Return(nil)
+	svc := NewCronJobService(repo)
+	assert.NoError(t, svc.UpdateSchedule(context.Background(), 1, "@every 1h", "cfg"))
+	assert.Equal(t, ErrInvalidJobExpression, svc.UpdateSchedule(context.Background(), 1, "bad", "cfg"))
+}
+
+func TestCronJobService_Resume(t *testing.T) {
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) repository.CronJobRepository
+
+		wantErr error
+	}{
+		{
+			name: "从现在开始重新计算下一次执行的时间",
+			mock: func(ctrl *gomock.Controller) repository.CronJobRepository {
+				repo := repomocks.NewMockCronJobRepository(ctrl)
+				repo.EXPECT().FindById(gomock.Any(), int64(1)).Return(domain.Job{
+					Id: 1, Expression: "@every 1m", Status: domain.JobStatusPaused,
+				}, nil)
+				repo.EXPECT().Resume(gomock.Any(), int64(1), nextTimeBetween(time.Minute, time.Minute)).Return(nil)
+				return repo
+			},
+		},
+		{
+			name: "恢复失败的任务",
+			mock: func(ctrl *gomock.Controller) repository.CronJobRepository {
+				repo := repomocks.NewMockCronJobRepository(ctrl)
+				repo.EXPECT().FindById(gomock.Any(), int64(1)).Return(domain.Job{
+					Id: 1, Expression: "@every 1m", Status: domain.JobStatusFailed, Failures: 3,
+				}, nil)
+				repo.EXPECT().Resume(gomock.Any(), int64(1), nextTimeBetween(time.Minute, time.Minute)).Return(nil)
+				return repo
+			},
+		},
+		{
+			name: "没有暂停",
+			mock: func(ctrl *gomock.Controller) repository.CronJobRepository {
+				repo := repomocks.NewMockCronJobRepository(ctrl)
+				repo.EXPECT().FindById(gomock.Any(), int64(1)).Return(domain.Job{
+					Id: 1, Expression: "@every 1m", Status: domain.JobStatusRunning,
+				}, nil)
+				return repo
+			},
+		},
+		{
+			name: "任务不存在",
+			mock: func(ctrl *gomock.Controller) repository.CronJobRepository {
+				repo := repomocks.NewMockCronJobRepository(ctrl)
+				repo.EXPECT().FindById(gomock.Any(), int64(1)).Return(domain.Job{}, repository.ErrJobNotFound)
+				return repo
+			},
+			wantErr: ErrJobNotFound,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			svc := NewCronJobService(tc.mock(ctrl))
+			assert.Equal(t, tc.wantErr, svc.Resume(context.Background(), 1))
+		})
+	}
+}
+
+func TestCronJobService_Trigger(t *testing.T) {
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) repository.CronJobRepository
+
+		wantErr error
+	}{
+		{
+			name: "马上执行",
+			mock: func(ctrl *gomock.Controller) repository.CronJobRepository {
+				repo := repomocks.NewMockCronJobRepository(ctrl)
+				repo.EXPECT().FindById(gomock.Any(), int64(1)).Return(domain.Job{
+					Id: 1, Expression: "@every 1h", Status: domain.JobStatusWaiting,
+				}, nil)
+				repo.EXPECT().UpdateNextTime(gomock.Any(), int64(1), nextTimeBetween(0, 0)).Return(nil)
+				return repo
+			},
+		},
+		{
+			name: "暂停的任务不能触发",
+			mock: func(ctrl *gomock.Controller) repository.CronJobRepository {
+				repo := repomocks.NewMockCronJobRepository(ctrl)
+				repo.EXPECT().FindById(gomock.Any(), int64(1)).Return(domain.Job{
+					Id: 1, Expression: "@every 1h", Status: domain.JobStatusPaused,
+				}, nil)
+				return repo
+			},
+			wantErr: ErrJobPaused,
+		},
+		{
+			name: "失败的任务不能触发",
+			mock: func(ctrl *gomock.Controller) repository.CronJobRepository {
+				repo := repomocks.NewMockCronJobRepository(ctrl)
+				repo.EXPECT().FindById(gomock.Any(), int64(1)).Return(domain.Job{
+					Id: 1, Expression: "@every 1h", Status: domain.JobStatusFailed,
+				}, nil)
+				return repo
+			},
+			wantErr: ErrJobFailed,
+		},
+		{
+			name: "正在执行的任务不能触发",
+			mock: func(ctrl *gomock.Controller) repository.CronJobRepository {
+				repo := repomocks.NewMockCronJobRepository(ctrl)
+				repo.EXPECT().FindById(gomock.Any(), int64(1)).Return(domain.Job{
+					Id: 1, Expression: "@every 1h", Status: domain.JobStatusRunning,
+				}, nil)
+				return repo
+			},
+			wantErr: ErrJobRunning,
+		},
+		{
+			name: "查询之后被抢占",
+			mock: func(ctrl *gomock.Controller) repository.CronJobRepository {
+				repo := repomocks.NewMockCronJobRepository(ctrl)
+				repo.EXPECT().FindById(gomock.Any(), int64(1)).Return(domain.Job{
+					Id: 1, Expression: "@every 1h", Status: domain.JobStatusWaiting,
+				}, nil)
+				repo.EXPECT().UpdateNextTime(gomock.Any(), int64(1), gomock.Any()).
+					Return(repository.ErrJobNotWaiting)
+				return repo
+			},
+			wantErr: ErrJobRunning,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			svc := NewCronJobService(tc.mock(ctrl))
+			assert.Equal(t, tc.wantErr, svc.Trigger(context.Background(), 1))
+		})
+	}
+}
+
+func TestCronJobService_Fail(t *testing.T) {
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) repository.CronJobRepository
+		job  domain.Job
+
+		wantErr error
+	}{
+		{
+			name: "第一次失败，按照默认的间隔重试",
+			mock: func(ctrl *gomock.Controller) repository.CronJobRepository {
+				repo := repomocks.NewMockCronJobRepository(ctrl)
+				repo.EXPECT().Fail(gomock.Any(), int64(1), "node-1", 1,
+					nextTimeBetween(defaultJobBackoff, defaultJobBackoff), false).Return(nil)
+				return repo
+			},
+			job: domain.Job{Id: 1, Expression: "@every 1h"},
+		},
+		{
+			name: "间隔翻倍",
+			mock: func(ctrl *gomock.Controller) repository.CronJobRepository {
+				repo := repomocks.NewMockCronJobRepository(ctrl)
+				repo.EXPECT().Fail(gomock.Any(), int64(1), "node-1", 3,
+					nextTimeBetween(time.Minute*4, time.Minute*4), false).Return(nil)
+				return repo
+			},
+			job: domain.Job{Id: 1, Expression: "@every 1h", MaxAttempts: 5, Backoff: time.Minute, Failures: 2},
+		},
+		{
+			name: "不会比正常调度更晚",
+			mock: func(ctrl *gomock.Controller) repository.CronJobRepository {
+				repo := repomocks.NewMockCronJobRepository(ctrl)
+				repo.EXPECT().Fail(gomock.Any(), int64(1), "node-1", 1,
+					nextTimeBetween(time.Second*5, time.Second*5), false).Return(nil)
+				return repo
+			},
+			job: domain.Job{Id: 1, Expression: "@every 5s", Backoff: time.Minute},
+		},
+		{
+			name: "达到最大次数，不再调度",
+			mock: func(ctrl *gomock.Controller) repository.CronJobRepository {
+				repo := repomocks.NewMockCronJobRepository(ctrl)
+				repo.EXPECT().Fail(gomock.Any(), int64(1), "node-1", defaultJobMaxAttempts, gomock.Any(), true).Return(nil)
+				return repo
+			},
+			job: domain.Job{Id: 1, Expression: "@every 1h", Failures: defaultJobMaxAttempts - 1},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			svc := NewCronJobService(tc.mock(ctrl))
+			assert.Equal(t, tc.wantErr, svc.Fail(context.Background(), tc.job, "node-1"))
+		})
+	}
+}
+
+func TestJobBackoff(t *testing.T) {
+	assert.Equal(t, defaultJobBackoff, jobBackoff(0, 1))
+	assert.Equal(t, time.Second*8, jobBackoff(time.Second, 4))
+	assert.Equal(t, maxJobBackoff, jobBackoff(time.Minute, 100))
+}
+
+// TestCronJobService_Preempt 释放的时候带上抢占的节点，租约被回收之后不会释放别人的任务
+func TestCronJobService_Preempt(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	repo := repomocks.NewMockCronJobRepository(ctrl)
+	repo.EXPECT().Preempt(gomock.Any(), "node-1").Return(domain.Job{
+		Id: 1, Owner: "node-1", ReclaimedFrom: "node-0",
+	}, nil)
+	repo.EXPECT().Release(gomock.Any(), int64(1), "node-1").Return(nil)
+	svc := NewCronJobService(repo)
+	j, err := svc.Preempt(context.Background(), "node-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "node-0", j.ReclaimedFrom)
+	j.CancelFunc()
+}
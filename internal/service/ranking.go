@@ -2,65 +2,97 @@ package service
 
 import (
 	"context"
+	"errors"
 	"github.com/Tuanzi-bug/tuan-book/internal/domain"
 	"github.com/Tuanzi-bug/tuan-book/internal/repository"
+	"github.com/Tuanzi-bug/tuan-book/pkg/log"
+	"github.com/Tuanzi-bug/tuan-book/pkg/trace"
 	"github.com/ecodeclub/ekit/queue"
 	"github.com/ecodeclub/ekit/slice"
-	"math"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
 	"time"
 )
 
+// DefaultRankingBoard 默认展示的榜单
+const DefaultRankingBoard = "weekly"
+
+var ErrRankingBoardNotFound = errors.New("榜单不存在")
+
+// RankingBoard 一个榜单的配置
+type RankingBoard struct {
+	Name string
+	// 只统计这段时间内更新过的文章，0 表示不限制，实时榜单不支持
+	Window time.Duration
+	// 榜单容量
+	N        int
+	Strategy ScoreStrategy
+	// 实时榜单中热度的半衰期，0 表示不衰减
+	HalfLife time.Duration
+}
+
 //go:generate mockgen -source=./ranking.go -package=svcmocks -destination=./mocks/ranking.mock.go RankingService
 type RankingService interface {
-	// TopN 前 100 的
-	TopN(ctx context.Context) error
-	GetTopN(ctx context.Context) ([]domain.Article, error)
+	// TopN 计算指定榜单，并且保存起来
+	TopN(ctx context.Context, board string) error
+	GetTopN(ctx context.Context, board string) ([]domain.Article, error)
 }
 
 type BatchRankingService struct {
 	articleSvc     ArticleService
 	interactiveSvc InteractiveService
 	rankingRepo    repository.RankingRepository
-	scoreFunc      func(likeCnt int64, utime time.Time) float64
-	n              int // 容量
+	boards         map[string]RankingBoard
 	batchSize      int
+	// 缓存都失效时合并并发的计算请求
+	group singleflight.Group
+	// computeTimeout 合并之后的计算不跟着任何一个请求取消，最多算这么久
+	computeTimeout time.Duration
 }
 
-func NewBatchRankingService(intrSvc InteractiveService, artSvc ArticleService, rankingRepository repository.RankingRepository) RankingService {
+func NewBatchRankingService(intrSvc InteractiveService, artSvc ArticleService,
+	rankingRepository repository.RankingRepository, boards []RankingBoard) RankingService {
+	m := make(map[string]RankingBoard, len(boards))
+	for _, b := range boards {
+		m[b.Name] = b
+	}
 	return &BatchRankingService{
 		articleSvc:     artSvc,
 		interactiveSvc: intrSvc,
-		n:              100,
 		batchSize:      100,
 		rankingRepo:    rankingRepository,
-		// 计算热榜分数
-		scoreFunc: func(likeCnt int64, utime time.Time) float64 {
-			duration := time.Since(utime).Seconds()
-			return float64(likeCnt-1) / math.Pow(duration+2, 1.5)
-		},
+		boards:         m,
+		computeTimeout: time.Second * 30,
 	}
 }
 
-func (b *BatchRankingService) TopN(ctx context.Context) error {
-	arts, err := b.topN(ctx)
+func (b *BatchRankingService) TopN(ctx context.Context, board string) error {
+	bd, ok := b.boards[board]
+	if !ok {
+		return ErrRankingBoardNotFound
+	}
+	arts, err := b.topN(ctx, bd)
 	if err != nil {
 		return err
 	}
 	// 保存到缓存
-	return b.rankingRepo.ReplaceTopN(ctx, arts)
+	return b.rankingRepo.ReplaceTopN(ctx, board, arts)
 }
 
-func (b *BatchRankingService) topN(ctx context.Context) ([]domain.Article, error) {
+func (b *BatchRankingService) topN(ctx context.Context, board RankingBoard) ([]domain.Article, error) {
 	offset := 0
 	start := time.Now()
-	ddl := start.Add(-time.Hour * 24 * 7) // 一周内的文章
+	var ddl time.Time
+	if board.Window > 0 {
+		ddl = start.Add(-board.Window)
+	}
 	// 定义一个结构体，用于存储分数和文章
 	type Score struct {
 		score float64
 		art   domain.Article
 	}
 	// 构建一个小顶堆
-	topN := queue.NewPriorityQueue[Score](b.n, func(src Score, dst Score) int {
+	topN := queue.NewPriorityQueue[Score](board.N, func(src Score, dst Score) int {
 		if src.score > dst.score {
 			return 1
 		} else if src.score < dst.score {
@@ -74,7 +106,7 @@ func (b *BatchRankingService) topN(ctx context.Context) ([]domain.Article, error
 		if err != nil {
 			return nil, err
 		}
-		// 取出相关信息 (包括：点赞数，时间)
+		// 取出相关信息 (包括：阅读数，点赞数，收藏数)
 		ids := slice.Map(articles, func(idx int, src domain.Article) int64 {
 			return src.Id
 		})
@@ -84,15 +116,17 @@ func (b *BatchRankingService) topN(ctx context.Context) ([]domain.Article, error
 		}
 		// 计算分数
 		for _, art := range articles {
-			// 点赞信息
-			interactive := intrMap[art.Id]
-			score := b.scoreFunc(interactive.LikeCnt, art.Utime)
+			// 超出时间窗口的文章不参与排名
+			if art.Utime.Before(ddl) {
+				continue
+			}
+			score := board.Strategy.Score(art, intrMap[art.Id])
 			ele := Score{
 				score: score,
 				art:   art,
 			}
 			// 如果堆未满，直接插入
-			if topN.Len() < b.n {
+			if topN.Len() < board.N {
 				_ = topN.Enqueue(ele)
 			} else {
 				// 如果堆满了，比较堆顶元素
@@ -122,6 +156,39 @@ func (b *BatchRankingService) topN(ctx context.Context) ([]domain.Article, error
 	return res, nil
 }
 
-func (b *BatchRankingService) GetTopN(ctx context.Context) ([]domain.Article, error) {
-	return b.rankingRepo.GetTopN(ctx)
+func (b *BatchRankingService) GetTopN(ctx context.Context, board string) ([]domain.Article, error) {
+	bd, ok := b.boards[board]
+	if !ok {
+		return nil, ErrRankingBoardNotFound
+	}
+	arts, err := b.rankingRepo.GetTopN(ctx, board)
+	if err == nil {
+		return arts, nil
+	}
+	// 本地缓存和 redis 都没有数据（比如刚上线，定时任务还没跑），现场计算一次
+	log.Warn("热榜缓存未命中，开始现场计算", zap.String("board", board), zap.Error(err))
+	ch := b.group.DoChan(board, func() (interface{}, error) {
+		// 第一个请求取消了，其他等待的请求也不能跟着失败
+		computeCtx, cancel := context.WithTimeout(trace.Detach(ctx), b.computeTimeout)
+		defer cancel()
+		res, er := b.topN(computeCtx, bd)
+		if er != nil {
+			return nil, er
+		}
+		er = b.rankingRepo.ReplaceTopN(computeCtx, board, res)
+		if er != nil {
+			// 计算出来了就可以返回，缓存失败只记录日志
+			log.Error("热榜写入缓存失败", zap.String("board", board), zap.Error(er))
+		}
+		return res, nil
+	})
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.([]domain.Article), nil
+	}
 }
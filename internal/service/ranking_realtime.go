@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"github.com/Tuanzi-bug/tuan-book/internal/domain"
+	"github.com/Tuanzi-bug/tuan-book/internal/repository"
+)
+
+// RealTimeRankingService 基于 redis zset 的实时热榜
+// 阅读、点赞、收藏事件由消费者实时给文章加分，TopN 只负责按照半衰期衰减和裁剪，
+// GetTopN 直接读取 zset，不需要扫描全表。
+// 榜单的 Window 在这里不生效，旧文章的热度只靠 HalfLife 衰减
+type RealTimeRankingService struct {
+	articleSvc ArticleService
+	repo       repository.RealTimeRankingRepository
+	boards     map[string]RankingBoard
+}
+
+func NewRealTimeRankingService(artSvc ArticleService, repo repository.RealTimeRankingRepository,
+	boards []RankingBoard) RankingService {
+	m := make(map[string]RankingBoard, len(boards))
+	for _, b := range boards {
+		m[b.Name] = b
+	}
+	return &RealTimeRankingService{
+		articleSvc: artSvc,
+		repo:       repo,
+		boards:     m,
+	}
+}
+
+func (r *RealTimeRankingService) TopN(ctx context.Context, board string) error {
+	bd, ok := r.boards[board]
+	if !ok {
+		return ErrRankingBoardNotFound
+	}
+	// 多保留一些候选，避免衰减之后榜单不满
+	return r.repo.Decay(ctx, board, bd.HalfLife, bd.N*10)
+}
+
+func (r *RealTimeRankingService) GetTopN(ctx context.Context, board string) ([]domain.Article, error) {
+	bd, ok := r.boards[board]
+	if !ok {
+		return nil, ErrRankingBoardNotFound
+	}
+	ids, err := r.repo.TopIds(ctx, board, bd.N)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return []domain.Article{}, nil
+	}
+	arts, err := r.articleSvc.GetPubByIds(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	artMap := make(map[int64]domain.Article, len(arts))
+	for _, art := range arts {
+		artMap[art.Id] = art
+	}
+	// 按照热度排序，已经撤回的文章查不到，直接跳过
+	res := make([]domain.Article, 0, len(arts))
+	for _, id := range ids {
+		art, ok := artMap[id]
+		if ok {
+			res = append(res, art)
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/Tuanzi-bug/tuan-book/internal/domain"
+	"github.com/Tuanzi-bug/tuan-book/internal/repository"
+	repomocks "github.com/Tuanzi-bug/tuan-book/internal/repository/mocks"
+	svcmocks "github.com/Tuanzi-bug/tuan-book/internal/service/mocks"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"testing"
+)
+
+func TestRealTimeRankingService_GetTopN(t *testing.T) {
+	testCases := []struct {
+		name string
+
+		mock func(ctrl *gomock.Controller) (ArticleService, repository.RealTimeRankingRepository)
+
+		board    string
+		wantArts []domain.Article
+		wantErr  error
+	}{
+		{
+			name: "按照热度排序，跳过撤回的文章",
+			mock: func(ctrl *gomock.Controller) (ArticleService, repository.RealTimeRankingRepository) {
+				artSvc := svcmocks.NewMockArticleService(ctrl)
+				repo := repomocks.NewMockRealTimeRankingRepository(ctrl)
+				repo.EXPECT().TopIds(gomock.Any(), "daily", 3).Return([]int64{3, 1, 2}, nil)
+				// 数据库返回的顺序和热度无关，2 已经撤回了
+				artSvc.EXPECT().GetPubByIds(gomock.Any(), []int64{3, 1, 2}).
+					Return([]domain.Article{{Id: 1}, {Id: 3}}, nil)
+				return artSvc, repo
+			},
+			board:    "daily",
+			wantArts: []domain.Article{{Id: 3}, {Id: 1}},
+		},
+		{
+			name: "榜单为空",
+			mock: func(ctrl *gomock.Controller) (ArticleService, repository.RealTimeRankingRepository) {
+				repo := repomocks.NewMockRealTimeRankingRepository(ctrl)
+				repo.EXPECT().TopIds(gomock.Any(), "daily", 3).Return([]int64{}, nil)
+				return svcmocks.NewMockArticleService(ctrl), repo
+			},
+			board:    "daily",
+			wantArts: []domain.Article{},
+		},
+		{
+			name: "redis 错误",
+			mock: func(ctrl *gomock.Controller) (ArticleService, repository.RealTimeRankingRepository) {
+				repo := repomocks.NewMockRealTimeRankingRepository(ctrl)
+				repo.EXPECT().TopIds(gomock.Any(), "daily", 3).Return(nil, errors.New("mock error"))
+				return svcmocks.NewMockArticleService(ctrl), repo
+			},
+			board:   "daily",
+			wantErr: errors.New("mock error"),
+		},
+		{
+			name: "榜单不存在",
+			mock: func(ctrl *gomock.Controller) (ArticleService, repository.RealTimeRankingRepository) {
+				return svcmocks.NewMockArticleService(ctrl), repomocks.NewMockRealTimeRankingRepository(ctrl)
+			},
+			board:   "monthly",
+			wantErr: ErrRankingBoardNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			artSvc, repo := tc.mock(ctrl)
+			svc := NewRealTimeRankingService(artSvc, repo, []RankingBoard{{Name: "daily", N: 3}})
+			arts, err := svc.GetTopN(context.Background(), tc.board)
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantArts, arts)
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"github.com/Tuanzi-bug/tuan-book/internal/domain"
+	"math"
+	"sync"
+	"time"
+)
+
+// ScoreStrategy 热榜的打分策略，不同的榜单可以使用不同的策略
+type ScoreStrategy interface {
+	Name() string
+	Score(art domain.Article, intr domain.Interactive) float64
+}
+
+var (
+	strategiesMutex sync.RWMutex
+	strategies      = make(map[string]ScoreStrategy)
+)
+
+// RegisterScoreStrategy 注册打分策略，同名的策略会被覆盖
+func RegisterScoreStrategy(s ScoreStrategy) {
+	strategiesMutex.Lock()
+	defer strategiesMutex.Unlock()
+	strategies[s.Name()] = s
+}
+
+// GetScoreStrategy 根据名字获取已注册的打分策略
+func GetScoreStrategy(name string) (ScoreStrategy, bool) {
+	strategiesMutex.RLock()
+	defer strategiesMutex.RUnlock()
+	s, ok := strategies[name]
+	return s, ok
+}
+
+func init() {
+	RegisterScoreStrategy(HackerNewsScore{})
+	RegisterScoreStrategy(WeightedScore{
+		StrategyName:  "weighted",
+		ReadWeight:    0.1,
+		LikeWeight:    1,
+		CollectWeight: 2,
+		Gravity:       1.5,
+	})
+	// 用独立读者代替阅读数，刷新页面不会把分数刷上去
+	RegisterScoreStrategy(WeightedScore{
+		StrategyName:  "weighted_reader",
+		ReaderWeight:  0.5,
+		LikeWeight:    1,
+		CollectWeight: 2,
+		Gravity:       1.5,
+	})
+	// 不随时间衰减，适合总榜
+	RegisterScoreStrategy(WeightedScore{
+		StrategyName:  "popularity",
+		ReadWeight:    0.1,
+		LikeWeight:    1,
+		CollectWeight: 2,
+	})
+}
+
+// HackerNewsScore 只考虑点赞数的 Hacker News 算法
+type HackerNewsScore struct {
+}
+
+func (h HackerNewsScore) Name() string {
+	return "hacker_news"
+}
+
+func (h HackerNewsScore) Score(art domain.Article, intr domain.Interactive) float64 {
+	duration := time.Since(art.Utime).Seconds()
+	return float64(intr.LikeCnt-1) / math.Pow(duration+2, 1.5)
+}
+
+// WeightedScore 对阅读、独立读者、点赞、收藏加权求和，再按照发表时间衰减
+// Gravity 为 0 的时候不衰减
+type WeightedScore struct {
+	StrategyName  string
+	ReadWeight    float64
+	ReaderWeight  float64
+	LikeWeight    float64
+	CollectWeight float64
+	Gravity       float64
+}
+
+func (w WeightedScore) Name() string {
+	return w.StrategyName
+}
+
+func (w WeightedScore) Score(art domain.Article, intr domain.Interactive) float64 {
+	score := w.ReadWeight*float64(intr.ReadCnt) +
+		w.ReaderWeight*float64(intr.ReaderCnt) +
+		w.LikeWeight*float64(intr.LikeCnt) +
+		w.CollectWeight*float64(intr.CollectCnt)
+	if w.Gravity == 0 {
+		return score
+	}
+	hours := time.Since(art.Utime).Hours()
+	return score / math.Pow(hours+2, w.Gravity)
+}
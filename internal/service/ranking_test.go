@@ -2,7 +2,9 @@ package service
 
 import (
 	"context"
+	"errors"
 	"github.com/Tuanzi-bug/tuan-book/internal/domain"
+	repomocks "github.com/Tuanzi-bug/tuan-book/internal/repository/mocks"
 	svcmocks "github.com/Tuanzi-bug/tuan-book/internal/service/mocks"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/mock/gomock"
@@ -83,14 +85,73 @@ func TestBatchRankingService_TopN(t *testing.T) {
 				interactiveSvc: intrSvc,
 				articleSvc:     artSvc,
 				batchSize:      batchSize,
-				n:              3,
-				scoreFunc: func(likeCnt int64, utime time.Time) float64 {
-					return float64(likeCnt)
-				},
 			}
-			arts, err := svc.topN(context.Background())
+			arts, err := svc.topN(context.Background(), RankingBoard{
+				Name:     "test",
+				Window:   time.Hour,
+				N:        3,
+				Strategy: likeCntScore{},
+			})
 			assert.Equal(t, tc.wantErr, err)
 			assert.Equal(t, tc.wantArts, arts)
 		})
 	}
 }
+
+// likeCntScore 直接使用点赞数作为分数
+type likeCntScore struct {
+}
+
+func (l likeCntScore) Name() string {
+	return "like_cnt"
+}
+
+func (l likeCntScore) Score(art domain.Article, intr domain.Interactive) float64 {
+	return float64(intr.LikeCnt)
+}
+
+func TestBatchRankingService_GetTopN(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	intrSvc := svcmocks.NewMockInteractiveService(ctrl)
+	artSvc := svcmocks.NewMockArticleService(ctrl)
+	rankingRepo := repomocks.NewMockRankingRepository(ctrl)
+	svc := NewBatchRankingService(intrSvc, artSvc, rankingRepo, []RankingBoard{
+		{Name: "test", N: 3, Strategy: likeCntScore{}},
+	})
+
+	// 缓存都没有数据，现场计算。计算的时候第一个请求取消了
+	ctx, cancel := context.WithCancel(context.Background())
+	started, release, cached := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	rankingRepo.EXPECT().GetTopN(gomock.Any(), "test").Return(nil, errors.New("mock miss"))
+	artSvc.EXPECT().ListPub(gomock.Any(), gomock.Any(), 0, 100).
+		DoAndReturn(func(ctx context.Context, start time.Time, offset, limit int) ([]domain.Article, error) {
+			close(started)
+			<-release
+			return []domain.Article{{Id: 1}}, nil
+		})
+	intrSvc.EXPECT().GetByIds(gomock.Any(), "article", []int64{1}).
+		Return(map[int64]domain.Interactive{1: {LikeCnt: 1}}, nil)
+	rankingRepo.EXPECT().ReplaceTopN(gomock.Any(), "test", []domain.Article{{Id: 1}}).
+		DoAndReturn(func(ctx context.Context, board string, arts []domain.Article) error {
+			// 计算不跟着请求取消，算完了照样写缓存
+			assert.NoError(t, ctx.Err())
+			close(cached)
+			return nil
+		})
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := svc.GetTopN(ctx, "test")
+		errCh <- err
+	}()
+	<-started
+	cancel()
+	assert.Equal(t, context.Canceled, <-errCh)
+	close(release)
+	select {
+	case <-cached:
+	case <-time.After(time.Second):
+		t.Fatal("没有写入缓存")
+	}
+}
@@ -0,0 +1,41 @@
+package service
+
+import (
+	"context"
+	"github.com/Tuanzi-bug/tuan-book/internal/domain"
+	"github.com/Tuanzi-bug/tuan-book/internal/repository"
+	"time"
+)
+
+//go:generate mockgen -source=./reader.go -package=svcmocks -destination=./mocks/reader.mock.go UniqueReaderService
+type UniqueReaderService interface {
+	// Record 记录文章的读者，未登录的阅读没有办法去重，直接忽略
+	Record(ctx context.Context, records []domain.ReadRecord) error
+	// Sync 把 day 这一天的独立读者数同步到数据库
+	Sync(ctx context.Context, day time.Time) (int, error)
+}
+
+type uniqueReaderService struct {
+	repo repository.UniqueReaderRepository
+}
+
+func NewUniqueReaderService(repo repository.UniqueReaderRepository) UniqueReaderService {
+	return &uniqueReaderService{repo: repo}
+}
+
+func (s *uniqueReaderService) Record(ctx context.Context, records []domain.ReadRecord) error {
+	res := make([]domain.ReadRecord, 0, len(records))
+	for _, r := range records {
+		if r.Uid > 0 {
+			res = append(res, r)
+		}
+	}
+	if len(res) == 0 {
+		return nil
+	}
+	return s.repo.AddReaders(ctx, "article", res)
+}
+
+func (s *uniqueReaderService) Sync(ctx context.Context, day time.Time) (int, error) {
+	return s.repo.Sync(ctx, "article", day)
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"github.com/Tuanzi-bug/tuan-book/internal/domain"
+	"github.com/Tuanzi-bug/tuan-book/internal/repository"
+	"github.com/ecodeclub/ekit/slice"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:generate mockgen -source=./search.go -package=svcmocks -destination=./mocks/search.mock.go SearchService
+type SearchService interface {
+	// SearchArticle 按照相关度排序，返回这一页和命中总数
+	SearchArticle(ctx context.Context, query string, offset, limit int) ([]domain.ArticleSearchHit, int, error)
+	// SyncArticles 按照线上库的最新状态更新索引，已经撤回的文章会从索引里删除
+	SyncArticles(ctx context.Context, ids []int64) error
+	// Rebuild 从线上库全量构建索引，可以和 SyncArticles 并发执行
+	Rebuild(ctx context.Context) error
+}
+
+type articleSearchService struct {
+	repo      repository.ArticleSearchRepository
+	artSvc    ArticleService
+	batchSize int
+	// 查线上库和写索引放在一起串行执行，
+	// 否则先查到的旧状态可能会覆盖后查到的新状态，例如把刚撤回的文章又写回索引
+	mu sync.Mutex
+}
+
+func NewArticleSearchService(repo repository.ArticleSearchRepository, artSvc ArticleService) SearchService {
+	return &articleSearchService{
+		repo:      repo,
+		artSvc:    artSvc,
+		batchSize: 100,
+	}
+}
+
+func (s *articleSearchService) SearchArticle(ctx context.Context, query string, offset, limit int) ([]domain.ArticleSearchHit, int, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return []domain.ArticleSearchHit{}, 0, nil
+	}
+	return s.repo.SearchArticle(ctx, query, offset, limit)
+}
+
+func (s *articleSearchService) SyncArticles(ctx context.Context, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// 只会查到已发表的文章，查不到的就是撤回了
+	arts, err := s.artSvc.GetPubByIds(ctx, ids)
+	if err != nil {
+		return err
+	}
+	err = s.repo.InputArticles(ctx, arts)
+	if err != nil {
+		return err
+	}
+	found := make(map[int64]struct{}, len(arts))
+	for _, art := range arts {
+		found[art.Id] = struct{}{}
+	}
+	missing := slice.FilterMap[int64, int64](ids, func(idx int, src int64) (int64, bool) {
+		_, ok := found[src]
+		return src, !ok
+	})
+	if len(missing) == 0 {
+		return nil
+	}
+	return s.repo.DeleteArticles(ctx, missing)
+}
+
+func (s *articleSearchService) Rebuild(ctx context.Context) error {
+	now := time.Now()
+	offset := 0
+	for {
+		arts, err := s.artSvc.ListPub(ctx, now, offset, s.batchSize)
+		if err != nil {
+			return err
+		}
+		// 分页查到的可能已经撤回了，写索引之前按照最新状态再查一次
+		ids := slice.Map[domain.Article, int64](arts, func(idx int, src domain.Article) int64 {
+			return src.Id
+		})
+		err = s.SyncArticles(ctx, ids)
+		if err != nil {
+			return err
+		}
+		if len(arts) < s.batchSize {
+			return nil
+		}
+		offset += len(arts)
+	}
+}
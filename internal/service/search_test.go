@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/Tuanzi-bug/tuan-book/internal/domain"
+	"github.com/Tuanzi-bug/tuan-book/internal/repository"
+	repomocks "github.com/Tuanzi-bug/tuan-book/internal/repository/mocks"
+	svcmocks "github.com/Tuanzi-bug/tuan-book/internal/service/mocks"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"testing"
+)
+
+func TestArticleSearchService_SyncArticles(t *testing.T) {
+	testCases := []struct {
+		name string
+
+		mock func(ctrl *gomock.Controller) (repository.ArticleSearchRepository, ArticleService)
+
+		ids     []int64
+		wantErr error
+	}{
+		{
+			name: "撤回的文章从索引中删除",
+			mock: func(ctrl *gomock.Controller) (repository.ArticleSearchRepository, ArticleService) {
+				repo := repomocks.NewMockArticleSearchRepository(ctrl)
+				artSvc := svcmocks.NewMockArticleService(ctrl)
+				arts := []domain.Article{{Id: 1, Title: "标题"}}
+				artSvc.EXPECT().GetPubByIds(gomock.Any(), []int64{1, 2}).Return(arts, nil)
+				repo.EXPECT().InputArticles(gomock.Any(), arts).Return(nil)
+				repo.EXPECT().DeleteArticles(gomock.Any(), []int64{2}).Return(nil)
+				return repo, artSvc
+			},
+			ids: []int64{1, 2},
+		},
+		{
+			name: "全部都是已发表的",
+			mock: func(ctrl *gomock.Controller) (repository.ArticleSearchRepository, ArticleService) {
+				repo := repomocks.NewMockArticleSearchRepository(ctrl)
+				artSvc := svcmocks.NewMockArticleService(ctrl)
+				arts := []domain.Article{{Id: 1}, {Id: 2}}
+				artSvc.EXPECT().GetPubByIds(gomock.Any(), []int64{1, 2}).Return(arts, nil)
+				repo.EXPECT().InputArticles(gomock.Any(), arts).Return(nil)
+				return repo, artSvc
+			},
+			ids: []int64{1, 2},
+		},
+		{
+			name: "查询线上库失败",
+			mock: func(ctrl *gomock.Controller) (repository.ArticleSearchRepository, ArticleService) {
+				artSvc := svcmocks.NewMockArticleService(ctrl)
+				artSvc.EXPECT().GetPubByIds(gomock.Any(), []int64{1}).Return(nil, errors.New("mock error"))
+				return repomocks.NewMockArticleSearchRepository(ctrl), artSvc
+			},
+			ids:     []int64{1},
+			wantErr: errors.New("mock error"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			svc := NewArticleSearchService(tc.mock(ctrl))
+			err := svc.SyncArticles(context.Background(), tc.ids)
+			assert.Equal(t, tc.wantErr, err)
+		})
+	}
+}
+
+func TestArticleSearchService_Rebuild(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	repo := repomocks.NewMockArticleSearchRepository(ctrl)
+	artSvc := svcmocks.NewMockArticleService(ctrl)
+	artSvc.EXPECT().ListPub(gomock.Any(), gomock.Any(), 0, 2).
+		Return([]domain.Article{{Id: 1}, {Id: 2}}, nil)
+	// 分页查到之后 2 被撤回了，写索引之前重新查一次
+	artSvc.EXPECT().GetPubByIds(gomock.Any(), []int64{1, 2}).Return([]domain.Article{{Id: 1}}, nil)
+	repo.EXPECT().InputArticles(gomock.Any(), []domain.Article{{Id: 1}}).Return(nil)
+	repo.EXPECT().DeleteArticles(gomock.Any(), []int64{2}).Return(nil)
+	artSvc.EXPECT().ListPub(gomock.Any(), gomock.Any(), 2, 2).
+		Return([]domain.Article{{Id: 3}}, nil)
+	artSvc.EXPECT().GetPubByIds(gomock.Any(), []int64{3}).Return([]domain.Article{{Id: 3}}, nil)
+	repo.EXPECT().InputArticles(gomock.Any(), []domain.Article{{Id: 3}}).Return(nil)
+
+	svc := &articleSearchService{repo: repo, artSvc: artSvc, batchSize: 2}
+	assert.NoError(t, svc.Rebuild(context.Background()))
+}
+
+func TestArticleSearchService_SearchArticle(t *testing.T) {
+	// 直接使用进程内的索引
+	repo := repository.NewLocalArticleSearchRepository()
+	err := repo.InputArticles(context.Background(), []domain.Article{
+		{Id: 1, Title: "Redis 缓存", Content: "缓存一致性", Author: domain.Author{Id: 123}},
+		{Id: 2, Title: "MySQL 索引", Content: "B+ 树"},
+	})
+	assert.NoError(t, err)
+	svc := NewArticleSearchService(repo, nil)
+
+	hits, total, err := svc.SearchArticle(context.Background(), " 缓存 ", 0, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, total)
+	assert.Equal(t, int64(1), hits[0].Article.Id)
+	assert.Equal(t, int64(123), hits[0].Article.Author.Id)
+	assert.Equal(t, "", hits[0].Article.Content)
+	assert.Equal(t, "Redis <em>缓存</em>", hits[0].TitleHighlight)
+	assert.Equal(t, "<em>缓存</em>一致性", hits[0].ContentHighlight)
+
+	hits, total, err = svc.SearchArticle(context.Background(), "  ", 0, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, total)
+	assert.Empty(t, hits)
+}
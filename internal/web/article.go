@@ -1,10 +1,12 @@
 package web
 
 import (
+	"errors"
 	"github.com/Tuanzi-bug/tuan-book/internal/domain"
 	"github.com/Tuanzi-bug/tuan-book/internal/service"
 	myjwt "github.com/Tuanzi-bug/tuan-book/internal/web/jwt"
 	"github.com/Tuanzi-bug/tuan-book/pkg/log"
+	"github.com/Tuanzi-bug/tuan-book/pkg/textdiff"
 	"github.com/ecodeclub/ekit/slice"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -17,14 +19,22 @@ import (
 const articleBiz = "article"
 
 type ArticleHandler struct {
-	svc     service.ArticleService
-	intrSvc service.InteractiveService
+	svc        service.ArticleService
+	intrSvc    service.InteractiveService
+	rankingSvc service.RankingService
+	commentSvc service.CommentService
+	followSvc  service.FollowService
 }
 
-func NewArticleHandler(svc service.ArticleService, intrSvc service.InteractiveService) *ArticleHandler {
+func NewArticleHandler(svc service.ArticleService, intrSvc service.InteractiveService,
+	rankingSvc service.RankingService, commentSvc service.CommentService,
+	followSvc service.FollowService) *ArticleHandler {
 	return &ArticleHandler{
-		svc:     svc,
-		intrSvc: intrSvc,
+		svc:        svc,
+		intrSvc:    intrSvc,
+		rankingSvc: rankingSvc,
+		commentSvc: commentSvc,
+		followSvc:  followSvc,
 	}
 }
 
@@ -34,16 +44,29 @@ func (h *ArticleHandler) RegisterRoutes(server *gin.Engine) {
 	g.POST("/edit", h.Edit)
 	g.POST("/publish", h.Publish)
 	g.POST("/withdraw", h.Withdraw)
+	// 定时发表
+	g.POST("/schedule", h.Schedule)
+	g.POST("/schedule/reschedule", h.Reschedule)
+	g.POST("/schedule/cancel", h.CancelSchedule)
 	g.POST("/list", h.List)
 	// 创作者相关的接口
 	a := g.Group("/author")
 	a.GET("/detail/:id", h.Detail)
+	// 历史版本
+	a.GET("/revisions/:id", h.Revisions)
+	a.GET("/revisions/:id/diff", h.RevisionDiff)
+	a.POST("/revisions/restore", h.RestoreRevision)
 	// 线上库的相关接口
 	pub := g.Group("/pub")
 	pub.GET("/detail/:id", h.PubDetail)
 	// 传入一个参数，true 就是点赞, false 就是不点赞
 	pub.POST("/like", h.Like)
 	pub.POST("/collect", h.Collect)
+	pub.POST("/collect/cancel", h.CancelCollect)
+	// 热榜
+	pub.GET("/ranking", h.Ranking)
+	// 按标签浏览
+	pub.GET("/tag/:tag", h.ListByTag)
 }
 
 // Edit 编辑文章接口
@@ -52,6 +75,8 @@ func (h *ArticleHandler) Edit(ctx *gin.Context) {
 		Id      int64
 		Title   string `json:"title"`
 		Content string `json:"content"`
+		// 不传表示不修改标签，传空数组表示清空标签
+		Tags []string `json:"tags"`
 	}
 	var req Req
 	if err := ctx.Bind(&req); err != nil {
@@ -67,10 +92,15 @@ func (h *ArticleHandler) Edit(ctx *gin.Context) {
 		Id:      req.Id,
 		Title:   req.Title,
 		Content: req.Content,
+		Tags:    req.Tags,
 		Author: domain.Author{
 			Id: u.Uid,
 		},
 	})
+	if msg, ok := tagErrMsg(err); ok {
+		ctx.JSON(http.StatusOK, Result{Code: 4, Msg: msg})
+		return
+	}
 	if err != nil {
 		ctx.JSON(http.StatusOK, Result{Msg: "系统错误"})
 		log.Error("保存帖子失败", zap.Int64("uid", u.Uid), zap.Error(err))
@@ -83,8 +113,9 @@ func (h *ArticleHandler) Edit(ctx *gin.Context) {
 func (h *ArticleHandler) Publish(ctx *gin.Context) {
 	type Req struct {
 		Id      int64
-		Title   string `json:"title"`
-		Content string `json:"content"`
+		Title   string   `json:"title"`
+		Content string   `json:"content"`
+		Tags    []string `json:"tags"`
 	}
 	var req Req
 	if err := ctx.Bind(&req); err != nil {
@@ -100,8 +131,13 @@ func (h *ArticleHandler) Publish(ctx *gin.Context) {
 		Id:      req.Id,
 		Title:   req.Title,
 		Content: req.Content,
+		Tags:    req.Tags,
 		Author:  domain.Author{Id: u.Uid},
 	})
+	if msg, ok := tagErrMsg(err); ok {
+		ctx.JSON(http.StatusOK, Result{Code: 4, Msg: msg})
+		return
+	}
 	if err != nil {
 		ctx.JSON(http.StatusOK, Result{
 			Msg:  "系统错误",
@@ -144,6 +180,87 @@ func (h *ArticleHandler) Withdraw(ctx *gin.Context) {
 	})
 }
 
+// Schedule 定时发表接口，publishAt 是毫秒时间戳。定时之后再保存草稿会取消定时
+func (h *ArticleHandler) Schedule(ctx *gin.Context) {
+	type Req struct {
+		Id        int64    `json:"id"`
+		Title     string   `json:"title"`
+		Content   string   `json:"content"`
+		Tags      []string `json:"tags"`
+		PublishAt int64    `json:"publishAt"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	uc := ctx.MustGet("user").(myjwt.UserClaims)
+	id, err := h.svc.SchedulePublish(ctx, domain.Article{
+		Id:      req.Id,
+		Title:   req.Title,
+		Content: req.Content,
+		Tags:    req.Tags,
+		Author:  domain.Author{Id: uc.Uid},
+	}, time.UnixMilli(req.PublishAt))
+	if msg, ok := tagErrMsg(err); ok {
+		ctx.JSON(http.StatusOK, Result{Code: 4, Msg: msg})
+		return
+	}
+	switch {
+	case errors.Is(err, service.ErrInvalidPublishTime):
+		ctx.JSON(http.StatusOK, Result{Code: 4, Msg: "定时发表的时间不正确"})
+		return
+	case err != nil:
+		ctx.JSON(http.StatusOK, Result{Code: 5, Msg: "系统错误"})
+		log.Error("定时发表失败", zap.Int64("uid", uc.Uid), zap.Int64("aid", req.Id), zap.Error(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Data: id})
+}
+
+// Reschedule 修改定时发表的时间
+func (h *ArticleHandler) Reschedule(ctx *gin.Context) {
+	type Req struct {
+		Id        int64 `json:"id"`
+		PublishAt int64 `json:"publishAt"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	uc := ctx.MustGet("user").(myjwt.UserClaims)
+	err := h.svc.Reschedule(ctx, uc.Uid, req.Id, time.UnixMilli(req.PublishAt))
+	h.scheduleResult(ctx, uc.Uid, req.Id, err)
+}
+
+// CancelSchedule 取消定时发表，文章回到草稿状态
+func (h *ArticleHandler) CancelSchedule(ctx *gin.Context) {
+	type Req struct {
+		Id int64 `json:"id"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	uc := ctx.MustGet("user").(myjwt.UserClaims)
+	err := h.svc.CancelSchedule(ctx, uc.Uid, req.Id)
+	h.scheduleResult(ctx, uc.Uid, req.Id, err)
+}
+
+func (h *ArticleHandler) scheduleResult(ctx *gin.Context, uid, aid int64, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidPublishTime):
+		ctx.JSON(http.StatusOK, Result{Code: 4, Msg: "定时发表的时间不正确"})
+	case errors.Is(err, service.ErrArticleNotScheduled):
+		// 文章不存在、不是作者、已经发表都算这种情况
+		ctx.JSON(http.StatusOK, Result{Code: 4, Msg: "文章不是定时发表状态"})
+	case err != nil:
+		ctx.JSON(http.StatusOK, Result{Code: 5, Msg: "系统错误"})
+		log.Error("修改定时发表失败", zap.Int64("uid", uid), zap.Int64("aid", aid), zap.Error(err))
+	default:
+		ctx.JSON(http.StatusOK, Result{Msg: "OK"})
+	}
+}
+
 // List 文章列表接口
 func (h *ArticleHandler) List(ctx *gin.Context) {
 	var page Page
@@ -166,27 +283,159 @@ func (h *ArticleHandler) List(ctx *gin.Context) {
 			//Content:  src.Content,
 			AuthorId: src.Author.Id,
 			// 列表，你不需要
-			Status: src.Status.ToUint8(),
-			Ctime:  src.Ctime.Format(time.DateTime),
-			Utime:  src.Utime.Format(time.DateTime),
+			Status:    src.Status.ToUint8(),
+			Ctime:     src.Ctime.Format(time.DateTime),
+			Utime:     src.Utime.Format(time.DateTime),
+			PublishAt: formatPublishAt(src.PublishAt),
 		}
 	})})
 }
 
 // Detail 制作库创作者的文章详情接口
 func (h *ArticleHandler) Detail(ctx *gin.Context) {
+	art, ok := h.authorArticle(ctx)
+	if !ok {
+		return
+	}
+	// 返回与前端约定的数据
+	ctx.JSON(http.StatusOK, Result{Data: ArticleVo{
+		Id:    art.Id,
+		Title: art.Title,
+		//Abstract: art.Abstract(),
+
+		Content:  art.Content,
+		AuthorId: art.Author.Id,
+		Tags:     art.Tags,
+		// 列表，你不需要
+		Status:    art.Status.ToUint8(),
+		Ctime:     art.Ctime.Format(time.DateTime),
+		Utime:     art.Utime.Format(time.DateTime),
+		PublishAt: formatPublishAt(art.PublishAt),
+	}})
+
+}
+
+// Revisions 文章历史版本列表接口，不返回内容
+func (h *ArticleHandler) Revisions(ctx *gin.Context) {
+	var page Page
+	if err := ctx.Bind(&page); err != nil {
+		return
+	}
+	if page.Limit <= 0 || page.Limit > 100 {
+		page.Limit = 10
+	}
+	if page.Offset < 0 {
+		page.Offset = 0
+	}
+	art, ok := h.authorArticle(ctx)
+	if !ok {
+		return
+	}
+	revs, err := h.svc.ListRevisions(ctx, art.Id, page.Offset, page.Limit)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: 5, Msg: "系统错误"})
+		log.Error("查找文章历史版本失败", zap.Int64("aid", art.Id), zap.Error(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Data: slice.Map[domain.ArticleRevision, ArticleRevisionVo](revs,
+		func(idx int, src domain.ArticleRevision) ArticleRevisionVo {
+			return ArticleRevisionVo{
+				Id:          src.Id,
+				ArticleId:   src.ArticleId,
+				Title:       src.Title,
+				ContentHash: src.ContentHash,
+				Status:      src.Status.ToUint8(),
+				Ctime:       src.Ctime.Format(time.DateTime),
+			}
+		})})
+}
+
+// RevisionDiff 比较两个历史版本的内容
+func (h *ArticleHandler) RevisionDiff(ctx *gin.Context) {
+	type Req struct {
+		From int64 `form:"from"`
+		To   int64 `form:"to"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	art, ok := h.authorArticle(ctx)
+	if !ok {
+		return
+	}
+	from, to, lines, err := h.svc.DiffRevisions(ctx, art.Id, req.From, req.To)
+	switch {
+	case errors.Is(err, service.ErrRevisionNotBelong), errors.Is(err, service.ErrRevisionNotFound):
+		ctx.JSON(http.StatusOK, Result{Code: 4, Msg: "版本不存在"})
+		return
+	case err != nil:
+		ctx.JSON(http.StatusOK, Result{Code: 5, Msg: "系统错误"})
+		log.Error("比较文章版本失败", zap.Int64("aid", art.Id),
+			zap.Int64("from", req.From), zap.Int64("to", req.To), zap.Error(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Data: RevisionDiffVo{
+		From:      from.Id,
+		To:        to.Id,
+		FromTitle: from.Title,
+		ToTitle:   to.Title,
+		Lines: slice.Map[textdiff.Line, DiffLineVo](lines, func(idx int, src textdiff.Line) DiffLineVo {
+			return DiffLineVo{Op: src.Op.String(), Text: src.Text}
+		}),
+	}})
+}
+
+// RestoreRevision 把历史版本恢复成草稿
+func (h *ArticleHandler) RestoreRevision(ctx *gin.Context) {
+	type Req struct {
+		Id         int64 `json:"id"`
+		RevisionId int64 `json:"revisionId"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	uc := ctx.MustGet("user").(myjwt.UserClaims)
+	art, err := h.svc.GetById(ctx, req.Id)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Msg: "系统错误", Code: 5})
+		log.Error("查找文章失败", zap.Int64("id", req.Id), zap.Error(err))
+		return
+	}
+	if uc.Uid != art.Author.Id {
+		ctx.JSON(http.StatusOK, Result{Msg: "无权操作", Code: 4})
+		log.Warn("无权恢复文章版本", zap.Int64("uid", uc.Uid), zap.Int64("aid", req.Id))
+		return
+	}
+	err = h.svc.RestoreRevision(ctx, uc.Uid, req.Id, req.RevisionId)
+	switch {
+	case errors.Is(err, service.ErrRevisionNotBelong), errors.Is(err, service.ErrRevisionNotFound):
+		ctx.JSON(http.StatusOK, Result{Code: 4, Msg: "版本不存在"})
+		return
+	case err != nil:
+		ctx.JSON(http.StatusOK, Result{Code: 5, Msg: "系统错误"})
+		log.Error("恢复文章版本失败", zap.Int64("aid", req.Id),
+			zap.Int64("revisionId", req.RevisionId), zap.Error(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Msg: "OK"})
+}
+
+// authorArticle 根据路径参数 id 查找文章并校验当前用户是不是作者，失败时已经写好响应
+func (h *ArticleHandler) authorArticle(ctx *gin.Context) (domain.Article, bool) {
 	idStr := ctx.Param("id")
 	id, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
 		ctx.JSON(http.StatusOK, Result{Msg: "id 参数错误", Code: 4})
-		log.Warn("Detail 获取 id 参数错误", zap.String("id", idStr), zap.Error(err))
-		return
+		log.Warn("获取 id 参数错误", zap.String("id", idStr), zap.Error(err))
+		return domain.Article{}, false
 	}
 	art, err := h.svc.GetById(ctx, id)
 	if err != nil {
 		ctx.JSON(http.StatusOK, Result{Msg: "系统错误", Code: 5})
 		log.Error("查找文章失败", zap.Int64("id", id), zap.Error(err))
-		return
+		return domain.Article{}, false
 	}
 	// 涉及到作者的相关信息，需要通过token信息获取个人信息
 	uc := ctx.MustGet("user").(myjwt.UserClaims)
@@ -194,22 +443,9 @@ func (h *ArticleHandler) Detail(ctx *gin.Context) {
 	if uc.Uid != art.Author.Id {
 		ctx.JSON(http.StatusOK, Result{Msg: "无权查看", Code: 4})
 		log.Warn("无权查看", zap.Int64("uid", uc.Uid), zap.Int64("aid", id))
-		return
+		return domain.Article{}, false
 	}
-	// 返回与前端约定的数据
-	ctx.JSON(http.StatusOK, Result{Data: ArticleVo{
-		Id:    art.Id,
-		Title: art.Title,
-		//Abstract: art.Abstract(),
-
-		Content:  art.Content,
-		AuthorId: art.Author.Id,
-		// 列表，你不需要
-		Status: art.Status.ToUint8(),
-		Ctime:  art.Ctime.Format(time.DateTime),
-		Utime:  art.Utime.Format(time.DateTime),
-	}})
-
+	return art, true
 }
 
 // PubDetail 线上库文章详情接口
@@ -224,9 +460,11 @@ func (h *ArticleHandler) PubDetail(ctx *gin.Context) {
 	// 在这里不仅要获取文章详情，还要获取阅读数，点赞数，收藏数
 	// 这些任务并发进行更加高效
 	var (
-		eg   errgroup.Group
-		art  domain.Article
-		intr domain.Interactive
+		eg         errgroup.Group
+		art        domain.Article
+		intr       domain.Interactive
+		commentCnt int64
+		followed   bool
 	)
 
 	//art, err := h.svc.GetPubById(ctx, id)
@@ -234,13 +472,31 @@ func (h *ArticleHandler) PubDetail(ctx *gin.Context) {
 	eg.Go(func() error {
 		var er error
 		art, er = h.svc.GetPubById(ctx, id, uc.Uid)
-		return er
+		if er != nil {
+			return er
+		}
+		// 要先知道作者才能查关注关系，查不到不影响文章详情
+		followed, er = h.followSvc.Followed(ctx, uc.Uid, art.Author.Id)
+		if er != nil {
+			log.Error("获取关注关系失败", zap.Int64("uid", uc.Uid), zap.Int64("author", art.Author.Id), zap.Error(er))
+		}
+		return nil
 	})
 	eg.Go(func() error {
 		var er error
 		intr, er = h.intrSvc.Get(ctx, articleBiz, id, uc.Uid)
 		return er
 	})
+	eg.Go(func() error {
+		cnts, er := h.commentSvc.CountByBiz(ctx, articleBiz, []int64{id})
+		if er != nil {
+			// 评论数拿不到不影响文章详情
+			log.Error("获取评论数失败", zap.Int64("aid", id), zap.Error(er))
+			return nil
+		}
+		commentCnt = cnts[id]
+		return nil
+	})
 	err = eg.Wait()
 	if err != nil {
 		ctx.JSON(http.StatusOK, Result{
@@ -266,16 +522,20 @@ func (h *ArticleHandler) PubDetail(ctx *gin.Context) {
 			Content:    art.Content,
 			AuthorId:   art.Author.Id,
 			AuthorName: art.Author.Name,
+			Tags:       art.Tags,
 
 			Status: art.Status.ToUint8(),
 			Ctime:  art.Ctime.Format(time.DateTime),
 			Utime:  art.Utime.Format(time.DateTime),
 
 			ReadCnt:    intr.ReadCnt,
+			ReaderCnt:  intr.ReaderCnt,
 			CollectCnt: intr.CollectCnt,
 			LikeCnt:    intr.LikeCnt,
+			CommentCnt: commentCnt,
 			Liked:      intr.Liked,
 			Collected:  intr.Collected,
+			Followed:   followed,
 		},
 	})
 }
@@ -292,18 +552,25 @@ func (h *ArticleHandler) Like(context *gin.Context) {
 	}
 	uc := context.MustGet("user").(myjwt.UserClaims)
 	// 在这里聚合点赞和取消点赞的服务
-	var err error
+	var (
+		intr domain.Interactive
+		err  error
+	)
 	if req.Like {
-		err = h.intrSvc.Like(context, articleBiz, req.Id, uc.Uid)
+		intr, err = h.intrSvc.Like(context, articleBiz, req.Id, uc.Uid)
 	} else {
-		err = h.intrSvc.CancelLike(context, articleBiz, req.Id, uc.Uid)
+		intr, err = h.intrSvc.CancelLike(context, articleBiz, req.Id, uc.Uid)
 	}
 	if err != nil {
 		context.JSON(http.StatusOK, Result{Msg: "系统错误"})
 		log.Error("点赞失败", zap.Int64("uid", uc.Uid), zap.Int64("aid", req.Id), zap.Error(err))
 		return
 	}
-	context.JSON(http.StatusOK, Result{Msg: "OK"})
+	// 返回最新的状态，前端可以直接更新页面
+	context.JSON(http.StatusOK, Result{Msg: "OK", Data: LikeVo{
+		Liked:   intr.Liked,
+		LikeCnt: intr.LikeCnt,
+	}})
 }
 
 // Collect 收藏接口
@@ -319,10 +586,180 @@ func (h *ArticleHandler) Collect(context *gin.Context) {
 	}
 	uc := context.MustGet("user").(myjwt.UserClaims)
 	err := h.intrSvc.Collect(context, articleBiz, req.Id, req.CId, uc.Uid)
-	if err != nil {
-		context.JSON(http.StatusOK, Result{Msg: "系统错误"})
+	switch {
+	case errors.Is(err, service.ErrCollectionNotFound):
+		context.JSON(http.StatusOK, Result{Code: 4, Msg: "收藏夹不存在"})
+		log.Warn("收藏到别人的收藏夹", zap.Int64("uid", uc.Uid), zap.Int64("cid", req.CId))
+		return
+	case errors.Is(err, service.ErrAlreadyCollected):
+		context.JSON(http.StatusOK, Result{Code: 4, Msg: "已经收藏过了，可以移动到其他收藏夹"})
+		return
+	case err != nil:
+		context.JSON(http.StatusOK, Result{Code: 5, Msg: "系统错误"})
 		log.Error("收藏失败", zap.Error(err), zap.Int64("uid", uc.Uid), zap.Int64("aid", req.Id), zap.Int64("cid", req.CId))
 		return
 	}
 	context.JSON(http.StatusOK, Result{Msg: "OK"})
 }
+
+// CancelCollect 取消收藏接口
+func (h *ArticleHandler) CancelCollect(ctx *gin.Context) {
+	type Req struct {
+		Id int64 `json:"id"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	uc := ctx.MustGet("user").(myjwt.UserClaims)
+	err := h.intrSvc.CancelCollect(ctx, articleBiz, req.Id, uc.Uid)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: 5, Msg: "系统错误"})
+		log.Error("取消收藏失败", zap.Error(err), zap.Int64("uid", uc.Uid), zap.Int64("aid", req.Id))
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Msg: "OK"})
+}
+
+// Ranking 热榜接口
+func (h *ArticleHandler) Ranking(ctx *gin.Context) {
+	var page Page
+	if err := ctx.Bind(&page); err != nil {
+		return
+	}
+	// 热榜最多只有 100 条，不传或者传错就给一页默认的
+	if page.Limit <= 0 || page.Limit > 100 {
+		page.Limit = 10
+	}
+	if page.Offset < 0 {
+		page.Offset = 0
+	}
+	board := ctx.DefaultQuery("board", service.DefaultRankingBoard)
+	arts, err := h.rankingSvc.GetTopN(ctx, board)
+	switch {
+	case errors.Is(err, service.ErrRankingBoardNotFound):
+		ctx.JSON(http.StatusOK, Result{Code: 4, Msg: "榜单不存在"})
+		return
+	case err != nil:
+		ctx.JSON(http.StatusOK, Result{Code: 5, Msg: "系统错误"})
+		log.Error("获取热榜失败", zap.String("board", board), zap.Error(err))
+		return
+	}
+	// 在内存中分页
+	if page.Offset >= len(arts) {
+		ctx.JSON(http.StatusOK, Result{Data: []ArticleVo{}})
+		return
+	}
+	end := min(page.Offset+page.Limit, len(arts))
+	arts = arts[page.Offset:end]
+	ids := slice.Map[domain.Article, int64](arts, func(idx int, src domain.Article) int64 {
+		return src.Id
+	})
+	uc := ctx.MustGet("user").(myjwt.UserClaims)
+	intrs, err := h.intrSvc.BatchGet(ctx, articleBiz, ids, uc.Uid)
+	if err != nil {
+		// 交互数据拿不到，热榜照样返回，只是计数为 0
+		log.Error("获取热榜交互数据失败", zap.Error(err))
+	}
+	commentCnts, err := h.commentSvc.CountByBiz(ctx, articleBiz, ids)
+	if err != nil {
+		log.Error("获取热榜评论数失败", zap.Error(err))
+	}
+	ctx.JSON(http.StatusOK, Result{Data: slice.Map[domain.Article, ArticleVo](arts, func(idx int, src domain.Article) ArticleVo {
+		intr := intrs[src.Id]
+		return ArticleVo{
+			Id:       src.Id,
+			Title:    src.Title,
+			Abstract: src.Abstract(),
+			AuthorId: src.Author.Id,
+			Ctime:    src.Ctime.Format(time.DateTime),
+			Utime:    src.Utime.Format(time.DateTime),
+
+			ReadCnt:    intr.ReadCnt,
+			ReaderCnt:  intr.ReaderCnt,
+			LikeCnt:    intr.LikeCnt,
+			CollectCnt: intr.CollectCnt,
+			CommentCnt: commentCnts[src.Id],
+			Liked:      intr.Liked,
+			Collected:  intr.Collected,
+		}
+	})})
+}
+
+// formatPublishAt 没有定时的时候返回空字符串
+func formatPublishAt(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.DateTime)
+}
+
+// ListByTag 按标签浏览线上库的文章，使用游标分页
+func (h *ArticleHandler) ListByTag(ctx *gin.Context) {
+	type Req struct {
+		// 上一页返回的 cursor，第一页不传
+		Cursor int64 `form:"cursor"`
+		Limit  int   `form:"limit"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	if req.Limit <= 0 || req.Limit > 100 {
+		req.Limit = 10
+	}
+	tag := ctx.Param("tag")
+	arts, err := h.svc.ListPubByTag(ctx, tag, req.Cursor, req.Limit)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: 5, Msg: "系统错误"})
+		log.Error("按标签查找文章失败", zap.String("tag", tag), zap.Int64("cursor", req.Cursor), zap.Error(err))
+		return
+	}
+	var next int64
+	// 不满一页说明没有下一页了
+	if len(arts) == req.Limit {
+		next = arts[len(arts)-1].Id
+	}
+	ids := slice.Map[domain.Article, int64](arts, func(idx int, src domain.Article) int64 {
+		return src.Id
+	})
+	uc := ctx.MustGet("user").(myjwt.UserClaims)
+	intrs, err := h.intrSvc.BatchGet(ctx, articleBiz, ids, uc.Uid)
+	if err != nil {
+		// 交互数据不影响列表展示
+		log.Error("获取文章列表交互数据失败", zap.String("tag", tag), zap.Error(err))
+	}
+	ctx.JSON(http.StatusOK, Result{Data: ArticleCursorVo{
+		Cursor: next,
+		Articles: slice.Map[domain.Article, ArticleVo](arts, func(idx int, src domain.Article) ArticleVo {
+			intr := intrs[src.Id]
+			return ArticleVo{
+				Id:       src.Id,
+				Title:    src.Title,
+				Abstract: src.Abstract(),
+				AuthorId: src.Author.Id,
+				Ctime:    src.Ctime.Format(time.DateTime),
+				Utime:    src.Utime.Format(time.DateTime),
+
+				ReadCnt:    intr.ReadCnt,
+				ReaderCnt:  intr.ReaderCnt,
+				LikeCnt:    intr.LikeCnt,
+				CollectCnt: intr.CollectCnt,
+				Liked:      intr.Liked,
+				Collected:  intr.Collected,
+			}
+		}),
+	}})
+}
+
+// tagErrMsg 标签相关的错误返回给前端的提示
+func tagErrMsg(err error) (string, bool) {
+	switch {
+	case errors.Is(err, service.ErrInvalidTag):
+		return "标签不能为空，长度不能超过 32", true
+	case errors.Is(err, service.ErrTooManyTags):
+		return "使用的标签太多了", true
+	default:
+		return "", false
+	}
+}
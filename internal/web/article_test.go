@@ -7,11 +7,13 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/Tuanzi-bug/tuan-book/internal/domain"
 	"github.com/Tuanzi-bug/tuan-book/internal/service"
 	svcmocks "github.com/Tuanzi-bug/tuan-book/internal/service/mocks"
 	myjwt "github.com/Tuanzi-bug/tuan-book/internal/web/jwt"
+	"github.com/Tuanzi-bug/tuan-book/pkg/textdiff"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -126,7 +128,7 @@ func TestArticleHandler_Publish(t *testing.T) {
 			// 启动mock控制器
 			ctrl := gomock.NewController(t)
 			defer ctrl.Finish()
-			h := NewArticleHandler(tc.mock(ctrl), nil)
+			h := NewArticleHandler(tc.mock(ctrl), nil, nil, nil, nil)
 			req, err := http.NewRequest(http.MethodPost, "/articles/publish", bytes.NewBuffer([]byte(tc.reqBody)))
 			require.NoError(t, err)
 			req.Header.Set("Content-Type", "application/json")
@@ -151,3 +153,263 @@ func TestArticleHandler_Publish(t *testing.T) {
 		})
 	}
 }
+
+func TestArticleHandler_Ranking(t *testing.T) {
+	now := time.Now()
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) (service.RankingService, service.InteractiveService, service.CommentService)
+
+		url      string
+		wantCode int
+		wantRes  Result
+	}{
+		{
+			name: "分页获取热榜",
+			mock: func(ctrl *gomock.Controller) (service.RankingService, service.InteractiveService, service.CommentService) {
+				rankingSvc := svcmocks.NewMockRankingService(ctrl)
+				intrSvc := svcmocks.NewMockInteractiveService(ctrl)
+				commentSvc := svcmocks.NewMockCommentService(ctrl)
+				rankingSvc.EXPECT().GetTopN(gomock.Any(), "daily").Return([]domain.Article{
+					{Id: 1, Title: "标题1", Author: domain.Author{Id: 11}, Ctime: now, Utime: now},
+					{Id: 2, Title: "标题2", Author: domain.Author{Id: 22}, Ctime: now, Utime: now},
+					{Id: 3, Title: "标题3", Author: domain.Author{Id: 33}, Ctime: now, Utime: now},
+				}, nil)
+				intrSvc.EXPECT().BatchGet(gomock.Any(), "article", []int64{2, 3}, int64(123)).
+					Return(map[int64]domain.Interactive{
+						2: {BizId: 2, ReadCnt: 10, ReaderCnt: 4, LikeCnt: 5, CollectCnt: 1, Liked: true},
+						3: {BizId: 3},
+					}, nil)
+				commentSvc.EXPECT().CountByBiz(gomock.Any(), "article", []int64{2, 3}).
+					Return(map[int64]int64{3: 7}, nil)
+				return rankingSvc, intrSvc, commentSvc
+			},
+			url:      "/articles/pub/ranking?board=daily&offset=1&limit=2",
+			wantCode: http.StatusOK,
+			wantRes: Result{
+				Data: []any{
+					map[string]any{"id": float64(2), "title": "标题2", "authorId": float64(22),
+						"ctime": now.Format(time.DateTime), "utime": now.Format(time.DateTime),
+						"readCnt": float64(10), "readerCnt": float64(4), "likeCnt": float64(5), "collectCnt": float64(1), "commentCnt": float64(0),
+						"liked": true, "collected": false},
+					map[string]any{"id": float64(3), "title": "标题3", "authorId": float64(33),
+						"ctime": now.Format(time.DateTime), "utime": now.Format(time.DateTime),
+						"readCnt": float64(0), "readerCnt": float64(0), "likeCnt": float64(0), "collectCnt": float64(0), "commentCnt": float64(7),
+						"liked": false, "collected": false},
+				},
+			},
+		},
+		{
+			name: "超出热榜范围",
+			mock: func(ctrl *gomock.Controller) (service.RankingService, service.InteractiveService, service.CommentService) {
+				rankingSvc := svcmocks.NewMockRankingService(ctrl)
+				rankingSvc.EXPECT().GetTopN(gomock.Any(), "weekly").Return([]domain.Article{{Id: 1}}, nil)
+				return rankingSvc, nil, nil
+			},
+			url:      "/articles/pub/ranking?offset=10&limit=2",
+			wantCode: http.StatusOK,
+			wantRes:  Result{Data: []any{}},
+		},
+		{
+			name: "获取热榜失败",
+			mock: func(ctrl *gomock.Controller) (service.RankingService, service.InteractiveService, service.CommentService) {
+				rankingSvc := svcmocks.NewMockRankingService(ctrl)
+				rankingSvc.EXPECT().GetTopN(gomock.Any(), "weekly").Return(nil, errors.New("mock error"))
+				return rankingSvc, nil, nil
+			},
+			url:      "/articles/pub/ranking",
+			wantCode: http.StatusOK,
+			wantRes:  Result{Code: 5, Msg: "系统错误"},
+		},
+		{
+			name: "榜单不存在",
+			mock: func(ctrl *gomock.Controller) (service.RankingService, service.InteractiveService, service.CommentService) {
+				rankingSvc := svcmocks.NewMockRankingService(ctrl)
+				rankingSvc.EXPECT().GetTopN(gomock.Any(), "monthly").Return(nil, service.ErrRankingBoardNotFound)
+				return rankingSvc, nil, nil
+			},
+			url:      "/articles/pub/ranking?board=monthly",
+			wantCode: http.StatusOK,
+			wantRes:  Result{Code: 4, Msg: "榜单不存在"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			rankingSvc, intrSvc, commentSvc := tc.mock(ctrl)
+			h := NewArticleHandler(nil, intrSvc, rankingSvc, commentSvc, nil)
+			req, err := http.NewRequest(http.MethodGet, tc.url, nil)
+			require.NoError(t, err)
+			resp := httptest.NewRecorder()
+			server := gin.Default()
+			server.Use(func(context *gin.Context) {
+				context.Set("user", myjwt.UserClaims{Uid: 123})
+			})
+			h.RegisterRoutes(server)
+
+			server.ServeHTTP(resp, req)
+			assert.Equal(t, tc.wantCode, resp.Code)
+			res := Result{}
+			err = json.NewDecoder(resp.Body).Decode(&res)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantRes, res)
+		})
+	}
+}
+
+func TestArticleHandler_Revisions(t *testing.T) {
+	ctime := time.UnixMilli(1700000000000)
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) service.ArticleService
+
+		method  string
+		url     string
+		reqBody string
+		wantRes Result
+	}{
+		{
+			name: "作者查看历史版本",
+			mock: func(ctrl *gomock.Controller) service.ArticleService {
+				svc := svcmocks.NewMockArticleService(ctrl)
+				svc.EXPECT().GetById(gomock.Any(), int64(1)).
+					Return(domain.Article{Id: 1, Author: domain.Author{Id: 123}}, nil)
+				svc.EXPECT().ListRevisions(gomock.Any(), int64(1), 0, 10).Return([]domain.ArticleRevision{
+					{Id: 2, ArticleId: 1, Title: "标题", ContentHash: "hash", Status: domain.ArticleStatusUnpublished, Ctime: ctime},
+				}, nil)
+				return svc
+			},
+			method: http.MethodGet,
+			url:    "/articles/author/revisions/1",
+			wantRes: Result{Data: []any{map[string]any{
+				"id": float64(2), "articleId": float64(1), "title": "标题", "contentHash": "hash",
+				"status": float64(domain.ArticleStatusUnpublished), "ctime": ctime.Format(time.DateTime),
+			}}},
+		},
+		{
+			name: "不是作者不能查看历史版本",
+			mock: func(ctrl *gomock.Controller) service.ArticleService {
+				svc := svcmocks.NewMockArticleService(ctrl)
+				svc.EXPECT().GetById(gomock.Any(), int64(1)).
+					Return(domain.Article{Id: 1, Author: domain.Author{Id: 456}}, nil)
+				return svc
+			},
+			method:  http.MethodGet,
+			url:     "/articles/author/revisions/1",
+			wantRes: Result{Code: 4, Msg: "无权查看"},
+		},
+		{
+			name: "比较两个版本",
+			mock: func(ctrl *gomock.Controller) service.ArticleService {
+				svc := svcmocks.NewMockArticleService(ctrl)
+				svc.EXPECT().GetById(gomock.Any(), int64(1)).
+					Return(domain.Article{Id: 1, Author: domain.Author{Id: 123}}, nil)
+				svc.EXPECT().DiffRevisions(gomock.Any(), int64(1), int64(2), int64(3)).Return(
+					domain.ArticleRevision{Id: 2, Title: "旧标题"}, domain.ArticleRevision{Id: 3, Title: "新标题"},
+					[]textdiff.Line{{Op: textdiff.OpDelete, Text: "a"}, {Op: textdiff.OpInsert, Text: "b"}}, nil)
+				return svc
+			},
+			method: http.MethodGet,
+			url:    "/articles/author/revisions/1/diff?from=2&to=3",
+			wantRes: Result{Data: map[string]any{
+				"from": float64(2), "to": float64(3), "fromTitle": "旧标题", "toTitle": "新标题",
+				"lines": []any{
+					map[string]any{"op": "-", "text": "a"},
+					map[string]any{"op": "+", "text": "b"},
+				},
+			}},
+		},
+		{
+			name: "比较别的文章的版本",
+			mock: func(ctrl *gomock.Controller) service.ArticleService {
+				svc := svcmocks.NewMockArticleService(ctrl)
+				svc.EXPECT().GetById(gomock.Any(), int64(1)).
+					Return(domain.Article{Id: 1, Author: domain.Author{Id: 123}}, nil)
+				svc.EXPECT().DiffRevisions(gomock.Any(), int64(1), int64(2), int64(3)).Return(
+					domain.ArticleRevision{}, domain.ArticleRevision{}, nil, service.ErrRevisionNotBelong)
+				return svc
+			},
+			method:  http.MethodGet,
+			url:     "/articles/author/revisions/1/diff?from=2&to=3",
+			wantRes: Result{Code: 4, Msg: "版本不存在"},
+		},
+		{
+			name: "不是作者不能比较",
+			mock: func(ctrl *gomock.Controller) service.ArticleService {
+				svc := svcmocks.NewMockArticleService(ctrl)
+				svc.EXPECT().GetById(gomock.Any(), int64(1)).
+					Return(domain.Article{Id: 1, Author: domain.Author{Id: 456}}, nil)
+				return svc
+			},
+			method:  http.MethodGet,
+			url:     "/articles/author/revisions/1/diff?from=2&to=3",
+			wantRes: Result{Code: 4, Msg: "无权查看"},
+		},
+		{
+			name: "恢复历史版本",
+			mock: func(ctrl *gomock.Controller) service.ArticleService {
+				svc := svcmocks.NewMockArticleService(ctrl)
+				svc.EXPECT().GetById(gomock.Any(), int64(1)).
+					Return(domain.Article{Id: 1, Author: domain.Author{Id: 123}}, nil)
+				svc.EXPECT().RestoreRevision(gomock.Any(), int64(123), int64(1), int64(2)).Return(nil)
+				return svc
+			},
+			method:  http.MethodPost,
+			url:     "/articles/author/revisions/restore",
+			reqBody: `{"id": 1, "revisionId": 2}`,
+			wantRes: Result{Msg: "OK"},
+		},
+		{
+			name: "不是作者不能恢复",
+			mock: func(ctrl *gomock.Controller) service.ArticleService {
+				svc := svcmocks.NewMockArticleService(ctrl)
+				svc.EXPECT().GetById(gomock.Any(), int64(1)).
+					Return(domain.Article{Id: 1, Author: domain.Author{Id: 456}}, nil)
+				return svc
+			},
+			method:  http.MethodPost,
+			url:     "/articles/author/revisions/restore",
+			reqBody: `{"id": 1, "revisionId": 2}`,
+			wantRes: Result{Code: 4, Msg: "无权操作"},
+		},
+		{
+			name: "恢复不存在的版本",
+			mock: func(ctrl *gomock.Controller) service.ArticleService {
+				svc := svcmocks.NewMockArticleService(ctrl)
+				svc.EXPECT().GetById(gomock.Any(), int64(1)).
+					Return(domain.Article{Id: 1, Author: domain.Author{Id: 123}}, nil)
+				svc.EXPECT().RestoreRevision(gomock.Any(), int64(123), int64(1), int64(2)).
+					Return(service.ErrRevisionNotFound)
+				return svc
+			},
+			method:  http.MethodPost,
+			url:     "/articles/author/revisions/restore",
+			reqBody: `{"id": 1, "revisionId": 2}`,
+			wantRes: Result{Code: 4, Msg: "版本不存在"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			h := NewArticleHandler(tc.mock(ctrl), nil, nil, nil, nil)
+			req, err := http.NewRequest(tc.method, tc.url, bytes.NewBuffer([]byte(tc.reqBody)))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+			resp := httptest.NewRecorder()
+			server := gin.Default()
+			server.Use(func(context *gin.Context) {
+				context.Set("user", myjwt.UserClaims{Uid: 123})
+			})
+			h.RegisterRoutes(server)
+
+			server.ServeHTTP(resp, req)
+			assert.Equal(t, http.StatusOK, resp.Code)
+			res := Result{}
+			err = json.NewDecoder(resp.Body).Decode(&res)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantRes, res)
+		})
+	}
+}
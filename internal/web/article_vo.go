@@ -11,10 +11,68 @@ type ArticleVo struct {
 	Status     uint8  `json:"status,omitempty"`
 	Ctime      string `json:"ctime,omitempty"`
 	Utime      string `json:"utime,omitempty"`
+	// 定时发表的时间
+	PublishAt string   `json:"publishAt,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
 
-	ReadCnt    int64 `json:"readCnt"`
+	ReadCnt int64 `json:"readCnt"`
+	// 每天的独立读者数累计
+	ReaderCnt  int64 `json:"readerCnt"`
 	LikeCnt    int64 `json:"likeCnt"`
 	CollectCnt int64 `json:"collectCnt"`
+	CommentCnt int64 `json:"commentCnt"`
 	Liked      bool  `json:"liked"`
 	Collected  bool  `json:"collected"`
+	// 当前用户是否关注了作者
+	Followed bool `json:"followed,omitempty"`
+}
+
+// LikeVo 点赞或者取消点赞之后的状态
+type LikeVo struct {
+	Liked   bool  `json:"liked"`
+	LikeCnt int64 `json:"likeCnt"`
+}
+
+// ArticleRevisionVo 文章历史版本
+type ArticleRevisionVo struct {
+	Id          int64  `json:"id"`
+	ArticleId   int64  `json:"articleId"`
+	Title       string `json:"title"`
+	Content     string `json:"content,omitempty"`
+	ContentHash string `json:"contentHash"`
+	Status      uint8  `json:"status"`
+	Ctime       string `json:"ctime"`
+}
+
+// DiffLineVo 按行差异，op 取值为 " "、"-"、"+"
+type DiffLineVo struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// RevisionDiffVo 两个版本之间的差异
+type RevisionDiffVo struct {
+	From      int64        `json:"from"`
+	To        int64        `json:"to"`
+	FromTitle string       `json:"fromTitle"`
+	ToTitle   string       `json:"toTitle"`
+	Lines     []DiffLineVo `json:"lines"`
+}
+
+// ArticleCursorVo 游标分页的文章列表，cursor 为 0 表示没有下一页
+type ArticleCursorVo struct {
+	Cursor   int64       `json:"cursor"`
+	Articles []ArticleVo `json:"articles"`
+}
+
+// FeedVo 关注动态，cursor 是 "发表时间_文章id"，为空表示没有下一页
+type FeedVo struct {
+	Cursor   string      `json:"cursor"`
+	Articles []ArticleVo `json:"articles"`
+}
+
+// ArticleSearchVo 搜索结果，title 和 abstract 是高亮之后的 HTML
+type ArticleSearchVo struct {
+	Total    int         `json:"total"`
+	Articles []ArticleVo `json:"articles"`
 }
@@ -0,0 +1,198 @@
+package web
+
+import (
+	"errors"
+	"github.com/Tuanzi-bug/tuan-book/internal/domain"
+	"github.com/Tuanzi-bug/tuan-book/internal/service"
+	myjwt "github.com/Tuanzi-bug/tuan-book/internal/web/jwt"
+	"github.com/Tuanzi-bug/tuan-book/pkg/log"
+	"github.com/ecodeclub/ekit/slice"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type CollectionHandler struct {
+	svc service.CollectionService
+}
+
+func NewCollectionHandler(svc service.CollectionService) *CollectionHandler {
+	return &CollectionHandler{svc: svc}
+}
+
+func (h *CollectionHandler) RegisterRoutes(server *gin.Engine) {
+	g := server.Group("/collections")
+	g.POST("/create", h.Create)
+	g.POST("/rename", h.Rename)
+	g.POST("/delete", h.Delete)
+	// 自己的收藏夹
+	g.GET("/list", h.List)
+	// 收藏夹里面的内容，0 表示默认收藏夹
+	g.GET("/items/:id", h.Items)
+	g.POST("/items/move", h.MoveItems)
+}
+
+func (h *CollectionHandler) Create(ctx *gin.Context) {
+	type Req struct {
+		Name string `json:"name"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	uc := ctx.MustGet("user").(myjwt.UserClaims)
+	id, err := h.svc.Create(ctx, uc.Uid, req.Name)
+	if msg, ok := collectionErrMsg(err); ok {
+		ctx.JSON(http.StatusOK, Result{Code: 4, Msg: msg})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: 5, Msg: "系统错误"})
+		log.Error("创建收藏夹失败", zap.Int64("uid", uc.Uid), zap.String("name", req.Name), zap.Error(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Data: id})
+}
+
+func (h *CollectionHandler) Rename(ctx *gin.Context) {
+	type Req struct {
+		Id   int64  `json:"id"`
+		Name string `json:"name"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	uc := ctx.MustGet("user").(myjwt.UserClaims)
+	err := h.svc.Rename(ctx, uc.Uid, req.Id, req.Name)
+	if msg, ok := collectionErrMsg(err); ok {
+		ctx.JSON(http.StatusOK, Result{Code: 4, Msg: msg})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: 5, Msg: "系统错误"})
+		log.Error("重命名收藏夹失败", zap.Int64("uid", uc.Uid), zap.Int64("id", req.Id), zap.Error(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Msg: "OK"})
+}
+
+// Delete 删除收藏夹，里面收藏的内容也会被取消收藏
+func (h *CollectionHandler) Delete(ctx *gin.Context) {
+	type Req struct {
+		Id int64 `json:"id"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	uc := ctx.MustGet("user").(myjwt.UserClaims)
+	err := h.svc.Delete(ctx, uc.Uid, req.Id)
+	if msg, ok := collectionErrMsg(err); ok {
+		ctx.JSON(http.StatusOK, Result{Code: 4, Msg: msg})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: 5, Msg: "系统错误"})
+		log.Error("删除收藏夹失败", zap.Int64("uid", uc.Uid), zap.Int64("id", req.Id), zap.Error(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Msg: "OK"})
+}
+
+func (h *CollectionHandler) List(ctx *gin.Context) {
+	uc := ctx.MustGet("user").(myjwt.UserClaims)
+	cs, err := h.svc.List(ctx, uc.Uid)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: 5, Msg: "系统错误"})
+		log.Error("查找收藏夹失败", zap.Int64("uid", uc.Uid), zap.Error(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Data: slice.Map[domain.Collection, CollectionVo](cs, func(idx int, src domain.Collection) CollectionVo {
+		return CollectionVo{
+			Id:      src.Id,
+			Name:    src.Name,
+			ItemCnt: src.ItemCnt,
+			Ctime:   src.Ctime.Format(time.DateTime),
+			Utime:   src.Utime.Format(time.DateTime),
+		}
+	})})
+}
+
+func (h *CollectionHandler) Items(ctx *gin.Context) {
+	idStr := ctx.Param("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Msg: "id 参数错误", Code: 4})
+		return
+	}
+	var page Page
+	if err = ctx.Bind(&page); err != nil {
+		return
+	}
+	if page.Limit <= 0 || page.Limit > 100 {
+		page.Limit = 20
+	}
+	uc := ctx.MustGet("user").(myjwt.UserClaims)
+	items, err := h.svc.ListItems(ctx, uc.Uid, id, page.Offset, page.Limit)
+	if msg, ok := collectionErrMsg(err); ok {
+		ctx.JSON(http.StatusOK, Result{Code: 4, Msg: msg})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: 5, Msg: "系统错误"})
+		log.Error("查找收藏夹内容失败", zap.Int64("uid", uc.Uid), zap.Int64("cid", id), zap.Error(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Data: slice.Map[domain.CollectionItem, CollectionItemVo](items, func(idx int, src domain.CollectionItem) CollectionItemVo {
+		return CollectionItemVo{
+			Biz:   src.Biz,
+			BizId: src.BizId,
+			Cid:   src.Cid,
+			Title: src.Title,
+			Ctime: src.Ctime.Format(time.DateTime),
+		}
+	})})
+}
+
+// MoveItems 把收藏的文章移动到另外一个收藏夹
+func (h *CollectionHandler) MoveItems(ctx *gin.Context) {
+	type Req struct {
+		Ids []int64 `json:"ids"`
+		To  int64   `json:"to"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	uc := ctx.MustGet("user").(myjwt.UserClaims)
+	cnt, err := h.svc.MoveItems(ctx, uc.Uid, articleBiz, req.Ids, req.To)
+	if msg, ok := collectionErrMsg(err); ok {
+		ctx.JSON(http.StatusOK, Result{Code: 4, Msg: msg})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: 5, Msg: "系统错误"})
+		log.Error("移动收藏失败", zap.Int64("uid", uc.Uid), zap.Int64("to", req.To), zap.Error(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Data: cnt})
+}
+
+// collectionErrMsg 收藏夹相关的错误返回给前端的提示
+func collectionErrMsg(err error) (string, bool) {
+	switch {
+	case errors.Is(err, service.ErrCollectionNotFound):
+		return "收藏夹不存在", true
+	case errors.Is(err, service.ErrCollectionDuplicate):
+		return "收藏夹已经存在", true
+	case errors.Is(err, service.ErrInvalidCollectionName):
+		return "收藏夹名字不能为空，长度不能超过 64", true
+	case errors.Is(err, service.ErrInvalidCollectionItems):
+		return "没有要移动的内容", true
+	default:
+		return "", false
+	}
+}
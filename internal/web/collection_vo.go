@@ -0,0 +1,18 @@
+package web
+
+type CollectionVo struct {
+	Id      int64  `json:"id"`
+	Name    string `json:"name"`
+	ItemCnt int64  `json:"itemCnt"`
+	Ctime   string `json:"ctime"`
+	Utime   string `json:"utime"`
+}
+
+// CollectionItemVo 收藏夹里面的一篇文章，撤回的文章 title 为空
+type CollectionItemVo struct {
+	Biz   string `json:"biz"`
+	BizId int64  `json:"bizId"`
+	Cid   int64  `json:"cid"`
+	Title string `json:"title"`
+	Ctime string `json:"ctime"`
+}
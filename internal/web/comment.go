@@ -0,0 +1,192 @@
+package web
+
+import (
+	"errors"
+	"github.com/Tuanzi-bug/tuan-book/internal/domain"
+	"github.com/Tuanzi-bug/tuan-book/internal/service"
+	myjwt "github.com/Tuanzi-bug/tuan-book/internal/web/jwt"
+	"github.com/Tuanzi-bug/tuan-book/pkg/log"
+	"github.com/ecodeclub/ekit/slice"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type CommentHandler struct {
+	svc service.CommentService
+}
+
+func NewCommentHandler(svc service.CommentService) *CommentHandler {
+	return &CommentHandler{svc: svc}
+}
+
+func (h *CommentHandler) RegisterRoutes(server *gin.Engine) {
+	g := server.Group("/comments")
+	g.POST("/create", h.Create)
+	g.POST("/delete", h.Delete)
+	// 某个资源下面的根评论
+	g.GET("/list/:biz/:bizId", h.List)
+	// 某个根评论下面的回复
+	g.GET("/replies/:rootId", h.Replies)
+}
+
+// Create 发表评论，parentId 不为 0 的时候是回复
+func (h *CommentHandler) Create(ctx *gin.Context) {
+	type Req struct {
+		Biz      string `json:"biz"`
+		BizId    int64  `json:"bizId"`
+		ParentId int64  `json:"parentId"`
+		Content  string `json:"content"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	if req.Biz == "" {
+		req.Biz = articleBiz
+	}
+	// 回复的 biz 以被回复的评论为准
+	if req.ParentId == 0 && req.Biz != articleBiz {
+		ctx.JSON(http.StatusOK, Result{Code: 4, Msg: "只能评论文章"})
+		return
+	}
+	uc := ctx.MustGet("user").(myjwt.UserClaims)
+	id, err := h.svc.Create(ctx, domain.Comment{
+		Uid:      uc.Uid,
+		Biz:      req.Biz,
+		BizId:    req.BizId,
+		ParentId: req.ParentId,
+		Content:  req.Content,
+	})
+	switch {
+	case errors.Is(err, service.ErrInvalidComment):
+		ctx.JSON(http.StatusOK, Result{Code: 4, Msg: "评论内容不能为空，长度不能超过 1000"})
+		return
+	case errors.Is(err, service.ErrCommentNotFound):
+		ctx.JSON(http.StatusOK, Result{Code: 4, Msg: "回复的评论不存在"})
+		return
+	case errors.Is(err, service.ErrCommentBizNotSupport):
+		ctx.JSON(http.StatusOK, Result{Code: 4, Msg: "只能评论文章"})
+		return
+	case errors.Is(err, service.ErrCommentArticleNotFound):
+		ctx.JSON(http.StatusOK, Result{Code: 4, Msg: "文章不存在或者没有发表"})
+		return
+	case err != nil:
+		ctx.JSON(http.StatusOK, Result{Code: 5, Msg: "系统错误"})
+		log.Error("发表评论失败", zap.Int64("uid", uc.Uid), zap.String("biz", req.Biz),
+			zap.Int64("bizId", req.BizId), zap.Int64("parentId", req.ParentId), zap.Error(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Data: id})
+}
+
+// Delete 删除自己的评论
+func (h *CommentHandler) Delete(ctx *gin.Context) {
+	type Req struct {
+		Id int64 `json:"id"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	uc := ctx.MustGet("user").(myjwt.UserClaims)
+	err := h.svc.Delete(ctx, uc.Uid, req.Id)
+	switch {
+	case errors.Is(err, service.ErrCommentNotFound):
+		ctx.JSON(http.StatusOK, Result{Code: 4, Msg: "评论不存在"})
+		return
+	case errors.Is(err, service.ErrCommentNoPermission):
+		ctx.JSON(http.StatusOK, Result{Code: 4, Msg: "只能删除自己的评论"})
+		log.Warn("删除别人的评论", zap.Int64("uid", uc.Uid), zap.Int64("id", req.Id))
+		return
+	case err != nil:
+		ctx.JSON(http.StatusOK, Result{Code: 5, Msg: "系统错误"})
+		log.Error("删除评论失败", zap.Int64("uid", uc.Uid), zap.Int64("id", req.Id), zap.Error(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Msg: "OK"})
+}
+
+// List 根评论列表，每条根评论带上最早的几条回复，使用游标分页
+func (h *CommentHandler) List(ctx *gin.Context) {
+	bizIdStr := ctx.Param("bizId")
+	bizId, err := strconv.ParseInt(bizIdStr, 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Msg: "id 参数错误", Code: 4})
+		return
+	}
+	cursor, limit, ok := h.cursorPage(ctx)
+	if !ok {
+		return
+	}
+	biz := ctx.Param("biz")
+	cs, err := h.svc.ListRoots(ctx, biz, bizId, cursor, limit)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: 5, Msg: "系统错误"})
+		log.Error("查找评论失败", zap.String("biz", biz), zap.Int64("bizId", bizId), zap.Error(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Data: h.toCursorVo(cs, limit)})
+}
+
+// Replies 根评论下面的回复，使用游标分页
+func (h *CommentHandler) Replies(ctx *gin.Context) {
+	rootIdStr := ctx.Param("rootId")
+	rootId, err := strconv.ParseInt(rootIdStr, 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Msg: "id 参数错误", Code: 4})
+		return
+	}
+	cursor, limit, ok := h.cursorPage(ctx)
+	if !ok {
+		return
+	}
+	cs, err := h.svc.ListReplies(ctx, rootId, cursor, limit)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: 5, Msg: "系统错误"})
+		log.Error("查找回复失败", zap.Int64("rootId", rootId), zap.Error(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Data: h.toCursorVo(cs, limit)})
+}
+
+func (h *CommentHandler) cursorPage(ctx *gin.Context) (int64, int, bool) {
+	type Req struct {
+		Cursor int64 `form:"cursor"`
+		Limit  int   `form:"limit"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return 0, 0, false
+	}
+	if req.Limit <= 0 || req.Limit > 100 {
+		req.Limit = 20
+	}
+	return req.Cursor, req.Limit, true
+}
+
+func (h *CommentHandler) toCursorVo(cs []domain.Comment, limit int) CommentCursorVo {
+	var next int64
+	// 不满一页说明没有下一页了
+	if len(cs) == limit {
+		next = cs[len(cs)-1].Id
+	}
+	return CommentCursorVo{Cursor: next, Comments: toCommentVos(cs)}
+}
+
+func toCommentVos(cs []domain.Comment) []CommentVo {
+	return slice.Map[domain.Comment, CommentVo](cs, func(idx int, src domain.Comment) CommentVo {
+		return CommentVo{
+			Id:       src.Id,
+			Uid:      src.Uid,
+			Content:  src.Content,
+			RootId:   src.RootId,
+			ParentId: src.ParentId,
+			ReplyCnt: src.ReplyCnt,
+			Replies:  toCommentVos(src.Replies),
+			Ctime:    src.Ctime.Format(time.DateTime),
+		}
+	})
+}
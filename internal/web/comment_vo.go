@@ -0,0 +1,18 @@
+package web
+
+type CommentVo struct {
+	Id       int64       `json:"id"`
+	Uid      int64       `json:"uid"`
+	Content  string      `json:"content"`
+	RootId   int64       `json:"rootId"`
+	ParentId int64       `json:"parentId"`
+	ReplyCnt int64       `json:"replyCnt"`
+	Replies  []CommentVo `json:"replies,omitempty"`
+	Ctime    string      `json:"ctime"`
+}
+
+// CommentCursorVo 游标分页的评论列表，cursor 为 0 表示没有下一页
+type CommentCursorVo struct {
+	Cursor   int64       `json:"cursor"`
+	Comments []CommentVo `json:"comments"`
+}
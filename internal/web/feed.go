@@ -0,0 +1,96 @@
+package web
+
+import (
+	"errors"
+	"github.com/Tuanzi-bug/tuan-book/internal/domain"
+	"github.com/Tuanzi-bug/tuan-book/internal/service"
+	myjwt "github.com/Tuanzi-bug/tuan-book/internal/web/jwt"
+	"github.com/Tuanzi-bug/tuan-book/pkg/log"
+	"github.com/ecodeclub/ekit/slice"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type FeedHandler struct {
+	svc service.FeedService
+}
+
+func NewFeedHandler(svc service.FeedService) *FeedHandler {
+	return &FeedHandler{svc: svc}
+}
+
+func (h *FeedHandler) RegisterRoutes(server *gin.Engine) {
+	server.GET("/feed", h.List)
+}
+
+// List 关注的作者发表的文章，按照发表时间倒序，使用游标分页
+func (h *FeedHandler) List(ctx *gin.Context) {
+	type Req struct {
+		Cursor string `form:"cursor"`
+		Limit  int    `form:"limit"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	if req.Limit <= 0 || req.Limit > 100 {
+		req.Limit = 20
+	}
+	cursor, err := parseFeedCursor(req.Cursor)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: 4, Msg: "游标不对"})
+		return
+	}
+	uc := ctx.MustGet("user").(myjwt.UserClaims)
+	arts, next, err := h.svc.ListFeed(ctx, uc.Uid, cursor, req.Limit)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: 5, Msg: "系统错误"})
+		log.Error("获取关注动态失败", zap.Int64("uid", uc.Uid), zap.String("cursor", req.Cursor), zap.Error(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Data: FeedVo{
+		Cursor: formatFeedCursor(next),
+		Articles: slice.Map[domain.Article, ArticleVo](arts, func(idx int, src domain.Article) ArticleVo {
+			return ArticleVo{
+				Id:       src.Id,
+				Title:    src.Title,
+				Abstract: src.Abstract(),
+				AuthorId: src.Author.Id,
+				Ctime:    src.Ctime.Format(time.DateTime),
+				Utime:    src.Utime.Format(time.DateTime),
+			}
+		}),
+	}})
+}
+
+// formatFeedCursor 游标是 "发表时间_文章id"，零值返回空字符串表示没有下一页
+func formatFeedCursor(c domain.FeedCursor) string {
+	if c.IsZero() {
+		return ""
+	}
+	return strconv.FormatInt(c.Ctime.UnixMilli(), 10) + "_" + strconv.FormatInt(c.Aid, 10)
+}
+
+// parseFeedCursor 空字符串表示第一页
+func parseFeedCursor(s string) (domain.FeedCursor, error) {
+	if s == "" {
+		return domain.FeedCursor{}, nil
+	}
+	ctime, aid, ok := strings.Cut(s, "_")
+	if !ok {
+		return domain.FeedCursor{}, errors.New("游标格式不对")
+	}
+	ms, err := strconv.ParseInt(ctime, 10, 64)
+	if err != nil {
+		return domain.FeedCursor{}, err
+	}
+	id, err := strconv.ParseInt(aid, 10, 64)
+	if err != nil {
+		return domain.FeedCursor{}, err
+	}
+	return domain.FeedCursor{Ctime: time.UnixMilli(ms), Aid: id}, nil
+}
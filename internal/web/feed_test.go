@@ -0,0 +1,29 @@
+package web
+
+import (
+	"github.com/Tuanzi-bug/tuan-book/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestFeedCursor(t *testing.T) {
+	c := domain.FeedCursor{Ctime: time.UnixMilli(1700000000123), Aid: 42}
+	s := formatFeedCursor(c)
+	assert.Equal(t, "1700000000123_42", s)
+	got, err := parseFeedCursor(s)
+	assert.NoError(t, err)
+	assert.True(t, c.Ctime.Equal(got.Ctime))
+	assert.Equal(t, c.Aid, got.Aid)
+
+	// 第一页和最后一页
+	assert.Equal(t, "", formatFeedCursor(domain.FeedCursor{}))
+	got, err = parseFeedCursor("")
+	assert.NoError(t, err)
+	assert.True(t, got.IsZero())
+
+	for _, bad := range []string{"1700000000123", "abc_1", "1_abc"} {
+		_, err = parseFeedCursor(bad)
+		assert.Error(t, err, bad)
+	}
+}
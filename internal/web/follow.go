@@ -0,0 +1,188 @@
+package web
+
+import (
+	"errors"
+	"github.com/Tuanzi-bug/tuan-book/internal/domain"
+	"github.com/Tuanzi-bug/tuan-book/internal/service"
+	myjwt "github.com/Tuanzi-bug/tuan-book/internal/web/jwt"
+	"github.com/Tuanzi-bug/tuan-book/pkg/log"
+	"github.com/ecodeclub/ekit/slice"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type FollowHandler struct {
+	svc service.FollowService
+}
+
+func NewFollowHandler(svc service.FollowService) *FollowHandler {
+	return &FollowHandler{svc: svc}
+}
+
+func (h *FollowHandler) RegisterRoutes(server *gin.Engine) {
+	g := server.Group("/follows")
+	g.POST("/follow", h.Follow)
+	g.POST("/cancel", h.Cancel)
+	// 某个用户的粉丝
+	g.GET("/followers/:uid", h.Followers)
+	// 某个用户关注的人
+	g.GET("/followees/:uid", h.Followees)
+	g.GET("/statistic/:uid", h.Statistic)
+}
+
+// Follow 关注，重复关注直接返回成功
+func (h *FollowHandler) Follow(ctx *gin.Context) {
+	type Req struct {
+		Followee int64 `json:"followee"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	uc := ctx.MustGet("user").(myjwt.UserClaims)
+	err := h.svc.Follow(ctx, uc.Uid, req.Followee)
+	switch {
+	case errors.Is(err, service.ErrFollowSelf):
+		ctx.JSON(http.StatusOK, Result{Code: 4, Msg: "不能关注自己"})
+		return
+	case errors.Is(err, service.ErrUserNotFound):
+		ctx.JSON(http.StatusOK, Result{Code: 4, Msg: "用户不存在"})
+		return
+	case err != nil:
+		ctx.JSON(http.StatusOK, Result{Code: 5, Msg: "系统错误"})
+		log.Error("关注失败", zap.Int64("follower", uc.Uid), zap.Int64("followee", req.Followee), zap.Error(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Msg: "OK"})
+}
+
+// Cancel 取消关注
+func (h *FollowHandler) Cancel(ctx *gin.Context) {
+	type Req struct {
+		Followee int64 `json:"followee"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	uc := ctx.MustGet("user").(myjwt.UserClaims)
+	err := h.svc.Unfollow(ctx, uc.Uid, req.Followee)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: 5, Msg: "系统错误"})
+		log.Error("取消关注失败", zap.Int64("follower", uc.Uid), zap.Int64("followee", req.Followee), zap.Error(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Msg: "OK"})
+}
+
+// Followers 粉丝列表，使用游标分页
+func (h *FollowHandler) Followers(ctx *gin.Context) {
+	uid, cursor, limit, ok := h.listParams(ctx)
+	if !ok {
+		return
+	}
+	rels, err := h.svc.ListFollowers(ctx, uid, cursor, limit)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: 5, Msg: "系统错误"})
+		log.Error("查找粉丝失败", zap.Int64("uid", uid), zap.Error(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Data: h.toCursorVo(rels, limit, func(rel domain.FollowRelation) int64 {
+		return rel.Follower
+	})})
+}
+
+// Followees 关注列表，使用游标分页
+func (h *FollowHandler) Followees(ctx *gin.Context) {
+	uid, cursor, limit, ok := h.listParams(ctx)
+	if !ok {
+		return
+	}
+	rels, err := h.svc.ListFollowees(ctx, uid, cursor, limit)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: 5, Msg: "系统错误"})
+		log.Error("查找关注失败", zap.Int64("uid", uid), zap.Error(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Data: h.toCursorVo(rels, limit, func(rel domain.FollowRelation) int64 {
+		return rel.Followee
+	})})
+}
+
+// Statistic 粉丝数、关注数，以及当前用户有没有关注他
+func (h *FollowHandler) Statistic(ctx *gin.Context) {
+	uidStr := ctx.Param("uid")
+	uid, err := strconv.ParseInt(uidStr, 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Msg: "id 参数错误", Code: 4})
+		return
+	}
+	uc := ctx.MustGet("user").(myjwt.UserClaims)
+	var (
+		eg       errgroup.Group
+		s        domain.FollowStatistic
+		followed bool
+	)
+	eg.Go(func() error {
+		var er error
+		s, er = h.svc.GetStatistic(ctx, uid)
+		return er
+	})
+	eg.Go(func() error {
+		var er error
+		followed, er = h.svc.Followed(ctx, uc.Uid, uid)
+		return er
+	})
+	if err = eg.Wait(); err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: 5, Msg: "系统错误"})
+		log.Error("获取关注数据失败", zap.Int64("uid", uid), zap.Error(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Data: FollowStatisticVo{
+		Uid:       uid,
+		Followers: s.Followers,
+		Followees: s.Followees,
+		Followed:  followed,
+	}})
+}
+
+func (h *FollowHandler) listParams(ctx *gin.Context) (int64, int64, int, bool) {
+	type Req struct {
+		Cursor int64 `form:"cursor"`
+		Limit  int   `form:"limit"`
+	}
+	uidStr := ctx.Param("uid")
+	uid, err := strconv.ParseInt(uidStr, 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Msg: "id 参数错误", Code: 4})
+		return 0, 0, 0, false
+	}
+	var req Req
+	if err = ctx.Bind(&req); err != nil {
+		return 0, 0, 0, false
+	}
+	if req.Limit <= 0 || req.Limit > 100 {
+		req.Limit = 20
+	}
+	return uid, req.Cursor, req.Limit, true
+}
+
+// toCursorVo user 决定列表里面展示关系的哪一方
+func (h *FollowHandler) toCursorVo(rels []domain.FollowRelation, limit int,
+	user func(rel domain.FollowRelation) int64) FollowCursorVo {
+	var next int64
+	// 不满一页说明没有下一页了
+	if len(rels) == limit {
+		next = rels[len(rels)-1].Id
+	}
+	return FollowCursorVo{
+		Cursor: next,
+		Users: slice.Map[domain.FollowRelation, FollowUserVo](rels, func(idx int, src domain.FollowRelation) FollowUserVo {
+			return FollowUserVo{Uid: user(src), Ctime: src.Ctime.Format(time.DateTime)}
+		}),
+	}
+}
@@ -0,0 +1,21 @@
+package web
+
+// FollowUserVo 列表中的一个用户以及关注时间
+type FollowUserVo struct {
+	Uid   int64  `json:"uid"`
+	Ctime string `json:"ctime"`
+}
+
+// FollowCursorVo 游标分页的粉丝或者关注列表，cursor 为 0 表示没有下一页
+type FollowCursorVo struct {
+	Cursor int64          `json:"cursor"`
+	Users  []FollowUserVo `json:"users"`
+}
+
+type FollowStatisticVo struct {
+	Uid       int64 `json:"uid"`
+	Followers int64 `json:"followers"`
+	Followees int64 `json:"followees"`
+	// 当前用户是否关注了他
+	Followed bool `json:"followed"`
+}
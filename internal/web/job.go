@@ -0,0 +1,237 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"github.com/Tuanzi-bug/tuan-book/internal/domain"
+	"github.com/Tuanzi-bug/tuan-book/internal/service"
+	"github.com/Tuanzi-bug/tuan-book/internal/web/middleware"
+	"github.com/Tuanzi-bug/tuan-book/pkg/log"
+	"github.com/ecodeclub/ekit/slice"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+)
+
+// JobHandler 管理分布式任务，只有管理员可以访问
+type JobHandler struct {
+	svc   service.CronJobService
+	admin *middleware.AdminMiddlewareBuilder
+}
+
+func NewJobHandler(svc service.CronJobService, admin *middleware.AdminMiddlewareBuilder) *JobHandler {
+	return &JobHandler{svc: svc, admin: admin}
+}
+
+func (h *JobHandler) RegisterRoutes(server *gin.Engine) {
+	g := server.Group("/admin/jobs", h.admin.Build())
+	g.POST("/create", h.Create)
+	g.GET("/list", h.List)
+	// 修改表达式和配置
+	g.POST("/update", h.Update)
+	g.POST("/pause", h.Pause)
+	g.POST("/resume", h.Resume)
+	// 马上执行一次
+	g.POST("/trigger", h.Trigger)
+	g.POST("/delete", h.Delete)
+	// 修改重试策略
+	g.POST("/retry", h.UpdateRetryPolicy)
+	// 执行记录
+	g.GET("/runs", h.Runs)
+}
+
+func (h *JobHandler) Create(ctx *gin.Context) {
+	type Req struct {
+		Name       string `json:"name"`
+		Executor   string `json:"executor"`
+		Expression string `json:"expression"`
+		Cfg        string `json:"cfg"`
+		// 下面两个不传就使用默认的重试策略，backoff 的单位是毫秒
+		MaxAttempts int   `json:"maxAttempts"`
+		Backoff     int64 `json:"backoff"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	id, err := h.svc.Create(ctx, domain.Job{
+		Name:        req.Name,
+		Executor:    req.Executor,
+		Expression:  req.Expression,
+		Cfg:         req.Cfg,
+		MaxAttempts: req.MaxAttempts,
+		Backoff:     time.Duration(req.Backoff) * time.Millisecond,
+	})
+	if msg, ok := jobErrMsg(err); ok {
+		ctx.JSON(http.StatusOK, Result{Code: 4, Msg: msg})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: 5, Msg: "系统错误"})
+		log.Error("创建任务失败", zap.String("name", req.Name), zap.Error(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Data: id})
+}
+
+func (h *JobHandler) List(ctx *gin.Context) {
+	var page Page
+	if err := ctx.Bind(&page); err != nil {
+		return
+	}
+	if page.Limit <= 0 || page.Limit > 100 {
+		page.Limit = 20
+	}
+	js, err := h.svc.List(ctx, page.Offset, page.Limit)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: 5, Msg: "系统错误"})
+		log.Error("查找任务失败", zap.Error(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Data: slice.Map[domain.Job, JobVo](js, func(idx int, src domain.Job) JobVo {
+		return JobVo{
+			Id:          src.Id,
+			Name:        src.Name,
+			Executor:    src.Executor,
+			Expression:  src.Expression,
+			Cfg:         src.Cfg,
+			MaxAttempts: src.MaxAttempts,
+			Backoff:     src.Backoff.Milliseconds(),
+			Failures:    src.Failures,
+			Status:      uint8(src.Status),
+			Owner:       src.Owner,
+			NextTime:    src.NextExecTime.Format(time.DateTime),
+			Ctime:       src.Ctime.Format(time.DateTime),
+			Utime:       src.Utime.Format(time.DateTime),
+		}
+	})})
+}
+
+func (h *JobHandler) Update(ctx *gin.Context) {
+	type Req struct {
+		Id         int64  `json:"id"`
+		Expression string `json:"expression"`
+		Cfg        string `json:"cfg"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	err := h.svc.UpdateSchedule(ctx, req.Id, req.Expression, req.Cfg)
+	h.result(ctx, "修改任务失败", req.Id, err)
+}
+
+func (h *JobHandler) UpdateRetryPolicy(ctx *gin.Context) {
+	type Req struct {
+		Id          int64 `json:"id"`
+		MaxAttempts int   `json:"maxAttempts"`
+		Backoff     int64 `json:"backoff"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	err := h.svc.UpdateRetryPolicy(ctx, req.Id, req.MaxAttempts, time.Duration(req.Backoff)*time.Millisecond)
+	h.result(ctx, "修改重试策略失败", req.Id, err)
+}
+
+func (h *JobHandler) Runs(ctx *gin.Context) {
+	type Req struct {
+		Id int64 `form:"id"`
+		Page
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	if req.Limit <= 0 || req.Limit > 100 {
+		req.Limit = 20
+	}
+	rs, err := h.svc.ListRuns(ctx, req.Id, req.Offset, req.Limit)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: 5, Msg: "系统错误"})
+		log.Error("查找任务执行记录失败", zap.Int64("id", req.Id), zap.Error(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Data: slice.Map[domain.JobRun, JobRunVo](rs, func(idx int, src domain.JobRun) JobRunVo {
+		vo := JobRunVo{
+			Id:        src.Id,
+			Node:      src.Node,
+			Status:    uint8(src.Status),
+			Attempt:   src.Attempt,
+			Err:       src.Err,
+			StartTime: src.StartTime.Format(time.DateTime),
+		}
+		if !src.EndTime.IsZero() {
+			vo.EndTime = src.EndTime.Format(time.DateTime)
+			vo.Duration = src.EndTime.Sub(src.StartTime).Milliseconds()
+		}
+		return vo
+	})})
+}
+
+func (h *JobHandler) Pause(ctx *gin.Context) {
+	h.byId(ctx, "暂停任务失败", h.svc.Pause)
+}
+
+func (h *JobHandler) Resume(ctx *gin.Context) {
+	h.byId(ctx, "恢复任务失败", h.svc.Resume)
+}
+
+func (h *JobHandler) Trigger(ctx *gin.Context) {
+	h.byId(ctx, "触发任务失败", h.svc.Trigger)
+}
+
+func (h *JobHandler) Delete(ctx *gin.Context) {
+	h.byId(ctx, "删除任务失败", h.svc.Delete)
+}
+
+// byId 只需要任务 id 的操作
+func (h *JobHandler) byId(ctx *gin.Context, errLog string, fn func(ctx context.Context, id int64) error) {
+	type Req struct {
+		Id int64 `json:"id"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	h.result(ctx, errLog, req.Id, fn(ctx, req.Id))
+}
+
+func (h *JobHandler) result(ctx *gin.Context, errLog string, id int64, err error) {
+	if msg, ok := jobErrMsg(err); ok {
+		ctx.JSON(http.StatusOK, Result{Code: 4, Msg: msg})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: 5, Msg: "系统错误"})
+		log.Error(errLog, zap.Int64("id", id), zap.Error(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Msg: "OK"})
+}
+
+// jobErrMsg 任务相关的错误返回给前端的提示
+func jobErrMsg(err error) (string, bool) {
+	switch {
+	case errors.Is(err, service.ErrJobNotFound):
+		return "任务不存在", true
+	case errors.Is(err, service.ErrJobDuplicate):
+		return "任务已经存在", true
+	case errors.Is(err, service.ErrJobPaused):
+		return "任务已经暂停，请先恢复", true
+	case errors.Is(err, service.ErrJobFailed):
+		return "任务连续失败太多次，请先恢复", true
+	case errors.Is(err, service.ErrJobRunning):
+		return "任务正在执行，请稍后再试", true
+	case errors.Is(err, service.ErrInvalidRetryPolicy):
+		return "重试次数和重试间隔不能为负数", true
+	case errors.Is(err, service.ErrInvalidJob):
+		return "任务名字和执行器不能为空", true
+	case errors.Is(err, service.ErrInvalidJobExpression):
+		return "cron 表达式不合法", true
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,34 @@
+package web
+
+type JobVo struct {
+	Id         int64  `json:"id"`
+	Name       string `json:"name"`
+	Executor   string `json:"executor"`
+	Expression string `json:"expression"`
+	Cfg        string `json:"cfg"`
+	// MaxAttempts 和 Backoff 为 0 表示使用默认的重试策略，Backoff 的单位是毫秒
+	MaxAttempts int   `json:"maxAttempts"`
+	Backoff     int64 `json:"backoff"`
+	// Failures 连续失败的次数
+	Failures int `json:"failures"`
+	// Status 0 等待调度，1 正在执行，2 暂停，3 连续失败太多次
+	Status uint8 `json:"status"`
+	// Owner 正在执行这个任务的节点
+	Owner    string `json:"owner"`
+	NextTime string `json:"nextTime"`
+	Ctime    string `json:"ctime"`
+	Utime    string `json:"utime"`
+}
+
+type JobRunVo struct {
+	Id   int64  `json:"id"`
+	Node string `json:"node"`
+	// Status 1 正在执行，2 成功，3 失败
+	Status  uint8  `json:"status"`
+	Attempt int    `json:"attempt"`
+	Err     string `json:"err"`
+	// EndTime 和 Duration 只有执行完之后才有，Duration 的单位是毫秒
+	StartTime string `json:"startTime"`
+	EndTime   string `json:"endTime"`
+	Duration  int64  `json:"duration"`
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	myjwt "github.com/Tuanzi-bug/tuan-book/internal/web/jwt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// AdminMiddlewareBuilder 管理后台的接口只允许配置的用户访问，挂在管理后台的路由分组上，
+// 全局的 JWT 中间件已经在前面执行过了
+type AdminMiddlewareBuilder struct {
+	uids map[int64]struct{}
+}
+
+func NewAdminMiddlewareBuilder(uids []int64) *AdminMiddlewareBuilder {
+	m := &AdminMiddlewareBuilder{
+		uids: make(map[int64]struct{}, len(uids)),
+	}
+	for _, uid := range uids {
+		m.uids[uid] = struct{}{}
+	}
+	return m
+}
+
+func (m *AdminMiddlewareBuilder) Build() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		val, ok := ctx.Get("user")
+		if !ok {
+			ctx.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		uc, ok := val.(myjwt.UserClaims)
+		if !ok {
+			ctx.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		if _, ok = m.uids[uc.Uid]; !ok {
+			ctx.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		ctx.Next()
+	}
+}
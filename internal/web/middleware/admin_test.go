@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	myjwt "github.com/Tuanzi-bug/tuan-book/internal/web/jwt"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdminMiddlewareBuilder(t *testing.T) {
+	testCases := []struct {
+		name string
+
+		// 模拟 JWT 中间件设置的用户信息
+		user any
+
+		wantCode int
+	}{
+		{
+			name:     "管理员",
+			user:     myjwt.UserClaims{Uid: 1},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "不是管理员",
+			user:     myjwt.UserClaims{Uid: 2},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "没有登录信息",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "登录信息类型不对",
+			user:     "1",
+			wantCode: http.StatusUnauthorized,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := gin.New()
+			server.Use(func(ctx *gin.Context) {
+				if tc.user != nil {
+					ctx.Set("user", tc.user)
+				}
+			})
+			g := server.Group("/admin", NewAdminMiddlewareBuilder([]int64{1}).Build())
+			g.GET("/jobs", func(ctx *gin.Context) {
+				ctx.String(http.StatusOK, "ok")
+			})
+
+			req, err := http.NewRequest(http.MethodGet, "/admin/jobs", nil)
+			assert.NoError(t, err)
+			resp := httptest.NewRecorder()
+			server.ServeHTTP(resp, req)
+			assert.Equal(t, tc.wantCode, resp.Code)
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"github.com/Tuanzi-bug/tuan-book/pkg/trace"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// TraceMiddlewareBuilder 沿用调用方传过来的链路 id，没有的话生成一个，并且在响应里面返回。
+// 链路 id 放在 Request 的 context 里面，需要打开 gin.Engine 的 ContextWithFallback，
+// 下游拿 *gin.Context 当 context.Context 用的时候才能取到
+type TraceMiddlewareBuilder struct {
+	header string
+}
+
+func NewTraceMiddlewareBuilder() *TraceMiddlewareBuilder {
+	return &TraceMiddlewareBuilder{header: trace.Header}
+}
+
+func (m *TraceMiddlewareBuilder) Build() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.GetHeader(m.header)
+		if id == "" {
+			id = uuid.New().String()
+		}
+		ctx.Request = ctx.Request.WithContext(trace.WithId(ctx.Request.Context(), id))
+		ctx.Header(m.header, id)
+		ctx.Next()
+	}
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"github.com/Tuanzi-bug/tuan-book/pkg/trace"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTraceMiddlewareBuilder(t *testing.T) {
+	testCases := []struct {
+		name string
+
+		traceId string
+
+		wantGenerated bool
+	}{
+		{
+			name:    "沿用调用方的链路 id",
+			traceId: "abc",
+		},
+		{
+			name:          "生成链路 id",
+			wantGenerated: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := gin.New()
+			server.ContextWithFallback = true
+			server.Use(NewTraceMiddlewareBuilder().Build())
+			var got string
+			server.GET("/test", func(ctx *gin.Context) {
+				// 和业务代码一样，直接把 *gin.Context 当 context.Context 用
+				got = trace.IdFromContext(ctx)
+			})
+
+			req, err := http.NewRequest(http.MethodGet, "/test", nil)
+			assert.NoError(t, err)
+			if tc.traceId != "" {
+				req.Header.Set(trace.Header, tc.traceId)
+			}
+			resp := httptest.NewRecorder()
+			server.ServeHTTP(resp, req)
+			assert.Equal(t, got, resp.Header().Get(trace.Header))
+			if tc.wantGenerated {
+				assert.NotEmpty(t, got)
+				return
+			}
+			assert.Equal(t, tc.traceId, got)
+		})
+	}
+}
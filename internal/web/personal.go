@@ -0,0 +1,153 @@
+package web
+
+import (
+	"github.com/Tuanzi-bug/tuan-book/internal/domain"
+	"github.com/Tuanzi-bug/tuan-book/internal/service"
+	myjwt "github.com/Tuanzi-bug/tuan-book/internal/web/jwt"
+	"github.com/Tuanzi-bug/tuan-book/pkg/log"
+	"github.com/ecodeclub/ekit/slice"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+)
+
+// PersonalHandler 个人主页上和自己相关的文章列表：我的点赞、阅读历史
+type PersonalHandler struct {
+	artSvc     service.ArticleService
+	intrSvc    service.InteractiveService
+	historySvc service.ReadHistoryService
+}
+
+func NewPersonalHandler(artSvc service.ArticleService, intrSvc service.InteractiveService,
+	historySvc service.ReadHistoryService) *PersonalHandler {
+	return &PersonalHandler{
+		artSvc:     artSvc,
+		intrSvc:    intrSvc,
+		historySvc: historySvc,
+	}
+}
+
+func (h *PersonalHandler) RegisterRoutes(server *gin.Engine) {
+	g := server.Group("/users/me")
+	g.GET("/likes", h.Likes)
+	g.GET("/history", h.History)
+	g.POST("/history/clear", h.ClearHistory)
+}
+
+// Likes 点赞过的文章，按照点赞时间倒序，使用游标分页
+func (h *PersonalHandler) Likes(ctx *gin.Context) {
+	cursor, limit, ok := h.cursorPage(ctx)
+	if !ok {
+		return
+	}
+	uc := ctx.MustGet("user").(myjwt.UserClaims)
+	likes, err := h.intrSvc.ListLikes(ctx, articleBiz, uc.Uid, cursor, limit)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: 5, Msg: "系统错误"})
+		log.Error("查找点赞记录失败", zap.Int64("uid", uc.Uid), zap.Error(err))
+		return
+	}
+	var next int64
+	// 不满一页说明没有下一页了
+	if len(likes) == limit {
+		next = likes[len(likes)-1].Utime.UnixMilli()
+	}
+	ids := slice.Map[domain.LikeRecord, int64](likes, func(idx int, src domain.LikeRecord) int64 {
+		return src.BizId
+	})
+	arts, err := h.articles(ctx, ids)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: 5, Msg: "系统错误"})
+		log.Error("查找点赞过的文章失败", zap.Int64("uid", uc.Uid), zap.Error(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Data: ArticleCursorVo{Cursor: next, Articles: arts}})
+}
+
+// History 阅读历史，按照阅读时间倒序，使用游标分页
+func (h *PersonalHandler) History(ctx *gin.Context) {
+	cursor, limit, ok := h.cursorPage(ctx)
+	if !ok {
+		return
+	}
+	uc := ctx.MustGet("user").(myjwt.UserClaims)
+	records, err := h.historySvc.List(ctx, uc.Uid, cursor, limit)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: 5, Msg: "系统错误"})
+		log.Error("查找阅读历史失败", zap.Int64("uid", uc.Uid), zap.Error(err))
+		return
+	}
+	var next int64
+	if len(records) == limit {
+		next = records[len(records)-1].Ctime.UnixMilli()
+	}
+	ids := slice.Map[domain.ReadRecord, int64](records, func(idx int, src domain.ReadRecord) int64 {
+		return src.Aid
+	})
+	arts, err := h.articles(ctx, ids)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: 5, Msg: "系统错误"})
+		log.Error("查找阅读过的文章失败", zap.Int64("uid", uc.Uid), zap.Error(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Data: ArticleCursorVo{Cursor: next, Articles: arts}})
+}
+
+// ClearHistory 清空阅读历史
+func (h *PersonalHandler) ClearHistory(ctx *gin.Context) {
+	uc := ctx.MustGet("user").(myjwt.UserClaims)
+	err := h.historySvc.Clear(ctx, uc.Uid)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: 5, Msg: "系统错误"})
+		log.Error("清空阅读历史失败", zap.Int64("uid", uc.Uid), zap.Error(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Msg: "OK"})
+}
+
+// articles 按照 ids 的顺序返回线上库的文章，已经撤回的跳过
+func (h *PersonalHandler) articles(ctx *gin.Context, ids []int64) ([]ArticleVo, error) {
+	if len(ids) == 0 {
+		return []ArticleVo{}, nil
+	}
+	arts, err := h.artSvc.GetPubByIds(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	artMap := make(map[int64]domain.Article, len(arts))
+	for _, art := range arts {
+		artMap[art.Id] = art
+	}
+	res := make([]ArticleVo, 0, len(ids))
+	for _, id := range ids {
+		art, ok := artMap[id]
+		if !ok {
+			continue
+		}
+		res = append(res, ArticleVo{
+			Id:       art.Id,
+			Title:    art.Title,
+			Abstract: art.Abstract(),
+			AuthorId: art.Author.Id,
+			Ctime:    art.Ctime.Format(time.DateTime),
+			Utime:    art.Utime.Format(time.DateTime),
+		})
+	}
+	return res, nil
+}
+
+func (h *PersonalHandler) cursorPage(ctx *gin.Context) (int64, int, bool) {
+	type Req struct {
+		Cursor int64 `form:"cursor"`
+		Limit  int   `form:"limit"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return 0, 0, false
+	}
+	if req.Limit <= 0 || req.Limit > 100 {
+		req.Limit = 20
+	}
+	return req.Cursor, req.Limit, true
+}
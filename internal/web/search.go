@@ -0,0 +1,62 @@
+package web
+
+import (
+	"github.com/Tuanzi-bug/tuan-book/internal/domain"
+	"github.com/Tuanzi-bug/tuan-book/internal/service"
+	"github.com/Tuanzi-bug/tuan-book/pkg/log"
+	"github.com/ecodeclub/ekit/slice"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+)
+
+type SearchHandler struct {
+	svc service.SearchService
+}
+
+func NewSearchHandler(svc service.SearchService) *SearchHandler {
+	return &SearchHandler{svc: svc}
+}
+
+func (h *SearchHandler) RegisterRoutes(server *gin.Engine) {
+	server.GET("/articles/search", h.SearchArticle)
+}
+
+// SearchArticle 搜索已发表的文章，标题和摘要中命中的部分用 <em> 标签包起来
+func (h *SearchHandler) SearchArticle(ctx *gin.Context) {
+	type Req struct {
+		Query  string `form:"q"`
+		Offset int    `form:"offset"`
+		Limit  int    `form:"limit"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	if req.Limit <= 0 || req.Limit > 100 {
+		req.Limit = 10
+	}
+	if req.Offset < 0 {
+		req.Offset = 0
+	}
+	hits, total, err := h.svc.SearchArticle(ctx, req.Query, req.Offset, req.Limit)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{Code: 5, Msg: "系统错误"})
+		log.Error("搜索文章失败", zap.String("query", req.Query), zap.Error(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{Data: ArticleSearchVo{
+		Total: total,
+		Articles: slice.Map[domain.ArticleSearchHit, ArticleVo](hits, func(idx int, src domain.ArticleSearchHit) ArticleVo {
+			return ArticleVo{
+				Id:       src.Article.Id,
+				Title:    src.TitleHighlight,
+				Abstract: src.ContentHighlight,
+				AuthorId: src.Article.Author.Id,
+				Ctime:    src.Article.Ctime.Format(time.DateTime),
+				Utime:    src.Article.Utime.Format(time.DateTime),
+			}
+		}),
+	}})
+}
@@ -60,7 +60,10 @@ func InitDB() *gorm.DB {
 		panic(err)
 	}
 
-	err = db.AutoMigrate(&dao.User{}, &dao.Article{}, &dao.PublishedArticle{}, &dao.Interactive{}, &dao.UserLikeBiz{}, &dao.UserCollectionBiz{}, &dao.Job{})
+	err = db.AutoMigrate(&dao.User{}, &dao.Article{}, &dao.PublishedArticle{}, &dao.Interactive{}, &dao.UserLikeBiz{}, &dao.UserCollectionBiz{}, &dao.Job{},
+		&dao.ArticleRevision{}, &dao.Tag{}, &dao.ArticleTag{}, &dao.PublishedArticleTag{}, &dao.Comment{},
+		&dao.FollowRelation{}, &dao.FollowStatistic{}, &dao.FeedInbox{}, &dao.Collection{}, &dao.DailyReader{},
+		&dao.OutboxMessage{}, &dao.JobRun{})
 	if err != nil {
 		panic(err)
 	}
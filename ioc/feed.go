@@ -0,0 +1,27 @@
+package ioc
+
+import (
+	"github.com/IBM/sarama"
+	"github.com/Tuanzi-bug/tuan-book/internal/events/article"
+	"github.com/Tuanzi-bug/tuan-book/internal/repository"
+	"github.com/Tuanzi-bug/tuan-book/internal/service"
+	"github.com/Tuanzi-bug/tuan-book/pkg/saramax"
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/viper"
+)
+
+func InitFeedService(repo repository.FeedRepository, followRepo repository.FollowRepository,
+	artRepo repository.ArticleRepository) service.FeedService {
+	// 粉丝数达到阈值的作者改成读的时候拉，避免一次发表写太多收件箱
+	threshold := viper.GetInt64("feed.pushThreshold")
+	if threshold <= 0 {
+		threshold = 1000
+	}
+	return service.NewFeedService(repo, followRepo, artRepo, threshold)
+}
+
+func InitFeedEventConsumer(broker saramax.Broker, producer sarama.SyncProducer, client redis.Cmdable,
+	svc service.FeedService) *article.FeedEventConsumer {
+	// 消费者组的名字和 FeedEventConsumer 里面的保持一致
+	return article.NewFeedEventConsumer(broker, svc, initRetrier(producer, "feed"), initDeduplicator(client, "feed"))
+}
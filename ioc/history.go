@@ -0,0 +1,30 @@
+package ioc
+
+import (
+	"github.com/Tuanzi-bug/tuan-book/internal/events/article"
+	"github.com/Tuanzi-bug/tuan-book/internal/repository/cache"
+	"github.com/Tuanzi-bug/tuan-book/internal/service"
+	"github.com/Tuanzi-bug/tuan-book/pkg/saramax"
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/viper"
+	"time"
+)
+
+func InitReadHistoryCache(client redis.Cmdable) cache.ReadHistoryCache {
+	type Config struct {
+		// 每个用户最多保留多少条阅读记录
+		Capacity int64 `yaml:"capacity"`
+		// 阅读记录保留多长时间
+		Retention time.Duration `yaml:"retention"`
+	}
+	cfg := Config{Capacity: 1000, Retention: time.Hour * 24 * 90}
+	err := viper.UnmarshalKey("history", &cfg)
+	if err != nil {
+		panic(err)
+	}
+	return cache.NewReadHistoryRedisCache(client, cfg.Capacity, cfg.Retention)
+}
+
+func InitReadHistoryConsumer(broker saramax.Broker, svc service.ReadHistoryService) *article.ReadHistoryConsumer {
+	return article.NewReadHistoryConsumer(broker, svc)
+}
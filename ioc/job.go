@@ -1,19 +1,19 @@
 package ioc
 
 import (
+	"context"
+	"github.com/Tuanzi-bug/tuan-book/internal/domain"
 	"github.com/Tuanzi-bug/tuan-book/internal/job"
+	"github.com/Tuanzi-bug/tuan-book/internal/repository"
 	"github.com/Tuanzi-bug/tuan-book/internal/service"
 	rlock "github.com/gotomicro/redis-lock"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/robfig/cron/v3"
+	"github.com/spf13/viper"
 	"time"
 )
 
-func InitRankingJob(service service.RankingService, client *rlock.Client) job.Job {
-	return job.NewRankingJob(service, time.Second*30, client)
-}
-
-func InitJobs(rankingJob job.Job) *cron.Cron {
+func InitJobs(svc service.RankingService, client *rlock.Client) *cron.Cron {
 	builder := job.NewCronJobBuilder(prometheus.SummaryOpts{
 		Namespace: "tuan_book",
 		Subsystem: "job",
@@ -28,9 +28,93 @@ func InitJobs(rankingJob job.Job) *cron.Cron {
 		},
 	})
 	expr := cron.New(cron.WithSeconds())
-	_, err := expr.AddJob("@every 1m", builder.Build(rankingJob))
+	// 每一个榜单单独调度
+	for _, cfg := range rankingBoardConfigs() {
+		rankingJob := job.NewRankingJob(svc, cfg.Name, time.Second*30, client)
+		_, err := expr.AddJob(cfg.Cron, builder.Build(rankingJob))
+		if err != nil {
+			panic(err)
+		}
+	}
+	return expr
+}
+
+// InitJobScheduler 基于 MySQL 抢占的分布式任务调度，多个节点之间同一个任务只有一个节点执行
+func InitJobScheduler(svc service.CronJobService, artSvc service.ArticleService,
+	readerSvc service.UniqueReaderService, intrSvc service.InteractiveService,
+	outboxRepo repository.OutboxRepository) *job.Scheduler {
+	scheduler := job.NewScheduler(svc)
+	publishExecutor := job.NewScheduledPublishExecutor(artSvc)
+	scheduler.RegisterExecutor(publishExecutor)
+	readerExecutor := job.NewUniqueReaderSyncExecutor(readerSvc)
+	scheduler.RegisterExecutor(readerExecutor)
+	reconcileCfg := initReconcileConfig()
+	reconcileExecutor := job.NewInteractiveReconcileExecutor(intrSvc, reconcileCfg.BatchSize, reconcileCfg.MaxRows)
+	scheduler.RegisterExecutor(reconcileExecutor)
+	viper.SetDefault("outbox.cleanup.retention", "24h")
+	cleanupExecutor := job.NewOutboxCleanupExecutor(outboxRepo, viper.GetDuration("outbox.cleanup.retention"))
+	scheduler.RegisterExecutor(cleanupExecutor)
+
+	// 定时发表：每隔一段时间扫一次到期的文章
+	viper.SetDefault("article.schedule.cron", "@every 10s")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	err := svc.AddJob(ctx, domain.Job{
+		Name:       "article_scheduled_publish",
+		Executor:   publishExecutor.Name(),
+		Expression: viper.GetString("article.schedule.cron"),
+	})
 	if err != nil {
 		panic(err)
 	}
-	return expr
+	// 独立读者数：定时从 redis 同步到数据库
+	viper.SetDefault("interactive.reader.cron", "@every 5m")
+	err = svc.AddJob(ctx, domain.Job{
+		Name:       "unique_reader_sync",
+		Executor:   readerExecutor.Name(),
+		Expression: viper.GetString("interactive.reader.cron"),
+	})
+	if err != nil {
+		panic(err)
+	}
+	// 交互数据对账：点赞数、收藏数以明细表为准
+	err = svc.AddJob(ctx, domain.Job{
+		Name:       "interactive_reconcile",
+		Executor:   reconcileExecutor.Name(),
+		Expression: reconcileCfg.Cron,
+	})
+	if err != nil {
+		panic(err)
+	}
+	// 已经发送的 outbox 消息：定时清理
+	viper.SetDefault("outbox.cleanup.cron", "@every 1h")
+	err = svc.AddJob(ctx, domain.Job{
+		Name:       "outbox_cleanup",
+		Executor:   cleanupExecutor.Name(),
+		Expression: viper.GetString("outbox.cleanup.cron"),
+	})
+	if err != nil {
+		panic(err)
+	}
+	return scheduler
+}
+
+type reconcileConfig struct {
+	Cron string `yaml:"cron"`
+	// 每次最多扫描 MaxRows 行，每批 BatchSize 行
+	BatchSize int `yaml:"batchSize"`
+	MaxRows   int `yaml:"maxRows"`
+}
+
+func initReconcileConfig() reconcileConfig {
+	cfg := reconcileConfig{
+		Cron:      "@every 10m",
+		BatchSize: 100,
+		MaxRows:   10000,
+	}
+	err := viper.UnmarshalKey("interactive.reconcile", &cfg)
+	if err != nil {
+		panic(err)
+	}
+	return cfg
 }
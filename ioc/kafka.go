@@ -4,10 +4,35 @@ import (
 	"github.com/IBM/sarama"
 	"github.com/Tuanzi-bug/tuan-book/internal/events"
 	"github.com/Tuanzi-bug/tuan-book/internal/events/article"
+	"github.com/Tuanzi-bug/tuan-book/internal/repository"
+	"github.com/Tuanzi-bug/tuan-book/pkg/saramax"
+	"github.com/redis/go-redis/v9"
 	"github.com/spf13/viper"
+	"time"
 )
 
-func InitSaramaClient() sarama.Client {
+// InitBroker kafka.mode 为 memory 的时候使用进程内的 broker，单机运行和本地调试不需要 kafka
+func InitBroker() saramax.Broker {
+	type Config struct {
+		Mode   string `yaml:"mode"`
+		Memory struct {
+			Partitions int `yaml:"partitions"`
+			// 每个分区最多保留多少条消息
+			Retention int `yaml:"retention"`
+		} `yaml:"memory"`
+	}
+	var cfg Config
+	err := viper.UnmarshalKey("kafka", &cfg)
+	if err != nil {
+		panic(err)
+	}
+	if cfg.Mode == "memory" {
+		return saramax.NewMemoryBroker(cfg.Memory.Partitions, cfg.Memory.Retention)
+	}
+	return saramax.NewKafkaBroker(initSaramaClient())
+}
+
+func initSaramaClient() sarama.Client {
 	type Config struct {
 		Addr []string `json:"addr"`
 	}
@@ -27,14 +52,68 @@ func InitSaramaClient() sarama.Client {
 	return client
 }
 
-func InitSyncProducer(c sarama.Client) sarama.SyncProducer {
-	p, err := sarama.NewSyncProducerFromClient(c)
+func InitSyncProducer(broker saramax.Broker) sarama.SyncProducer {
+	p, err := broker.SyncProducer()
 	if err != nil {
 		panic(err)
 	}
 	return p
 }
 
-func InitConsumers(c1 *article.InteractiveReadEventConsumer) []events.Consumer {
-	return []events.Consumer{c1}
+// initRetrier 所有消费者共用 kafka.retry 的配置，重试 topic 和死信队列按照消费者组区分
+func initRetrier(producer sarama.SyncProducer, group string) *saramax.Retrier {
+	type Config struct {
+		MaxAttempts int             `yaml:"maxAttempts"`
+		Backoff     time.Duration   `yaml:"backoff"`
+		Delays      []time.Duration `yaml:"delays"`
+	}
+	cfg := Config{
+		MaxAttempts: 3,
+		Backoff:     time.Millisecond * 100,
+		Delays:      []time.Duration{time.Second * 10, time.Minute, time.Minute * 10},
+	}
+	err := viper.UnmarshalKey("kafka.retry", &cfg)
+	if err != nil {
+		panic(err)
+	}
+	return saramax.NewRetrier(producer, group,
+		saramax.NewRetryPolicy(group, cfg.MaxAttempts, cfg.Backoff, cfg.Delays))
+}
+
+// initDeduplicator 按照消费者组去重，kafka.dedup.ttl 之内重复投递的事件都能识别出来
+func initDeduplicator(client redis.Cmdable, group string) saramax.Deduplicator {
+	type Config struct {
+		TTL time.Duration `yaml:"ttl"`
+	}
+	cfg := Config{TTL: time.Hour * 24}
+	err := viper.UnmarshalKey("kafka.dedup", &cfg)
+	if err != nil {
+		panic(err)
+	}
+	return saramax.NewRedisDeduplicator(client, group, cfg.TTL)
+}
+
+// InitInteractiveReadEventConsumer 阅读数的消费者，批次越大合并写入的效果越好，但是延迟也越高
+func InitInteractiveReadEventConsumer(broker saramax.Broker, producer sarama.SyncProducer, client redis.Cmdable,
+	repo repository.InteractiveRepository) *article.InteractiveReadEventConsumer {
+	cfg := saramax.BatchConfig{BatchSize: 100, Linger: time.Second, Concurrency: 1, Commit: saramax.CommitAuto}
+	err := viper.UnmarshalKey("interactive.read", &cfg)
+	if err != nil {
+		panic(err)
+	}
+	// 消费者组的名字和 InteractiveReadEventConsumer 里面的保持一致
+	return article.NewInteractiveReadEventConsumer(broker, repo, cfg,
+		initRetrier(producer, "interactive"), initDeduplicator(client, "interactive"))
+}
+
+func InitConsumers(c1 *article.InteractiveReadEventConsumer, c2 *article.RankingEventConsumer,
+	c3 *article.SearchIndexConsumer, c4 *article.FeedEventConsumer, c5 *article.ReadHistoryConsumer,
+	c6 *article.UniqueReaderConsumer, relay *events.OutboxRelay) []events.Consumer {
+	// outbox 的发送和消费者一起启动
+	consumers := []events.Consumer{c1, c3, c4, c5, c6, relay}
+	// 只有实时热榜需要消费交互事件
+	if rankingMode() == rankingModeRealTime {
+		consumers = append(consumers, c2)
+	}
+	return consumers
 }
@@ -0,0 +1,25 @@
+package ioc
+
+import (
+	"github.com/IBM/sarama"
+	"github.com/Tuanzi-bug/tuan-book/internal/events"
+	"github.com/Tuanzi-bug/tuan-book/internal/repository"
+	rlock "github.com/gotomicro/redis-lock"
+	"github.com/spf13/viper"
+	"time"
+)
+
+// InitOutboxRelay 间隔越短事件的延迟越低，但是空转查询数据库的次数也越多
+func InitOutboxRelay(repo repository.OutboxRepository, producer sarama.SyncProducer, client *rlock.Client) *events.OutboxRelay {
+	type Config struct {
+		BatchSize  int           `yaml:"batchSize"`
+		Interval   time.Duration `yaml:"interval"`
+		MaxRetries int           `yaml:"maxRetries"`
+	}
+	cfg := Config{BatchSize: 100, Interval: time.Millisecond * 500, MaxRetries: 10}
+	err := viper.UnmarshalKey("outbox.relay", &cfg)
+	if err != nil {
+		panic(err)
+	}
+	return events.NewOutboxRelay(repo, producer, client, cfg.BatchSize, cfg.Interval, cfg.MaxRetries)
+}
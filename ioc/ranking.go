@@ -0,0 +1,110 @@
+package ioc
+
+import (
+	"fmt"
+	"github.com/Tuanzi-bug/tuan-book/internal/events/article"
+	"github.com/Tuanzi-bug/tuan-book/internal/repository"
+	"github.com/Tuanzi-bug/tuan-book/internal/service"
+	"github.com/Tuanzi-bug/tuan-book/pkg/saramax"
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/viper"
+	"time"
+)
+
+const (
+	// rankingModeBatch 定时全量计算
+	rankingModeBatch = "batch"
+	// rankingModeRealTime 交互事件实时更新 redis zset
+	rankingModeRealTime = "realtime"
+)
+
+type rankingBoardConfig struct {
+	Name string `yaml:"name"`
+	// 统计的时间窗口，0 表示不限制。
+	// 只有全量计算的时候生效，实时热榜不区分时间窗口，旧文章的热度靠 HalfLife 衰减
+	Window time.Duration `yaml:"window"`
+	N      int           `yaml:"n"`
+	// 打分策略的名字，需要在 service 里面注册过
+	Strategy string `yaml:"strategy"`
+	// 实时榜单的半衰期，0 表示不衰减，只有实时计算的时候生效
+	HalfLife time.Duration `yaml:"halfLife"`
+	// 计算榜单的定时任务表达式
+	Cron string `yaml:"cron"`
+}
+
+func rankingMode() string {
+	mode := viper.GetString("ranking.mode")
+	if mode == "" {
+		return rankingModeBatch
+	}
+	return mode
+}
+
+func rankingBoardConfigs() []rankingBoardConfig {
+	if !viper.IsSet("ranking.boards") {
+		// 默认的榜单：日榜、周榜、总榜
+		return []rankingBoardConfig{
+			{Name: "daily", Window: time.Hour * 24, N: 100, Strategy: "weighted", HalfLife: time.Hour * 6, Cron: "@every 1m"},
+			{Name: "weekly", Window: time.Hour * 24 * 7, N: 100, Strategy: "hacker_news", HalfLife: time.Hour * 24 * 2, Cron: "@every 1m"},
+			{Name: "all", N: 100, Strategy: "popularity", Cron: "@every 10m"},
+		}
+	}
+	var cfgs []rankingBoardConfig
+	err := viper.UnmarshalKey("ranking.boards", &cfgs)
+	if err != nil {
+		panic(err)
+	}
+	return cfgs
+}
+
+func InitRankingBoards() []service.RankingBoard {
+	cfgs := rankingBoardConfigs()
+	boards := make([]service.RankingBoard, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		strategy, ok := service.GetScoreStrategy(cfg.Strategy)
+		if !ok {
+			panic(fmt.Errorf("榜单 %s 使用了未注册的打分策略 %s", cfg.Name, cfg.Strategy))
+		}
+		boards = append(boards, service.RankingBoard{
+			Name:     cfg.Name,
+			Window:   cfg.Window,
+			N:        cfg.N,
+			Strategy: strategy,
+			HalfLife: cfg.HalfLife,
+		})
+	}
+	return boards
+}
+
+// InitRankingService 根据配置选择全量计算还是实时计算的热榜
+func InitRankingService(intrSvc service.InteractiveService, artSvc service.ArticleService,
+	repo repository.RankingRepository, realTimeRepo repository.RealTimeRankingRepository,
+	boards []service.RankingBoard) service.RankingService {
+	switch mode := rankingMode(); mode {
+	case rankingModeBatch:
+		return service.NewBatchRankingService(intrSvc, artSvc, repo, boards)
+	case rankingModeRealTime:
+		return service.NewRealTimeRankingService(artSvc, realTimeRepo, boards)
+	default:
+		panic(fmt.Errorf("未知的热榜模式 %s", mode))
+	}
+}
+
+func InitRankingEventConsumer(broker saramax.Broker, client redis.Cmdable,
+	repo repository.RealTimeRankingRepository) *article.RankingEventConsumer {
+	cfgs := rankingBoardConfigs()
+	boards := make([]string, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		boards = append(boards, cfg.Name)
+	}
+	weights := article.RankingWeights{
+		Read:    1,
+		Like:    5,
+		Collect: 10,
+	}
+	err := viper.UnmarshalKey("ranking.weights", &weights)
+	if err != nil {
+		panic(err)
+	}
+	return article.NewRankingEventConsumer(broker, repo, boards, weights, initDeduplicator(client, "ranking"))
+}
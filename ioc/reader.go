@@ -0,0 +1,11 @@
+package ioc
+
+import (
+	"github.com/Tuanzi-bug/tuan-book/internal/events/article"
+	"github.com/Tuanzi-bug/tuan-book/internal/service"
+	"github.com/Tuanzi-bug/tuan-book/pkg/saramax"
+)
+
+func InitUniqueReaderConsumer(broker saramax.Broker, svc service.UniqueReaderService) *article.UniqueReaderConsumer {
+	return article.NewUniqueReaderConsumer(broker, svc)
+}
@@ -0,0 +1,23 @@
+package ioc
+
+import (
+	"fmt"
+	"github.com/Tuanzi-bug/tuan-book/internal/events/article"
+	"github.com/Tuanzi-bug/tuan-book/internal/service"
+	"github.com/Tuanzi-bug/tuan-book/pkg/saramax"
+	"github.com/spf13/viper"
+	"os"
+)
+
+func InitSearchIndexConsumer(broker saramax.Broker, svc service.SearchService) *article.SearchIndexConsumer {
+	group := viper.GetString("search.group")
+	if group == "" {
+		// 索引在进程内，每个节点都需要消费全部的事件
+		hostname, err := os.Hostname()
+		if err != nil {
+			panic(err)
+		}
+		group = fmt.Sprintf("search-%s", hostname)
+	}
+	return article.NewSearchIndexConsumer(broker, svc, group)
+}
@@ -9,14 +9,27 @@ import (
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/redis/go-redis/v9"
+	"github.com/spf13/viper"
 )
 
-func InitWebServer(middlewares []gin.HandlerFunc, userHdl *web.UserHandler, artHandler *web.ArticleHandler) *gin.Engine {
+func InitWebServer(middlewares []gin.HandlerFunc, userHdl *web.UserHandler, artHandler *web.ArticleHandler,
+	searchHdl *web.SearchHandler, commentHdl *web.CommentHandler, followHdl *web.FollowHandler,
+	feedHdl *web.FeedHandler, collectionHdl *web.CollectionHandler, personalHdl *web.PersonalHandler,
+	jobHdl *web.JobHandler) *gin.Engine {
 	// 因为重写了log和recovery中间件
 	server := gin.New()
+	// 链路 id 在 Request 的 context 里面，*gin.Context 当 context.Context 用的时候要能取到
+	server.ContextWithFallback = true
 	server.Use(middlewares...)
 	userHdl.RegisterRoutes(server)
 	artHandler.RegisterRoutes(server)
+	searchHdl.RegisterRoutes(server)
+	commentHdl.RegisterRoutes(server)
+	followHdl.RegisterRoutes(server)
+	feedHdl.RegisterRoutes(server)
+	collectionHdl.RegisterRoutes(server)
+	personalHdl.RegisterRoutes(server)
+	jobHdl.RegisterRoutes(server)
 	return server
 }
 func InitMiddlewares(redisClient redis.Cmdable, hdl myjwt.Handler) []gin.HandlerFunc {
@@ -31,6 +44,7 @@ func InitMiddlewares(redisClient redis.Cmdable, hdl myjwt.Handler) []gin.Handler
 		//middleware.Ginzap(logger, time.RFC3339, true),
 		//// 加入Recovery中间件
 		//middleware.RecoveryWithZap(logger, true),
+		middleware.NewTraceMiddlewareBuilder().Build(),
 		corsHdl(),
 		middleware.NewJWTMiddlewareBuilder(hdl).
 			IgnorePaths("/users/signup").
@@ -44,13 +58,24 @@ func InitMiddlewares(redisClient redis.Cmdable, hdl myjwt.Handler) []gin.Handler
 		//ratelimit.NewBuilder(limiter.NewRedisSlidingWindowLimiter(redisClient, time.Second, 1000)).Build(),
 	}
 }
+
+// InitAdminMiddleware 只有 admin.uids 里面的用户可以访问管理后台
+func InitAdminMiddleware() *middleware.AdminMiddlewareBuilder {
+	var uids []int64
+	err := viper.UnmarshalKey("admin.uids", &uids)
+	if err != nil {
+		panic(err)
+	}
+	return middleware.NewAdminMiddlewareBuilder(uids)
+}
+
 func corsHdl() gin.HandlerFunc {
 	return cors.New(cors.Config{
 		//AllowAllOrigins: true,
 		//AllowOrigins:     []string{"http://localhost:3000"},
 		AllowCredentials: true,
-		AllowHeaders:     []string{"Origin", "Authorization", "Content-Type"},
-		ExposeHeaders:    []string{"x-jwt-token", "x-refresh-token"},
+		AllowHeaders:     []string{"Origin", "Authorization", "Content-Type", "X-Trace-Id"},
+		ExposeHeaders:    []string{"x-jwt-token", "x-refresh-token", "x-trace-id"},
 		//AllowMethods: []string{"POST"},
 		AllowOriginFunc: func(origin string) bool {
 			fmt.Println(origin)
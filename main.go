@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/Tuanzi-bug/tuan-book/ioc"
 	"github.com/Tuanzi-bug/tuan-book/pkg/log"
@@ -24,6 +26,16 @@ func main() {
 		// 等待定时任务结束
 		<-app.cron.Stop().Done()
 	}()
+	// 启动分布式任务调度
+	log.Info("start job scheduler")
+	schedCtx, schedCancel := context.WithCancel(context.Background())
+	defer schedCancel()
+	go func() {
+		err := app.scheduler.Schedule(schedCtx)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			log.Error("任务调度退出", log.Err(err))
+		}
+	}()
 	// 启动消费者
 	log.Info("start consumers")
 	for _, c := range app.consumers {
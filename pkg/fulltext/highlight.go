@@ -0,0 +1,69 @@
+package fulltext
+
+import (
+	"html"
+	"strings"
+	"unicode/utf8"
+)
+
+// Highlight 用 pre 和 post 包住 text 中命中搜索词的部分
+// maxRunes > 0 的时候只截取第一个命中位置附近的一段，其余部分会做 HTML 转义
+func Highlight(text, query, pre, post string, maxRunes int) string {
+	terms := make(map[string]struct{})
+	for _, tk := range TokenizeQuery(query) {
+		terms[tk.Term] = struct{}{}
+	}
+	// 命中的区间，相邻或者重叠的合并成一个
+	var spans [][2]int
+	for _, tk := range Tokenize(text) {
+		if _, ok := terms[tk.Term]; !ok {
+			continue
+		}
+		if last := len(spans) - 1; last >= 0 && tk.Start <= spans[last][1] {
+			spans[last][1] = max(spans[last][1], tk.End)
+			continue
+		}
+		spans = append(spans, [2]int{tk.Start, tk.End})
+	}
+	start, end := 0, len(text)
+	if maxRunes > 0 && utf8.RuneCountInString(text) > maxRunes {
+		if len(spans) > 0 {
+			// 命中位置前面留一点上下文
+			start = backRunes(text, spans[0][0], maxRunes/4)
+		}
+		end = forwardRunes(text, start, maxRunes)
+	}
+	var sb strings.Builder
+	pos := start
+	for _, sp := range spans {
+		if sp[1] <= start || sp[0] >= end {
+			continue
+		}
+		s, e := max(sp[0], start), min(sp[1], end)
+		sb.WriteString(html.EscapeString(text[pos:s]))
+		sb.WriteString(pre)
+		sb.WriteString(html.EscapeString(text[s:e]))
+		sb.WriteString(post)
+		pos = e
+	}
+	sb.WriteString(html.EscapeString(text[pos:end]))
+	return sb.String()
+}
+
+// backRunes 从 pos 往前数 n 个字符
+func backRunes(text string, pos, n int) int {
+	for ; n > 0 && pos > 0; n-- {
+		_, size := utf8.DecodeLastRuneInString(text[:pos])
+		pos -= size
+	}
+	return pos
+}
+
+// forwardRunes 从 pos 往后数 n 个字符
+func forwardRunes(text string, pos, n int) int {
+	for ; n > 0 && pos < len(text); n-- {
+		_, size := utf8.DecodeRuneInString(text[pos:])
+		pos += size
+	}
+	return pos
+}
@@ -0,0 +1,164 @@
+package fulltext
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+// BM25 的参数
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// Doc 一个待索引的文档，Fields 的顺序和 NewIndex 传入的权重一一对应
+type Doc struct {
+	Id     int64
+	Fields []string
+}
+
+type Hit struct {
+	Id    int64
+	Score float64
+}
+
+// Index 内存中的倒排索引，并发安全
+type Index struct {
+	mu      sync.RWMutex
+	weights []float64
+	// term -> 文档 id -> 每个字段中出现的次数
+	postings map[string]map[int64][]int
+	docs     map[int64]Doc
+	// 每个文档每个字段的词数，以及每个字段的总词数，用于计算平均长度
+	lens      map[int64][]int
+	totalLens []int
+}
+
+// NewIndex weights 是每个字段的权重，例如标题比内容更重要
+func NewIndex(weights ...float64) *Index {
+	return &Index{
+		weights:   weights,
+		postings:  make(map[string]map[int64][]int),
+		docs:      make(map[int64]Doc),
+		lens:      make(map[int64][]int),
+		totalLens: make([]int, len(weights)),
+	}
+}
+
+// Put 添加或者替换一个文档
+func (i *Index) Put(doc Doc) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.delete(doc.Id)
+	lens := make([]int, len(i.weights))
+	for f := 0; f < len(i.weights) && f < len(doc.Fields); f++ {
+		tokens := Tokenize(doc.Fields[f])
+		lens[f] = len(tokens)
+		i.totalLens[f] += len(tokens)
+		for _, tk := range tokens {
+			docs, ok := i.postings[tk.Term]
+			if !ok {
+				docs = make(map[int64][]int)
+				i.postings[tk.Term] = docs
+			}
+			tfs, ok := docs[doc.Id]
+			if !ok {
+				tfs = make([]int, len(i.weights))
+				docs[doc.Id] = tfs
+			}
+			tfs[f]++
+		}
+	}
+	i.docs[doc.Id] = doc
+	i.lens[doc.Id] = lens
+}
+
+func (i *Index) Delete(id int64) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.delete(id)
+}
+
+func (i *Index) delete(id int64) {
+	doc, ok := i.docs[id]
+	if !ok {
+		return
+	}
+	for f := 0; f < len(i.weights) && f < len(doc.Fields); f++ {
+		for _, tk := range Tokenize(doc.Fields[f]) {
+			docs := i.postings[tk.Term]
+			delete(docs, id)
+			if len(docs) == 0 {
+				delete(i.postings, tk.Term)
+			}
+		}
+		i.totalLens[f] -= i.lens[id][f]
+	}
+	delete(i.docs, id)
+	delete(i.lens, id)
+}
+
+func (i *Index) Get(id int64) (Doc, bool) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	doc, ok := i.docs[id]
+	return doc, ok
+}
+
+func (i *Index) Len() int {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return len(i.docs)
+}
+
+// Search 包含任意一个搜索词的文档都会命中，按照 BM25 得分倒序，返回这一页和命中总数
+func (i *Index) Search(query string, offset, limit int) ([]Hit, int) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	n := float64(len(i.docs))
+	if n == 0 {
+		return []Hit{}, 0
+	}
+	scores := make(map[int64]float64)
+	seen := make(map[string]struct{})
+	for _, tk := range TokenizeQuery(query) {
+		if _, ok := seen[tk.Term]; ok {
+			continue
+		}
+		seen[tk.Term] = struct{}{}
+		docs := i.postings[tk.Term]
+		if len(docs) == 0 {
+			continue
+		}
+		df := float64(len(docs))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for id, tfs := range docs {
+			lens := i.lens[id]
+			for f, tf := range tfs {
+				if tf == 0 {
+					continue
+				}
+				avg := float64(i.totalLens[f]) / n
+				norm := 1 - bm25B + bm25B*float64(lens[f])/avg
+				scores[id] += i.weights[f] * idf * float64(tf) * (bm25K1 + 1) / (float64(tf) + bm25K1*norm)
+			}
+		}
+	}
+	hits := make([]Hit, 0, len(scores))
+	for id, score := range scores {
+		hits = append(hits, Hit{Id: id, Score: score})
+	}
+	sort.Slice(hits, func(a, b int) bool {
+		if hits[a].Score != hits[b].Score {
+			return hits[a].Score > hits[b].Score
+		}
+		// 分数一样的时候新的文章在前面
+		return hits[a].Id > hits[b].Id
+	})
+	total := len(hits)
+	if offset >= total {
+		return []Hit{}, total
+	}
+	return hits[offset:min(offset+limit, total)], total
+}
@@ -0,0 +1,147 @@
+package fulltext
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	testCases := []struct {
+		name  string
+		text  string
+		query bool
+		want  []string
+	}{
+		{
+			name: "英文和数字",
+			text: "Hello, Go1.22 world!",
+			want: []string{"hello", "go1", "22", "world"},
+		},
+		{
+			name: "中文建索引",
+			text: "数据库",
+			want: []string{"数", "据", "库", "数据", "据库"},
+		},
+		{
+			name:  "中文搜索词",
+			text:  "数据库",
+			query: true,
+			want:  []string{"数据", "据库"},
+		},
+		{
+			name:  "单个汉字的搜索词",
+			text:  "库",
+			query: true,
+			want:  []string{"库"},
+		},
+		{
+			name:  "中英混合",
+			text:  "用Redis做缓存",
+			query: true,
+			want:  []string{"用", "redis", "做缓", "缓存"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var tokens []Token
+			if tc.query {
+				tokens = TokenizeQuery(tc.text)
+			} else {
+				tokens = Tokenize(tc.text)
+			}
+			terms := make([]string, 0, len(tokens))
+			for _, tk := range tokens {
+				terms = append(terms, tk.Term)
+				// 偏移量要能还原出原文
+				assert.Equal(t, tk.Term, strings.ToLower(tc.text[tk.Start:tk.End]))
+			}
+			assert.Equal(t, tc.want, terms)
+		})
+	}
+}
+
+func TestIndex_Search(t *testing.T) {
+	idx := NewIndex(2, 1)
+	idx.Put(Doc{Id: 1, Fields: []string{"Redis 缓存设计", "介绍缓存穿透、缓存击穿和缓存雪崩"}})
+	idx.Put(Doc{Id: 2, Fields: []string{"MySQL 索引", "聊一聊 B+ 树，顺便提一下缓存"}})
+	idx.Put(Doc{Id: 3, Fields: []string{"Kafka 入门", "消息队列"}})
+
+	hits, total := idx.Search("缓存", 0, 10)
+	assert.Equal(t, 2, total)
+	// 标题命中，并且内容里面出现得更多
+	assert.Equal(t, int64(1), hits[0].Id)
+	assert.Equal(t, int64(2), hits[1].Id)
+
+	hits, total = idx.Search("缓存", 1, 10)
+	assert.Equal(t, 2, total)
+	assert.Equal(t, []int64{2}, ids(hits))
+
+	hits, total = idx.Search("kafka", 0, 10)
+	assert.Equal(t, 1, total)
+	assert.Equal(t, []int64{3}, ids(hits))
+
+	hits, total = idx.Search("不存在", 0, 10)
+	assert.Equal(t, 0, total)
+	assert.Empty(t, hits)
+
+	// 替换之后旧的内容搜不到
+	idx.Put(Doc{Id: 1, Fields: []string{"Redis 数据结构", "跳表"}})
+	hits, _ = idx.Search("缓存", 0, 10)
+	assert.Equal(t, []int64{2}, ids(hits))
+
+	idx.Delete(2)
+	hits, total = idx.Search("缓存", 0, 10)
+	assert.Equal(t, 0, total)
+	assert.Empty(t, hits)
+	assert.Equal(t, 2, idx.Len())
+}
+
+func TestHighlight(t *testing.T) {
+	testCases := []struct {
+		name     string
+		text     string
+		query    string
+		maxRunes int
+		want     string
+	}{
+		{
+			name:  "英文不区分大小写",
+			text:  "Learn Go in Go way",
+			query: "go",
+			want:  "Learn <em>Go</em> in <em>Go</em> way",
+		},
+		{
+			name:  "中文相邻的 bigram 合并",
+			text:  "分布式数据库的设计",
+			query: "数据库",
+			want:  "分布式<em>数据库</em>的设计",
+		},
+		{
+			name:  "转义",
+			text:  "<b>redis</b>",
+			query: "redis",
+			want:  "&lt;b&gt;<em>redis</em>&lt;/b&gt;",
+		},
+		{
+			name:     "截取命中位置附近",
+			text:     "一二三四五六七八九十缓存甲乙丙丁戊己庚辛",
+			query:    "缓存",
+			maxRunes: 8,
+			want:     "九十<em>缓存</em>甲乙丙丁",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, Highlight(tc.text, tc.query, "<em>", "</em>", tc.maxRunes))
+		})
+	}
+}
+
+func ids(hits []Hit) []int64 {
+	res := make([]int64, 0, len(hits))
+	for _, h := range hits {
+		res = append(res, h.Id)
+	}
+	return res
+}
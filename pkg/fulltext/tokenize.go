@@ -0,0 +1,88 @@
+package fulltext
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Token 分词结果，Start 和 End 是在原文中的字节偏移
+type Token struct {
+	Term  string
+	Start int
+	End   int
+}
+
+// Tokenize 建索引时使用的分词
+// 字母和数字连续的部分作为一个词，统一转成小写；
+// 中日韩文字没有空格分隔，同时切出单字和相邻两个字（bigram），这样单字和词语都能搜到
+func Tokenize(text string) []Token {
+	return tokenize(text, true)
+}
+
+// TokenizeQuery 搜索词使用的分词，中日韩文字只切 bigram，只有一个字的时候才使用单字
+func TokenizeQuery(text string) []Token {
+	return tokenize(text, false)
+}
+
+func tokenize(text string, unigram bool) []Token {
+	var tokens []Token
+	i := 0
+	for i < len(text) {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		switch {
+		case isCJK(r):
+			end := i
+			var starts []int
+			for end < len(text) {
+				r, size = utf8.DecodeRuneInString(text[end:])
+				if !isCJK(r) {
+					break
+				}
+				starts = append(starts, end)
+				end += size
+			}
+			starts = append(starts, end)
+			tokens = append(tokens, cjkTokens(text, starts, unigram)...)
+			i = end
+		case isWord(r):
+			end := i
+			for end < len(text) {
+				r, size = utf8.DecodeRuneInString(text[end:])
+				if !isWord(r) || isCJK(r) {
+					break
+				}
+				end += size
+			}
+			tokens = append(tokens, Token{Term: strings.ToLower(text[i:end]), Start: i, End: end})
+			i = end
+		default:
+			i += size
+		}
+	}
+	return tokens
+}
+
+// cjkTokens starts 是每个字的起始偏移，最后一个元素是结束偏移
+func cjkTokens(text string, starts []int, unigram bool) []Token {
+	n := len(starts) - 1
+	var tokens []Token
+	if unigram || n == 1 {
+		for k := 0; k < n; k++ {
+			tokens = append(tokens, Token{Term: text[starts[k]:starts[k+1]], Start: starts[k], End: starts[k+1]})
+		}
+	}
+	for k := 0; k+1 < n; k++ {
+		tokens = append(tokens, Token{Term: text[starts[k]:starts[k+2]], Start: starts[k], End: starts[k+2]})
+	}
+	return tokens
+}
+
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r)
+}
+
+func isWord(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -2,70 +2,311 @@ package saramax
 
 import (
 	"context"
-	"encoding/json"
 	"github.com/IBM/sarama"
 	"github.com/Tuanzi-bug/tuan-book/pkg/log"
+	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+	"hash/fnv"
+	"strconv"
 	"time"
 )
 
+// CommitStrategy 一批消息处理完之后怎么提交
+type CommitStrategy string
+
+const (
+	// CommitAuto 只标记，由 sarama 定时提交，重启的时候可能重复消费最后一小段
+	CommitAuto CommitStrategy = "auto"
+	// CommitSync 每一批处理完都同步提交一次
+	CommitSync CommitStrategy = "sync"
+)
+
+// BatchConfig 方便从配置文件里面读取，零值的字段使用默认值
+type BatchConfig struct {
+	BatchSize   int            `yaml:"batchSize"`
+	Linger      time.Duration  `yaml:"linger"`
+	Concurrency int            `yaml:"concurrency"`
+	Commit      CommitStrategy `yaml:"commit"`
+}
+
+var (
+	batchSizeVec = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "tuan_book",
+		Subsystem: "saramax",
+		Name:      "batch_size",
+		Help:      "每一批消息的条数",
+		Buckets:   []float64{1, 5, 10, 20, 50, 100, 200, 500},
+	}, []string{"consumer", "topic"})
+	batchDurationVec = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "tuan_book",
+		Subsystem: "saramax",
+		Name:      "batch_duration_seconds",
+		Help:      "处理一批消息的耗时，包括原地重试",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"consumer", "topic"})
+	lagVec = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "tuan_book",
+		Subsystem: "saramax",
+		Name:      "consumer_lag",
+		Help:      "分区最新的 offset 和已经处理的 offset 的差距",
+	}, []string{"consumer", "topic", "partition"})
+)
+
+func init() {
+	prometheus.MustRegister(batchSizeVec, batchDurationVec, lagVec)
+}
+
 type BatchHandler[T any] struct {
 	fn func(msgs []*sarama.ConsumerMessage, ts []T) error
+	// 一批最多多少条消息
+	batchSize int
+	// 凑一批最多等多久，没凑够也会处理
+	linger time.Duration
+	// 一批消息按照 key 分成几份并发处理
+	concurrency int
+	commit      CommitStrategy
+	// 监控指标上的 consumer 标签，一般是消费者组
+	name string
+	// 为 nil 的时候失败的批次只记录日志
+	retrier *Retrier
+	// 为 nil 的时候不去重
+	dedup Deduplicator
 }
 
 func NewBatchHandler[T any](fn func(msgs []*sarama.ConsumerMessage, ts []T) error) *BatchHandler[T] {
-	return &BatchHandler[T]{fn: fn}
+	return &BatchHandler[T]{fn: fn, batchSize: 10, linger: time.Second, concurrency: 1, commit: CommitAuto}
+}
+
+// WithBatchSize 小于等于 0 的时候不修改
+func (b *BatchHandler[T]) WithBatchSize(batchSize int) *BatchHandler[T] {
+	if batchSize > 0 {
+		b.batchSize = batchSize
+	}
+	return b
+}
+
+// WithLinger 小于等于 0 的时候不修改
+func (b *BatchHandler[T]) WithLinger(linger time.Duration) *BatchHandler[T] {
+	if linger > 0 {
+		b.linger = linger
+	}
+	return b
+}
+
+// WithConcurrency 同一个 key 的消息落在同一份里面，仍然按照顺序处理。小于等于 0 的时候不修改
+func (b *BatchHandler[T]) WithConcurrency(concurrency int) *BatchHandler[T] {
+	if concurrency > 0 {
+		b.concurrency = concurrency
+	}
+	return b
+}
+
+// WithCommit 为空的时候不修改
+func (b *BatchHandler[T]) WithCommit(commit CommitStrategy) *BatchHandler[T] {
+	if commit != "" {
+		b.commit = commit
+	}
+	return b
+}
+
+// WithConfig 一次设置 cfg 里面所有非零值的字段
+func (b *BatchHandler[T]) WithConfig(cfg BatchConfig) *BatchHandler[T] {
+	return b.WithBatchSize(cfg.BatchSize).WithLinger(cfg.Linger).
+		WithConcurrency(cfg.Concurrency).WithCommit(cfg.Commit)
+}
+
+func (b *BatchHandler[T]) WithName(name string) *BatchHandler[T] {
+	b.name = name
+	return b
+}
+
+// WithRetrier 整批原地重试，都失败了整批转发到重试 topic，消费者还需要订阅 retrier.Topics()
+func (b *BatchHandler[T]) WithRetrier(retrier *Retrier) *BatchHandler[T] {
+	b.retrier = retrier
+	return b
+}
+
+// WithDeduplicator 按照事件 id 跳过已经处理过的消息，同一批里面重复的也只处理一次
+func (b *BatchHandler[T]) WithDeduplicator(dedup Deduplicator) *BatchHandler[T] {
+	b.dedup = dedup
+	return b
 }
 
 func (b *BatchHandler[T]) Setup(session sarama.ConsumerGroupSession) error {
-	log.Info("BatchHandler Setup")
+	log.Info("BatchHandler Setup", zap.String("consumer", b.name))
 	return nil
 }
 
 func (b *BatchHandler[T]) Cleanup(session sarama.ConsumerGroupSession) error {
-	log.Info("BatchHandler Cleanup")
+	log.Info("BatchHandler Cleanup", zap.String("consumer", b.name))
 	return nil
 }
 
+// ConsumeClaim 会话结束或者分区被收回的时候，先处理完已经凑到的消息再返回
 func (b *BatchHandler[T]) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
-	log.Info("BatchHandler ConsumeClaim")
-	msgs := claim.Messages()
-	const batchSize = 10
+	log.Info("BatchHandler ConsumeClaim", zap.String("consumer", b.name),
+		zap.String("topic", claim.Topic()), zap.Int32("partition", claim.Partition()))
 	for {
-		batch := make([]*sarama.ConsumerMessage, 0, batchSize)
-		ts := make([]T, 0, batchSize)
-		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-		var done = false
-		for i := 0; i < batchSize && !done; i++ {
-			select {
-			// 超时情况
-			case <-ctx.Done():
-				done = true
-			case msg, ok := <-msgs:
-				if !ok {
-					cancel()
-					return nil
+		batch, ts, ids, closed, err := b.collect(session.Context(), claim.Messages())
+		if err != nil {
+			return err
+		}
+		err = b.process(session, claim, batch, ts, ids)
+		if err != nil {
+			return err
+		}
+		if closed {
+			return nil
+		}
+	}
+}
+
+// collect 凑一批消息，ids 是每条消息的事件 id，closed 表示不会再有新的消息了
+func (b *BatchHandler[T]) collect(ctx context.Context,
+	msgs <-chan *sarama.ConsumerMessage) (batch []*sarama.ConsumerMessage, ts []T, ids []string, closed bool, err error) {
+	batch = make([]*sarama.ConsumerMessage, 0, b.batchSize)
+	ts = make([]T, 0, b.batchSize)
+	ids = make([]string, 0, b.batchSize)
+	timer := time.NewTimer(b.linger)
+	defer timer.Stop()
+	for len(batch) < b.batchSize {
+		select {
+		case <-ctx.Done():
+			return batch, ts, ids, true, nil
+		// 超时情况
+		case <-timer.C:
+			return batch, ts, ids, false, nil
+		case msg, ok := <-msgs:
+			if !ok {
+				return batch, ts, ids, true, nil
+			}
+			if b.retrier != nil {
+				if err := b.retrier.Wait(ctx, msg); err != nil {
+					// 会话结束了，这条消息没有标记，下次会重新消费
+					return batch, ts, ids, true, nil
 				}
-				//batch = append(batch, msg)
-				var t T
-				err := json.Unmarshal(msg.Value, &t)
-				if err != nil {
-					log.Error("反序列化失败", zap.String("topic", msg.Topic), zap.Int32("partition", msg.Partition), zap.Int64("offset", msg.Offset), zap.Error(err))
-					continue
+			}
+			var t T
+			env, err := Unmarshal(msg.Value, &t)
+			if err != nil {
+				log.Error("反序列化失败", zap.String("topic", msg.Topic), zap.Int32("partition", msg.Partition), zap.Int64("offset", msg.Offset), zap.Error(err))
+				if b.retrier != nil {
+					if er := b.retrier.DeadLetter([]*sarama.ConsumerMessage{msg}, err); er != nil {
+						return batch, ts, ids, true, er
+					}
 				}
-				batch = append(batch, msg)
-				ts = append(ts, t)
+				continue
 			}
+			batch = append(batch, msg)
+			ts = append(ts, t)
+			ids = append(ids, env.Id)
 		}
-		// 凑够一批信息时候，进行处理
-		cancel()
-		err := b.fn(batch, ts)
-		if err != nil {
-			log.Error("处理消息失败", zap.Error(err))
+	}
+	return batch, ts, ids, false, nil
+}
+
+func (b *BatchHandler[T]) process(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim,
+	batch []*sarama.ConsumerMessage, ts []T, ids []string) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	// 会话结束之后还要处理完这一批，不能因为 ctx 取消就放弃重试
+	ctx := context.WithoutCancel(session.Context())
+	topic := claim.Topic()
+	start := time.Now()
+	err := b.handle(ctx, b.dedupe(ctx, batch, ts, ids))
+	batchDurationVec.WithLabelValues(b.name, topic).Observe(time.Since(start).Seconds())
+	batchSizeVec.WithLabelValues(b.name, topic).Observe(float64(len(batch)))
+	if err != nil {
+		// 不提交这一批，重新平衡之后会再次消费
+		log.Error("转发失败的消息失败", zap.Int("cnt", len(batch)), zap.Error(err))
+		return err
+	}
+	// 标记消息
+	for _, msg := range batch {
+		session.MarkMessage(msg, "")
+	}
+	last := batch[len(batch)-1]
+	lagVec.WithLabelValues(b.name, topic, strconv.FormatInt(int64(claim.Partition()), 10)).
+		Set(float64(claim.HighWaterMarkOffset() - last.Offset - 1))
+	if b.commit == CommitSync {
+		session.Commit()
+	}
+	return nil
+}
+
+// batchShard 一批消息里面的一份，三个切片一一对应
+type batchShard[T any] struct {
+	msgs []*sarama.ConsumerMessage
+	ts   []T
+	ids  []string
+}
+
+func (s *batchShard[T]) add(msg *sarama.ConsumerMessage, t T, id string) {
+	s.msgs = append(s.msgs, msg)
+	s.ts = append(s.ts, t)
+	s.ids = append(s.ids, id)
+}
+
+// dedupe 去掉已经处理过的消息，这些消息仍然会被标记
+func (b *BatchHandler[T]) dedupe(ctx context.Context, batch []*sarama.ConsumerMessage, ts []T, ids []string) batchShard[T] {
+	if b.dedup == nil {
+		return batchShard[T]{msgs: batch, ts: ts, ids: ids}
+	}
+	var res batchShard[T]
+	for _, i := range dedupe(ctx, b.dedup, ids) {
+		res.add(batch[i], ts[i], ids[i])
+	}
+	return res
+}
+
+// handle 按照 key 把一批消息分成 concurrency 份并发处理，没有 key 的消息轮流分配
+func (b *BatchHandler[T]) handle(ctx context.Context, batch batchShard[T]) error {
+	if len(batch.msgs) == 0 {
+		return nil
+	}
+	n := min(b.concurrency, len(batch.msgs))
+	if n <= 1 {
+		return b.call(ctx, batch)
+	}
+	shards := make([]batchShard[T], n)
+	for i, msg := range batch.msgs {
+		idx := i % n
+		if len(msg.Key) > 0 {
+			h := fnv.New32a()
+			_, _ = h.Write(msg.Key)
+			idx = int(h.Sum32() % uint32(n))
 		}
-		// 标记消息
-		for _, msg := range batch {
-			session.MarkMessage(msg, "")
+		shards[idx].add(msg, batch.ts[i], batch.ids[i])
+	}
+	var eg errgroup.Group
+	for i := range shards {
+		if len(shards[i].msgs) == 0 {
+			continue
+		}
+		eg.Go(func() error {
+			return b.call(ctx, shards[i])
+		})
+	}
+	return eg.Wait()
+}
+
+// call 没有配置 retrier 的时候失败只记录日志，处理成功之后才标记事件
+func (b *BatchHandler[T]) call(ctx context.Context, shard batchShard[T]) error {
+	fn := func() error {
+		err := b.fn(shard.msgs, shard.ts)
+		if err == nil {
+			markProcessed(ctx, b.dedup, shard.ids)
+		}
+		return err
+	}
+	if b.retrier == nil {
+		err := fn()
+		if err != nil {
+			log.Error("处理消息失败", zap.String("consumer", b.name), zap.Int("cnt", len(shard.msgs)), zap.Error(err))
 		}
+		return nil
 	}
+	return b.retrier.Do(ctx, shard.msgs, fn)
 }
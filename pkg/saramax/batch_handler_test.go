@@ -0,0 +1,124 @@
+package saramax
+
+import (
+	"context"
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBatchHandler_ConsumeClaim(t *testing.T) {
+	testCases := []struct {
+		name    string
+		handler func(fn func(msgs []*sarama.ConsumerMessage, ts []int) error) *BatchHandler[int]
+		keys    []string
+		// 消息都发完之后会话才结束
+		cancel bool
+
+		wantBatches [][]int
+		wantCommits int
+	}{
+		{
+			name: "会话结束的时候处理完凑到一半的批次",
+			handler: func(fn func(msgs []*sarama.ConsumerMessage, ts []int) error) *BatchHandler[int] {
+				return NewBatchHandler[int](fn).WithBatchSize(10).WithLinger(time.Hour)
+			},
+			keys:        []string{"a", "b", "c"},
+			cancel:      true,
+			wantBatches: [][]int{{0, 1, 2}},
+		},
+		{
+			name: "按照 key 分成几份并发处理，同一个 key 保持顺序",
+			handler: func(fn func(msgs []*sarama.ConsumerMessage, ts []int) error) *BatchHandler[int] {
+				return NewBatchHandler[int](fn).WithConfig(BatchConfig{BatchSize: 4, Linger: time.Hour, Concurrency: 2})
+			},
+			keys:        []string{"a", "b", "a", "b"},
+			wantBatches: [][]int{{0, 2}, {1, 3}},
+		},
+		{
+			name: "每一批同步提交",
+			handler: func(fn func(msgs []*sarama.ConsumerMessage, ts []int) error) *BatchHandler[int] {
+				return NewBatchHandler[int](fn).WithBatchSize(2).WithCommit(CommitSync)
+			},
+			keys:        []string{"a", "b", "c", "d"},
+			wantBatches: [][]int{{0, 1}, {2, 3}},
+			wantCommits: 2,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var (
+				mu      sync.Mutex
+				batches [][]int
+			)
+			h := tc.handler(func(msgs []*sarama.ConsumerMessage, ts []int) error {
+				mu.Lock()
+				defer mu.Unlock()
+				batches = append(batches, ts)
+				return nil
+			})
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			session := &fakeSession{ctx: ctx}
+			claim := &fakeClaim{msgs: make(chan *sarama.ConsumerMessage, len(tc.keys))}
+			for i, key := range tc.keys {
+				claim.msgs <- &sarama.ConsumerMessage{Topic: "t", Offset: int64(i),
+					Key: []byte(key), Value: []byte{byte('0' + i)}}
+			}
+			if tc.cancel {
+				go func() {
+					// 等消息都被读走
+					for len(claim.msgs) > 0 {
+						time.Sleep(time.Millisecond)
+					}
+					cancel()
+				}()
+			} else {
+				close(claim.msgs)
+			}
+			err := h.ConsumeClaim(session, claim)
+			assert.NoError(t, err)
+			assert.ElementsMatch(t, tc.wantBatches, batches)
+			assert.Equal(t, len(tc.keys), session.marked)
+			assert.Equal(t, tc.wantCommits, session.commits)
+		})
+	}
+}
+
+type fakeSession struct {
+	ctx     context.Context
+	mu      sync.Mutex
+	marked  int
+	commits int
+}
+
+func (f *fakeSession) Claims() map[string][]int32 { return nil }
+func (f *fakeSession) MemberID() string           { return "" }
+func (f *fakeSession) GenerationID() int32        { return 0 }
+func (f *fakeSession) MarkOffset(topic string, partition int32, offset int64, metadata string) {
+}
+func (f *fakeSession) ResetOffset(topic string, partition int32, offset int64, metadata string) {
+}
+func (f *fakeSession) Context() context.Context { return f.ctx }
+
+func (f *fakeSession) Commit() {
+	f.commits++
+}
+
+func (f *fakeSession) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.marked++
+}
+
+type fakeClaim struct {
+	msgs chan *sarama.ConsumerMessage
+}
+
+func (f *fakeClaim) Topic() string                            { return "t" }
+func (f *fakeClaim) Partition() int32                         { return 0 }
+func (f *fakeClaim) InitialOffset() int64                     { return 0 }
+func (f *fakeClaim) HighWaterMarkOffset() int64               { return int64(cap(f.msgs)) }
+func (f *fakeClaim) Messages() <-chan *sarama.ConsumerMessage { return f.msgs }
@@ -0,0 +1,25 @@
+package saramax
+
+import "github.com/IBM/sarama"
+
+// Broker 消费者和生产者都从这里拿 kafka 的连接，单机运行和测试的时候换成 MemoryBroker 就不需要 kafka
+type Broker interface {
+	ConsumerGroup(group string) (sarama.ConsumerGroup, error)
+	SyncProducer() (sarama.SyncProducer, error)
+}
+
+type KafkaBroker struct {
+	client sarama.Client
+}
+
+func NewKafkaBroker(client sarama.Client) *KafkaBroker {
+	return &KafkaBroker{client: client}
+}
+
+func (b *KafkaBroker) ConsumerGroup(group string) (sarama.ConsumerGroup, error) {
+	return sarama.NewConsumerGroupFromClient(group, b.client)
+}
+
+func (b *KafkaBroker) SyncProducer() (sarama.SyncProducer, error) {
+	return sarama.NewSyncProducerFromClient(b.client)
+}
@@ -1,7 +1,7 @@
 package saramax
 
 import (
-	"encoding/json"
+	"context"
 	"github.com/IBM/sarama"
 	"github.com/Tuanzi-bug/tuan-book/pkg/log"
 	"go.uber.org/zap"
@@ -9,12 +9,28 @@ import (
 
 type Handler[T any] struct {
 	fn func(msg *sarama.ConsumerMessage, t T) error
+	// 为 nil 的时候失败的消息只记录日志
+	retrier *Retrier
+	// 为 nil 的时候不去重
+	dedup Deduplicator
 }
 
 func NewHandler[T any](fn func(msg *sarama.ConsumerMessage, t T) error) *Handler[T] {
 	return &Handler[T]{fn: fn}
 }
 
+// WithRetrier 处理失败的消息按照 retrier 的策略重试，消费者还需要订阅 retrier.Topics()
+func (h *Handler[T]) WithRetrier(retrier *Retrier) *Handler[T] {
+	h.retrier = retrier
+	return h
+}
+
+// WithDeduplicator 按照事件 id 跳过已经处理过的消息
+func (h *Handler[T]) WithDeduplicator(dedup Deduplicator) *Handler[T] {
+	h.dedup = dedup
+	return h
+}
+
 func (h *Handler[T]) Setup(session sarama.ConsumerGroupSession) error {
 	return nil
 }
@@ -23,25 +39,62 @@ func (h *Handler[T]) Cleanup(session sarama.ConsumerGroupSession) error {
 	return nil
 }
 
-// ConsumeClaim 可以考虑在这个封装里面提供统一的重试机制
+// ConsumeClaim 配置了 retrier 的时候，只有转发到重试 topic 或者死信队列也失败才会返回 error，
+// 这时候消息没有提交，重新平衡之后会再次消费
 func (h *Handler[T]) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
 	msgs := claim.Messages()
 	for msg := range msgs {
+		if h.retrier != nil {
+			if err := h.retrier.Wait(session.Context(), msg); err != nil {
+				return err
+			}
+		}
 		var t T
-		err := json.Unmarshal(msg.Value, &t)
+		env, err := Unmarshal(msg.Value, &t)
 		if err != nil {
 			// 消息格式都不对，没啥好处理的
 			// 但是也不能直接返回，在线上的时候要继续处理下去
 			log.Error("反序列化失败", zap.String("topic", msg.Topic), zap.Int32("partition", msg.Partition), zap.Int64("offset", msg.Offset), zap.Error(err))
+			if h.retrier != nil {
+				if er := h.retrier.DeadLetter([]*sarama.ConsumerMessage{msg}, err); er != nil {
+					return er
+				}
+			}
 			// 不中断，继续下一个
 			session.MarkMessage(msg, "")
 			continue
 		}
-		err = h.fn(msg, t)
+		ids := []string{env.Id}
+		if len(dedupe(session.Context(), h.dedup, ids)) == 0 {
+			// 重复投递的事件
+			session.MarkMessage(msg, "")
+			continue
+		}
+		if h.retrier == nil {
+			err = h.call(msg, t, ids)
+			if err != nil {
+				log.Error("处理消息失败", zap.String("topic", msg.Topic), zap.Int32("partition", msg.Partition), zap.Int64("offset", msg.Offset), zap.Error(err))
+			}
+			session.MarkMessage(msg, "")
+			continue
+		}
+		err = h.retrier.Do(session.Context(), []*sarama.ConsumerMessage{msg}, func() error {
+			return h.call(msg, t, ids)
+		})
 		if err != nil {
-			log.Error("处理消息失败", zap.String("topic", msg.Topic), zap.Int32("partition", msg.Partition), zap.Int64("offset", msg.Offset), zap.Error(err))
+			log.Error("转发失败的消息失败", zap.String("topic", msg.Topic), zap.Int32("partition", msg.Partition), zap.Int64("offset", msg.Offset), zap.Error(err))
+			return err
 		}
 		session.MarkMessage(msg, "")
 	}
 	return nil
 }
+
+// call 处理成功之后才标记事件，转发到重试 topic 的消息还要再处理
+func (h *Handler[T]) call(msg *sarama.ConsumerMessage, t T, ids []string) error {
+	err := h.fn(msg, t)
+	if err == nil {
+		markProcessed(context.Background(), h.dedup, ids)
+	}
+	return err
+}
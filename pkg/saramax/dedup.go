@@ -0,0 +1,132 @@
+package saramax
+
+import (
+	"context"
+	"github.com/Tuanzi-bug/tuan-book/pkg/log"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"time"
+)
+
+// Deduplicator 按照事件 id 去重，重复投递的事件不再处理。
+// 处理成功之后才 Mark，所以处理完还没来得及 Mark 就挂了的话还是会重复，只是窗口小了很多
+type Deduplicator interface {
+	// Seen 返回每个 id 是否已经处理过
+	Seen(ctx context.Context, ids []string) ([]bool, error)
+	Mark(ctx context.Context, ids []string) error
+}
+
+// RedisDeduplicator 每个消费者组一个，同一个事件不同的消费者组要各自处理一次
+type RedisDeduplicator struct {
+	client redis.Cmdable
+	group  string
+	// 超过这个时间之后重复投递的事件不能识别出来
+	ttl time.Duration
+}
+
+func NewRedisDeduplicator(client redis.Cmdable, group string, ttl time.Duration) *RedisDeduplicator {
+	return &RedisDeduplicator{
+		client: client,
+		group:  group,
+		ttl:    ttl,
+	}
+}
+
+func (r *RedisDeduplicator) Seen(ctx context.Context, ids []string) ([]bool, error) {
+	pipe := r.client.Pipeline()
+	cmds := make([]*redis.IntCmd, 0, len(ids))
+	for _, id := range ids {
+		cmds = append(cmds, pipe.Exists(ctx, r.key(id)))
+	}
+	_, err := pipe.Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]bool, 0, len(ids))
+	for _, cmd := range cmds {
+		res = append(res, cmd.Val() > 0)
+	}
+	return res, nil
+}
+
+func (r *RedisDeduplicator) Mark(ctx context.Context, ids []string) error {
+	pipe := r.client.Pipeline()
+	for _, id := range ids {
+		pipe.Set(ctx, r.key(id), 1, r.ttl)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (r *RedisDeduplicator) key(id string) string {
+	return "event:dedup:" + r.group + ":" + id
+}
+
+// dedupe 返回需要处理的下标，已经处理过的和同一批里面重复的都去掉。
+// 没有事件 id 的老消息都要处理，查询失败的时候也都处理，宁可重复也不能丢
+func dedupe(ctx context.Context, d Deduplicator, ids []string) []int {
+	idx := make([]int, 0, len(ids))
+	if d == nil {
+		for i := range ids {
+			idx = append(idx, i)
+		}
+		return idx
+	}
+	checkIdx := make([]int, 0, len(ids))
+	checkIds := make([]string, 0, len(ids))
+	dup := make(map[string]struct{}, len(ids))
+	for i, id := range ids {
+		if id == "" {
+			continue
+		}
+		if _, ok := dup[id]; ok {
+			continue
+		}
+		dup[id] = struct{}{}
+		checkIdx = append(checkIdx, i)
+		checkIds = append(checkIds, id)
+	}
+	var seen []bool
+	if len(checkIds) > 0 {
+		var err error
+		seen, err = d.Seen(ctx, checkIds)
+		if err != nil {
+			log.Error("查询事件是否处理过失败", zap.Int("cnt", len(checkIds)), zap.Error(err))
+			seen = nil
+		}
+	}
+	keep := make([]bool, len(ids))
+	for i, id := range ids {
+		keep[i] = id == ""
+	}
+	// 同一批里面重复的只保留第一次出现的
+	for j, i := range checkIdx {
+		keep[i] = seen == nil || !seen[j]
+	}
+	for i := range ids {
+		if keep[i] {
+			idx = append(idx, i)
+		}
+	}
+	return idx
+}
+
+// markProcessed 标记失败只记录日志，最多就是重复处理一次
+func markProcessed(ctx context.Context, d Deduplicator, ids []string) {
+	if d == nil {
+		return
+	}
+	marks := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if id != "" {
+			marks = append(marks, id)
+		}
+	}
+	if len(marks) == 0 {
+		return
+	}
+	err := d.Mark(ctx, marks)
+	if err != nil {
+		log.Error("标记事件已经处理失败", zap.Int("cnt", len(marks)), zap.Error(err))
+	}
+}
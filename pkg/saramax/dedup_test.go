@@ -0,0 +1,109 @@
+package saramax
+
+import (
+	"context"
+	"errors"
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memDeduplicator 测试用，seenErr 不为 nil 的时候 Seen 返回这个错误
+type memDeduplicator struct {
+	mu      sync.Mutex
+	ids     map[string]struct{}
+	seenErr error
+}
+
+func (m *memDeduplicator) Seen(ctx context.Context, ids []string) ([]bool, error) {
+	if m.seenErr != nil {
+		return nil, m.seenErr
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	res := make([]bool, 0, len(ids))
+	for _, id := range ids {
+		_, ok := m.ids[id]
+		res = append(res, ok)
+	}
+	return res, nil
+}
+
+func (m *memDeduplicator) Mark(ctx context.Context, ids []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, id := range ids {
+		m.ids[id] = struct{}{}
+	}
+	return nil
+}
+
+func TestDedupe(t *testing.T) {
+	testCases := []struct {
+		name  string
+		dedup Deduplicator
+		ids   []string
+
+		wantIdx []int
+	}{
+		{
+			name:    "没有配置去重",
+			ids:     []string{"a", "a"},
+			wantIdx: []int{0, 1},
+		},
+		{
+			name:    "跳过处理过的和同一批里面重复的",
+			dedup:   &memDeduplicator{ids: map[string]struct{}{"b": {}}},
+			ids:     []string{"a", "b", "", "a", "c", ""},
+			wantIdx: []int{0, 2, 4, 5},
+		},
+		{
+			name:    "查询失败的时候都处理，同一批里面重复的还是跳过",
+			dedup:   &memDeduplicator{seenErr: errors.New("模拟 redis 错误")},
+			ids:     []string{"a", "b", "a"},
+			wantIdx: []int{0, 1},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.wantIdx, dedupe(context.Background(), tc.dedup, tc.ids))
+		})
+	}
+}
+
+// TestBatchHandler_Deduplicator 同一个事件投递两次只处理一次，但是两条消息都会被标记
+func TestBatchHandler_Deduplicator(t *testing.T) {
+	b := NewMemoryBroker(1, 0)
+	p, err := b.SyncProducer()
+	require.NoError(t, err)
+	first, err := MarshalEnvelope(context.Background(), "test.dedup", 1, 1)
+	require.NoError(t, err)
+	second, err := MarshalEnvelope(context.Background(), "test.dedup", 1, 2)
+	require.NoError(t, err)
+	for _, val := range [][]byte{first, first, second, first} {
+		_, _, err = p.SendMessage(&sarama.ProducerMessage{Topic: "dedup", Value: sarama.ByteEncoder(val)})
+		require.NoError(t, err)
+	}
+
+	dedup := &memDeduplicator{ids: map[string]struct{}{}}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	var got []int
+	h := NewBatchHandler[int](func(msgs []*sarama.ConsumerMessage, ts []int) error {
+		got = append(got, ts...)
+		if len(got) == 2 {
+			cancel()
+		}
+		return nil
+	}).WithBatchSize(2).WithLinger(time.Millisecond * 10).WithDeduplicator(dedup)
+	cg, err := b.ConsumerGroup("dedup")
+	require.NoError(t, err)
+	require.NoError(t, cg.Consume(ctx, []string{"dedup"}, h))
+	assert.Equal(t, []int{1, 2}, got)
+	assert.Len(t, dedup.ids, 2)
+	// 所有的消息都标记了，重新消费的时候不会再收到
+	assert.Empty(t, consume(t, b, "dedup", "dedup", 1))
+}
@@ -0,0 +1,159 @@
+package saramax
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/IBM/sarama"
+	"github.com/Tuanzi-bug/tuan-book/pkg/trace"
+	"github.com/google/uuid"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 发送的时候把信封里面的元数据放到消息头里面，不需要解析消息体就能知道是什么事件
+const (
+	HeaderEventId      = "x-event-id"
+	HeaderEventType    = "x-event-type"
+	HeaderEventVersion = "x-event-version"
+	HeaderTraceId      = "x-trace-id"
+)
+
+// ProducerName 写在信封里面，默认是机器名，排查问题的时候知道是哪个节点发出来的
+var ProducerName = defaultProducerName()
+
+func defaultProducerName() string {
+	name, err := os.Hostname()
+	if err != nil || name == "" {
+		return "tuan-book"
+	}
+	return name
+}
+
+// Envelope 所有事件共用的信封，Data 是具体的事件
+type Envelope struct {
+	Id   string `json:"id"`
+	Type string `json:"type"`
+	// Version 事件结构体的版本，修改了结构体之后加一，并且注册从旧版本升级的 Upcaster
+	Version int `json:"version"`
+	// OccurredAt 毫秒时间戳，事件发生的时间，不是发送到 kafka 的时间
+	OccurredAt int64  `json:"occurredAt"`
+	Producer   string `json:"producer"`
+	// TraceId 同一个链路上的事件共用，从 ctx 里面取，没有的时候和 Id 相同
+	TraceId string          `json:"traceId,omitempty"`
+	Data    json.RawMessage `json:"data"`
+}
+
+func NewEnvelope(ctx context.Context, typ string, version int, data any) (Envelope, error) {
+	val, err := json.Marshal(data)
+	if err != nil {
+		return Envelope{}, err
+	}
+	id := uuid.New().String()
+	traceId := trace.IdFromContext(ctx)
+	if traceId == "" {
+		traceId = id
+	}
+	return Envelope{
+		Id:         id,
+		Type:       typ,
+		Version:    version,
+		OccurredAt: time.Now().UnixMilli(),
+		Producer:   ProducerName,
+		TraceId:    traceId,
+		Data:       val,
+	}, nil
+}
+
+// MarshalEnvelope 把 data 装进信封之后序列化
+func MarshalEnvelope(ctx context.Context, typ string, version int, data any) ([]byte, error) {
+	env, err := NewEnvelope(ctx, typ, version, data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(env)
+}
+
+// Headers 发送到 kafka 的时候带上的消息头
+func (e Envelope) Headers() []sarama.RecordHeader {
+	return []sarama.RecordHeader{
+		{Key: []byte(HeaderEventId), Value: []byte(e.Id)},
+		{Key: []byte(HeaderEventType), Value: []byte(e.Type)},
+		{Key: []byte(HeaderEventVersion), Value: []byte(strconv.Itoa(e.Version))},
+		{Key: []byte(HeaderTraceId), Value: []byte(e.TraceId)},
+	}
+}
+
+// EnvelopeHeaders 已经序列化好的消息，比如 outbox 里面的，不是信封的时候返回 nil
+func EnvelopeHeaders(val []byte) []sarama.RecordHeader {
+	env, ok := decodeEnvelope(val)
+	if !ok {
+		return nil
+	}
+	return env.Headers()
+}
+
+// Upcaster 把某个版本的 Data 升级到下一个版本
+type Upcaster func(data json.RawMessage) (json.RawMessage, error)
+
+var (
+	upcastersMu sync.RWMutex
+	// 事件类型 -> 旧版本 -> 升级到下一个版本的函数
+	upcasters = map[string]map[int]Upcaster{}
+)
+
+// RegisterUpcaster 注册 typ 事件从 from 版本升级到 from+1 版本的函数，一般在事件所在的包的 init 里面调用
+func RegisterUpcaster(typ string, from int, fn Upcaster) {
+	upcastersMu.Lock()
+	defer upcastersMu.Unlock()
+	m, ok := upcasters[typ]
+	if !ok {
+		m = make(map[int]Upcaster)
+		upcasters[typ] = m
+	}
+	m[from] = fn
+}
+
+// Unmarshal 拆开信封，按照注册的 Upcaster 一直升级到最新的版本之后反序列化到 t。
+// 没有信封的老消息直接反序列化，返回的 Envelope 只有 Data
+func Unmarshal(val []byte, t any) (Envelope, error) {
+	env, ok := decodeEnvelope(val)
+	if !ok {
+		return Envelope{Data: val}, json.Unmarshal(val, t)
+	}
+	env, err := upcast(env)
+	if err != nil {
+		return env, err
+	}
+	return env, json.Unmarshal(env.Data, t)
+}
+
+func upcast(env Envelope) (Envelope, error) {
+	upcastersMu.RLock()
+	defer upcastersMu.RUnlock()
+	m := upcasters[env.Type]
+	for {
+		fn, ok := m[env.Version]
+		if !ok {
+			return env, nil
+		}
+		data, err := fn(env.Data)
+		if err != nil {
+			return env, fmt.Errorf("升级事件 %s 版本 %d 失败 %w", env.Type, env.Version, err)
+		}
+		env.Data = data
+		env.Version++
+	}
+}
+
+// decodeEnvelope 有事件类型和消息体的才算信封
+func decodeEnvelope(val []byte) (Envelope, bool) {
+	var env Envelope
+	err := json.Unmarshal(val, &env)
+	if err != nil || env.Type == "" || len(env.Data) == 0 {
+		return Envelope{}, false
+	}
+	return env, true
+}
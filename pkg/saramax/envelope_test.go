@@ -0,0 +1,130 @@
+package saramax
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/Tuanzi-bug/tuan-book/pkg/trace"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+type testEventV2 struct {
+	Aid  int64
+	Uids []int64
+}
+
+func TestUnmarshal(t *testing.T) {
+	// v1 只有一个 Uid，v2 改成了 Uids
+	RegisterUpcaster("test.upcast", 1, func(data json.RawMessage) (json.RawMessage, error) {
+		var v1 struct {
+			Aid int64
+			Uid int64
+		}
+		if err := json.Unmarshal(data, &v1); err != nil {
+			return nil, err
+		}
+		return json.Marshal(testEventV2{Aid: v1.Aid, Uids: []int64{v1.Uid}})
+	})
+	RegisterUpcaster("test.broken", 1, func(data json.RawMessage) (json.RawMessage, error) {
+		return nil, errors.New("模拟升级失败")
+	})
+	marshal := func(typ string, version int, data any) []byte {
+		val, err := MarshalEnvelope(context.Background(), typ, version, data)
+		require.NoError(t, err)
+		return val
+	}
+	testCases := []struct {
+		name string
+		val  []byte
+
+		wantEvt     testEventV2
+		wantType    string
+		wantVersion int
+		wantErr     bool
+	}{
+		{
+			name:        "最新版本",
+			val:         marshal("test.upcast", 2, testEventV2{Aid: 1, Uids: []int64{2, 3}}),
+			wantEvt:     testEventV2{Aid: 1, Uids: []int64{2, 3}},
+			wantType:    "test.upcast",
+			wantVersion: 2,
+		},
+		{
+			name: "旧版本升级到最新版本",
+			val: marshal("test.upcast", 1, struct {
+				Aid int64
+				Uid int64
+			}{Aid: 1, Uid: 2}),
+			wantEvt:     testEventV2{Aid: 1, Uids: []int64{2}},
+			wantType:    "test.upcast",
+			wantVersion: 2,
+		},
+		{
+			name:    "没有信封的老消息",
+			val:     []byte(`{"Aid":1,"Uids":[2]}`),
+			wantEvt: testEventV2{Aid: 1, Uids: []int64{2}},
+		},
+		{
+			name:    "升级失败",
+			val:     marshal("test.broken", 1, testEventV2{Aid: 1}),
+			wantErr: true,
+		},
+		{
+			name:    "格式不对",
+			val:     []byte(`not json`),
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var evt testEventV2
+			env, err := Unmarshal(tc.val, &evt)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantEvt, evt)
+			assert.Equal(t, tc.wantType, env.Type)
+			assert.Equal(t, tc.wantVersion, env.Version)
+			if tc.wantType != "" {
+				assert.NotEmpty(t, env.Id)
+				assert.Equal(t, env.Id, env.TraceId)
+				assert.Equal(t, ProducerName, env.Producer)
+			}
+		})
+	}
+}
+
+func TestEnvelopeHeaders(t *testing.T) {
+	val, err := MarshalEnvelope(context.Background(), "test.headers", 3, testEventV2{Aid: 1})
+	require.NoError(t, err)
+	var env Envelope
+	require.NoError(t, json.Unmarshal(val, &env))
+	headers := map[string]string{}
+	for _, h := range EnvelopeHeaders(val) {
+		headers[string(h.Key)] = string(h.Value)
+	}
+	assert.Equal(t, map[string]string{
+		HeaderEventId:      env.Id,
+		HeaderEventType:    "test.headers",
+		HeaderEventVersion: "3",
+		HeaderTraceId:      env.Id,
+	}, headers)
+	assert.Nil(t, EnvelopeHeaders([]byte(`{"Aid":1}`)))
+}
+
+func TestNewEnvelope_TraceId(t *testing.T) {
+	// 请求里面带了链路 id
+	env, err := NewEnvelope(trace.WithId(context.Background(), "abc"), "test.trace", 1, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "abc", env.TraceId)
+	assert.NotEqual(t, env.Id, env.TraceId)
+
+	// 没有的时候和事件 id 相同
+	env, err = NewEnvelope(context.Background(), "test.trace", 1, 1)
+	require.NoError(t, err)
+	assert.Equal(t, env.Id, env.TraceId)
+}
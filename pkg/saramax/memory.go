@@ -0,0 +1,483 @@
+package saramax
+
+import (
+	"context"
+	"github.com/IBM/sarama"
+	"hash/fnv"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MemoryBroker 进程内的 broker，单机运行和测试的时候代替 kafka。
+// 每个 topic 按照 key 分成若干个分区，每个消费者组分别记录每个分区消费到了哪里。
+// 和 kafka 不一样的地方：
+//  1. 同一个消费者组同一时间只有一个 Consume 在运行，后面的等前面的结束
+//  2. 没有消费过的消费者组从最早的消息开始消费
+//  3. 标记之后立刻生效，Commit 什么也不做
+//  4. 每个分区最多保留 retention 条消息，进程退出之后消息和进度都没有了
+type MemoryBroker struct {
+	mu         sync.Mutex
+	partitions int
+	retention  int
+	topics     map[string]*memTopic
+	groups     map[string]*memGroup
+	generation int32
+}
+
+type memTopic struct {
+	partitions []*memPartition
+	// 没有 key 的消息轮流分配
+	next int
+}
+
+type memPartition struct {
+	// msgs[0] 的 offset，超过 retention 的旧消息删掉之后会变大
+	base int64
+	msgs []*sarama.ConsumerMessage
+	// 有新消息的时候关闭，然后换成一个新的
+	notify chan struct{}
+}
+
+type memGroup struct {
+	// 容量为 1，拿到了才能 Consume
+	lock chan struct{}
+	// 下一条要消费的消息的 offset
+	offsets map[string]map[int32]int64
+}
+
+// NewMemoryBroker partitions 和 retention 小于等于 0 的时候分别使用 4 和 10000
+func NewMemoryBroker(partitions int, retention int) *MemoryBroker {
+	if partitions <= 0 {
+		partitions = 4
+	}
+	if retention <= 0 {
+		retention = 10000
+	}
+	return &MemoryBroker{
+		partitions: partitions,
+		retention:  retention,
+		topics:     make(map[string]*memTopic),
+		groups:     make(map[string]*memGroup),
+	}
+}
+
+func (b *MemoryBroker) ConsumerGroup(group string) (sarama.ConsumerGroup, error) {
+	b.mu.Lock()
+	g, ok := b.groups[group]
+	if !ok {
+		g = &memGroup{
+			lock:    make(chan struct{}, 1),
+			offsets: make(map[string]map[int32]int64),
+		}
+		b.groups[group] = g
+	}
+	b.mu.Unlock()
+	return &memConsumerGroup{
+		broker: b,
+		name:   group,
+		group:  g,
+		errs:   make(chan error, 16),
+		closed: make(chan struct{}),
+	}, nil
+}
+
+// SyncProducer 所有的生产者共用同一份数据，Close 不会影响别的生产者
+func (b *MemoryBroker) SyncProducer() (sarama.SyncProducer, error) {
+	return &memProducer{broker: b}, nil
+}
+
+// topic 调用者需要持有锁
+func (b *MemoryBroker) topic(name string) *memTopic {
+	t, ok := b.topics[name]
+	if ok {
+		return t
+	}
+	t = &memTopic{partitions: make([]*memPartition, b.partitions)}
+	for i := range t.partitions {
+		t.partitions[i] = &memPartition{notify: make(chan struct{})}
+	}
+	b.topics[name] = t
+	return t
+}
+
+func (b *MemoryBroker) send(msg *sarama.ProducerMessage) (int32, int64, error) {
+	if msg.Topic == "" {
+		return -1, -1, sarama.ErrInvalidTopic
+	}
+	var (
+		key, val []byte
+		err      error
+	)
+	if msg.Key != nil {
+		key, err = msg.Key.Encode()
+		if err != nil {
+			return -1, -1, err
+		}
+	}
+	if msg.Value != nil {
+		val, err = msg.Value.Encode()
+		if err != nil {
+			return -1, -1, err
+		}
+	}
+	headers := make([]*sarama.RecordHeader, 0, len(msg.Headers))
+	for i := range msg.Headers {
+		h := msg.Headers[i]
+		headers = append(headers, &h)
+	}
+	if msg.Timestamp.IsZero() {
+		msg.Timestamp = time.Now()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t := b.topic(msg.Topic)
+	var partition int32
+	if key != nil {
+		h := fnv.New32a()
+		_, _ = h.Write(key)
+		partition = int32(h.Sum32() % uint32(len(t.partitions)))
+	} else {
+		partition = int32(t.next % len(t.partitions))
+		t.next++
+	}
+	p := t.partitions[partition]
+	offset := p.base + int64(len(p.msgs))
+	p.msgs = append(p.msgs, &sarama.ConsumerMessage{
+		Topic:     msg.Topic,
+		Partition: partition,
+		Offset:    offset,
+		Key:       key,
+		Value:     val,
+		Headers:   headers,
+		Timestamp: msg.Timestamp,
+	})
+	if len(p.msgs) > b.retention {
+		// 一次删掉一半，避免每条消息都要挪一次
+		n := len(p.msgs) - b.retention/2
+		p.msgs = slices.Clone(p.msgs[n:])
+		p.base += int64(n)
+	}
+	close(p.notify)
+	p.notify = make(chan struct{})
+	msg.Partition, msg.Offset = partition, offset
+	return partition, offset, nil
+}
+
+// read 返回 offset 开始的所有消息，没有新消息的时候等 notify 关闭
+func (b *MemoryBroker) read(topic string, partition int32, offset int64) ([]*sarama.ConsumerMessage, <-chan struct{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	p := b.topic(topic).partitions[partition]
+	// 已经被删掉的消息跳过
+	idx := max(offset-p.base, 0)
+	if idx >= int64(len(p.msgs)) {
+		return nil, p.notify
+	}
+	return p.msgs[idx:len(p.msgs):len(p.msgs)], p.notify
+}
+
+func (b *MemoryBroker) highWaterMark(topic string, partition int32) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	p := b.topic(topic).partitions[partition]
+	return p.base + int64(len(p.msgs))
+}
+
+type memProducer struct {
+	broker *MemoryBroker
+}
+
+func (p *memProducer) SendMessage(msg *sarama.ProducerMessage) (int32, int64, error) {
+	return p.broker.send(msg)
+}
+
+// SendMessages 和 sarama 一样，失败的消息通过 sarama.ProducerErrors 返回
+func (p *memProducer) SendMessages(msgs []*sarama.ProducerMessage) error {
+	var errs sarama.ProducerErrors
+	for _, msg := range msgs {
+		_, _, err := p.broker.send(msg)
+		if err != nil {
+			errs = append(errs, &sarama.ProducerError{Msg: msg, Err: err})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (p *memProducer) Close() error {
+	return nil
+}
+
+func (p *memProducer) TxnStatus() sarama.ProducerTxnStatusFlag {
+	return sarama.ProducerTxnFlagReady
+}
+
+// IsTransactional 不支持事务
+func (p *memProducer) IsTransactional() bool {
+	return false
+}
+
+func (p *memProducer) BeginTxn() error {
+	return sarama.ErrNonTransactedProducer
+}
+
+func (p *memProducer) CommitTxn() error {
+	return sarama.ErrNonTransactedProducer
+}
+
+func (p *memProducer) AbortTxn() error {
+	return sarama.ErrNonTransactedProducer
+}
+
+func (p *memProducer) AddOffsetsToTxn(offsets map[string][]*sarama.PartitionOffsetMetadata, groupId string) error {
+	return sarama.ErrNonTransactedProducer
+}
+
+func (p *memProducer) AddMessageToTxn(msg *sarama.ConsumerMessage, groupId string, metadata *string) error {
+	return sarama.ErrNonTransactedProducer
+}
+
+type memConsumerGroup struct {
+	broker    *MemoryBroker
+	name      string
+	group     *memGroup
+	errs      chan error
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// Consume 和 sarama 一样，ctx 结束或者任何一个 ConsumeClaim 返回的时候会话结束
+func (c *memConsumerGroup) Consume(ctx context.Context, topics []string, handler sarama.ConsumerGroupHandler) error {
+	if len(topics) == 0 {
+		return sarama.ConfigurationError("no topics provided")
+	}
+	select {
+	case c.group.lock <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.closed:
+		return sarama.ErrClosedConsumerGroup
+	}
+	defer func() {
+		<-c.group.lock
+	}()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-c.closed:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	sess := c.newSession(ctx, topics)
+	err := handler.Setup(sess)
+	if err != nil {
+		return err
+	}
+	var wg sync.WaitGroup
+	for topic, partitions := range sess.claims {
+		for _, partition := range partitions {
+			claim := &memClaim{
+				broker:    c.broker,
+				topic:     topic,
+				partition: partition,
+				initial:   sess.offset(topic, partition),
+				msgs:      make(chan *sarama.ConsumerMessage, 256),
+			}
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				claim.feed(ctx)
+			}()
+			go func() {
+				defer wg.Done()
+				defer cancel()
+				if er := handler.ConsumeClaim(sess, claim); er != nil {
+					c.handleError(er)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	return handler.Cleanup(sess)
+}
+
+func (c *memConsumerGroup) newSession(ctx context.Context, topics []string) *memSession {
+	b := c.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.generation++
+	claims := make(map[string][]int32, len(topics))
+	for _, topic := range topics {
+		t := b.topic(topic)
+		partitions := make([]int32, 0, len(t.partitions))
+		for i := range t.partitions {
+			partitions = append(partitions, int32(i))
+		}
+		claims[topic] = partitions
+	}
+	return &memSession{
+		ctx:        ctx,
+		broker:     b,
+		group:      c.group,
+		claims:     claims,
+		memberID:   c.name + "-" + strconv.Itoa(int(b.generation)),
+		generation: b.generation,
+	}
+}
+
+// handleError Errors 没有人读的时候直接丢掉
+func (c *memConsumerGroup) handleError(err error) {
+	select {
+	case c.errs <- err:
+	default:
+	}
+}
+
+func (c *memConsumerGroup) Errors() <-chan error {
+	return c.errs
+}
+
+func (c *memConsumerGroup) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+	})
+	return nil
+}
+
+// Pause 没有实现，内存里面不需要控制拉取的速度
+func (c *memConsumerGroup) Pause(partitions map[string][]int32) {}
+
+func (c *memConsumerGroup) Resume(partitions map[string][]int32) {}
+
+func (c *memConsumerGroup) PauseAll() {}
+
+func (c *memConsumerGroup) ResumeAll() {}
+
+type memSession struct {
+	ctx        context.Context
+	broker     *MemoryBroker
+	group      *memGroup
+	claims     map[string][]int32
+	memberID   string
+	generation int32
+}
+
+func (s *memSession) Claims() map[string][]int32 {
+	return s.claims
+}
+
+func (s *memSession) MemberID() string {
+	return s.memberID
+}
+
+func (s *memSession) GenerationID() int32 {
+	return s.generation
+}
+
+// MarkOffset 和 kafka 一样只能往前
+func (s *memSession) MarkOffset(topic string, partition int32, offset int64, metadata string) {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	offsets := s.partitionOffsets(topic)
+	if offset > offsets[partition] {
+		offsets[partition] = offset
+	}
+}
+
+// Commit 标记的时候已经生效了
+func (s *memSession) Commit() {}
+
+func (s *memSession) ResetOffset(topic string, partition int32, offset int64, metadata string) {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	s.partitionOffsets(topic)[partition] = offset
+}
+
+func (s *memSession) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	s.MarkOffset(msg.Topic, msg.Partition, msg.Offset+1, metadata)
+}
+
+func (s *memSession) Context() context.Context {
+	return s.ctx
+}
+
+func (s *memSession) offset(topic string, partition int32) int64 {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	return s.partitionOffsets(topic)[partition]
+}
+
+// partitionOffsets 调用者需要持有锁
+func (s *memSession) partitionOffsets(topic string) map[int32]int64 {
+	offsets, ok := s.group.offsets[topic]
+	if !ok {
+		offsets = make(map[int32]int64)
+		s.group.offsets[topic] = offsets
+	}
+	return offsets
+}
+
+type memClaim struct {
+	broker    *MemoryBroker
+	topic     string
+	partition int32
+	initial   int64
+	msgs      chan *sarama.ConsumerMessage
+}
+
+func (c *memClaim) Topic() string {
+	return c.topic
+}
+
+func (c *memClaim) Partition() int32 {
+	return c.partition
+}
+
+func (c *memClaim) InitialOffset() int64 {
+	return c.initial
+}
+
+func (c *memClaim) HighWaterMarkOffset() int64 {
+	return c.broker.highWaterMark(c.topic, c.partition)
+}
+
+func (c *memClaim) Messages() <-chan *sarama.ConsumerMessage {
+	return c.msgs
+}
+
+// feed 把新消息不断地放进 msgs，ctx 结束的时候关闭 msgs
+func (c *memClaim) feed(ctx context.Context) {
+	defer close(c.msgs)
+	offset := c.initial
+	for {
+		msgs, notify := c.broker.read(c.topic, c.partition, offset)
+		for _, msg := range msgs {
+			select {
+			case c.msgs <- msg:
+				offset = msg.Offset + 1
+			case <-ctx.Done():
+				return
+			}
+		}
+		if len(msgs) > 0 {
+			continue
+		}
+		select {
+		case <-notify:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+var _ Broker = (*MemoryBroker)(nil)
+var _ sarama.SyncProducer = (*memProducer)(nil)
+var _ sarama.ConsumerGroup = (*memConsumerGroup)(nil)
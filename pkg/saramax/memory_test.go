@@ -0,0 +1,120 @@
+package saramax
+
+import (
+	"context"
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordHandler 记录收到的消息，收到 want 条之后调用 done
+type recordHandler struct {
+	mu   sync.Mutex
+	msgs []*sarama.ConsumerMessage
+	want int
+	done context.CancelFunc
+}
+
+func (h *recordHandler) Setup(session sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+func (h *recordHandler) Cleanup(session sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+func (h *recordHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for msg := range claim.Messages() {
+		session.MarkMessage(msg, "")
+		h.mu.Lock()
+		h.msgs = append(h.msgs, msg)
+		if len(h.msgs) == h.want {
+			h.done()
+		}
+		h.mu.Unlock()
+	}
+	return nil
+}
+
+// consume 收到 want 条消息或者超时之后返回收到的消息
+func consume(t *testing.T, b *MemoryBroker, group string, topic string, want int) []*sarama.ConsumerMessage {
+	cg, err := b.ConsumerGroup(group)
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	h := &recordHandler{want: want, done: cancel}
+	err = cg.Consume(ctx, []string{topic}, h)
+	require.NoError(t, err)
+	return h.msgs
+}
+
+func values(msgs []*sarama.ConsumerMessage) []string {
+	res := make([]string, 0, len(msgs))
+	for _, msg := range msgs {
+		res = append(res, string(msg.Value))
+	}
+	return res
+}
+
+func TestMemoryBroker(t *testing.T) {
+	b := NewMemoryBroker(2, 0)
+	p, err := b.SyncProducer()
+	require.NoError(t, err)
+	send := func(vals ...string) {
+		for _, val := range vals {
+			_, _, err := p.SendMessage(&sarama.ProducerMessage{Topic: "t",
+				Key: sarama.StringEncoder("k"), Value: sarama.StringEncoder(val)})
+			require.NoError(t, err)
+		}
+	}
+
+	send("a", "b", "c")
+	// 同一个 key 在同一个分区，保持顺序
+	assert.Equal(t, []string{"a", "b", "c"}, values(consume(t, b, "g1", "t", 3)))
+	// 另外一个消费者组从头开始
+	assert.Equal(t, []string{"a", "b", "c"}, values(consume(t, b, "g2", "t", 3)))
+
+	send("d")
+	// 重新开始消费的时候从上次标记的位置继续
+	assert.Equal(t, []string{"d"}, values(consume(t, b, "g1", "t", 1)))
+	assert.Empty(t, consume(t, b, "g1", "t", 1))
+}
+
+func TestMemoryBroker_BatchHandler(t *testing.T) {
+	b := NewMemoryBroker(4, 0)
+	p, err := b.SyncProducer()
+	require.NoError(t, err)
+	cg, err := b.ConsumerGroup("batch")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	var (
+		mu  sync.Mutex
+		got []int
+	)
+	h := NewBatchHandler[int](func(msgs []*sarama.ConsumerMessage, ts []int) error {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, ts...)
+		if len(got) == 10 {
+			cancel()
+		}
+		return nil
+	}).WithBatchSize(3).WithLinger(time.Millisecond * 10)
+	done := make(chan error)
+	go func() {
+		done <- cg.Consume(ctx, []string{"batch"}, h)
+	}()
+	// 消费者已经在运行的时候发送的消息也能收到
+	for i := 0; i < 10; i++ {
+		_, _, err = p.SendMessage(&sarama.ProducerMessage{Topic: "batch",
+			Value: sarama.StringEncoder(string(rune('0' + i)))})
+		require.NoError(t, err)
+	}
+	require.NoError(t, <-done)
+	assert.ElementsMatch(t, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, got)
+}
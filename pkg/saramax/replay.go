@@ -0,0 +1,143 @@
+package saramax
+
+import (
+	"context"
+	"errors"
+	"github.com/IBM/sarama"
+	"github.com/Tuanzi-bug/tuan-book/pkg/log"
+	"go.uber.org/zap"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// replayDropHeaders 上一次失败的信息，重放的时候去掉。原来的位置要保留，
+// 重试 topic 里面的消息靠它找到原来的 topic
+var replayDropHeaders = map[string]struct{}{
+	HeaderNotBefore: {},
+	HeaderError:     {},
+	HeaderFailedAt:  {},
+}
+
+// ReplayDLQ 把消费者组 group 死信队列里面的消息发到这个组的第一级重试 topic，
+// 只有这个组会重新处理，原来的 topic 上别的消费者组不会再收到一次。
+// 所以这个组必须配置了重试 topic，见 NewRetryPolicy。
+// 超过 idle 没有新消息就结束，返回重放了多少条。
+// 进度用死信队列加上 "_replay" 这个消费者组记录，重复执行不会重复重放
+func ReplayDLQ(ctx context.Context, client sarama.Client, producer sarama.SyncProducer,
+	group string, idle time.Duration) (int64, error) {
+	dlqTopic := DLQTopicName(group)
+	cg, err := sarama.NewConsumerGroupFromClient(dlqTopic+"_replay", client)
+	if err != nil {
+		return 0, err
+	}
+	defer cg.Close()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	h := &replayHandler{producer: producer, topic: RetryTopicName(group, 1), active: make(chan struct{}, 1), cancel: cancel}
+	go func() {
+		timer := time.NewTimer(idle)
+		defer timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-h.active:
+				if !timer.Stop() {
+					<-timer.C
+				}
+				timer.Reset(idle)
+			case <-timer.C:
+				cancel()
+				return
+			}
+		}
+	}()
+	for ctx.Err() == nil {
+		err = cg.Consume(ctx, []string{dlqTopic}, h)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			return h.cnt.Load(), err
+		}
+	}
+	return h.cnt.Load(), h.firstErr()
+}
+
+type replayHandler struct {
+	producer sarama.SyncProducer
+	// topic 重放到哪个 topic
+	topic  string
+	active chan struct{}
+	cancel context.CancelFunc
+	cnt    atomic.Int64
+	mu     sync.Mutex
+	// 第一次发送失败的原因，发送失败之后不再继续
+	err error
+}
+
+func (h *replayHandler) fail(err error) {
+	h.mu.Lock()
+	if h.err == nil {
+		h.err = err
+	}
+	h.mu.Unlock()
+	h.cancel()
+}
+
+func (h *replayHandler) firstErr() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.err
+}
+
+func (h *replayHandler) Setup(session sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+func (h *replayHandler) Cleanup(session sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+func (h *replayHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for msg := range claim.Messages() {
+		select {
+		case h.active <- struct{}{}:
+		default:
+		}
+		if header(msg, HeaderOriginalTopic) == "" {
+			log.Warn("死信消息没有原来的 topic，跳过", zap.Int32("partition", msg.Partition), zap.Int64("offset", msg.Offset))
+			session.MarkMessage(msg, "")
+			continue
+		}
+		_, _, err := h.producer.SendMessage(replayMessage(msg, h.topic))
+		if err != nil {
+			// 不提交，下一次重放的时候从这里继续
+			h.fail(err)
+			return err
+		}
+		h.cnt.Add(1)
+		session.MarkMessage(msg, "")
+	}
+	return nil
+}
+
+// replayMessage 重放到第一级重试 topic，再失败的话接着转发到第二级
+func replayMessage(msg *sarama.ConsumerMessage, topic string) *sarama.ProducerMessage {
+	pmsg := &sarama.ProducerMessage{
+		Topic: topic,
+		Value: sarama.ByteEncoder(msg.Value),
+	}
+	if msg.Key != nil {
+		pmsg.Key = sarama.ByteEncoder(msg.Key)
+	}
+	kept := make([]*sarama.RecordHeader, 0, len(msg.Headers))
+	for _, rh := range msg.Headers {
+		if rh == nil {
+			continue
+		}
+		if _, ok := replayDropHeaders[string(rh.Key)]; !ok {
+			kept = append(kept, rh)
+		}
+	}
+	pmsg.Headers = mergeHeaders(kept, map[string]string{HeaderRetryTier: "1"})
+	return pmsg
+}
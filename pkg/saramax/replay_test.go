@@ -0,0 +1,59 @@
+package saramax
+
+import (
+	"errors"
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestReplayMessage(t *testing.T) {
+	msg := &sarama.ConsumerMessage{
+		Topic: "interactive_dlq",
+		Key:   []byte("1"),
+		Value: []byte("a"),
+		Headers: []*sarama.RecordHeader{
+			{Key: []byte("trace"), Value: []byte("abc")},
+			{Key: []byte(HeaderOriginalTopic), Value: []byte("article_read_event")},
+			{Key: []byte(HeaderOriginalPartition), Value: []byte("1")},
+			{Key: []byte(HeaderOriginalOffset), Value: []byte("10")},
+			{Key: []byte(HeaderConsumerGroup), Value: []byte("interactive")},
+			{Key: []byte(HeaderRetryTier), Value: []byte("3")},
+			{Key: []byte(HeaderNotBefore), Value: []byte("123")},
+			{Key: []byte(HeaderError), Value: []byte("模拟失败")},
+			{Key: []byte(HeaderFailedAt), Value: []byte("123")},
+		},
+	}
+	pmsg := replayMessage(msg, RetryTopicName("interactive", 1))
+	// 只有这个消费者组的重试 topic，不会发回原来的 topic
+	assert.Equal(t, "interactive_retry_1", pmsg.Topic)
+	assert.Equal(t, sarama.ByteEncoder("1"), pmsg.Key)
+	assert.Equal(t, sarama.ByteEncoder("a"), pmsg.Value)
+
+	headers := make(map[string]string, len(pmsg.Headers))
+	for _, h := range pmsg.Headers {
+		headers[string(h.Key)] = string(h.Value)
+	}
+	assert.Equal(t, map[string]string{
+		"trace": "abc",
+		// 处理的时候靠原来的 topic 区分消息
+		HeaderOriginalTopic:     "article_read_event",
+		HeaderOriginalPartition: "1",
+		HeaderOriginalOffset:    "10",
+		HeaderConsumerGroup:     "interactive",
+		// 相当于已经在第一级重试了，再失败就转发到第二级
+		HeaderRetryTier: "1",
+	}, headers)
+
+	// 重放的消息再次失败，转发到下一级
+	policy := NewRetryPolicy("interactive", 1, 0, []time.Duration{time.Minute, time.Minute})
+	r := NewRetrier(nil, "interactive", policy)
+	cmsg := &sarama.ConsumerMessage{Topic: pmsg.Topic, Value: msg.Value}
+	for i := range pmsg.Headers {
+		cmsg.Headers = append(cmsg.Headers, &pmsg.Headers[i])
+	}
+	next := r.next(cmsg, errors.New("模拟失败"), time.Now(), false)
+	assert.Equal(t, "interactive_retry_2", next.Topic)
+	assert.Equal(t, "article_read_event", OriginalTopic(cmsg))
+}
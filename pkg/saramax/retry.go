@@ -0,0 +1,244 @@
+package saramax
+
+import (
+	"context"
+	"fmt"
+	"github.com/IBM/sarama"
+	"github.com/Tuanzi-bug/tuan-book/pkg/log"
+	"go.uber.org/zap"
+	"strconv"
+	"time"
+)
+
+// 转发到重试 topic 和死信队列的时候带上的消息头
+const (
+	HeaderOriginalTopic     = "x-original-topic"
+	HeaderOriginalPartition = "x-original-partition"
+	HeaderOriginalOffset    = "x-original-offset"
+	HeaderConsumerGroup     = "x-consumer-group"
+	// HeaderRetryTier 已经转发过几次，0 表示还在原来的 topic 上
+	HeaderRetryTier = "x-retry-tier"
+	// HeaderNotBefore 毫秒时间戳，重试 topic 里面的消息在这之前不会处理
+	HeaderNotBefore = "x-not-before"
+	HeaderError     = "x-error"
+	HeaderFailedAt  = "x-failed-at"
+)
+
+// RetryTopic 一级重试，Delay 是转发之后至少等多久再处理
+type RetryTopic struct {
+	Topic string
+	Delay time.Duration
+}
+
+// RetryPolicy 处理失败之后先原地重试，然后依次转发到重试 topic，最后转发到死信队列
+type RetryPolicy struct {
+	// MaxAttempts 原地最多执行几次，包括第一次
+	MaxAttempts int
+	// Backoff 原地重试的间隔，每次翻倍，最多 MaxBackoff
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+	RetryTopics []RetryTopic
+	// DLQTopic 为空的时候重试都失败的消息只记录日志
+	DLQTopic string
+}
+
+// NewRetryPolicy 每一个 delay 对应一级重试 topic，topic 的名字按照消费者组生成
+func NewRetryPolicy(group string, maxAttempts int, backoff time.Duration, delays []time.Duration) RetryPolicy {
+	topics := make([]RetryTopic, 0, len(delays))
+	for i, delay := range delays {
+		topics = append(topics, RetryTopic{
+			Topic: RetryTopicName(group, i+1),
+			Delay: delay,
+		})
+	}
+	return RetryPolicy{
+		MaxAttempts: maxAttempts,
+		Backoff:     backoff,
+		MaxBackoff:  backoff * 32,
+		RetryTopics: topics,
+		DLQTopic:    DLQTopicName(group),
+	}
+}
+
+// RetryTopicName 消费者组的第 tier 级重试 topic，tier 从 1 开始
+func RetryTopicName(group string, tier int) string {
+	return fmt.Sprintf("%s_retry_%d", group, tier)
+}
+
+func DLQTopicName(group string) string {
+	return group + "_dlq"
+}
+
+// Retrier 给 Handler 和 BatchHandler 用的重试策略。
+// 重试 topic 里面的消息 Topic 是重试 topic，需要原来的 topic 的时候用 OriginalTopic
+type Retrier struct {
+	producer sarama.SyncProducer
+	group    string
+	policy   RetryPolicy
+}
+
+func NewRetrier(producer sarama.SyncProducer, group string, policy RetryPolicy) *Retrier {
+	return &Retrier{
+		producer: producer,
+		group:    group,
+		policy:   policy,
+	}
+}
+
+// Topics 消费者除了原来的 topic 之外还需要订阅的重试 topic，r 为 nil 的时候返回 nil
+func (r *Retrier) Topics() []string {
+	if r == nil {
+		return nil
+	}
+	topics := make([]string, 0, len(r.policy.RetryTopics))
+	for _, rt := range r.policy.RetryTopics {
+		topics = append(topics, rt.Topic)
+	}
+	return topics
+}
+
+// Wait 重试 topic 里面的消息没到时间之前一直等待，ctx 结束的时候返回 ctx.Err()
+func (r *Retrier) Wait(ctx context.Context, msg *sarama.ConsumerMessage) error {
+	notBefore, err := strconv.ParseInt(header(msg, HeaderNotBefore), 10, 64)
+	if err != nil {
+		// 不是转发过来的消息
+		return nil
+	}
+	d := time.Until(time.UnixMilli(notBefore))
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Do 原地重试 fn，都失败了就把 msgs 转发到下一级，只有转发也失败的时候才返回 error
+func (r *Retrier) Do(ctx context.Context, msgs []*sarama.ConsumerMessage, fn func() error) error {
+	err := r.retry(ctx, fn)
+	if err == nil {
+		return nil
+	}
+	return r.forward(msgs, err, false)
+}
+
+// DeadLetter 没有必要重试的消息直接转发到死信队列，比如反序列化失败
+func (r *Retrier) DeadLetter(msgs []*sarama.ConsumerMessage, cause error) error {
+	return r.forward(msgs, cause, true)
+}
+
+func (r *Retrier) retry(ctx context.Context, fn func() error) error {
+	attempts := max(r.policy.MaxAttempts, 1)
+	backoff := r.policy.Backoff
+	var err error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			timer := time.NewTimer(backoff)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return err
+			case <-timer.C:
+			}
+			backoff = min(backoff*2, max(r.policy.MaxBackoff, r.policy.Backoff))
+		}
+		err = fn()
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func (r *Retrier) forward(msgs []*sarama.ConsumerMessage, cause error, dlq bool) error {
+	now := time.Now()
+	pmsgs := make([]*sarama.ProducerMessage, 0, len(msgs))
+	for _, msg := range msgs {
+		pmsg := r.next(msg, cause, now, dlq)
+		if pmsg == nil {
+			log.Error("消息重试失败，没有配置死信队列，直接丢弃", zap.String("topic", msg.Topic),
+				zap.Int32("partition", msg.Partition), zap.Int64("offset", msg.Offset), zap.Error(cause))
+			continue
+		}
+		pmsgs = append(pmsgs, pmsg)
+	}
+	if len(pmsgs) == 0 {
+		return nil
+	}
+	return r.producer.SendMessages(pmsgs)
+}
+
+// next 转发到下一级重试 topic，重试 topic 用完了或者 dlq 为 true 的时候转发到死信队列
+func (r *Retrier) next(msg *sarama.ConsumerMessage, cause error, now time.Time, dlq bool) *sarama.ProducerMessage {
+	tier, _ := strconv.Atoi(header(msg, HeaderRetryTier))
+	pmsg := &sarama.ProducerMessage{
+		Value: sarama.ByteEncoder(msg.Value),
+	}
+	if msg.Key != nil {
+		pmsg.Key = sarama.ByteEncoder(msg.Key)
+	}
+	headers := map[string]string{
+		HeaderRetryTier:     strconv.Itoa(tier + 1),
+		HeaderConsumerGroup: r.group,
+		HeaderError:         cause.Error(),
+		HeaderFailedAt:      strconv.FormatInt(now.UnixMilli(), 10),
+	}
+	switch {
+	case !dlq && tier < len(r.policy.RetryTopics):
+		rt := r.policy.RetryTopics[tier]
+		pmsg.Topic = rt.Topic
+		headers[HeaderNotBefore] = strconv.FormatInt(now.Add(rt.Delay).UnixMilli(), 10)
+	case r.policy.DLQTopic != "":
+		pmsg.Topic = r.policy.DLQTopic
+	default:
+		return nil
+	}
+	// 已经转发过的消息保留最开始的位置
+	if header(msg, HeaderOriginalTopic) == "" {
+		headers[HeaderOriginalTopic] = msg.Topic
+		headers[HeaderOriginalPartition] = strconv.FormatInt(int64(msg.Partition), 10)
+		headers[HeaderOriginalOffset] = strconv.FormatInt(msg.Offset, 10)
+	}
+	pmsg.Headers = mergeHeaders(msg.Headers, headers)
+	return pmsg
+}
+
+// OriginalTopic 转发过的消息返回最开始的 topic
+func OriginalTopic(msg *sarama.ConsumerMessage) string {
+	if topic := header(msg, HeaderOriginalTopic); topic != "" {
+		return topic
+	}
+	return msg.Topic
+}
+
+func header(msg *sarama.ConsumerMessage, key string) string {
+	for _, h := range msg.Headers {
+		if h != nil && string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// mergeHeaders 保留原来的消息头，同名的用 overrides 覆盖
+func mergeHeaders(old []*sarama.RecordHeader, overrides map[string]string) []sarama.RecordHeader {
+	res := make([]sarama.RecordHeader, 0, len(old)+len(overrides))
+	for _, h := range old {
+		if h == nil {
+			continue
+		}
+		if _, ok := overrides[string(h.Key)]; ok {
+			continue
+		}
+		res = append(res, *h)
+	}
+	for k, v := range overrides {
+		res = append(res, sarama.RecordHeader{Key: []byte(k), Value: []byte(v)})
+	}
+	return res
+}
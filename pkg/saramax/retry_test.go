@@ -0,0 +1,118 @@
+package saramax
+
+import (
+	"context"
+	"errors"
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRetrier_Do(t *testing.T) {
+	policy := NewRetryPolicy("interactive", 2, time.Millisecond, []time.Duration{time.Minute})
+	msg := &sarama.ConsumerMessage{Topic: "article_read_event", Partition: 1, Offset: 10,
+		Key: []byte("1"), Value: []byte("a")}
+
+	testCases := []struct {
+		name  string
+		msg   *sarama.ConsumerMessage
+		fails int
+
+		wantCalls   int
+		wantTopic   string
+		wantHeaders map[string]string
+	}{
+		{
+			name:      "原地重试成功",
+			msg:       msg,
+			fails:     1,
+			wantCalls: 2,
+		},
+		{
+			name:      "转发到第一级重试",
+			msg:       msg,
+			fails:     2,
+			wantCalls: 2,
+			wantTopic: "interactive_retry_1",
+			wantHeaders: map[string]string{
+				HeaderOriginalTopic:     "article_read_event",
+				HeaderOriginalPartition: "1",
+				HeaderOriginalOffset:    "10",
+				HeaderRetryTier:         "1",
+				HeaderConsumerGroup:     "interactive",
+				HeaderError:             "mock error",
+			},
+		},
+		{
+			name: "重试 topic 用完了进入死信队列",
+			msg: &sarama.ConsumerMessage{Topic: "interactive_retry_1", Partition: 0, Offset: 3,
+				Key: []byte("1"), Value: []byte("a"), Headers: []*sarama.RecordHeader{
+					{Key: []byte(HeaderOriginalTopic), Value: []byte("article_read_event")},
+					{Key: []byte(HeaderOriginalOffset), Value: []byte("10")},
+					{Key: []byte(HeaderRetryTier), Value: []byte("1")},
+					{Key: []byte("trace"), Value: []byte("abc")},
+				}},
+			fails:     2,
+			wantCalls: 2,
+			wantTopic: "interactive_dlq",
+			wantHeaders: map[string]string{
+				HeaderOriginalTopic:  "article_read_event",
+				HeaderOriginalOffset: "10",
+				HeaderRetryTier:      "2",
+				"trace":              "abc",
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			producer := mocks.NewSyncProducer(t, nil)
+			defer producer.Close()
+			if tc.wantTopic != "" {
+				producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(pmsg *sarama.ProducerMessage) error {
+					assert.Equal(t, tc.wantTopic, pmsg.Topic)
+					key, err := pmsg.Key.Encode()
+					require.NoError(t, err)
+					assert.Equal(t, []byte("1"), key)
+					headers := make(map[string]string, len(pmsg.Headers))
+					for _, h := range pmsg.Headers {
+						headers[string(h.Key)] = string(h.Value)
+					}
+					for k, v := range tc.wantHeaders {
+						assert.Equal(t, v, headers[k], k)
+					}
+					return nil
+				})
+			}
+			r := NewRetrier(producer, "interactive", policy)
+			calls := 0
+			err := r.Do(context.Background(), []*sarama.ConsumerMessage{tc.msg}, func() error {
+				calls++
+				if calls <= tc.fails {
+					return errors.New("mock error")
+				}
+				return nil
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantCalls, calls)
+		})
+	}
+}
+
+func TestRetrier_Wait(t *testing.T) {
+	r := NewRetrier(nil, "interactive", RetryPolicy{})
+	// 没有时间限制的消息直接处理
+	assert.NoError(t, r.Wait(context.Background(), &sarama.ConsumerMessage{}))
+
+	// 没到时间的时候等到 ctx 结束
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	notBefore := strconv.FormatInt(time.Now().Add(time.Hour).UnixMilli(), 10)
+	err := r.Wait(ctx, &sarama.ConsumerMessage{Headers: []*sarama.RecordHeader{
+		{Key: []byte(HeaderNotBefore), Value: []byte(notBefore)},
+	}})
+	assert.Equal(t, context.Canceled, err)
+}
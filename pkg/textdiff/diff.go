@@ -0,0 +1,186 @@
+package textdiff
+
+import "strings"
+
+type Op uint8
+
+const (
+	// OpEqual 两边都有的行
+	OpEqual Op = iota
+	// OpDelete 只在旧文本中存在的行
+	OpDelete
+	// OpInsert 只在新文本中存在的行
+	OpInsert
+)
+
+func (o Op) String() string {
+	switch o {
+	case OpDelete:
+		return "-"
+	case OpInsert:
+		return "+"
+	default:
+		return " "
+	}
+}
+
+type Line struct {
+	Op   Op
+	Text string
+}
+
+// maxCost Myers 算法的耗时是 O((N+M)D)，超过这个量级就不再逐行比较，
+// 没比较完的部分直接全部删除再全部插入。几万行的文本改了几行还是能精确比较，
+// 几万行完全不一样的文本不会占用太多 CPU
+const maxCost = 50_000_000
+
+// Lines 按行比较两段文本，返回从 a 变成 b 的差异
+// 基于 Myers 的 O(ND) 算法，每次找中间的蛇分成两半递归，只需要线性的内存
+func Lines(a, b string) []Line {
+	as, bs := split(a), split(b)
+	d := &differ{
+		res:  make([]Line, 0, len(as)+len(bs)),
+		maxD: max(maxCost/max(len(as)+len(bs), 1), 1),
+	}
+	d.diff(as, bs)
+	return d.res
+}
+
+type differ struct {
+	res []Line
+	// maxD 编辑距离的上限
+	maxD int
+}
+
+func (d *differ) add(op Op, lines []string) {
+	for _, l := range lines {
+		d.res = append(d.res, Line{Op: op, Text: l})
+	}
+}
+
+// trim 返回公共前缀和公共后缀的长度
+func trim(as, bs []string) (int, int) {
+	prefix := 0
+	for prefix < len(as) && prefix < len(bs) && as[prefix] == bs[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(as)-prefix && suffix < len(bs)-prefix &&
+		as[len(as)-1-suffix] == bs[len(bs)-1-suffix] {
+		suffix++
+	}
+	return prefix, suffix
+}
+
+func (d *differ) diff(as, bs []string) {
+	prefix, suffix := trim(as, bs)
+	d.add(OpEqual, as[:prefix])
+	ma, mb := as[prefix:len(as)-suffix], bs[prefix:len(bs)-suffix]
+	switch {
+	case len(ma) == 0:
+		d.add(OpInsert, mb)
+	case len(mb) == 0:
+		d.add(OpDelete, ma)
+	default:
+		x, y := bisect(ma, mb, d.maxD)
+		if (x == 0 && y == 0) || (x == len(ma) && y == len(mb)) {
+			// 没有公共的行，或者差异太大
+			d.add(OpDelete, ma)
+			d.add(OpInsert, mb)
+		} else {
+			d.diff(ma[:x], mb[:y])
+			d.diff(ma[x:], mb[y:])
+		}
+	}
+	d.add(OpEqual, as[len(as)-suffix:])
+}
+
+// bisect 从两头同时按照 Myers 算法往中间走，返回两条路径重合的位置。
+// 调用方保证两边都不为空，并且首尾的行都不相同，所以编辑距离至少是 2，
+// 重合的位置一定在中间，两半的编辑距离都更小。
+// 找不到或者走了 limit 步还没有重合的时候返回 (0, 0)
+func bisect(as, bs []string, limit int) (int, int) {
+	n, m := len(as), len(bs)
+	maxD := (n + m + 1) / 2
+	offset := maxD
+	// 多留两个位置，k 在 [-d-1, d+1] 之间
+	v1 := make([]int, 2*maxD+2)
+	v2 := make([]int, 2*maxD+2)
+	for i := range v1 {
+		v1[i] = -1
+		v2[i] = -1
+	}
+	v1[offset+1] = 0
+	v2[offset+1] = 0
+	delta := n - m
+	// delta 是奇数的时候在正向检查重合，偶数的时候在反向检查
+	front := delta%2 != 0
+	// 走出边界的对角线不用再算
+	k1start, k1end, k2start, k2end := 0, 0, 0, 0
+	for d := 0; d < min(maxD, limit); d++ {
+		for k1 := -d + k1start; k1 <= d-k1end; k1 += 2 {
+			i := offset + k1
+			var x1 int
+			if k1 == -d || (k1 != d && v1[i-1] < v1[i+1]) {
+				x1 = v1[i+1]
+			} else {
+				x1 = v1[i-1] + 1
+			}
+			y1 := x1 - k1
+			for x1 < n && y1 < m && as[x1] == bs[y1] {
+				x1++
+				y1++
+			}
+			v1[i] = x1
+			switch {
+			case x1 > n:
+				k1end += 2
+			case y1 > m:
+				k1start += 2
+			case front:
+				j := offset + delta - k1
+				if j >= 0 && j < len(v2) && v2[j] != -1 && x1 >= n-v2[j] {
+					return x1, y1
+				}
+			}
+		}
+		for k2 := -d + k2start; k2 <= d-k2end; k2 += 2 {
+			i := offset + k2
+			var x2 int
+			if k2 == -d || (k2 != d && v2[i-1] < v2[i+1]) {
+				x2 = v2[i+1]
+			} else {
+				x2 = v2[i-1] + 1
+			}
+			y2 := x2 - k2
+			for x2 < n && y2 < m && as[n-x2-1] == bs[m-y2-1] {
+				x2++
+				y2++
+			}
+			v2[i] = x2
+			switch {
+			case x2 > n:
+				k2end += 2
+			case y2 > m:
+				k2start += 2
+			case !front:
+				j := offset + delta - k2
+				if j >= 0 && j < len(v1) && v1[j] != -1 {
+					x1 := v1[j]
+					y1 := x1 - (j - offset)
+					if x1 >= n-x2 {
+						return x1, y1
+					}
+				}
+			}
+		}
+	}
+	return 0, 0
+}
+
+func split(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+}
@@ -0,0 +1,158 @@
+package textdiff
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math/rand"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	testCases := []struct {
+		name string
+		a    string
+		b    string
+		want []Line
+	}{
+		{
+			name: "完全一样",
+			a:    "a\nb",
+			b:    "a\nb",
+			want: []Line{{Op: OpEqual, Text: "a"}, {Op: OpEqual, Text: "b"}},
+		},
+		{
+			name: "新增",
+			a:    "",
+			b:    "a",
+			want: []Line{{Op: OpInsert, Text: "a"}},
+		},
+		{
+			name: "删除",
+			a:    "a\nb",
+			b:    "",
+			want: []Line{{Op: OpDelete, Text: "a"}, {Op: OpDelete, Text: "b"}},
+		},
+		{
+			name: "修改中间一行",
+			a:    "a\nb\nc",
+			b:    "a\nd\nc",
+			want: []Line{
+				{Op: OpEqual, Text: "a"},
+				{Op: OpDelete, Text: "b"},
+				{Op: OpInsert, Text: "d"},
+				{Op: OpEqual, Text: "c"},
+			},
+		},
+		{
+			name: "交错修改",
+			a:    "a\nb\nc\nd",
+			b:    "b\nc\ne\nd\nf",
+			want: []Line{
+				{Op: OpDelete, Text: "a"},
+				{Op: OpEqual, Text: "b"},
+				{Op: OpEqual, Text: "c"},
+				{Op: OpInsert, Text: "e"},
+				{Op: OpEqual, Text: "d"},
+				{Op: OpInsert, Text: "f"},
+			},
+		},
+		{
+			name: "windows 换行",
+			a:    "a\r\nb",
+			b:    "a\nb",
+			want: []Line{{Op: OpEqual, Text: "a"}, {Op: OpEqual, Text: "b"}},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, Lines(tc.a, tc.b))
+		})
+	}
+}
+
+// TestLines_Random 随机的文本，差异能够还原两边的文本，并且是最短的
+func TestLines_Random(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	gen := func() string {
+		n := r.Intn(30)
+		lines := make([]string, n)
+		for i := range lines {
+			lines[i] = string(rune('a' + r.Intn(4)))
+		}
+		return strings.Join(lines, "\n")
+	}
+	for i := 0; i < 1000; i++ {
+		a, b := gen(), gen()
+		res := Lines(a, b)
+		var ra, rb []string
+		equal := 0
+		for _, l := range res {
+			switch l.Op {
+			case OpEqual:
+				ra = append(ra, l.Text)
+				rb = append(rb, l.Text)
+				equal++
+			case OpDelete:
+				ra = append(ra, l.Text)
+			case OpInsert:
+				rb = append(rb, l.Text)
+			}
+		}
+		require.Equal(t, a, strings.Join(ra, "\n"), "a=%q b=%q", a, b)
+		require.Equal(t, b, strings.Join(rb, "\n"), "a=%q b=%q", a, b)
+		require.Equal(t, lcsLen(split(a), split(b)), equal, "a=%q b=%q", a, b)
+	}
+}
+
+// TestLines_Large 修订最多 64KB，几万行的文本也不能占用太多内存
+func TestLines_Large(t *testing.T) {
+	const n = 30000
+	as := make([]string, n)
+	bs := make([]string, n)
+	for i := range as {
+		as[i] = strconv.Itoa(i)
+		bs[i] = strconv.Itoa(i)
+	}
+	// 改几行
+	bs[100], bs[15000], bs[29000] = "x", "y", "z"
+	res := Lines(strings.Join(as, "\n"), strings.Join(bs, "\n"))
+	changed := 0
+	for _, l := range res {
+		if l.Op != OpEqual {
+			changed++
+		}
+	}
+	assert.Equal(t, 6, changed)
+
+	// 完全不一样，差异太大不再逐行比较
+	for i := range bs {
+		bs[i] = "b" + strconv.Itoa(i)
+	}
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	res = Lines(strings.Join(as, "\n"), strings.Join(bs, "\n"))
+	runtime.ReadMemStats(&after)
+	assert.Len(t, res, n*2)
+	assert.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(64<<20))
+}
+
+// lcsLen 用动态规划计算最长公共子序列的长度，只在测试里面用来校验
+func lcsLen(as, bs []string) int {
+	dp := make([][]int, len(as)+1)
+	for i := range dp {
+		dp[i] = make([]int, len(bs)+1)
+	}
+	for i := len(as) - 1; i >= 0; i-- {
+		for j := len(bs) - 1; j >= 0; j-- {
+			if as[i] == bs[j] {
+				dp[i][j] = dp[i+1][j+1] + 1
+			} else {
+				dp[i][j] = max(dp[i+1][j], dp[i][j+1])
+			}
+		}
+	}
+	return dp[0][0]
+}
@@ -0,0 +1,28 @@
+// Package trace 在 context 里面传递链路 id，HTTP 请求进来的时候设置，发送事件的时候写进信封
+package trace
+
+import "context"
+
+// Header HTTP 请求和响应里面的链路 id
+const Header = "X-Trace-Id"
+
+type idKey struct{}
+
+func WithId(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, idKey{}, id)
+}
+
+// IdFromContext 没有链路 id 的时候返回空字符串
+func IdFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(idKey{}).(string)
+	return id
+}
+
+// Detach 只保留链路 id，给请求结束之后还在执行的 goroutine 用。
+// gin.Context 会被复用，不能在请求结束之后继续使用
+func Detach(ctx context.Context) context.Context {
+	return WithId(context.Background(), IdFromContext(ctx))
+}
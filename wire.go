@@ -25,19 +25,79 @@ var articleSvcProvider = wire.NewSet(
 	cache.NewArticleRedisCache,
 	repository.NewCacheArticleRepository,
 	article.NewSaramaSyncProducer,
-	article.NewInteractiveReadEventConsumer,
+	ioc.InitInteractiveReadEventConsumer,
 	service.NewArticleService)
 
 var interactiveSvcSet = wire.NewSet(dao.NewGORMInteractiveDAO,
 	cache.NewInteractiveRedisCache,
 	repository.NewCachedInteractiveRepository,
+	dao.NewGORMCollectionDAO,
+	repository.NewCachedCollectionRepository,
 	service.NewInteractiveService,
 )
 
+var searchSvcSet = wire.NewSet(
+	repository.NewLocalArticleSearchRepository,
+	service.NewArticleSearchService,
+	ioc.InitSearchIndexConsumer,
+)
+
+var commentSvcSet = wire.NewSet(
+	dao.NewGORMCommentDAO,
+	cache.NewCommentRedisCache,
+	repository.NewCachedCommentRepository,
+	service.NewCommentService,
+)
+
+var followSvcSet = wire.NewSet(
+	dao.NewGORMFollowDAO,
+	cache.NewFollowRedisCache,
+	repository.NewCachedFollowRepository,
+	service.NewFollowService,
+)
+
+var feedSvcSet = wire.NewSet(
+	dao.NewGORMFeedDAO,
+	repository.NewInboxFeedRepository,
+	ioc.InitFeedService,
+	ioc.InitFeedEventConsumer,
+)
+
+var historySvcSet = wire.NewSet(
+	ioc.InitReadHistoryCache,
+	repository.NewRedisReadHistoryRepository,
+	service.NewReadHistoryService,
+	ioc.InitReadHistoryConsumer,
+)
+
+var uniqueReaderSvcSet = wire.NewSet(
+	dao.NewGORMUniqueReaderDAO,
+	cache.NewUniqueReaderRedisCache,
+	repository.NewCachedUniqueReaderRepository,
+	service.NewUniqueReaderService,
+	ioc.InitUniqueReaderConsumer,
+)
+
+var outboxSet = wire.NewSet(
+	dao.NewGORMOutboxDAO,
+	repository.NewGORMOutboxRepository,
+	ioc.InitOutboxRelay,
+)
+
+var jobSvcSet = wire.NewSet(
+	dao.NewGORMJobDAO,
+	repository.NewPreemptJobRepository,
+	service.NewCronJobService,
+)
+
 var rankingSvcSet = wire.NewSet(
 	cache.NewRankingRedisCache,
+	cache.NewRankingLocalCache,
+	cache.NewRankingRedisZSetCache,
 	repository.NewCachedRankingRepository,
-	service.NewBatchRankingService,
+	repository.NewCachedRealTimeRankingRepository,
+	ioc.InitRankingBoards,
+	ioc.InitRankingService,
 )
 
 func InitWebServer() *App {
@@ -47,18 +107,27 @@ func InitWebServer() *App {
 		ioc.InitRedis,
 		//ioc.InitLogger,
 		ioc.InitSyncProducer,
-		ioc.InitSaramaClient,
+		ioc.InitBroker,
 		ioc.InitConsumers,
+		ioc.InitRankingEventConsumer,
 		// 接口集合
 		userSvcProvider,
 		articleSvcProvider,
 		interactiveSvcSet,
 		rankingSvcSet,
+		searchSvcSet,
+		commentSvcSet,
+		followSvcSet,
+		feedSvcSet,
+		historySvcSet,
+		uniqueReaderSvcSet,
+		outboxSet,
 
 		// 定时任务
 		ioc.InitJobs,
-		ioc.InitRankingJob,
 		ioc.InitRlockClient,
+		jobSvcSet,
+		ioc.InitJobScheduler,
 		// 数据层
 		//dao.NewUserDAO,
 		//dao.NewGORMArticleDAO,
@@ -79,10 +148,19 @@ func InitWebServer() *App {
 		// 控制层
 		web.NewUserHandler,
 		web.NewArticleHandler,
+		web.NewSearchHandler,
+		web.NewCommentHandler,
+		web.NewFollowHandler,
+		web.NewCollectionHandler,
+		web.NewPersonalHandler,
+		service.NewCollectionService,
+		web.NewFeedHandler,
+		web.NewJobHandler,
 		myjwt.NewRedisJWTHandler,
 		// 初始化服务
 		ioc.InitWebServer,
 		ioc.InitMiddlewares,
+		ioc.InitAdminMiddleware,
 		wire.Struct(new(App), "*"),
 	)
 	return new(App)